@@ -172,6 +172,32 @@ func TestParseApiServing(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "OpenAPI with info overrides",
+			caddyfile: `
+				caddy_api_registrar_serve openapi-v3.0 {
+					info_title "Internal Gateway"
+					info_version 3.2.1
+					contact_email ops@example.com
+					license_name MIT
+				}
+			`,
+			expectError: false,
+			checkFunc: func(t *testing.T, handler *ApiServingHandler) {
+				if handler.InfoTitle != "Internal Gateway" {
+					t.Errorf("Expected info_title 'Internal Gateway', got '%s'", handler.InfoTitle)
+				}
+				if handler.InfoVersion != "3.2.1" {
+					t.Errorf("Expected info_version '3.2.1', got '%s'", handler.InfoVersion)
+				}
+				if handler.ContactEmail != "ops@example.com" {
+					t.Errorf("Expected contact_email 'ops@example.com', got '%s'", handler.ContactEmail)
+				}
+				if handler.LicenseName != "MIT" {
+					t.Errorf("Expected license_name 'MIT', got '%s'", handler.LicenseName)
+				}
+			},
+		},
 		{
 			name: "Redoc format",
 			caddyfile: `
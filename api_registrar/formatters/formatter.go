@@ -27,15 +27,16 @@ type CaddyModuleApiSpec struct {
 
 // CaddyModuleApiEndpoint represents a single API endpoint
 type CaddyModuleApiEndpoint struct {
-	Method      string              `json:"method"`                 // GET, POST, PUT, PATCH, DELETE
-	Path        string              `json:"path"`                   // Relative path like "/status" or "/config/{path}"
-	Summary     string              `json:"summary"`                // Short summary
-	Description string              `json:"description"`            // Detailed description
-	Request     interface{}         `json:"request,omitempty"`      // Request body structure
-	Responses   map[int]ResponseDef `json:"responses"`              // Status code -> Response definition
-	PathParams  []Parameter         `json:"path_params,omitempty"`  // Path parameters
-	QueryParams []Parameter         `json:"query_params,omitempty"` // Query parameters
-	Headers     []Parameter         `json:"headers,omitempty"`      // Header parameters
+	Method      string                 `json:"method"`                 // GET, POST, PUT, PATCH, DELETE
+	Path        string                 `json:"path"`                   // Relative path like "/status" or "/config/{path}"
+	Summary     string                 `json:"summary"`                // Short summary
+	Description string                 `json:"description"`            // Detailed description
+	Request     interface{}            `json:"request,omitempty"`      // Request body structure
+	Responses   map[int]ResponseDef    `json:"responses"`              // Status code -> Response definition
+	PathParams  []Parameter            `json:"path_params,omitempty"`  // Path parameters
+	QueryParams []Parameter            `json:"query_params,omitempty"` // Query parameters
+	Headers     []Parameter            `json:"headers,omitempty"`      // Header parameters
+	Extensions  map[string]interface{} `json:"extensions,omitempty"`   // Vendor extensions, emitted with an "x-" prefix
 }
 
 // ResponseDef defines a response for a specific status code
@@ -77,6 +78,12 @@ func GetFormatter(format string) Formatter {
 		return &OpenAPIv3Formatter{}
 	case "openapi-v3.1", "openapi-3.1":
 		return &OpenAPIv31Formatter{}
+	case "openapi-v3.0-yaml", "openapi-3.0-yaml", "openapi-yaml":
+		return &OpenAPIv3YAMLFormatter{}
+	case "openapi-v3.1-yaml", "openapi-3.1-yaml":
+		return &OpenAPIv31YAMLFormatter{}
+	case "postman":
+		return &PostmanFormatter{}
 	case "swagger-ui", "swaggerui":
 		// For UI formatters, the spec URL needs to be set dynamically
 		// This should be handled by the handler
@@ -106,6 +113,9 @@ func GetAvailableFormats() []string {
 	return []string{
 		"openapi-v3.0",
 		"openapi-v3.1",
+		"openapi-yaml",
+		"openapi-v3.1-yaml",
+		"postman",
 		"swagger-ui",
 		"redoc",
 	}
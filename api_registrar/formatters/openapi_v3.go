@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -18,9 +19,22 @@ type OpenAPISpec struct {
 }
 
 type Info struct {
-	Title       string `json:"title"`
-	Description string `json:"description,omitempty"`
-	Version     string `json:"version"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Version     string   `json:"version"`
+	Contact     *Contact `json:"contact,omitempty"`
+	License     *License `json:"license,omitempty"`
+}
+
+type Contact struct {
+	Name  string `json:"name,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type License struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
 }
 
 type Server struct {
@@ -50,6 +64,31 @@ type Operation struct {
 	Parameters  []ParameterObject   `json:"parameters,omitempty"`
 	RequestBody *RequestBody        `json:"requestBody,omitempty"`
 	Responses   map[string]Response `json:"responses"`
+
+	// Extensions holds vendor extensions, emitted as top-level "x-" keys
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON merges the vendor extensions into the operation object
+func (o Operation) MarshalJSON() ([]byte, error) {
+	// Alias drops the method set so marshaling doesn't recurse
+	type operationAlias Operation
+	data, err := json.Marshal(operationAlias(o))
+	if err != nil || len(o.Extensions) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]interface{})
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range o.Extensions {
+		if !strings.HasPrefix(key, "x-") {
+			key = "x-" + key
+		}
+		merged[key] = value
+	}
+	return json.Marshal(merged)
 }
 
 type ParameterObject struct {
@@ -88,6 +127,29 @@ type Schema struct {
 	Default     interface{}        `json:"default,omitempty"`
 	Example     interface{}        `json:"example,omitempty"`
 	Ref         string             `json:"$ref,omitempty"`
+
+	// Nullable marks a schema that also accepts null, in OpenAPI 3.0 form
+	Nullable bool `json:"nullable,omitempty"`
+
+	// Examples replaces Example in OpenAPI 3.1, which follows JSON Schema
+	Examples []interface{} `json:"examples,omitempty"`
+
+	// orNull writes type as [type, "null"], the OpenAPI 3.1 form of Nullable
+	orNull bool
+}
+
+// MarshalJSON writes the type of OpenAPI 3.1 nullable schemas as an array
+func (s Schema) MarshalJSON() ([]byte, error) {
+	// Alias drops the method set so marshaling doesn't recurse
+	type schemaAlias Schema
+	if !s.orNull {
+		return json.Marshal(schemaAlias(s))
+	}
+	// The outer Type shadows the embedded one
+	return json.Marshal(struct {
+		schemaAlias
+		Type []string `json:"type"`
+	}{schemaAlias(s), []string{s.Type, "null"}})
 }
 
 type Components struct {
@@ -97,6 +159,7 @@ type Components struct {
 // OpenAPIv3Formatter formats API specs as OpenAPI 3.0
 type OpenAPIv3Formatter struct {
 	ServerURL string // Optional server URL override
+	Info      *Info  // Optional info overrides; empty fields keep the defaults
 }
 
 // Format converts the API specs to OpenAPI 3.0 format
@@ -126,6 +189,24 @@ func (f *OpenAPIv3Formatter) Format(specs map[string]*CaddyModuleApiSpec, config
 		},
 	}
 
+	// Apply configured info overrides
+	if f.Info != nil {
+		if f.Info.Title != "" {
+			openapi.Info.Title = f.Info.Title
+		}
+		if f.Info.Description != "" {
+			openapi.Info.Description = f.Info.Description
+		}
+		if f.Info.Version != "" {
+			openapi.Info.Version = f.Info.Version
+		}
+		openapi.Info.Contact = f.Info.Contact
+		openapi.Info.License = f.Info.License
+	}
+
+	// Struct types shared between endpoints are emitted once as components
+	schemas := newSchemaRegistry(openapi.Components)
+
 	// Process each configured API
 	for id, config := range configs {
 		if !config.Enabled {
@@ -149,7 +230,7 @@ func (f *OpenAPIv3Formatter) Format(specs map[string]*CaddyModuleApiSpec, config
 			}
 
 			// Create operation
-			operation := f.createOperation(endpoint, spec.ID)
+			operation := f.createOperation(endpoint, spec.ID, schemas)
 
 			// Assign to correct method
 			switch strings.ToUpper(endpoint.Method) {
@@ -171,7 +252,7 @@ func (f *OpenAPIv3Formatter) Format(specs map[string]*CaddyModuleApiSpec, config
 }
 
 // createOperation creates an OpenAPI operation from an endpoint
-func (f *OpenAPIv3Formatter) createOperation(endpoint CaddyModuleApiEndpoint, apiID string) *Operation {
+func (f *OpenAPIv3Formatter) createOperation(endpoint CaddyModuleApiEndpoint, apiID string, schemas *schemaRegistry) *Operation {
 	op := &Operation{
 		Summary:     endpoint.Summary,
 		Description: endpoint.Description,
@@ -223,7 +304,7 @@ func (f *OpenAPIv3Formatter) createOperation(endpoint CaddyModuleApiEndpoint, ap
 			Required:    true,
 			Content: map[string]MediaType{
 				"application/json": {
-					Schema: f.generateSchema(endpoint.Request),
+					Schema: f.generateSchema(endpoint.Request, schemas),
 				},
 			},
 		}
@@ -238,7 +319,7 @@ func (f *OpenAPIv3Formatter) createOperation(endpoint CaddyModuleApiEndpoint, ap
 		if responseDef.Body != nil {
 			response.Content = map[string]MediaType{
 				"application/json": {
-					Schema: f.generateSchema(responseDef.Body),
+					Schema: f.generateSchema(responseDef.Body, schemas),
 				},
 			}
 		}
@@ -253,6 +334,11 @@ func (f *OpenAPIv3Formatter) createOperation(endpoint CaddyModuleApiEndpoint, ap
 		}
 	}
 
+	// Pass vendor extensions through for gateway tooling
+	if len(endpoint.Extensions) > 0 {
+		op.Extensions = endpoint.Extensions
+	}
+
 	return op
 }
 
@@ -281,8 +367,9 @@ func (f *OpenAPIv3Formatter) parameterToSchema(param Parameter) *Schema {
 	return schema
 }
 
-// generateSchema generates an OpenAPI schema from a Go type
-func (f *OpenAPIv3Formatter) generateSchema(v interface{}) *Schema {
+// generateSchema generates an OpenAPI schema from a Go type. Named struct
+// types are registered as components and referenced with $ref.
+func (f *OpenAPIv3Formatter) generateSchema(v interface{}, schemas *schemaRegistry) *Schema {
 	if v == nil {
 		return &Schema{Type: "object"}
 	}
@@ -294,12 +381,12 @@ func (f *OpenAPIv3Formatter) generateSchema(v interface{}) *Schema {
 
 	switch t.Kind() {
 	case reflect.Struct:
-		return f.generateStructSchema(t)
+		return f.generateStructSchema(t, schemas)
 	case reflect.Slice, reflect.Array:
 		elemType := t.Elem()
 		return &Schema{
 			Type:  "array",
-			Items: f.generateSchema(reflect.New(elemType).Elem().Interface()),
+			Items: f.generateSchema(reflect.New(elemType).Elem().Interface(), schemas),
 		}
 	case reflect.Map:
 		return &Schema{
@@ -319,14 +406,33 @@ func (f *OpenAPIv3Formatter) generateSchema(v interface{}) *Schema {
 	}
 }
 
-// generateStructSchema generates a schema for a struct type
-func (f *OpenAPIv3Formatter) generateStructSchema(t reflect.Type) *Schema {
+// generateStructSchema generates a schema for a struct type. Named types are
+// registered under components/schemas on first use and every usage, including
+// recursive ones, gets a $ref to it; anonymous structs are inlined.
+func (f *OpenAPIv3Formatter) generateStructSchema(t reflect.Type, schemas *schemaRegistry) *Schema {
 	schema := &Schema{
 		Type:       "object",
 		Properties: make(map[string]*Schema),
 		Required:   []string{},
 	}
 
+	if t.Name() != "" {
+		name, registered := schemas.register(t, schema)
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		if registered {
+			return ref
+		}
+		f.fillStructSchema(t, schema, schemas)
+		return ref
+	}
+
+	f.fillStructSchema(t, schema, schemas)
+	return schema
+}
+
+// fillStructSchema adds a property for each exported field of t to schema
+func (f *OpenAPIv3Formatter) fillStructSchema(t reflect.Type, schema *Schema, schemas *schemaRegistry) {
+
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
@@ -357,22 +463,84 @@ func (f *OpenAPIv3Formatter) generateStructSchema(t reflect.Type) *Schema {
 		}
 
 		// Generate schema for field
-		fieldSchema := f.generateSchema(reflect.New(field.Type).Elem().Interface())
+		fieldSchema := f.generateSchema(reflect.New(field.Type).Elem().Interface(), schemas)
+
+		// Pointer fields may be null. OpenAPI 3.0 ignores siblings of $ref,
+		// so references are left as they are.
+		if field.Type.Kind() == reflect.Ptr && fieldSchema.Ref == "" {
+			fieldSchema.Nullable = true
+		}
 
 		// Add description from struct tag if present
 		if desc := field.Tag.Get("description"); desc != "" {
 			fieldSchema.Description = desc
 		}
 
+		// enum:"a|b|c" and example:"..." tags document the field's values.
+		// They describe the elements of array fields, and are converted to
+		// the schema's type so integer and boolean values aren't quoted.
+		if fieldSchema.Ref == "" {
+			valueSchema := fieldSchema
+			if valueSchema.Type == "array" && valueSchema.Items != nil && valueSchema.Items.Ref == "" {
+				valueSchema = valueSchema.Items
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				for _, value := range strings.Split(enum, "|") {
+					valueSchema.Enum = append(valueSchema.Enum, tagValue(value, valueSchema))
+				}
+			}
+			if example, ok := field.Tag.Lookup("example"); ok {
+				fieldSchema.Example = tagValue(example, valueSchema)
+				if valueSchema != fieldSchema {
+					fieldSchema.Example = []interface{}{fieldSchema.Example}
+				}
+			}
+		}
+
 		schema.Properties[fieldName] = fieldSchema
 
-		// Add to required if not omitempty
-		if !omitempty {
+		// Fields without omitempty are required, except pointers, slices,
+		// maps and interfaces, which may be nil. A required:"true" or
+		// required:"false" tag overrides both.
+		required := !omitempty && !isNillable(field.Type)
+		if tag, ok := field.Tag.Lookup("required"); ok {
+			if override, err := strconv.ParseBool(tag); err == nil {
+				required = override
+			}
+		}
+		if required {
 			schema.Required = append(schema.Required, fieldName)
 		}
 	}
+}
 
-	return schema
+// tagValue converts a struct tag value to the type of schema, keeping it as
+// a string when it doesn't parse
+func tagValue(value string, schema *Schema) interface{} {
+	switch schema.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// isNillable reports whether values of t may be nil, and so encode as null
+func isNillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
 }
 
 // generateOperationID generates a unique operation ID
@@ -411,10 +579,68 @@ func (f *OpenAPIv31Formatter) Format(specs map[string]*CaddyModuleApiSpec, confi
 		return nil, err
 	}
 
-	// Update version to 3.1
+	// Update version to 3.1 and move schemas to JSON Schema semantics
 	if openapi, ok := spec.(*OpenAPISpec); ok {
 		openapi.OpenAPI = "3.1.0"
+		convertToJSONSchema(openapi)
 	}
 
 	return spec, nil
 }
+
+// convertToJSONSchema rewrites every schema in the spec from OpenAPI 3.0
+// conventions to the JSON Schema ones OpenAPI 3.1 uses
+func convertToJSONSchema(openapi *OpenAPISpec) {
+	visited := make(map[*Schema]bool)
+	if openapi.Components != nil {
+		for _, schema := range openapi.Components.Schemas {
+			toJSONSchema(schema, visited)
+		}
+	}
+	for _, pathItem := range openapi.Paths {
+		for _, op := range []*Operation{pathItem.Get, pathItem.Post, pathItem.Put, pathItem.Patch, pathItem.Delete} {
+			if op == nil {
+				continue
+			}
+			for _, param := range op.Parameters {
+				toJSONSchema(param.Schema, visited)
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					toJSONSchema(media.Schema, visited)
+				}
+			}
+			for _, response := range op.Responses {
+				for _, media := range response.Content {
+					toJSONSchema(media.Schema, visited)
+				}
+			}
+		}
+	}
+}
+
+// toJSONSchema converts one schema and its subschemas: nullable becomes a
+// "null" type, with null added to any enum, and example becomes examples
+func toJSONSchema(schema *Schema, visited map[*Schema]bool) {
+	if schema == nil || visited[schema] {
+		return
+	}
+	visited[schema] = true
+
+	if schema.Nullable {
+		schema.Nullable = false
+		schema.orNull = schema.Type != ""
+		if len(schema.Enum) > 0 {
+			schema.Enum = append(schema.Enum, nil)
+		}
+	}
+	if schema.Example != nil {
+		schema.Examples = []interface{}{schema.Example}
+		schema.Example = nil
+	}
+
+	for _, property := range schema.Properties {
+		toJSONSchema(property, visited)
+	}
+	toJSONSchema(schema.Items, visited)
+}
@@ -3,6 +3,7 @@ package formatters
 import (
 	"bytes"
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -170,6 +171,139 @@ func TestOpenAPIv3Formatter_DisabledAPI(t *testing.T) {
 	}
 }
 
+func TestOpenAPIv3Formatter_Extensions(t *testing.T) {
+	formatter := &OpenAPIv3Formatter{}
+
+	specs := map[string]*CaddyModuleApiSpec{
+		"ext_api": {
+			ID:    "ext_api",
+			Title: "Extensions API",
+			Endpoints: []CaddyModuleApiEndpoint{
+				{
+					Method:  "GET",
+					Path:    "/internal",
+					Summary: "Internal endpoint",
+					Extensions: map[string]interface{}{
+						"x-internal": true,
+						"amazon-apigateway-integration": map[string]interface{}{
+							"type": "http_proxy",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	configs := map[string]*ApiConfig{
+		"ext_api": {
+			Path:    "/api",
+			Enabled: true,
+		},
+	}
+
+	result, err := formatter.Format(specs, configs)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+
+	data, err := json.Marshal(result.(*OpenAPISpec).Paths["/api/internal"].Get)
+	if err != nil {
+		t.Fatalf("Failed to marshal operation: %v", err)
+	}
+
+	var op map[string]interface{}
+	if err := json.Unmarshal(data, &op); err != nil {
+		t.Fatalf("Failed to unmarshal operation: %v", err)
+	}
+
+	if op["x-internal"] != true {
+		t.Errorf("Expected x-internal: true in operation, got %s", data)
+	}
+	if _, ok := op["x-amazon-apigateway-integration"]; !ok {
+		t.Errorf("Expected unprefixed extension to gain x- prefix, got %s", data)
+	}
+	if op["summary"] != "Internal endpoint" {
+		t.Errorf("Expected regular fields preserved, got %s", data)
+	}
+	if _, ok := op["Extensions"]; ok {
+		t.Error("Expected extensions map not to be emitted as a field")
+	}
+}
+
+// sharedStatus is a response type returned by more than one endpoint
+type sharedStatus struct {
+	Healthy bool          `json:"healthy"`
+	Parent  *sharedStatus `json:"parent,omitempty"`
+	Nested  []sharedNode  `json:"nested"`
+}
+
+// sharedNode refers back to sharedStatus to exercise mutual recursion
+type sharedNode struct {
+	Status *sharedStatus `json:"status,omitempty"`
+}
+
+func TestOpenAPIv3Formatter_ComponentRefs(t *testing.T) {
+	formatter := &OpenAPIv3Formatter{}
+
+	specs := map[string]*CaddyModuleApiSpec{
+		"ref_api": {
+			ID: "ref_api",
+			Endpoints: []CaddyModuleApiEndpoint{
+				{
+					Method:    "GET",
+					Path:      "/status",
+					Responses: map[int]ResponseDef{200: {Description: "OK", Body: sharedStatus{}}},
+				},
+				{
+					Method:    "GET",
+					Path:      "/statuses",
+					Responses: map[int]ResponseDef{200: {Description: "OK", Body: []sharedStatus{}}},
+				},
+			},
+		},
+	}
+	configs := map[string]*ApiConfig{"ref_api": {Path: "/api", Enabled: true}}
+
+	result, err := formatter.Format(specs, configs)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	openapi := result.(*OpenAPISpec)
+
+	if len(openapi.Components.Schemas) != 2 {
+		t.Fatalf("Expected sharedStatus and sharedNode components once each, got %d", len(openapi.Components.Schemas))
+	}
+	status := openapi.Components.Schemas["sharedStatus"]
+	if status == nil || status.Type != "object" {
+		t.Fatalf("Expected sharedStatus object component, got %+v", status)
+	}
+	const statusRef = "#/components/schemas/sharedStatus"
+	if ref := status.Properties["parent"].Ref; ref != statusRef {
+		t.Errorf("Expected self reference for parent, got %q", ref)
+	}
+	if ref := status.Properties["nested"].Items.Ref; ref != "#/components/schemas/sharedNode" {
+		t.Errorf("Expected nested items to reference sharedNode, got %q", ref)
+	}
+	if ref := openapi.Components.Schemas["sharedNode"].Properties["status"].Ref; ref != statusRef {
+		t.Errorf("Expected sharedNode to reference sharedStatus, got %q", ref)
+	}
+
+	single := openapi.Paths["/api/status"].Get.Responses["200"].Content["application/json"].Schema
+	if single.Ref != statusRef {
+		t.Errorf("Expected /status to reference the component, got %+v", single)
+	}
+	list := openapi.Paths["/api/statuses"].Get.Responses["200"].Content["application/json"].Schema
+	if list.Type != "array" || list.Items.Ref != statusRef {
+		t.Errorf("Expected /statuses to be an array referencing the component, got %+v", list)
+	}
+
+	// The spec must still serialize with the recursive types
+	var buf bytes.Buffer
+	if err := formatter.Write(&buf, result); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
 func TestOpenAPIv3Formatter_Write(t *testing.T) {
 	formatter := &OpenAPIv3Formatter{}
 
@@ -269,6 +403,87 @@ func TestOpenAPIv31Formatter(t *testing.T) {
 	}
 }
 
+// nullableProfile has a pointer field, which may be null
+type nullableProfile struct {
+	Name     string  `json:"name"`
+	Nickname *string `json:"nickname,omitempty"`
+}
+
+func TestOpenAPIv31Formatter_JSONSchema(t *testing.T) {
+	specs := map[string]*CaddyModuleApiSpec{
+		"profile_api": {
+			ID: "profile_api",
+			Endpoints: []CaddyModuleApiEndpoint{
+				{
+					Method: "GET",
+					Path:   "/profile",
+					QueryParams: []Parameter{
+						{Name: "fields", Type: "string", Example: "name,nickname"},
+					},
+					Responses: map[int]ResponseDef{200: {Description: "OK", Body: nullableProfile{}}},
+				},
+			},
+		},
+	}
+	configs := map[string]*ApiConfig{"profile_api": {Path: "/api", Enabled: true}}
+
+	// render formats the spec and decodes the JSON output generically
+	render := func(formatter Formatter) map[string]interface{} {
+		result, err := formatter.Format(specs, configs)
+		if err != nil {
+			t.Fatalf("Format() error = %v", err)
+		}
+		var buf bytes.Buffer
+		if err := formatter.Write(&buf, result); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("Failed to decode output: %v", err)
+		}
+		return doc
+	}
+	property := func(doc map[string]interface{}, name string) map[string]interface{} {
+		schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		profile := schemas["nullableProfile"].(map[string]interface{})
+		return profile["properties"].(map[string]interface{})[name].(map[string]interface{})
+	}
+	paramSchema := func(doc map[string]interface{}) map[string]interface{} {
+		get := doc["paths"].(map[string]interface{})["/api/profile"].(map[string]interface{})["get"].(map[string]interface{})
+		return get["parameters"].([]interface{})[0].(map[string]interface{})["schema"].(map[string]interface{})
+	}
+
+	v30 := render(&OpenAPIv3Formatter{})
+	if field := property(v30, "nickname"); field["type"] != "string" || field["nullable"] != true {
+		t.Errorf("Expected 3.0 nullable string, got %v", field)
+	}
+	if schema := paramSchema(v30); schema["example"] != "name,nickname" || schema["examples"] != nil {
+		t.Errorf("Expected 3.0 schema example, got %v", schema)
+	}
+
+	v31 := render(&OpenAPIv31Formatter{})
+	field := property(v31, "nickname")
+	if _, ok := field["nullable"]; ok {
+		t.Errorf("Expected no nullable keyword in 3.1, got %v", field)
+	}
+	types, ok := field["type"].([]interface{})
+	if !ok || len(types) != 2 || types[0] != "string" || types[1] != "null" {
+		t.Errorf("Expected 3.1 type [string, null], got %v", field["type"])
+	}
+	schema := paramSchema(v31)
+	if _, ok := schema["example"]; ok {
+		t.Errorf("Expected no schema example in 3.1, got %v", schema)
+	}
+	if examples, ok := schema["examples"].([]interface{}); !ok || len(examples) != 1 || examples[0] != "name,nickname" {
+		t.Errorf("Expected 3.1 schema examples [name,nickname], got %v", schema["examples"])
+	}
+
+	// Non-nullable fields keep a plain type
+	if name := property(v31, "name"); name["type"] != "string" {
+		t.Errorf("Expected non-nullable name to keep type string, got %v", name["type"])
+	}
+}
+
 func TestGenerateSchema(t *testing.T) {
 	formatter := &OpenAPIv3Formatter{}
 
@@ -282,7 +497,15 @@ func TestGenerateSchema(t *testing.T) {
 		private  string            // Should be skipped
 	}
 
-	schema := formatter.generateSchema(TestStruct{})
+	schemas := newSchemaRegistry(&Components{})
+	ref := formatter.generateSchema(TestStruct{}, schemas)
+	if ref.Ref != "#/components/schemas/TestStruct" {
+		t.Fatalf("Expected a reference to the TestStruct component, got %+v", ref)
+	}
+	schema := schemas.components.Schemas["TestStruct"]
+	if schema == nil {
+		t.Fatal("Expected TestStruct to be registered as a component")
+	}
 
 	if schema.Type != "object" {
 		t.Errorf("Expected type 'object', got '%s'", schema.Type)
@@ -322,7 +545,7 @@ func TestGenerateSchema(t *testing.T) {
 	}
 
 	// Test array schema
-	arraySchema := formatter.generateSchema([]string{})
+	arraySchema := formatter.generateSchema([]string{}, schemas)
 	if arraySchema.Type != "array" {
 		t.Errorf("Expected type 'array', got '%s'", arraySchema.Type)
 	}
@@ -331,22 +554,117 @@ func TestGenerateSchema(t *testing.T) {
 	}
 
 	// Test primitive types
-	stringSchema := formatter.generateSchema("")
+	stringSchema := formatter.generateSchema("", schemas)
 	if stringSchema.Type != "string" {
 		t.Errorf("Expected type 'string', got '%s'", stringSchema.Type)
 	}
 
-	intSchema := formatter.generateSchema(0)
+	intSchema := formatter.generateSchema(0, schemas)
 	if intSchema.Type != "integer" {
 		t.Errorf("Expected type 'integer', got '%s'", intSchema.Type)
 	}
 
-	boolSchema := formatter.generateSchema(false)
+	boolSchema := formatter.generateSchema(false, schemas)
 	if boolSchema.Type != "boolean" {
 		t.Errorf("Expected type 'boolean', got '%s'", boolSchema.Type)
 	}
 }
 
+func TestGenerateSchema_RequiredFields(t *testing.T) {
+	formatter := &OpenAPIv3Formatter{}
+
+	type Account struct {
+		ID      string            `json:"id"`
+		Email   *string           `json:"email"`
+		Roles   []string          `json:"roles"`
+		Labels  map[string]string `json:"labels"`
+		Owner   *string           `json:"owner" required:"true"`
+		Plan    string            `json:"plan" required:"false"`
+		Comment string            `json:"comment,omitempty" required:"true"`
+	}
+
+	schemas := newSchemaRegistry(&Components{})
+	formatter.generateSchema(Account{}, schemas)
+	schema := schemas.components.Schemas["Account"]
+	if schema == nil {
+		t.Fatal("Expected Account to be registered as a component")
+	}
+
+	requiredMap := make(map[string]bool)
+	for _, field := range schema.Required {
+		requiredMap[field] = true
+	}
+
+	tests := []struct {
+		field    string
+		required bool
+	}{
+		{"id", true},
+		{"email", false},  // pointer
+		{"roles", false},  // slice
+		{"labels", false}, // map
+		{"owner", true},   // pointer tagged required:"true"
+		{"plan", false},   // value tagged required:"false"
+		{"comment", true}, // omitempty tagged required:"true"
+	}
+	for _, tt := range tests {
+		if requiredMap[tt.field] != tt.required {
+			t.Errorf("Field %q required = %v, want %v", tt.field, requiredMap[tt.field], tt.required)
+		}
+	}
+}
+
+func TestGenerateSchema_EnumAndExampleTags(t *testing.T) {
+	formatter := &OpenAPIv3Formatter{}
+
+	type Upstream struct {
+		Status  string   `json:"status" enum:"UP|DOWN|UNHEALTHY" example:"UP"`
+		Weight  int      `json:"weight" enum:"1|2|3" example:"2"`
+		Enabled bool     `json:"enabled" example:"true"`
+		Tags    []string `json:"tags" enum:"primary|backup" example:"primary"`
+		Plain   string   `json:"plain"`
+	}
+
+	schemas := newSchemaRegistry(&Components{})
+	formatter.generateSchema(Upstream{}, schemas)
+	schema := schemas.components.Schemas["Upstream"]
+	if schema == nil {
+		t.Fatal("Expected Upstream to be registered as a component")
+	}
+
+	status := schema.Properties["status"]
+	if !reflect.DeepEqual(status.Enum, []interface{}{"UP", "DOWN", "UNHEALTHY"}) {
+		t.Errorf("Expected status enum [UP DOWN UNHEALTHY], got %v", status.Enum)
+	}
+	if status.Example != "UP" {
+		t.Errorf("Expected status example UP, got %v", status.Example)
+	}
+
+	weight := schema.Properties["weight"]
+	if !reflect.DeepEqual(weight.Enum, []interface{}{int64(1), int64(2), int64(3)}) {
+		t.Errorf("Expected integer weight enum [1 2 3], got %#v", weight.Enum)
+	}
+	if weight.Example != int64(2) {
+		t.Errorf("Expected integer weight example 2, got %#v", weight.Example)
+	}
+
+	if enabled := schema.Properties["enabled"]; enabled.Example != true {
+		t.Errorf("Expected boolean enabled example true, got %#v", enabled.Example)
+	}
+
+	tags := schema.Properties["tags"]
+	if !reflect.DeepEqual(tags.Items.Enum, []interface{}{"primary", "backup"}) {
+		t.Errorf("Expected tags items enum [primary backup], got %v", tags.Items.Enum)
+	}
+	if !reflect.DeepEqual(tags.Example, []interface{}{"primary"}) {
+		t.Errorf("Expected tags example [primary], got %v", tags.Example)
+	}
+
+	if plain := schema.Properties["plain"]; plain.Enum != nil || plain.Example != nil {
+		t.Errorf("Expected untagged field without enum or example, got %+v", plain)
+	}
+}
+
 func TestParameterToSchema(t *testing.T) {
 	formatter := &OpenAPIv3Formatter{}
 
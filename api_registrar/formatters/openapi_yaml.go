@@ -0,0 +1,71 @@
+package formatters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIv3YAMLFormatter formats API specs as an OpenAPI 3.0 YAML document
+type OpenAPIv3YAMLFormatter struct {
+	OpenAPIv3Formatter
+}
+
+// ContentType returns the HTTP content type for OpenAPI YAML
+func (f *OpenAPIv3YAMLFormatter) ContentType() string {
+	return "application/yaml"
+}
+
+// Write outputs the formatted spec to the writer as YAML
+func (f *OpenAPIv3YAMLFormatter) Write(w io.Writer, spec interface{}) error {
+	return writeYAML(w, spec)
+}
+
+// OpenAPIv31YAMLFormatter formats API specs as an OpenAPI 3.1 YAML document
+type OpenAPIv31YAMLFormatter struct {
+	OpenAPIv31Formatter
+}
+
+// ContentType returns the HTTP content type for OpenAPI YAML
+func (f *OpenAPIv31YAMLFormatter) ContentType() string {
+	return "application/yaml"
+}
+
+// Write outputs the formatted spec to the writer as YAML
+func (f *OpenAPIv31YAMLFormatter) Write(w io.Writer, spec interface{}) error {
+	return writeYAML(w, spec)
+}
+
+// writeYAML encodes a spec as YAML. The spec types only carry JSON tags, so it
+// is encoded as JSON first; JSON is valid YAML, and decoding it into a node
+// keeps the field names and order of the JSON output.
+func writeYAML(w io.Writer, spec interface{}) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("failed to encode spec: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to convert spec to YAML: %w", err)
+	}
+	useBlockStyle(&doc)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// useBlockStyle drops the JSON flow style and quoting decoded into a node, so
+// the encoder emits block YAML, quoting only where a value needs it
+func useBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		useBlockStyle(child)
+	}
+}
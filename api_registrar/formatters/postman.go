@@ -0,0 +1,270 @@
+package formatters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// postmanSchema identifies the Postman collection format version
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// Postman collection v2.1 type definitions
+type PostmanCollection struct {
+	Info     PostmanInfo       `json:"info"`
+	Item     []PostmanItem     `json:"item"`
+	Variable []PostmanVariable `json:"variable,omitempty"`
+}
+
+type PostmanInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// PostmanItem is either a folder, with child items, or a single request
+type PostmanItem struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Item        []PostmanItem   `json:"item,omitempty"`
+	Request     *PostmanRequest `json:"request,omitempty"`
+}
+
+type PostmanRequest struct {
+	Method      string          `json:"method"`
+	Header      []PostmanHeader `json:"header"`
+	URL         PostmanURL      `json:"url"`
+	Body        *PostmanBody    `json:"body,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+type PostmanHeader struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+type PostmanURL struct {
+	Raw      string            `json:"raw"`
+	Host     []string          `json:"host"`
+	Path     []string          `json:"path,omitempty"`
+	Query    []PostmanQuery    `json:"query,omitempty"`
+	Variable []PostmanVariable `json:"variable,omitempty"`
+}
+
+type PostmanQuery struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+type PostmanVariable struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+type PostmanBody struct {
+	Mode    string                 `json:"mode"`
+	Raw     string                 `json:"raw"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// PostmanFormatter formats API specs as a Postman v2.1 collection, with a
+// folder per API and a request per endpoint
+type PostmanFormatter struct {
+	ServerURL string // Optional server URL, stored in the baseUrl variable
+	Info      *Info  // Optional info overrides; Title and Description are used
+}
+
+// Format converts the API specs to a Postman collection
+func (f *PostmanFormatter) Format(specs map[string]*CaddyModuleApiSpec, configs map[string]*ApiConfig) (interface{}, error) {
+	serverURL := f.ServerURL
+	if serverURL == "" {
+		serverURL = "http://localhost"
+	}
+
+	collection := &PostmanCollection{
+		Info: PostmanInfo{
+			Name:        "Caddy Server API",
+			Description: "Caddy web server administration and module APIs",
+			Schema:      postmanSchema,
+		},
+		Item: []PostmanItem{},
+		Variable: []PostmanVariable{
+			{Key: "baseUrl", Value: serverURL},
+		},
+	}
+	if f.Info != nil {
+		if f.Info.Title != "" {
+			collection.Info.Name = f.Info.Title
+		}
+		if f.Info.Description != "" {
+			collection.Info.Description = f.Info.Description
+		}
+	}
+
+	// Sort API IDs so the folder order is stable
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		config := configs[id]
+		if !config.Enabled {
+			continue
+		}
+
+		spec, exists := specs[id]
+		if !exists {
+			continue
+		}
+
+		folder := PostmanItem{
+			Name:        spec.ID,
+			Description: spec.Description,
+			Item:        []PostmanItem{},
+		}
+		if folder.Description == "" {
+			folder.Description = spec.Title
+		}
+
+		for _, endpoint := range spec.Endpoints {
+			request, err := f.createRequest(endpoint, config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert %s %s: %w", endpoint.Method, endpoint.Path, err)
+			}
+			name := endpoint.Summary
+			if name == "" {
+				name = strings.ToUpper(endpoint.Method) + " " + endpoint.Path
+			}
+			folder.Item = append(folder.Item, PostmanItem{
+				Name:    name,
+				Request: request,
+			})
+		}
+
+		collection.Item = append(collection.Item, folder)
+	}
+
+	return collection, nil
+}
+
+// createRequest creates a Postman request from an endpoint. Path parameters
+// become :name variables and the request body is an example built from the
+// endpoint's request type.
+func (f *PostmanFormatter) createRequest(endpoint CaddyModuleApiEndpoint, config *ApiConfig) (*PostmanRequest, error) {
+	request := &PostmanRequest{
+		Method:      strings.ToUpper(endpoint.Method),
+		Header:      []PostmanHeader{},
+		Description: endpoint.Description,
+	}
+
+	// Global headers first, sorted for a stable order, then endpoint headers
+	headerNames := make([]string, 0, len(config.Headers))
+	for name := range config.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	for _, name := range headerNames {
+		request.Header = append(request.Header, PostmanHeader{Key: name, Value: config.Headers[name]})
+	}
+	for _, param := range endpoint.Headers {
+		request.Header = append(request.Header, PostmanHeader{
+			Key:         param.Name,
+			Value:       exampleValue(param),
+			Description: param.Description,
+		})
+	}
+
+	// Postman writes path parameters as :name rather than {name}, and keeps
+	// a trailing slash as an empty last segment
+	fullPath := config.Path + endpoint.Path
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(fullPath, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segment = ":" + strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) > 0 && strings.HasSuffix(fullPath, "/") {
+		segments = append(segments, "")
+	}
+	request.URL = PostmanURL{
+		Raw:  "{{baseUrl}}/" + strings.Join(segments, "/"),
+		Host: []string{"{{baseUrl}}"},
+		Path: segments,
+	}
+	for _, param := range endpoint.PathParams {
+		request.URL.Variable = append(request.URL.Variable, PostmanVariable{
+			Key:         param.Name,
+			Value:       exampleValue(param),
+			Description: param.Description,
+		})
+	}
+
+	var query []string
+	for _, param := range endpoint.QueryParams {
+		value := exampleValue(param)
+		request.URL.Query = append(request.URL.Query, PostmanQuery{
+			Key:         param.Name,
+			Value:       value,
+			Description: param.Description,
+			Disabled:    !param.Required,
+		})
+		if param.Required {
+			query = append(query, param.Name+"="+value)
+		}
+	}
+	if len(query) > 0 {
+		request.URL.Raw += "?" + strings.Join(query, "&")
+	}
+
+	if endpoint.Request != nil {
+		example, err := json.MarshalIndent(endpoint.Request, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		request.Body = &PostmanBody{
+			Mode: "raw",
+			Raw:  string(example),
+			Options: map[string]interface{}{
+				"raw": map[string]string{"language": "json"},
+			},
+		}
+		request.Header = append(request.Header, PostmanHeader{Key: "Content-Type", Value: "application/json"})
+	}
+
+	return request, nil
+}
+
+// exampleValue returns a parameter's example, falling back to its default
+func exampleValue(param Parameter) string {
+	if param.Example != nil {
+		return fmt.Sprint(param.Example)
+	}
+	if param.Default != nil {
+		return fmt.Sprint(param.Default)
+	}
+	return ""
+}
+
+// ContentType returns the HTTP content type for Postman collections
+func (f *PostmanFormatter) ContentType() string {
+	return "application/json"
+}
+
+// Write outputs the formatted collection to the writer
+func (f *PostmanFormatter) Write(w io.Writer, spec interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(spec)
+}
@@ -0,0 +1,134 @@
+package formatters
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPostmanFormatter_Format(t *testing.T) {
+	formatter := &PostmanFormatter{ServerURL: "https://caddy.example.com"}
+
+	specs := map[string]*CaddyModuleApiSpec{
+		"failover_api": {
+			ID:    "failover_api",
+			Title: "Failover API",
+			Endpoints: []CaddyModuleApiEndpoint{
+				{
+					Method:  "GET",
+					Path:    "/status",
+					Summary: "Get status",
+					QueryParams: []Parameter{
+						{Name: "path", Description: "Filter by path", Example: "/api"},
+					},
+				},
+				{
+					Method:  "POST",
+					Path:    "/upstreams/{id}/drain",
+					Summary: "Drain upstream",
+					PathParams: []Parameter{
+						{Name: "id", Required: true, Type: "string", Example: "primary"},
+					},
+					Request: struct {
+						Timeout string `json:"timeout"`
+					}{Timeout: "30s"},
+				},
+			},
+		},
+		"caddy_api": {
+			ID:    "caddy_api",
+			Title: "Caddy API",
+			Endpoints: []CaddyModuleApiEndpoint{
+				{Method: "GET", Path: "/config/"},
+			},
+		},
+	}
+	configs := map[string]*ApiConfig{
+		"failover_api": {Path: "/caddy/failover", Enabled: true, Headers: map[string]string{"X-Api-Key": "secret"}},
+		"caddy_api":    {Path: "/caddy", Enabled: true},
+	}
+
+	result, err := formatter.Format(specs, configs)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	collection := result.(*PostmanCollection)
+
+	if collection.Info.Schema != "https://schema.getpostman.com/json/collection/v2.1.0/collection.json" {
+		t.Errorf("Expected Postman v2.1 schema, got %q", collection.Info.Schema)
+	}
+	if len(collection.Variable) != 1 || collection.Variable[0].Key != "baseUrl" ||
+		collection.Variable[0].Value != "https://caddy.example.com" {
+		t.Errorf("Expected baseUrl variable with the server URL, got %+v", collection.Variable)
+	}
+
+	// Folders are sorted by API ID
+	if len(collection.Item) != 2 || collection.Item[0].Name != "caddy_api" || collection.Item[1].Name != "failover_api" {
+		t.Fatalf("Expected a folder per API ID, got %+v", collection.Item)
+	}
+	if len(collection.Item[0].Item) != 1 {
+		t.Errorf("Expected 1 request in caddy_api, got %d", len(collection.Item[0].Item))
+	}
+	if name := collection.Item[0].Item[0].Name; name != "GET /config/" {
+		t.Errorf("Expected unnamed endpoint to be named by method and path, got %q", name)
+	}
+	if raw := collection.Item[0].Item[0].Request.URL.Raw; raw != "{{baseUrl}}/caddy/config/" {
+		t.Errorf("Expected trailing slash to be kept, got %q", raw)
+	}
+
+	requests := collection.Item[1].Item
+	if len(requests) != 2 {
+		t.Fatalf("Expected each endpoint to become an item, got %d", len(requests))
+	}
+
+	status := requests[0]
+	if status.Name != "Get status" || status.Request.Method != "GET" {
+		t.Errorf("Unexpected status item: %+v", status)
+	}
+	if status.Request.URL.Raw != "{{baseUrl}}/caddy/failover/status" {
+		t.Errorf("Unexpected raw URL %q", status.Request.URL.Raw)
+	}
+	if len(status.Request.URL.Query) != 1 || !status.Request.URL.Query[0].Disabled || status.Request.URL.Query[0].Value != "/api" {
+		t.Errorf("Expected optional query parameter disabled with its example, got %+v", status.Request.URL.Query)
+	}
+	if len(status.Request.Header) != 1 || status.Request.Header[0].Key != "X-Api-Key" {
+		t.Errorf("Expected the API's global header, got %+v", status.Request.Header)
+	}
+
+	drain := requests[1].Request
+	if drain.URL.Raw != "{{baseUrl}}/caddy/failover/upstreams/:id/drain" {
+		t.Errorf("Expected path parameter as :id, got %q", drain.URL.Raw)
+	}
+	if len(drain.URL.Variable) != 1 || drain.URL.Variable[0].Key != "id" || drain.URL.Variable[0].Value != "primary" {
+		t.Errorf("Expected id path variable with its example, got %+v", drain.URL.Variable)
+	}
+	if drain.Body == nil || drain.Body.Mode != "raw" {
+		t.Fatalf("Expected a raw example body, got %+v", drain.Body)
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(drain.Body.Raw), &body); err != nil || body["timeout"] != "30s" {
+		t.Errorf("Expected example JSON body, got %q", drain.Body.Raw)
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Write(&buf, result); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if info, _ := decoded["info"].(map[string]interface{}); info["schema"] != postmanSchema {
+		t.Errorf("Expected info.schema in output, got %v", decoded["info"])
+	}
+}
+
+func TestGetFormatter_Postman(t *testing.T) {
+	formatter, ok := GetFormatter("postman").(*PostmanFormatter)
+	if !ok {
+		t.Fatal("Expected GetFormatter to return a PostmanFormatter for postman")
+	}
+	if formatter.ContentType() != "application/json" {
+		t.Errorf("Expected application/json, got %s", formatter.ContentType())
+	}
+}
@@ -0,0 +1,55 @@
+package formatters
+
+import (
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// invalidComponentChars matches characters not allowed in component names
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// schemaRegistry tracks the struct types emitted as component schemas while a
+// spec is formatted, so each type is generated once and then referenced
+type schemaRegistry struct {
+	components *Components
+	names      map[reflect.Type]string
+}
+
+// newSchemaRegistry returns a registry that adds schemas to components
+func newSchemaRegistry(components *Components) *schemaRegistry {
+	if components.Schemas == nil {
+		components.Schemas = make(map[string]*Schema)
+	}
+	return &schemaRegistry{
+		components: components,
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// register returns the component name for t and whether it was already
+// registered. A new type is added with the given schema, which the caller
+// then fills in; registering before filling stops recursive types looping.
+func (r *schemaRegistry) register(t reflect.Type, schema *Schema) (string, bool) {
+	if name, ok := r.names[t]; ok {
+		return name, true
+	}
+
+	// Types from different packages may share a name: qualify the later ones
+	name := invalidComponentChars.ReplaceAllString(t.Name(), "_")
+	if _, taken := r.components.Schemas[name]; taken {
+		qualified := invalidComponentChars.ReplaceAllString(path.Base(t.PkgPath())+"."+t.Name(), "_")
+		name = qualified
+		for i := 2; ; i++ {
+			if _, taken := r.components.Schemas[name]; !taken {
+				break
+			}
+			name = qualified + strconv.Itoa(i)
+		}
+	}
+
+	r.names[t] = name
+	r.components.Schemas[name] = schema
+	return name, false
+}
@@ -176,6 +176,10 @@ func GetFormatterWithUI(format string, currentPath string) Formatter {
 		return &OpenAPIv3Formatter{}
 	case "openapi-v3.1", "openapi-3.1":
 		return &OpenAPIv31Formatter{}
+	case "openapi-v3.0-yaml", "openapi-3.0-yaml", "openapi-yaml":
+		return &OpenAPIv3YAMLFormatter{}
+	case "openapi-v3.1-yaml", "openapi-3.1-yaml":
+		return &OpenAPIv31YAMLFormatter{}
 	default:
 		// Default to OpenAPI 3.0
 		return &OpenAPIv3Formatter{}
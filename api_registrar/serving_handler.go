@@ -17,12 +17,25 @@ func init() {
 
 // ApiServingHandler serves API documentation in various formats
 type ApiServingHandler struct {
-	// Format specifies the output format (e.g., "openapi-v3.0", "openapi-v3.1", "swagger-ui", "redoc")
+	// Format specifies the output format (e.g., "openapi-v3.0", "openapi-v3.1", "openapi-yaml", "postman", "swagger-ui", "redoc")
 	Format string `json:"format,omitempty"`
 	// SpecURL is the URL to the OpenAPI spec (for UI formatters, optional)
 	SpecURL string `json:"spec_url,omitempty"`
 	// ServerURL is the base URL for the API server (optional, defaults to dynamic detection)
 	ServerURL string `json:"server_url,omitempty"`
+	// InfoTitle overrides the document title (optional)
+	InfoTitle string `json:"info_title,omitempty"`
+	// InfoDescription overrides the document description (optional)
+	InfoDescription string `json:"info_description,omitempty"`
+	// InfoVersion overrides the document version (optional)
+	InfoVersion string `json:"info_version,omitempty"`
+	// ContactName, ContactURL and ContactEmail populate info.contact (optional)
+	ContactName  string `json:"contact_name,omitempty"`
+	ContactURL   string `json:"contact_url,omitempty"`
+	ContactEmail string `json:"contact_email,omitempty"`
+	// LicenseName and LicenseURL populate info.license (optional)
+	LicenseName string `json:"license_name,omitempty"`
+	LicenseURL  string `json:"license_url,omitempty"`
 }
 
 // CaddyModule returns the Caddy module information
@@ -107,15 +120,32 @@ func (h *ApiServingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, ne
 			serverURL = fmt.Sprintf("%s://%s", scheme, r.Host)
 		}
 
-		// Set server URL for OpenAPI formatters
+		// Set server URL and info overrides for OpenAPI formatters
 		switch h.Format {
 		case "openapi-v3.0", "openapi-3.0", "openapi":
 			if openapiFormatter, ok := formatter.(*formatters.OpenAPIv3Formatter); ok {
 				openapiFormatter.ServerURL = serverURL
+				openapiFormatter.Info = h.infoOverrides()
 			}
 		case "openapi-v3.1", "openapi-3.1":
 			if openapiFormatter, ok := formatter.(*formatters.OpenAPIv31Formatter); ok {
 				openapiFormatter.ServerURL = serverURL
+				openapiFormatter.Info = h.infoOverrides()
+			}
+		case "openapi-v3.0-yaml", "openapi-3.0-yaml", "openapi-yaml":
+			if openapiFormatter, ok := formatter.(*formatters.OpenAPIv3YAMLFormatter); ok {
+				openapiFormatter.ServerURL = serverURL
+				openapiFormatter.Info = h.infoOverrides()
+			}
+		case "openapi-v3.1-yaml", "openapi-3.1-yaml":
+			if openapiFormatter, ok := formatter.(*formatters.OpenAPIv31YAMLFormatter); ok {
+				openapiFormatter.ServerURL = serverURL
+				openapiFormatter.Info = h.infoOverrides()
+			}
+		case "postman":
+			if postmanFormatter, ok := formatter.(*formatters.PostmanFormatter); ok {
+				postmanFormatter.ServerURL = serverURL
+				postmanFormatter.Info = h.infoOverrides()
 			}
 		}
 	}
@@ -154,6 +184,29 @@ func (h *ApiServingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, ne
 	return nil
 }
 
+// infoOverrides builds the OpenAPI info overrides from the configured fields
+func (h *ApiServingHandler) infoOverrides() *formatters.Info {
+	info := &formatters.Info{
+		Title:       h.InfoTitle,
+		Description: h.InfoDescription,
+		Version:     h.InfoVersion,
+	}
+	if h.ContactName != "" || h.ContactURL != "" || h.ContactEmail != "" {
+		info.Contact = &formatters.Contact{
+			Name:  h.ContactName,
+			URL:   h.ContactURL,
+			Email: h.ContactEmail,
+		}
+	}
+	if h.LicenseName != "" {
+		info.License = &formatters.License{
+			Name: h.LicenseName,
+			URL:  h.LicenseURL,
+		}
+	}
+	return info
+}
+
 // parseApiServing parses the caddy_api_registrar_serve directive
 func parseApiServing(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
 	handler := &ApiServingHandler{}
@@ -189,6 +242,35 @@ func parseApiServing(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error
 				if h.NextArg() {
 					return nil, h.ArgErr()
 				}
+			case "info_title", "info_description", "info_version",
+				"contact_name", "contact_url", "contact_email",
+				"license_name", "license_url":
+				option := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				value := h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				switch option {
+				case "info_title":
+					handler.InfoTitle = value
+				case "info_description":
+					handler.InfoDescription = value
+				case "info_version":
+					handler.InfoVersion = value
+				case "contact_name":
+					handler.ContactName = value
+				case "contact_url":
+					handler.ContactURL = value
+				case "contact_email":
+					handler.ContactEmail = value
+				case "license_name":
+					handler.LicenseName = value
+				case "license_url":
+					handler.LicenseURL = value
+				}
 			default:
 				return nil, h.Errf("unknown subdirective: %s", h.Val())
 			}
@@ -5,10 +5,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"gopkg.in/yaml.v3"
 )
 
 func TestApiServingHandler_ServeHTTP(t *testing.T) {
@@ -369,3 +374,159 @@ func TestApiServingHandler_ServerURL(t *testing.T) {
 		})
 	}
 }
+
+func TestApiServingHandler_InfoOverrides(t *testing.T) {
+	Reset()
+	ResetPaths()
+	defer func() {
+		Reset()
+		ResetPaths()
+	}()
+
+	for _, format := range []string{"openapi-v3.0", "openapi-v3.1"} {
+		t.Run(format, func(t *testing.T) {
+			handler := &ApiServingHandler{
+				Format:       format,
+				InfoTitle:    "Internal Gateway",
+				InfoVersion:  "3.2.1",
+				ContactEmail: "ops@example.com",
+				LicenseName:  "MIT",
+				LicenseURL:   "https://opensource.org/licenses/MIT",
+			}
+			if err := handler.Provision(caddy.Context{}); err != nil {
+				t.Fatalf("Failed to provision handler: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/api/openapi.json", nil)
+			w := httptest.NewRecorder()
+			if err := handler.ServeHTTP(w, req, nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+
+			var doc struct {
+				Info struct {
+					Title       string `json:"title"`
+					Description string `json:"description"`
+					Version     string `json:"version"`
+					Contact     struct {
+						Email string `json:"email"`
+					} `json:"contact"`
+					License struct {
+						Name string `json:"name"`
+						URL  string `json:"url"`
+					} `json:"license"`
+				} `json:"info"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+
+			if doc.Info.Title != "Internal Gateway" {
+				t.Errorf("Expected title 'Internal Gateway', got '%s'", doc.Info.Title)
+			}
+			if doc.Info.Version != "3.2.1" {
+				t.Errorf("Expected version '3.2.1', got '%s'", doc.Info.Version)
+			}
+			if doc.Info.Description == "" {
+				t.Error("Expected default description to be kept when not overridden")
+			}
+			if doc.Info.Contact.Email != "ops@example.com" {
+				t.Errorf("Expected contact email 'ops@example.com', got '%s'", doc.Info.Contact.Email)
+			}
+			if doc.Info.License.Name != "MIT" || doc.Info.License.URL == "" {
+				t.Errorf("Expected MIT license with URL, got %+v", doc.Info.License)
+			}
+		})
+	}
+}
+
+func TestApiServingHandler_YAML(t *testing.T) {
+	Reset()
+	ResetPaths()
+	defer func() {
+		Reset()
+		ResetPaths()
+	}()
+
+	RegisterApiSpec("test_api", func() *CaddyModuleApiSpec {
+		return &CaddyModuleApiSpec{
+			ID:          "test_api",
+			Title:       "Test API",
+			Version:     "1.0",
+			Description: "Status: all systems go",
+			Endpoints: []CaddyModuleApiEndpoint{
+				{
+					Method:  "GET",
+					Path:    "/test",
+					Summary: "Test endpoint",
+					Responses: map[int]ResponseDef{
+						200: {Description: "Success", Body: map[string]interface{}{"ok": true}},
+						404: {Description: "Not found"},
+					},
+				},
+			},
+		}
+	})
+	RegisterApiPath("test_api", &ApiConfig{
+		Path:    "/api",
+		Enabled: true,
+	})
+
+	serve := func(t *testing.T, directive string) *httptest.ResponseRecorder {
+		t.Helper()
+		parsed, err := parseApiServing(httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(directive)})
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", directive, err)
+		}
+		handler := parsed.(*ApiServingHandler)
+		if err := handler.Provision(caddy.Context{}); err != nil {
+			t.Fatalf("Failed to provision handler: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/api/openapi.yaml", nil)
+		w := httptest.NewRecorder()
+		if err := handler.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		return w
+	}
+
+	for format, jsonFormat := range map[string]string{
+		"openapi-yaml":      "openapi-v3.0",
+		"openapi-v3.1-yaml": "openapi-v3.1",
+	} {
+		t.Run(format, func(t *testing.T) {
+			yamlResp := serve(t, "caddy_api_registrar_serve "+format)
+			if ct := yamlResp.Header().Get("Content-Type"); ct != "application/yaml" {
+				t.Errorf("Expected Content-Type application/yaml, got %s", ct)
+			}
+			if strings.HasPrefix(strings.TrimSpace(yamlResp.Body.String()), "{") {
+				t.Errorf("Expected block YAML, got JSON-style output:\n%s", yamlResp.Body.String())
+			}
+
+			var fromYAML interface{}
+			if err := yaml.Unmarshal(yamlResp.Body.Bytes(), &fromYAML); err != nil {
+				t.Fatalf("Response is not valid YAML: %v", err)
+			}
+			var fromJSON interface{}
+			if err := json.Unmarshal(serve(t, "caddy_api_registrar_serve "+jsonFormat).Body.Bytes(), &fromJSON); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+
+			// Normalize YAML's integer types through JSON before comparing
+			normalized, err := json.Marshal(fromYAML)
+			if err != nil {
+				t.Fatalf("Failed to re-encode YAML document: %v", err)
+			}
+			var roundTripped interface{}
+			if err := json.Unmarshal(normalized, &roundTripped); err != nil {
+				t.Fatalf("Failed to parse re-encoded YAML document: %v", err)
+			}
+			if !reflect.DeepEqual(roundTripped, fromJSON) {
+				t.Errorf("YAML document differs from JSON output\nYAML:\n%s", yamlResp.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package failover
+
+// Active selection modes decide which healthy upstream becomes active
+const (
+	activeSelectionOrder       = "order"        // the first healthy upstream in declared order
+	activeSelectionSuccessRate = "success_rate" // the healthy upstream with the best request success rate
+)
+
+// recordUpstreamMetrics records a request's outcome against the upstream it
+// was sent to, for success_rate selection, and re-evaluates the active
+// upstream. Must be called with lock held
+func (f *FailoverProxy) recordUpstreamMetrics(upstreamURL string, elapsedMs int64, success bool) {
+	if f.ActiveSelection != activeSelectionSuccessRate {
+		return
+	}
+	metrics, ok := f.upstreamMetrics[upstreamURL]
+	if !ok {
+		metrics = &ActiveUpstream{URL: upstreamURL}
+		f.upstreamMetrics[upstreamURL] = metrics
+	}
+	metrics.UpdateMetrics(elapsedMs, success)
+	f.checkActiveUpstreamChange()
+}
+
+// selectActive picks the active upstream from the healthy candidates, which
+// are in declared order. Under success_rate the candidate with the highest
+// success rate wins, then the one with fewest failures; upstreams without
+// requests yet rank last. The current active upstream keeps its place on a
+// tie so traffic doesn't flap. Must be called with lock held
+func (f *FailoverProxy) selectActive(candidates []string, currentURL string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	if f.ActiveSelection != activeSelectionSuccessRate {
+		return candidates[0]
+	}
+
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if f.betterSuccessRate(candidate, best) {
+			best = candidate
+		}
+	}
+	if best != currentURL {
+		for _, candidate := range candidates {
+			if candidate == currentURL && !f.betterSuccessRate(best, currentURL) {
+				return currentURL
+			}
+		}
+	}
+	return best
+}
+
+// betterSuccessRate reports whether upstream a has strictly better request
+// metrics than upstream b. Must be called with lock held
+func (f *FailoverProxy) betterSuccessRate(a, b string) bool {
+	ma, mb := f.upstreamMetrics[a], f.upstreamMetrics[b]
+	if ma == nil || mb == nil {
+		return ma != nil && mb == nil
+	}
+
+	ma.mu.Lock()
+	rateA, failedA := ma.SuccessRate, ma.FailedRequests
+	ma.mu.Unlock()
+	mb.mu.Lock()
+	rateB, failedB := mb.SuccessRate, mb.FailedRequests
+	mb.mu.Unlock()
+
+	if rateA != rateB {
+		return rateA > rateB
+	}
+	return failedA < failedB
+}
@@ -0,0 +1,154 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"go.uber.org/zap/zaptest"
+)
+
+// seedMetrics returns request metrics with the given number of successes and failures
+func seedMetrics(url string, successes, failures int) *ActiveUpstream {
+	metrics := &ActiveUpstream{URL: url}
+	for i := 0; i < successes; i++ {
+		metrics.UpdateMetrics(10, true)
+	}
+	for i := 0; i < failures; i++ {
+		metrics.UpdateMetrics(10, false)
+	}
+	return metrics
+}
+
+// TestActiveSelectionSuccessRate tests that the healthy upstream with the best
+// success rate becomes active rather than the first one
+func TestActiveSelectionSuccessRate(t *testing.T) {
+	upstreams := []string{"http://primary", "http://secondary", "http://tertiary", "http://fresh"}
+	f := &FailoverProxy{
+		Upstreams:       upstreams,
+		ActiveSelection: activeSelectionSuccessRate,
+		FailDuration:    caddy.Duration(30 * time.Second),
+		healthStatus: map[string]bool{
+			"http://primary":   true,
+			"http://secondary": true,
+			"http://tertiary":  false,
+			"http://fresh":     true,
+		},
+		failureCache: map[string]time.Time{},
+		upstreamMetrics: map[string]*ActiveUpstream{
+			"http://primary":   seedMetrics("http://primary", 6, 4),
+			"http://secondary": seedMetrics("http://secondary", 9, 1),
+			"http://tertiary":  seedMetrics("http://tertiary", 10, 0),
+		},
+		logger: zaptest.NewLogger(t),
+	}
+
+	f.checkActiveUpstreamChange()
+	if f.activeUpstream == nil || f.activeUpstream.URL != "http://secondary" {
+		t.Fatalf("Expected the healthy upstream with the best success rate to be active, got %+v", f.activeUpstream)
+	}
+
+	// Equal success rates: fewer failures wins
+	f.upstreamMetrics["http://primary"] = seedMetrics("http://primary", 18, 2)
+	f.upstreamMetrics["http://secondary"] = seedMetrics("http://secondary", 9, 1)
+	f.activeUpstream = nil
+	f.checkActiveUpstreamChange()
+	if f.activeUpstream == nil || f.activeUpstream.URL != "http://secondary" {
+		t.Errorf("Expected fewer failures to break the tie, got %+v", f.activeUpstream)
+	}
+
+	// A full tie keeps the current active upstream
+	f.upstreamMetrics["http://primary"] = seedMetrics("http://primary", 9, 1)
+	f.checkActiveUpstreamChange()
+	if f.activeUpstream.URL != "http://secondary" {
+		t.Errorf("Expected the current active upstream to be kept on a tie, got %s", f.activeUpstream.URL)
+	}
+	if reason := f.determineChangeReason("http://secondary", "http://primary"); reason == "higher success rate" {
+		t.Errorf("Expected no success rate reason for a tie, got %q", reason)
+	}
+}
+
+// TestActiveSelectionOrder tests that the default selection ignores success rates
+func TestActiveSelectionOrder(t *testing.T) {
+	f := &FailoverProxy{
+		Upstreams:       []string{"http://primary", "http://backup"},
+		ActiveSelection: activeSelectionOrder,
+		healthStatus:    map[string]bool{"http://primary": true, "http://backup": true},
+		failureCache:    map[string]time.Time{},
+		upstreamMetrics: map[string]*ActiveUpstream{
+			"http://primary": seedMetrics("http://primary", 1, 9),
+			"http://backup":  seedMetrics("http://backup", 10, 0),
+		},
+		logger: zaptest.NewLogger(t),
+	}
+
+	f.checkActiveUpstreamChange()
+	if f.activeUpstream == nil || f.activeUpstream.URL != "http://primary" {
+		t.Errorf("Expected the first healthy upstream to be active, got %+v", f.activeUpstream)
+	}
+}
+
+// TestActiveSelectionServesActive tests that requests start at the upstream
+// chosen by success rate once it overtakes the primary
+func TestActiveSelectionServesActive(t *testing.T) {
+	var primaryHits, backupHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.ActiveSelection = activeSelectionSuccessRate
+	})
+	fp.mu.Lock()
+	fp.upstreamMetrics[primary.URL] = seedMetrics(primary.URL, 5, 5)
+	fp.upstreamMetrics[backup.URL] = seedMetrics(backup.URL, 10, 0)
+	fp.checkActiveUpstreamChange()
+	fp.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	}
+	if primaryHits.Load() != 0 || backupHits.Load() != 3 {
+		t.Errorf("Expected requests to start at the backup, got %d primary and %d backup hits",
+			primaryHits.Load(), backupHits.Load())
+	}
+	if active := fp.GetActiveUpstreamMetrics(); active == nil || active.URL != backup.URL || active.RequestCount != 3 {
+		t.Errorf("Expected the backup to be active with 3 requests, got %+v", active)
+	}
+}
+
+// TestParseActiveSelection tests parsing the active_selection subdirective
+func TestParseActiveSelection(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+		"failover_proxy http://a http://b {\n active_selection success_rate\n}")}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := handler.(*FailoverProxy).ActiveSelection; got != activeSelectionSuccessRate {
+		t.Errorf("Expected success_rate, got %q", got)
+	}
+
+	for _, bad := range []string{"", "fastest", "order extra"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n active_selection " + bad + "\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for active_selection %q", bad)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package failover
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -357,7 +361,142 @@ func TestDetermineChangeReason(t *testing.T) {
 
 // TestActiveUpstreamWithServeHTTP tests metrics tracking during request handling
 func TestActiveUpstreamWithServeHTTP(t *testing.T) {
-	// This test would require more setup with HTTP test servers
-	// For now, we'll focus on the unit tests above
-	t.Skip("Integration test - requires HTTP test servers")
+	var failing atomic.Bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	// No health checks: the first request picks the active upstream
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL})
+	require.Nil(t, fp.GetActiveUpstreamMetrics(), "no active upstream before any request")
+
+	serve := func() {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		w := httptest.NewRecorder()
+		require.NoError(t, fp.ServeHTTP(w, req, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		serve()
+	}
+	metrics := fp.GetActiveUpstreamMetrics()
+	require.NotNil(t, metrics)
+	assert.Equal(t, primary.URL, metrics.URL)
+	assert.Equal(t, int64(3), metrics.RequestCount)
+	assert.Equal(t, int64(0), metrics.FailedRequests)
+	assert.Equal(t, 100.0, metrics.SuccessRate)
+	assert.GreaterOrEqual(t, metrics.AvgResponseMs, 5.0)
+
+	// A failed request counts against the primary; the backup's success doesn't count
+	failing.Store(true)
+	serve()
+	metrics = fp.GetActiveUpstreamMetrics()
+	require.NotNil(t, metrics)
+	assert.Equal(t, primary.URL, metrics.URL)
+	assert.Equal(t, int64(4), metrics.RequestCount)
+	assert.Equal(t, int64(1), metrics.FailedRequests)
+	assert.Equal(t, 75.0, metrics.SuccessRate)
+}
+
+// TestUpstreamStatusMetrics tests that the active upstream's request metrics appear in the status JSON
+func TestUpstreamStatusMetrics(t *testing.T) {
+	var requests int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Fail the 2nd and 4th requests
+		if n := atomic.AddInt32(&requests, 1); n%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	// A negligible fail duration sends every request back to the primary
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL},
+		WithFailDuration(time.Nanosecond),
+		WithHealthCheck(primary.URL, MockHealthCheck("/health", time.Hour, time.Second, http.StatusOK)))
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		return fp.isHealthy(primary.URL) && fp.GetActiveUpstreamMetrics() != nil
+	}, "primary to become active")
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		w := httptest.NewRecorder()
+		require.NoError(t, fp.ServeHTTP(w, req, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	data, err := json.Marshal(fp.GetUpstreamStatus())
+	require.NoError(t, err)
+	var statuses []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &statuses))
+	require.Len(t, statuses, 2)
+
+	active := statuses[0]
+	assert.Equal(t, primary.URL, active["host"])
+	assert.Equal(t, float64(5), active["request_count"])
+	assert.Equal(t, float64(2), active["failed_requests"])
+	assert.Equal(t, float64(60), active["success_rate"])
+	// Local responses often average 0ms, which is omitted like other zero values
+	if avg := fp.GetActiveUpstreamMetrics().AvgResponseMs; avg > 0 {
+		assert.Equal(t, avg, active["avg_response_ms"])
+	} else {
+		assert.NotContains(t, active, "avg_response_ms")
+	}
+
+	// Only the active upstream carries metrics
+	for _, key := range []string{"request_count", "failed_requests", "avg_response_ms", "success_rate"} {
+		assert.NotContains(t, statuses[1], key)
+	}
+}
+
+// TestUpstreamStatusLastSuccess tests that the upstream serving a request
+// reports when it last did, and upstreams that served nothing don't
+func TestUpstreamStatusLastSuccess(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL})
+
+	before := time.Now()
+	w := httptest.NewRecorder()
+	require.NoError(t, fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/api", nil), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	data, err := json.Marshal(fp.GetUpstreamStatus())
+	require.NoError(t, err)
+	var statuses []UpstreamStatus
+	require.NoError(t, json.Unmarshal(data, &statuses))
+	require.Len(t, statuses, 2)
+
+	assert.False(t, statuses[0].LastSuccess.Before(before), "last_success should be set by the request")
+	assert.WithinDuration(t, time.Now(), statuses[0].LastSuccess, time.Second)
+	assert.True(t, statuses[1].LastSuccess.IsZero(), "backup served no requests")
 }
@@ -0,0 +1,170 @@
+package failover
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// defaultRewriteBodyLimit is how much of a response body is rewritten when a
+// rule doesn't set its own limit
+const defaultRewriteBodyLimit = 10 << 20
+
+// BodyURLRewrite rewrites absolute URLs pointing at an internal host in text
+// response bodies so clients can follow them
+type BodyURLRewrite struct {
+	// From is the internal host (and optional port) to replace
+	From string `json:"from"`
+
+	// To is the external host clients should use instead
+	To string `json:"to"`
+
+	// MaxSize is the number of body bytes rewritten; responses declaring a
+	// larger Content-Length are passed through untouched (default 10MB)
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+// isRewritableContentType reports whether a response body is text that may
+// contain URLs
+func isRewritableContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
+
+// bodyRewriterFor returns a writer rewriting the response body for the
+// upstream's rules, or nil when the response should be copied unchanged
+func (f *FailoverProxy) bodyRewriterFor(w io.Writer, resp *http.Response) *bodyRewriter {
+	if len(f.BodyURLRewrites) == 0 || resp.Header.Get("Content-Encoding") != "" ||
+		!isRewritableContentType(resp.Header.Get("Content-Type")) {
+		return nil
+	}
+
+	// Absolute and protocol-relative URLs both start with "//host"
+	var patterns, replacements [][]byte
+	limit := int64(0)
+	for _, rule := range f.BodyURLRewrites {
+		patterns = append(patterns, []byte("//"+rule.From))
+		replacements = append(replacements, []byte("//"+rule.To))
+		maxSize := rule.MaxSize
+		if maxSize <= 0 {
+			maxSize = defaultRewriteBodyLimit
+		}
+		if maxSize > limit {
+			limit = maxSize
+		}
+	}
+	if resp.ContentLength > limit {
+		return nil
+	}
+
+	return &bodyRewriter{w: w, patterns: patterns, replacements: replacements, remaining: limit}
+}
+
+// bodyRewriter streams a body to w, replacing patterns as it goes. Bytes that
+// could be the start of a pattern split across writes are held back until the
+// next write or Flush.
+type bodyRewriter struct {
+	w            io.Writer
+	patterns     [][]byte
+	replacements [][]byte
+	pending      []byte
+	remaining    int64 // bytes still to be rewritten before passing through
+}
+
+// Write rewrites and forwards p, holding back a possible partial match
+func (b *bodyRewriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.remaining <= 0 {
+		if err := b.Flush(); err != nil {
+			return 0, err
+		}
+		return b.w.Write(p)
+	}
+
+	// Bytes past the limit are forwarded untouched after the rewritten prefix
+	var rest []byte
+	if int64(len(p)) > b.remaining {
+		p, rest = p[:b.remaining], p[b.remaining:]
+	}
+	b.remaining -= int64(len(p))
+	b.pending = append(b.pending, p...)
+
+	if err := b.rewritePending(b.remaining > 0); err != nil {
+		return 0, err
+	}
+	if len(rest) > 0 {
+		if _, err := b.w.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes any held-back bytes
+func (b *bodyRewriter) Flush() error {
+	return b.rewritePending(false)
+}
+
+// rewritePending writes out pending bytes with patterns replaced. When holdTail
+// is set, a tail that could still grow into a match is kept for the next write.
+func (b *bodyRewriter) rewritePending(holdTail bool) error {
+	var out bytes.Buffer
+	data := b.pending
+	for {
+		idx, which := -1, -1
+		for i, pattern := range b.patterns {
+			if j := bytes.Index(data, pattern); j >= 0 && (idx < 0 || j < idx) {
+				idx, which = j, i
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		out.Write(data[:idx])
+		out.Write(b.replacements[which])
+		data = data[idx+len(b.patterns[which]):]
+	}
+
+	keep := 0
+	if holdTail {
+		keep = b.partialMatchLen(data)
+	}
+	out.Write(data[:len(data)-keep])
+	b.pending = append(b.pending[:0], data[len(data)-keep:]...)
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := b.w.Write(out.Bytes())
+	return err
+}
+
+// partialMatchLen returns the length of the longest suffix of data that is a
+// prefix of some pattern
+func (b *bodyRewriter) partialMatchLen(data []byte) int {
+	longest := 0
+	for _, pattern := range b.patterns {
+		for n := len(pattern) - 1; n > longest; n-- {
+			if n <= len(data) && bytes.HasSuffix(data, pattern[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
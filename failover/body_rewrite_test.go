@@ -0,0 +1,124 @@
+package failover
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestRewriteBodyURLs tests that internal URLs in an HTML response are rewritten to the external host
+func TestRewriteBodyURLs(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<a href="http://backup.internal:8080/page">page</a>`))
+		w.Write([]byte(`<img src="//backup.internal:8080/logo.png">`))
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.BodyURLRewrites = []BodyURLRewrite{{From: "backup.internal:8080", To: "www.example.com"}}
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://www.example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	expected := `<a href="http://www.example.com/page">page</a><img src="//www.example.com/logo.png">`
+	if w.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, w.Body.String())
+	}
+	if w.Header().Get("Content-Length") != "" {
+		t.Errorf("Expected Content-Length to be dropped, got %s", w.Header().Get("Content-Length"))
+	}
+}
+
+// TestRewriteBodyURLsSkipsBinary tests that non-text responses are passed through unchanged
+func TestRewriteBodyURLsSkipsBinary(t *testing.T) {
+	body := "//backup.internal/raw"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.BodyURLRewrites = []BodyURLRewrite{{From: "backup.internal", To: "www.example.com"}}
+	})
+
+	w := httptest.NewRecorder()
+	fp.ServeHTTP(w, httptest.NewRequest("GET", "http://www.example.com/", nil), nil)
+
+	if w.Body.String() != body {
+		t.Errorf("Expected binary body untouched, got %q", w.Body.String())
+	}
+}
+
+// TestBodyRewriterSplitWrites tests matches that straddle write boundaries and the size limit
+func TestBodyRewriterSplitWrites(t *testing.T) {
+	var out bytes.Buffer
+	rw := &bodyRewriter{
+		w:            &out,
+		patterns:     [][]byte{[]byte("//internal")},
+		replacements: [][]byte{[]byte("//external")},
+		remaining:    1 << 20,
+	}
+
+	input := `{"self":"https://internal/a","next":"https://internal/b"}`
+	for i := 0; i < len(input); i += 3 {
+		end := i + 3
+		if end > len(input) {
+			end = len(input)
+		}
+		rw.Write([]byte(input[i:end]))
+	}
+	rw.Flush()
+
+	expected := strings.ReplaceAll(input, "//internal", "//external")
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// Only the first bytes up to the limit are rewritten
+	out.Reset()
+	rw = &bodyRewriter{
+		w:            &out,
+		patterns:     [][]byte{[]byte("//internal")},
+		replacements: [][]byte{[]byte("//external")},
+		remaining:    int64(len("//internal ")),
+	}
+	rw.Write([]byte("//internal //internal"))
+	rw.Flush()
+	if out.String() != "//external //internal" {
+		t.Errorf("Expected rewriting to stop at the limit, got %q", out.String())
+	}
+}
+
+// TestParseRewriteBodyURLs tests parsing of the rewrite_body_urls subdirective
+func TestParseRewriteBodyURLs(t *testing.T) {
+	input := `failover_proxy http://a {
+		rewrite_body_urls backup.internal www.example.com
+		rewrite_body_urls api.internal:9000 api.example.com 1MB
+	}`
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(input)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rules := handler.(*FailoverProxy).BodyURLRewrites
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].From != "backup.internal" || rules[0].To != "www.example.com" || rules[0].MaxSize != 0 {
+		t.Errorf("Unexpected first rule: %+v", rules[0])
+	}
+	if rules[1].MaxSize != 1<<20 {
+		t.Errorf("Expected 1MB limit, got %d", rules[1].MaxSize)
+	}
+}
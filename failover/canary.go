@@ -0,0 +1,22 @@
+package failover
+
+import (
+	"math/rand"
+)
+
+// Canary sends a share of requests to an upstream outside the normal order,
+// such as a new release being rolled out
+type Canary struct {
+	// Upstream is the canary upstream URL; it must not be one of the proxy's
+	// upstreams
+	Upstream string `json:"upstream,omitempty"`
+
+	// Percent is the share of requests, from 0 to 100, tried on the canary
+	// first
+	Percent float64 `json:"percent,omitempty"`
+}
+
+// picked reports whether this request goes to the canary
+func (c *Canary) picked() bool {
+	return rand.Float64()*100 < c.Percent
+}
@@ -0,0 +1,162 @@
+package failover
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestCanary tests that about the configured percentage of requests reach
+// the canary and the rest the primary
+func TestCanary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("canary"))
+	}))
+	defer canary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL}, func(fp *FailoverProxy) {
+		fp.Canary = &Canary{Upstream: canary.URL, Percent: 20}
+	})
+
+	const requests = 2000
+	counts := make(map[string]int)
+	for i := 0; i < requests; i++ {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		body, _ := io.ReadAll(w.Result().Body)
+		counts[string(body)]++
+	}
+
+	if counts["canary"]+counts["primary"] != requests {
+		t.Fatalf("Expected every request to reach canary or primary, got %v", counts)
+	}
+	// 20% of 2000 is 400; allow for randomness
+	if counts["canary"] < 300 || counts["canary"] > 500 {
+		t.Errorf("Expected about 400 canary requests, got %d", counts["canary"])
+	}
+}
+
+// TestCanaryFailover tests that requests picked for a failing canary fail
+// over to the normal order
+func TestCanaryFailover(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	canary := newDownUpstreams(t, 1)[0]
+
+	fp := CreateTestProxy(t, []string{primary.URL}, func(fp *FailoverProxy) {
+		fp.Canary = &Canary{Upstream: canary, Percent: 100}
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	if body, _ := io.ReadAll(w.Result().Body); string(body) != "primary" {
+		t.Errorf("Expected failover to primary, got %d %q", w.Code, body)
+	}
+}
+
+// TestCanaryValidation tests that Provision rejects invalid canaries
+func TestCanaryValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		canary *Canary
+		want   string
+	}{
+		{"in upstream list", &Canary{Upstream: "http://a.local", Percent: 10}, "also in the upstream list"},
+		{"bad url", &Canary{Upstream: "a.local", Percent: 10}, "invalid canary upstream"},
+		{"percent over 100", &Canary{Upstream: "http://c.local", Percent: 120}, "invalid canary percent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := &FailoverProxy{Upstreams: []string{"http://a.local"}, Canary: tt.canary}
+			err := fp.Provision(caddy.Context{})
+			if err == nil {
+				fp.Cleanup()
+				t.Fatal("Expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestParseCanary tests parsing the canary subdirective
+func TestParseCanary(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`failover_proxy http://a.local {
+		canary http://c.local 5%
+	}`)
+	handler, err := parseFailoverProxy(httpcaddyfile.Helper{Dispenser: d})
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	if fp.Canary == nil || fp.Canary.Upstream != "http://c.local" || fp.Canary.Percent != 5 {
+		t.Errorf("Expected canary http://c.local at 5%%, got %+v", fp.Canary)
+	}
+
+	for _, input := range []string{
+		`failover_proxy http://a.local {
+			canary http://c.local
+		}`,
+		`failover_proxy http://a.local {
+			canary http://c.local 101
+		}`,
+		`failover_proxy http://a.local {
+			canary http://c.local ten
+		}`,
+	} {
+		d := caddyfile.NewTestDispenser(input)
+		if _, err := parseFailoverProxy(httpcaddyfile.Helper{Dispenser: d}); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+// TestCanaryFailoverBody tests that a POST failing on the canary reaches the
+// primary with its body when it is the only other upstream
+func TestCanaryFailoverBody(t *testing.T) {
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer canary.Close()
+	var received string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}))
+	defer primary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL}, func(fp *FailoverProxy) {
+		fp.Canary = &Canary{Upstream: canary.URL, Percent: 100}
+		fp.BufferRequests = true
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(`{"a":1}`))
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected failover to the primary, got %d", w.Code)
+	}
+	if received != `{"a":1}` {
+		t.Errorf("Expected the primary to receive the body, got %q", received)
+	}
+}
@@ -0,0 +1,160 @@
+package failover
+
+import (
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// Circuit breaker states reported by GetUpstreamStatus
+const (
+	circuitClosed   = "CLOSED"
+	circuitOpen     = "OPEN"
+	circuitHalfOpen = "HALF_OPEN"
+)
+
+// CircuitBreaker configures a per-upstream circuit breaker that replaces the
+// single-failure timeout of fail_duration
+type CircuitBreaker struct {
+	// Failures is how many consecutive failures open the circuit (default 5)
+	Failures int `json:"failures,omitempty"`
+
+	// Cooldown is how long an open circuit rejects requests (default FailDuration)
+	Cooldown caddy.Duration `json:"cooldown,omitempty"`
+
+	// HalfOpenRequests is how many trial requests must succeed after the
+	// cooldown before the circuit closes again (default 1)
+	HalfOpenRequests int `json:"half_open_requests,omitempty"`
+}
+
+// circuitState is the runtime breaker state of one upstream
+type circuitState struct {
+	state    string
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the circuit last opened
+	trials   int       // trial requests admitted while half-open
+	passed   int       // trial requests that succeeded while half-open
+}
+
+// circuitFor returns the breaker state of an upstream, creating it closed.
+// Must be called with lock held.
+func (f *FailoverProxy) circuitFor(upstreamURL string) *circuitState {
+	cs, exists := f.circuits[upstreamURL]
+	if !exists {
+		cs = &circuitState{state: circuitClosed}
+		f.circuits[upstreamURL] = cs
+	}
+	return cs
+}
+
+// circuitStateOf reports the state of an upstream's circuit, treating an open
+// circuit whose cooldown has passed as half-open. Must be called with lock held.
+func (f *FailoverProxy) circuitStateOf(upstreamURL string) string {
+	cs, exists := f.circuits[upstreamURL]
+	if !exists {
+		return circuitClosed
+	}
+	if cs.state == circuitOpen && time.Since(cs.openedAt) >= time.Duration(f.CircuitBreaker.Cooldown) {
+		return circuitHalfOpen
+	}
+	return cs.state
+}
+
+// circuitRejects reports whether the circuit would turn a request away, without
+// admitting it. Must be called with lock held.
+func (f *FailoverProxy) circuitRejects(upstreamURL string) bool {
+	switch f.circuitStateOf(upstreamURL) {
+	case circuitOpen:
+		return true
+	case circuitHalfOpen:
+		cs, exists := f.circuits[upstreamURL]
+		return exists && cs.state == circuitHalfOpen && cs.trials >= f.CircuitBreaker.HalfOpenRequests
+	}
+	return false
+}
+
+// circuitAllow admits a request to the upstream, moving an open circuit to
+// half-open once its cooldown has passed and counting half-open trials
+func (f *FailoverProxy) circuitAllow(upstreamURL string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cs := f.circuitFor(upstreamURL)
+	if cs.state == circuitOpen {
+		if time.Since(cs.openedAt) < time.Duration(f.CircuitBreaker.Cooldown) {
+			return false
+		}
+		cs.state = circuitHalfOpen
+		cs.trials = 0
+		cs.passed = 0
+		f.logger.Info("circuit half-open, allowing trial requests",
+			zap.String("upstream", upstreamURL),
+			zap.Int("trials", f.CircuitBreaker.HalfOpenRequests))
+		f.notifyStatusChange()
+	}
+	if cs.state == circuitHalfOpen {
+		if cs.trials >= f.CircuitBreaker.HalfOpenRequests {
+			return false
+		}
+		cs.trials++
+	}
+	return true
+}
+
+// circuitRecord applies the outcome of a request to the upstream's circuit.
+// Must be called with lock held.
+func (f *FailoverProxy) circuitRecord(upstreamURL string, success bool) {
+	cs := f.circuitFor(upstreamURL)
+	switch cs.state {
+	case circuitClosed:
+		if success {
+			cs.failures = 0
+			return
+		}
+		cs.failures++
+		if cs.failures >= f.CircuitBreaker.Failures {
+			f.openCircuit(upstreamURL, cs)
+		}
+
+	case circuitHalfOpen:
+		if !success {
+			f.openCircuit(upstreamURL, cs)
+			return
+		}
+		cs.passed++
+		if cs.passed >= f.CircuitBreaker.HalfOpenRequests {
+			cs.state = circuitClosed
+			cs.failures = 0
+			f.logger.Info("circuit closed",
+				zap.String("upstream", upstreamURL))
+			f.notifyStatusChange()
+		}
+	}
+}
+
+// openCircuit starts rejecting requests to the upstream for the cooldown.
+// Must be called with lock held.
+func (f *FailoverProxy) openCircuit(upstreamURL string, cs *circuitState) {
+	cs.state = circuitOpen
+	cs.openedAt = time.Now()
+	cs.failures = 0
+	f.logger.Warn("circuit opened",
+		zap.String("upstream", upstreamURL),
+		zap.Duration("cooldown", time.Duration(f.CircuitBreaker.Cooldown)))
+	f.notifyStatusChange()
+}
+
+// upstreamFailed reports whether recent failures keep the upstream out of
+// rotation, judged by passive health and then by the circuit breaker when
+// configured or by the failure cache otherwise. Must be called with lock held.
+func (f *FailoverProxy) upstreamFailed(upstreamURL string) bool {
+	if f.passivelyDown(upstreamURL) {
+		return true
+	}
+	if f.CircuitBreaker != nil {
+		return f.circuitRejects(upstreamURL)
+	}
+	lastFail, failed := f.failureCache[upstreamURL]
+	return failed && time.Since(lastFail) < f.failDurationFor(upstreamURL)
+}
@@ -0,0 +1,164 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"go.uber.org/zap"
+)
+
+// newCircuitTestProxy creates a proxy with a controlled primary and the circuit breaker
+func newCircuitTestProxy(t *testing.T, cb *CircuitBreaker) (fp *FailoverProxy, primaryURL string, primaryStatus, primaryHits *int32) {
+	return CreateControlledPrimaryProxy(t, func(fp *FailoverProxy) {
+		fp.CircuitBreaker = cb
+	})
+}
+
+// serveOnce sends one GET through the proxy and checks it succeeded
+func serveOnce(t *testing.T, fp *FailoverProxy) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+}
+
+// TestCircuitBreakerTransitions tests the closed -> open -> half-open -> closed cycle
+func TestCircuitBreakerTransitions(t *testing.T) {
+	fp, primaryURL, primaryStatus, primaryHits := newCircuitTestProxy(t, &CircuitBreaker{
+		Failures:         2,
+		Cooldown:         caddy.Duration(50 * time.Millisecond),
+		HalfOpenRequests: 2,
+	})
+
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitClosed {
+		t.Fatalf("Expected initial state %s, got %s", circuitClosed, got)
+	}
+
+	// A single failure doesn't take the primary out of rotation
+	serveOnce(t, fp)
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitClosed {
+		t.Errorf("Expected %s after one failure, got %s", circuitClosed, got)
+	}
+	serveOnce(t, fp)
+	if atomic.LoadInt32(primaryHits) != 2 {
+		t.Errorf("Expected primary to be tried again while closed, got %d hits", atomic.LoadInt32(primaryHits))
+	}
+
+	// The second consecutive failure opens the circuit
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitOpen {
+		t.Fatalf("Expected %s after two failures, got %s", circuitOpen, got)
+	}
+	serveOnce(t, fp)
+	if atomic.LoadInt32(primaryHits) != 2 {
+		t.Errorf("Expected open circuit to reject requests, got %d hits", atomic.LoadInt32(primaryHits))
+	}
+	if status := fp.GetUpstreamStatus()[0]; status.Status != "DOWN" {
+		t.Errorf("Expected open upstream to be DOWN, got %s", status.Status)
+	}
+
+	// After the cooldown, trial requests are let through
+	time.Sleep(60 * time.Millisecond)
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitHalfOpen {
+		t.Fatalf("Expected %s after cooldown, got %s", circuitHalfOpen, got)
+	}
+	atomic.StoreInt32(primaryStatus, http.StatusOK)
+
+	serveOnce(t, fp)
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitHalfOpen {
+		t.Errorf("Expected %s until all trials pass, got %s", circuitHalfOpen, got)
+	}
+	serveOnce(t, fp)
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitClosed {
+		t.Errorf("Expected %s after trials passed, got %s", circuitClosed, got)
+	}
+	if atomic.LoadInt32(primaryHits) != 4 {
+		t.Errorf("Expected 4 primary hits, got %d", atomic.LoadInt32(primaryHits))
+	}
+}
+
+// TestCircuitBreakerHalfOpenFailure tests that a failed trial request reopens the circuit
+func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
+	fp, primaryURL, _, primaryHits := newCircuitTestProxy(t, &CircuitBreaker{
+		Failures: 1,
+		Cooldown: caddy.Duration(50 * time.Millisecond),
+	})
+
+	serveOnce(t, fp)
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitOpen {
+		t.Fatalf("Expected %s after failure, got %s", circuitOpen, got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	serveOnce(t, fp)
+	if got := UpstreamStatusOf(t, fp, primaryURL).Circuit; got != circuitOpen {
+		t.Errorf("Expected failed trial to reopen the circuit, got %s", got)
+	}
+
+	serveOnce(t, fp)
+	if atomic.LoadInt32(primaryHits) != 2 {
+		t.Errorf("Expected reopened circuit to reject requests, got %d hits", atomic.LoadInt32(primaryHits))
+	}
+}
+
+// TestCircuitBreakerHalfOpenLimit tests that only half_open_requests trials are admitted at once
+func TestCircuitBreakerHalfOpenLimit(t *testing.T) {
+	fp := &FailoverProxy{
+		CircuitBreaker: &CircuitBreaker{Failures: 1, Cooldown: caddy.Duration(time.Millisecond), HalfOpenRequests: 2},
+		circuits:       make(map[string]*circuitState),
+		logger:         zap.NewNop(),
+	}
+
+	fp.mu.Lock()
+	fp.circuitRecord("http://a", false)
+	fp.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	if !fp.circuitAllow("http://a") || !fp.circuitAllow("http://a") {
+		t.Fatal("Expected two trial requests to be admitted")
+	}
+	if fp.circuitAllow("http://a") {
+		t.Error("Expected a third concurrent trial to be rejected")
+	}
+}
+
+// TestParseCircuitBreaker tests parsing the circuit_breaker block
+func TestParseCircuitBreaker(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		circuit_breaker {
+			failures 3
+			cooldown 10s
+			half_open_requests 2
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	cb := handler.(*FailoverProxy).CircuitBreaker
+	if cb == nil {
+		t.Fatal("Expected circuit breaker to be configured")
+	}
+	if cb.Failures != 3 || time.Duration(cb.Cooldown) != 10*time.Second || cb.HalfOpenRequests != 2 {
+		t.Errorf("Unexpected circuit breaker config: %+v", cb)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		circuit_breaker {
+			failures 0
+		}
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected error for zero failures")
+	}
+}
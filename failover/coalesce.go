@@ -0,0 +1,217 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// coalesceVaryHeaders are the request headers that commonly change the
+// representation an upstream returns, so they form part of the coalescing key
+var coalesceVaryHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// coalesceBufferLimit caps how much of a response is kept to hand to requests
+// that joined its fetch; larger responses are proxied by each request itself
+const coalesceBufferLimit = 1 << 20
+
+// coalesceCall is an in-flight upstream fetch that identical requests may join
+type coalesceCall struct {
+	decided chan struct{}      // closed once the leader's response headers are known
+	done    chan struct{}      // closed once the leader's response is complete
+	shared  bool               // set before decided is closed
+	resp    *coalescedResponse // set before done is closed, nil if it can't be shared
+}
+
+// wait returns the leader's response, or nil if the caller must proxy the
+// request itself because the response can't be shared
+func (c *coalesceCall) wait(ctx context.Context) (*coalescedResponse, error) {
+	select {
+	case <-c.decided:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !c.shared {
+		return nil, nil
+	}
+	select {
+	case <-c.done:
+		return c.resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// coalescedResponse is a buffered upstream response shared by every request
+// that joined the same in-flight fetch
+type coalescedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// writeTo replays the buffered response to one client
+func (c *coalescedResponse) writeTo(w http.ResponseWriter) error {
+	for name, values := range c.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(c.status)
+	_, err := w.Write(c.body.Bytes())
+	return err
+}
+
+// coalesceWriter streams the leader's response to its own client while
+// keeping a copy for the requests waiting on it. Unwrap keeps flushing working
+// through http.ResponseController.
+type coalesceWriter struct {
+	http.ResponseWriter
+	call        *coalesceCall
+	resp        *coalescedResponse // nil once the response can't be shared
+	wroteHeader bool
+}
+
+func (cw *coalesceWriter) WriteHeader(status int) {
+	// Informational responses such as 100 Continue precede the real status
+	if status >= 200 {
+		switch {
+		case cw.wroteHeader:
+			// A second final status means a failed attempt was followed by another
+			cw.resp = nil
+		case isShareableResponse(cw.Header(), status):
+			cw.resp.status = status
+			cw.resp.header = cw.Header().Clone()
+			cw.call.shared = true
+		default:
+			cw.resp = nil
+		}
+		if !cw.wroteHeader {
+			cw.wroteHeader = true
+			close(cw.call.decided)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *coalesceWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.resp != nil {
+		if cw.resp.body.Len()+len(p) > coalesceBufferLimit {
+			cw.resp = nil
+		} else {
+			cw.resp.body.Write(p)
+		}
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *coalesceWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// isShareableResponse reports whether a response may be handed to clients
+// other than the one it was fetched for: it must not set cookies, be marked
+// private or uncacheable, vary on everything, or stream indefinitely
+func isShareableResponse(header http.Header, status int) bool {
+	if len(header.Values("Set-Cookie")) > 0 || header.Get("Vary") == "*" {
+		return false
+	}
+	cacheControl := strings.ToLower(strings.Join(header.Values("Cache-Control"), ","))
+	if strings.Contains(cacheControl, "private") || strings.Contains(cacheControl, "no-store") {
+		return false
+	}
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType == "text/event-stream" {
+		return false
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length > coalesceBufferLimit {
+		return false
+	}
+	return status != http.StatusSwitchingProtocols
+}
+
+// isCoalescable reports whether a request may share its response with other
+// identical requests. Only bodiless GETs without credentials qualify, and
+// clients asking to bypass caches are always sent upstream themselves.
+func isCoalescable(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if r.ContentLength > 0 || len(r.TransferEncoding) > 0 {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return false
+	}
+	cacheControl := strings.ToLower(r.Header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-cache") && !strings.Contains(cacheControl, "no-store")
+}
+
+// coalesceKey identifies requests that would receive the same response
+func coalesceKey(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.RequestURI())
+	// A request looping back through this proxy must not wait on itself
+	fmt.Fprintf(&b, " hops=%d", requestHops(r))
+	for _, name := range coalesceVaryHeaders {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// serveCoalesced proxies the request once for all concurrent identical
+// requests. The first request streams its response as usual; the others wait
+// for it and replay it, or proxy the request themselves if it can't be shared.
+func (f *FailoverProxy) serveCoalesced(w http.ResponseWriter, r *http.Request) error {
+	key := coalesceKey(r)
+	f.coalesceMu.Lock()
+	if call, ok := f.coalesceCalls[key]; ok {
+		f.coalesceMu.Unlock()
+		resp, err := call.wait(r.Context())
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			return f.serveUpstreams(w, r)
+		}
+		f.logger.Debug("coalesced request with identical in-flight request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path))
+		return resp.writeTo(w)
+	}
+	if f.coalesceCalls == nil {
+		f.coalesceCalls = make(map[string]*coalesceCall)
+	}
+	call := &coalesceCall{decided: make(chan struct{}), done: make(chan struct{})}
+	f.coalesceCalls[key] = call
+	f.coalesceMu.Unlock()
+
+	cw := &coalesceWriter{ResponseWriter: w, call: call, resp: &coalescedResponse{}}
+	err := f.serveUpstreams(cw, r)
+
+	f.coalesceMu.Lock()
+	delete(f.coalesceCalls, key)
+	f.coalesceMu.Unlock()
+
+	// Only a complete response can be replayed; the leader's client going away
+	// or a failed fetch leaves the others to proxy for themselves
+	if err == nil && r.Context().Err() == nil {
+		call.resp = cw.resp
+	}
+	if !cw.wroteHeader {
+		close(call.decided)
+	}
+	close(call.done)
+	return err
+}
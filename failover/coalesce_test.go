@@ -0,0 +1,218 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCoalesceIdenticalRequests tests that concurrent identical GETs share one upstream request
+func TestCoalesceIdenticalRequests(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("X-Upstream", "backup")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("shared body"))
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, WithResponseTimeout(5*time.Second), func(fp *FailoverProxy) {
+		fp.Coalesce = true
+	})
+
+	const clients = 20
+	recorders := make([]*httptest.ResponseRecorder, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/data?id=1", nil), nil); err != nil {
+				t.Errorf("ServeHTTP error: %v", err)
+			}
+		}(recorders[i])
+	}
+
+	// Hold the upstream until every client has had time to join the fetch
+	WaitForCondition(t, 2*time.Second, 5*time.Millisecond, func() bool {
+		return atomic.LoadInt32(&hits) > 0
+	}, "upstream never received the request")
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("Expected upstream to see 1 request, got %d", got)
+	}
+	for i, w := range recorders {
+		if w.Code != http.StatusOK || w.Body.String() != "shared body" || w.Header().Get("X-Upstream") != "backup" {
+			t.Errorf("Client %d got status %d body %q header %q", i, w.Code, w.Body.String(), w.Header().Get("X-Upstream"))
+		}
+	}
+}
+
+// TestCoalesceEligibility tests which requests may share a response
+func TestCoalesceEligibility(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   bool
+	}{
+		{"plain GET", "GET", nil, true},
+		{"POST", "POST", nil, false},
+		{"authorized", "GET", map[string]string{"Authorization": "Bearer token"}, false},
+		{"with cookie", "GET", map[string]string{"Cookie": "session=abc"}, false},
+		{"no-cache", "GET", map[string]string{"Cache-Control": "no-cache"}, false},
+		{"max-age", "GET", map[string]string{"Cache-Control": "max-age=0"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com/", nil)
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			if got := isCoalescable(r); got != tt.want {
+				t.Errorf("isCoalescable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCoalesceKeyVaryHeaders tests that requests differing in negotiated headers are kept apart
+func TestCoalesceKeyVaryHeaders(t *testing.T) {
+	a := httptest.NewRequest("GET", "http://example.com/data", nil)
+	b := httptest.NewRequest("GET", "http://example.com/data", nil)
+	if coalesceKey(a) != coalesceKey(b) {
+		t.Error("Expected identical requests to share a key")
+	}
+
+	b.Header.Set("Accept-Encoding", "gzip")
+	if coalesceKey(a) == coalesceKey(b) {
+		t.Error("Expected different Accept-Encoding to produce different keys")
+	}
+
+	c := httptest.NewRequest("GET", "http://example.com/data?page=2", nil)
+	if coalesceKey(a) == coalesceKey(c) {
+		t.Error("Expected different queries to produce different keys")
+	}
+}
+
+// TestShareableResponse tests which upstream responses may be handed to other clients
+func TestShareableResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   bool
+	}{
+		{"plain", map[string]string{"Content-Type": "application/json"}, true},
+		{"public cache", map[string]string{"Cache-Control": "public, max-age=60"}, true},
+		{"sets cookie", map[string]string{"Set-Cookie": "session=abc"}, false},
+		{"private", map[string]string{"Cache-Control": "private, max-age=60"}, false},
+		{"no-store", map[string]string{"Cache-Control": "no-store"}, false},
+		{"vary everything", map[string]string{"Vary": "*"}, false},
+		{"event stream", map[string]string{"Content-Type": "text/event-stream; charset=utf-8"}, false},
+		{"too large", map[string]string{"Content-Length": "2097152"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			for name, value := range tt.header {
+				header.Set(name, value)
+			}
+			if got := isShareableResponse(header, http.StatusOK); got != tt.want {
+				t.Errorf("isShareableResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCoalesceUnshareableFallsBack tests that clients waiting on a response that
+// can't be shared proxy the request themselves
+func TestCoalesceUnshareableFallsBack(t *testing.T) {
+	large := strings.Repeat("x", coalesceBufferLimit+1)
+	tests := []struct {
+		name  string
+		write func(w http.ResponseWriter)
+		body  string
+	}{
+		{
+			name: "sets cookie",
+			write: func(w http.ResponseWriter) {
+				w.Header().Set("Set-Cookie", "session=abc")
+				w.Write([]byte("personal"))
+			},
+			body: "personal",
+		},
+		{
+			name: "over buffer limit",
+			write: func(w http.ResponseWriter) {
+				// Flushing first leaves the length unknown until the body ends
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				w.Write([]byte(large))
+			},
+			body: large,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			release := make(chan struct{})
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+				<-release
+				tt.write(w)
+			}))
+			defer upstream.Close()
+
+			fp := CreateTestProxy(t, []string{upstream.URL}, WithResponseTimeout(5*time.Second), func(fp *FailoverProxy) {
+				fp.Coalesce = true
+			})
+
+			const clients = 5
+			recorders := make([]*httptest.ResponseRecorder, clients)
+			var wg sync.WaitGroup
+			for i := 0; i < clients; i++ {
+				recorders[i] = httptest.NewRecorder()
+				wg.Add(1)
+				go func(w *httptest.ResponseRecorder) {
+					defer wg.Done()
+					if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/me", nil), nil); err != nil {
+						t.Errorf("ServeHTTP error: %v", err)
+					}
+				}(recorders[i])
+			}
+
+			WaitForCondition(t, 2*time.Second, 5*time.Millisecond, func() bool {
+				return atomic.LoadInt32(&hits) > 0
+			}, "upstream never received the request")
+			time.Sleep(100 * time.Millisecond)
+			if got := atomic.LoadInt32(&hits); got != 1 {
+				t.Fatalf("Expected identical requests to wait on one fetch, got %d", got)
+			}
+			close(release)
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&hits); got != clients {
+				t.Errorf("Expected every client to fetch for itself, got %d upstream requests", got)
+			}
+			for i, w := range recorders {
+				if w.Code != http.StatusOK || w.Body.String() != tt.body {
+					t.Errorf("Client %d got status %d and %d body bytes", i, w.Code, w.Body.Len())
+				}
+			}
+		})
+	}
+}
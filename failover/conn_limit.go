@@ -0,0 +1,29 @@
+package failover
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// withConnWait bounds how long a request may queue for one of the limited
+// connections to an upstream. The returned flag is set if the wait ran out
+// before a connection was obtained, in which case the context is cancelled.
+func withConnWait(ctx context.Context, wait time.Duration) (context.Context, *atomic.Bool, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	exceeded := &atomic.Bool{}
+	timer := time.AfterFunc(wait, func() {
+		exceeded.Store(true)
+		cancel()
+	})
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			timer.Stop()
+		},
+	})
+	return ctx, exceeded, func() {
+		timer.Stop()
+		cancel()
+	}
+}
@@ -0,0 +1,111 @@
+package failover
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// connCountingServer starts a server that tracks its peak number of open connections
+func connCountingServer(handler http.HandlerFunc) (*httptest.Server, *int32) {
+	var open, peak int32
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			n := atomic.AddInt32(&open, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&open, -1)
+		}
+	}
+	server.Start()
+	return server, &peak
+}
+
+// TestMaxConnsPerHostLimitsConnections tests that concurrent requests share the capped connections
+func TestMaxConnsPerHostLimitsConnections(t *testing.T) {
+	server, peak := connCountingServer(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL}, func(fp *FailoverProxy) {
+		fp.MaxConnsPerHost = 2
+		fp.MaxConnsWait = caddy.Duration(5 * time.Second)
+	})
+
+	const clients = 10
+	var wg sync.WaitGroup
+	var failures int32
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil || w.Code != http.StatusOK {
+				atomic.AddInt32(&failures, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failures != 0 {
+		t.Errorf("Expected all queued requests to succeed, %d failed", failures)
+	}
+	if got := atomic.LoadInt32(peak); got > 2 {
+		t.Errorf("Expected at most 2 connections to the upstream, saw %d", got)
+	}
+}
+
+// TestMaxConnsWaitFailsOver tests that a request queued past the wait fails over
+func TestMaxConnsWaitFailsOver(t *testing.T) {
+	release := make(chan struct{})
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer busy.Close()
+	defer close(release)
+
+	var backupHits int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{busy.URL, backup.URL}, WithResponseTimeout(5*time.Second), func(fp *FailoverProxy) {
+		fp.MaxConnsPerHost = 1
+		fp.MaxConnsWait = caddy.Duration(50 * time.Millisecond)
+	})
+
+	// Occupy the only connection to the primary
+	go fp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/slow", nil), nil)
+	time.Sleep(50 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK || atomic.LoadInt32(&backupHits) != 1 {
+		t.Errorf("Expected backup to serve the queued request, got status %d and %d backup hits", w.Code, backupHits)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected failover after the connection wait, took %v", elapsed)
+	}
+}
@@ -0,0 +1,80 @@
+package failover
+
+import (
+	"net/http"
+	"strings"
+)
+
+// defaultCookiePrefix namespaces cookies set by the proxy itself so they can't
+// collide with cookies set by upstreams
+const defaultCookiePrefix = "failover_"
+
+// cookieKey identifies a cookie the way browsers do: by name, domain and path
+func cookieKey(c *http.Cookie) string {
+	return c.Name + ";" + strings.ToLower(c.Domain) + ";" + c.Path
+}
+
+// parseSetCookie parses a single Set-Cookie header value
+func parseSetCookie(line string) *http.Cookie {
+	cookies := (&http.Response{Header: http.Header{"Set-Cookie": {line}}}).Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+	return cookies[0]
+}
+
+// copyResponseHeaders copies upstream response headers to the client response,
+// collapsing Set-Cookie headers for the same cookie so only the last one is sent
+func copyResponseHeaders(dst, src http.Header) {
+	for name, values := range src {
+		if http.CanonicalHeaderKey(name) == "Set-Cookie" {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(name, value)
+		}
+	}
+	for _, line := range src.Values("Set-Cookie") {
+		addSetCookie(dst, line)
+	}
+}
+
+// addSetCookie appends a Set-Cookie header, replacing any existing header that
+// sets the same cookie
+func addSetCookie(h http.Header, line string) {
+	c := parseSetCookie(line)
+	if c == nil {
+		h.Add("Set-Cookie", line)
+		return
+	}
+
+	key := cookieKey(c)
+	existing := h.Values("Set-Cookie")
+	merged := make([]string, 0, len(existing)+1)
+	for _, prev := range existing {
+		if pc := parseSetCookie(prev); pc != nil && cookieKey(pc) == key {
+			continue
+		}
+		merged = append(merged, prev)
+	}
+	h["Set-Cookie"] = append(merged, line)
+}
+
+// proxyCookieName returns the namespaced name of a cookie owned by the proxy
+func (f *FailoverProxy) proxyCookieName(name string) string {
+	if f.CookiePrefix == "" {
+		return defaultCookiePrefix + name
+	}
+	return f.CookiePrefix + name
+}
+
+// setProxyCookie sets a cookie owned by the proxy on the response. Its name is
+// namespaced with the cookie prefix and it replaces any upstream cookie that
+// happens to use the same name, domain and path.
+func (f *FailoverProxy) setProxyCookie(h http.Header, c *http.Cookie) {
+	namespaced := *c
+	namespaced.Name = f.proxyCookieName(c.Name)
+	if line := namespaced.String(); line != "" {
+		addSetCookie(h, line)
+	}
+}
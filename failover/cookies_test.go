@@ -0,0 +1,75 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSetCookieMerging tests that upstream and proxy cookies both survive without duplication
+func TestSetCookieMerging(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The same cookie set twice, plus one using the proxy's namespaced name
+		w.Header().Add("Set-Cookie", "session=old; Path=/")
+		w.Header().Add("Set-Cookie", "theme=dark; Path=/")
+		w.Header().Add("Set-Cookie", "session=new; Path=/")
+		w.Header().Add("Set-Cookie", "lb_upstream=spoofed; Path=/")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.CookiePrefix = "lb_"
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.tryUpstream(w, httptest.NewRequest("GET", "http://example.com/", nil), upstream.URL); err != nil {
+		t.Fatalf("tryUpstream error: %v", err)
+	}
+	fp.setProxyCookie(w.Header(), &http.Cookie{Name: "upstream", Value: "primary", Path: "/"})
+
+	counts := make(map[string]int)
+	values := make(map[string]string)
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		counts[c.Name]++
+		values[c.Name] = c.Value
+	}
+
+	for name, count := range counts {
+		if count != 1 {
+			t.Errorf("Expected cookie %s once, got %d", name, count)
+		}
+	}
+	if values["session"] != "new" {
+		t.Errorf("Expected last session cookie to win, got %q", values["session"])
+	}
+	if values["theme"] != "dark" {
+		t.Errorf("Expected theme cookie to survive, got %q", values["theme"])
+	}
+	if values["lb_upstream"] != "primary" {
+		t.Errorf("Expected proxy cookie to own its namespaced name, got %q", values["lb_upstream"])
+	}
+}
+
+// TestSetCookieDistinctPaths tests that cookies with the same name but different paths are kept
+func TestSetCookieDistinctPaths(t *testing.T) {
+	src := http.Header{}
+	src.Add("Set-Cookie", "id=1; Path=/a")
+	src.Add("Set-Cookie", "id=2; Path=/b")
+	src.Add("Set-Cookie", "not a cookie")
+
+	dst := http.Header{}
+	copyResponseHeaders(dst, src)
+
+	if got := len(dst.Values("Set-Cookie")); got != 3 {
+		t.Errorf("Expected 3 Set-Cookie headers, got %d: %v", got, dst.Values("Set-Cookie"))
+	}
+}
+
+// TestProxyCookieNameDefault tests the default cookie namespace
+func TestProxyCookieNameDefault(t *testing.T) {
+	fp := &FailoverProxy{}
+	if got := fp.proxyCookieName("upstream"); got != "failover_upstream" {
+		t.Errorf("Expected failover_upstream, got %s", got)
+	}
+}
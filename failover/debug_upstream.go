@@ -0,0 +1,54 @@
+package failover
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// debugRedactedHeaders are never logged verbatim by debug_upstream
+var debugRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactHeaders returns a copy of the headers safe to write to logs
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range debugRedactedHeaders {
+		if _, ok := redacted[name]; ok {
+			redacted[name] = []string{"REDACTED"}
+		}
+	}
+	return redacted
+}
+
+// logUpstreamRequest records the outgoing request to a debug_upstream upstream
+func (f *FailoverProxy) logUpstreamRequest(upstreamURL string, req *http.Request) {
+	if !f.debugUpstreams[upstreamURL] {
+		return
+	}
+	f.logger.Info("debug upstream request",
+		zap.String("upstream", upstreamURL),
+		zap.String("method", req.Method),
+		zap.String("target_url", req.URL.String()),
+		zap.Any("headers", redactHeaders(req.Header)))
+}
+
+// logUpstreamResponse records the outcome of a request to a debug_upstream upstream
+func (f *FailoverProxy) logUpstreamResponse(upstreamURL string, resp *http.Response, err error, elapsed time.Duration) {
+	if !f.debugUpstreams[upstreamURL] {
+		return
+	}
+	if err != nil {
+		f.logger.Info("debug upstream request failed",
+			zap.String("upstream", upstreamURL),
+			zap.Duration("elapsed", elapsed),
+			zap.Error(err))
+		return
+	}
+	f.logger.Info("debug upstream response",
+		zap.String("upstream", upstreamURL),
+		zap.Int("status", resp.StatusCode),
+		zap.String("proto", resp.Proto),
+		zap.Duration("elapsed", elapsed),
+		zap.Any("headers", redactHeaders(resp.Header)))
+}
@@ -0,0 +1,64 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestDebugUpstreamLogsOnlyTarget tests that verbose logging is limited to the debug_upstream upstream
+func TestDebugUpstreamLogsOnlyTarget(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backup", "yes")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.DebugUpstreams = []string{backup.URL}
+	})
+	core, logs := observer.New(zapcore.InfoLevel)
+	fp.logger = zap.New(core)
+
+	req := httptest.NewRequest("GET", "http://example.com/api", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	requests := logs.FilterMessage("debug upstream request").All()
+	responses := logs.FilterMessage("debug upstream response").All()
+	if len(requests) != 1 || len(responses) != 1 {
+		t.Fatalf("Expected one verbose request and response entry, got %d and %d", len(requests), len(responses))
+	}
+	for _, entry := range append(requests, responses...) {
+		if got := entry.ContextMap()["upstream"]; got != backup.URL {
+			t.Errorf("Expected verbose entry for %s only, got %v", backup.URL, got)
+		}
+	}
+
+	if status := responses[0].ContextMap()["status"]; status != int64(http.StatusOK) {
+		t.Errorf("Expected logged status 200, got %v", status)
+	}
+	headers := requests[0].ContextMap()["headers"].(http.Header)
+	if got := headers.Get("Authorization"); got != "REDACTED" {
+		t.Errorf("Expected Authorization to be redacted, got %q", got)
+	}
+
+	if n := logs.FilterField(zap.String("upstream", primary.URL)).FilterMessageSnippet("debug upstream").Len(); n != 0 {
+		t.Errorf("Expected no verbose entries for the primary, got %d", n)
+	}
+}
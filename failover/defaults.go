@@ -0,0 +1,73 @@
+package failover
+
+import (
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// ProxyDefaults are set by the failover_proxy global option and written into
+// every failover_proxy directive that leaves the field unset
+type ProxyDefaults struct {
+	FailDuration    caddy.Duration `json:"fail_duration,omitempty"`
+	DialTimeout     caddy.Duration `json:"dial_timeout,omitempty"`
+	ResponseTimeout caddy.Duration `json:"response_timeout,omitempty"`
+}
+
+// ParseGlobalFailoverProxy parses the failover_proxy global option:
+//
+//	{
+//	    failover_proxy {
+//	        fail_duration 10s
+//	        dial_timeout 5s
+//	        response_timeout 30s
+//	    }
+//	}
+func ParseGlobalFailoverProxy(d *caddyfile.Dispenser, _ interface{}) (interface{}, error) {
+	var defaults ProxyDefaults
+	for d.Next() {
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		for d.NextBlock(0) {
+			var target *caddy.Duration
+			switch d.Val() {
+			case "fail_duration":
+				target = &defaults.FailDuration
+			case "dial_timeout":
+				target = &defaults.DialTimeout
+			case "response_timeout":
+				target = &defaults.ResponseTimeout
+			default:
+				return nil, d.Errf("unknown failover_proxy global option: %s", d.Val())
+			}
+			option := d.Val()
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			dur, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.Errf("invalid %s: %v", option, err)
+			}
+			*target = caddy.Duration(dur)
+			if d.NextArg() {
+				return nil, d.ArgErr()
+			}
+		}
+	}
+
+	return defaults, nil
+}
+
+// applyTo fills fields the proxy left unset; fields unset in both keep their
+// hardcoded defaults, set at provision
+func (defaults ProxyDefaults) applyTo(f *FailoverProxy) {
+	if f.FailDuration == 0 {
+		f.FailDuration = defaults.FailDuration
+	}
+	if f.DialTimeout == 0 {
+		f.DialTimeout = defaults.DialTimeout
+	}
+	if f.ResponseTimeout == 0 {
+		f.ResponseTimeout = defaults.ResponseTimeout
+	}
+}
@@ -0,0 +1,55 @@
+package failover
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// TestGlobalDefaults tests that the failover_proxy global option fills
+// fields a proxy leaves unset, without overriding ones it sets
+func TestGlobalDefaults(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`failover_proxy {
+		dial_timeout 10s
+		fail_duration 1m
+	}`)
+	parsed, err := ParseGlobalFailoverProxy(d, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	fp := &FailoverProxy{FailDuration: caddy.Duration(5 * time.Second)}
+	parsed.(ProxyDefaults).applyTo(fp)
+	if fp.DialTimeout != caddy.Duration(10*time.Second) {
+		t.Errorf("Expected the global dial_timeout of 10s, got %v", time.Duration(fp.DialTimeout))
+	}
+	if fp.FailDuration != caddy.Duration(5*time.Second) {
+		t.Errorf("Expected the proxy's own fail_duration of 5s, got %v", time.Duration(fp.FailDuration))
+	}
+	if fp.ResponseTimeout != 0 {
+		t.Errorf("Expected response_timeout to be left for the built-in default, got %v", time.Duration(fp.ResponseTimeout))
+	}
+}
+
+// TestParseGlobalFailoverProxyErrors tests rejected global options
+func TestParseGlobalFailoverProxyErrors(t *testing.T) {
+	for _, input := range []string{
+		`failover_proxy {
+			dial_timeout
+		}`,
+		`failover_proxy {
+			dial_timeout soon
+		}`,
+		`failover_proxy {
+			lb_policy random
+		}`,
+		`failover_proxy http://a.local`,
+	} {
+		d := caddyfile.NewTestDispenser(input)
+		if _, err := ParseGlobalFailoverProxy(d, nil); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
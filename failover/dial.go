@@ -0,0 +1,42 @@
+package failover
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// dialRetryDelay is the pause between TCP connection attempts within a single
+// upstream attempt, long enough to ride out a lost SYN without stalling failover
+const dialRetryDelay = 50 * time.Millisecond
+
+// retryingDialer retries failed TCP connections a few times before reporting
+// the dial error, so transient packet loss doesn't trigger a failover
+type retryingDialer struct {
+	dialer  *net.Dialer
+	retries int
+	delay   time.Duration
+	dns     *dnsCache // falls back to last-known addresses when set
+}
+
+// DialContext dials the address, retrying up to retries extra times on failure
+func (d *retryingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, addr)
+	for attempt := 0; err != nil && attempt < d.retries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(d.delay):
+		}
+		conn, err = d.dial(ctx, network, addr)
+	}
+	return conn, err
+}
+
+// dial makes a single connection attempt, resolving through the DNS cache if enabled
+func (d *retryingDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.dns != nil {
+		return d.dns.dial(ctx, d.dialer, network, addr)
+	}
+	return d.dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,65 @@
+package failover
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDialRetriesAvoidFailover tests that a refused first connection is retried instead of failing over
+func TestDialRetriesAvoidFailover(t *testing.T) {
+	// Reserve a port, then release it so the first dial is refused
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var primaryHits, secondaryHits int32
+	primary := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{"http://" + addr, secondary.URL}, func(fp *FailoverProxy) {
+		fp.DialRetries = 3
+	})
+
+	// Start accepting shortly after the first dial has been refused
+	go func() {
+		time.Sleep(dialRetryDelay / 2)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		primary.Listener.Close()
+		primary.Listener = l
+		primary.Start()
+	}()
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if atomic.LoadInt32(&primaryHits) != 1 {
+		t.Errorf("Expected primary to serve the request after a dial retry, got %d hits", primaryHits)
+	}
+	if atomic.LoadInt32(&secondaryHits) != 0 {
+		t.Errorf("Expected no failover to secondary, got %d hits", secondaryHits)
+	}
+}
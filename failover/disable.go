@@ -0,0 +1,120 @@
+package failover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// UpstreamToggle is the body of a POST to the failover status endpoint that
+// administratively disables or re-enables an upstream
+type UpstreamToggle struct {
+	// Path is the handle path of the failover proxy, as shown in the status
+	Path string `json:"path"`
+
+	// Upstream is the upstream URL, as shown in the status
+	Upstream string `json:"upstream"`
+
+	// Enabled takes the upstream out of rotation when false and returns it
+	// when true
+	Enabled *bool `json:"enabled" required:"true"`
+}
+
+// SetUpstreamEnabled administratively disables or re-enables an upstream.
+// A disabled upstream receives no requests and is never made active, whatever
+// its health, until it is enabled again or the config is reloaded.
+func (f *FailoverProxy) SetUpstreamEnabled(upstreamURL string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	known := false
+	for _, upstream := range f.allUpstreams() {
+		if upstream == upstreamURL {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown upstream: %s", upstreamURL)
+	}
+	if f.disabled[upstreamURL] == !enabled {
+		return nil
+	}
+
+	if enabled {
+		delete(f.disabled, upstreamURL)
+		f.logger.Info("upstream enabled", zap.String("upstream", upstreamURL))
+	} else {
+		f.disabled[upstreamURL] = true
+		f.logger.Warn("upstream disabled", zap.String("upstream", upstreamURL))
+	}
+	f.notifyStatusChange()
+	f.checkActiveUpstreamChange()
+	return nil
+}
+
+// upstreamDisabled reports whether the upstream has been administratively
+// disabled. Must be called with lock held.
+func (f *FailoverProxy) upstreamDisabled(upstreamURL string) bool {
+	return f.disabled[upstreamURL]
+}
+
+// isDisabled is upstreamDisabled for callers not holding the lock
+func (f *FailoverProxy) isDisabled(upstreamURL string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.upstreamDisabled(upstreamURL)
+}
+
+// Lookup returns the proxy registered for path, or nil if there is none
+func (r *ProxyRegistry) Lookup(path string) *FailoverProxy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.proxies[path]
+	if !exists || entry == nil {
+		return nil
+	}
+	return entry.Proxy
+}
+
+// serveToggle applies an UpstreamToggle and responds with the proxy's updated status
+func (h FailoverStatusHandler) serveToggle(w http.ResponseWriter, r *http.Request) error {
+	var toggle UpstreamToggle
+	if err := json.NewDecoder(r.Body).Decode(&toggle); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return nil
+	}
+	if toggle.Path == "" || toggle.Upstream == "" || toggle.Enabled == nil {
+		writeJSONError(w, http.StatusBadRequest, "path, upstream and enabled are required")
+		return nil
+	}
+
+	proxy := proxyRegistry.Lookup(toggle.Path)
+	if proxy == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown path: "+toggle.Path)
+		return nil
+	}
+	if err := proxy.SetUpstreamEnabled(toggle.Upstream, *toggle.Enabled); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return nil
+	}
+
+	status := PathStatus{
+		Path:            toggle.Path,
+		Active:          proxy.GetActiveUpstream(),
+		ActiveMetrics:   proxy.GetActiveUpstreamMetrics(),
+		FailoverProxies: proxy.GetUpstreamStatus(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(status)
+}
+
+// writeJSONError responds with a {"error": message} body
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,142 @@
+package failover
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestDisableUpstream tests that disabling the primary through the status
+// endpoint routes traffic to the secondary and re-enabling restores it
+func TestDisableUpstream(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+
+	oldRegistry := proxyRegistry
+	proxyRegistry = CreateTestRegistry()
+	defer func() { proxyRegistry = oldRegistry }()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, WithPath("/api"))
+	handler := FailoverStatusHandler{AllowToggle: true}
+
+	serve := func() string {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/api", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		body, _ := io.ReadAll(w.Result().Body)
+		return string(body)
+	}
+	toggle := func(body string) (*httptest.ResponseRecorder, PathStatus) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/failover/status", strings.NewReader(body))
+		if err := handler.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		var status PathStatus
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode status: %v", err)
+			}
+		}
+		return w, status
+	}
+
+	if got := serve(); got != "primary" {
+		t.Fatalf("Expected primary before disabling, got %q", got)
+	}
+
+	w, status := toggle(`{"path": "/api", "upstream": "` + primary.URL + `", "enabled": false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 disabling the primary, got %d: %s", w.Code, w.Body)
+	}
+	if status.Active != secondary.URL || !status.FailoverProxies[0].Disabled {
+		t.Errorf("Expected the primary disabled and the secondary active, got %+v", status)
+	}
+	if got := serve(); got != "secondary" {
+		t.Errorf("Expected secondary while the primary is disabled, got %q", got)
+	}
+	if active := fp.GetActiveUpstream(); active != secondary.URL {
+		t.Errorf("Expected active upstream %s, got %s", secondary.URL, active)
+	}
+
+	w, status = toggle(`{"path": "/api", "upstream": "` + primary.URL + `", "enabled": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 enabling the primary, got %d: %s", w.Code, w.Body)
+	}
+	if status.Active != primary.URL || status.FailoverProxies[0].Disabled {
+		t.Errorf("Expected the primary enabled and active, got %+v", status)
+	}
+	if got := serve(); got != "primary" {
+		t.Errorf("Expected primary after re-enabling, got %q", got)
+	}
+}
+
+// TestDisableUpstreamErrors tests rejected toggle requests
+func TestDisableUpstreamErrors(t *testing.T) {
+	oldRegistry := proxyRegistry
+	proxyRegistry = CreateTestRegistry()
+	defer func() { proxyRegistry = oldRegistry }()
+
+	CreateTestProxy(t, []string{"http://localhost:5001"}, WithPath("/api"))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest},
+		{"missing enabled", `{"path": "/api", "upstream": "http://localhost:5001"}`, http.StatusBadRequest},
+		{"unknown path", `{"path": "/other", "upstream": "http://localhost:5001", "enabled": false}`, http.StatusNotFound},
+		{"unknown upstream", `{"path": "/api", "upstream": "http://localhost:5002", "enabled": false}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/admin/failover/status", strings.NewReader(tt.body))
+			if err := (FailoverStatusHandler{AllowToggle: true}).ServeHTTP(w, req, nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+
+	// Without allow_toggle POSTs are still rejected
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/failover/status",
+		strings.NewReader(`{"path": "/api", "upstream": "http://localhost:5001", "enabled": false}`))
+	if err := (FailoverStatusHandler{}).ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 without allow_toggle, got %d", w.Code)
+	}
+}
+
+// TestParseFailoverStatusAllowToggle tests parsing the allow_toggle option
+func TestParseFailoverStatusAllowToggle(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_status {
+		allow_toggle
+	}`)}
+	handler, err := parseFailoverStatus(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if !handler.(FailoverStatusHandler).AllowToggle {
+		t.Error("Expected AllowToggle to be set")
+	}
+}
@@ -0,0 +1,90 @@
+package failover
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// hostResolver looks up the addresses of a host, satisfied by *net.Resolver
+type hostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// dnsCacheEntry is the last successful resolution of a host
+type dnsCacheEntry struct {
+	addrs    []net.IPAddr
+	resolved time.Time
+}
+
+// dnsCache remembers successful resolutions so dials can fall back to the
+// last-known addresses while DNS is briefly unavailable
+type dnsCache struct {
+	resolver hostResolver
+	ttl      time.Duration
+	logger   *zap.Logger
+	mu       sync.Mutex
+	entries  map[string]dnsCacheEntry
+}
+
+// newDNSCache creates a cache whose entries may be used for up to ttl after
+// the resolution that produced them
+func newDNSCache(ttl time.Duration, logger *zap.Logger) *dnsCache {
+	return &dnsCache{
+		resolver: net.DefaultResolver,
+		ttl:      ttl,
+		logger:   logger,
+		entries:  make(map[string]dnsCacheEntry),
+	}
+}
+
+// lookup resolves host live, falling back to an unexpired cached resolution
+// when the live lookup fails
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	if err == nil && len(addrs) > 0 {
+		c.mu.Lock()
+		c.entries[host] = dnsCacheEntry{addrs: addrs, resolved: time.Now()}
+		c.mu.Unlock()
+		return addrs, nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if !ok || time.Since(entry.resolved) > c.ttl {
+		return addrs, err
+	}
+
+	c.logger.Warn("DNS resolution failed, using cached addresses",
+		zap.String("host", host),
+		zap.Duration("age", time.Since(entry.resolved)),
+		zap.Error(err))
+	return entry.addrs, nil
+}
+
+// dial resolves the host in addr through the cache and connects to the first
+// address that accepts the connection
+func (c *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	for _, ip := range addrs {
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,95 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// stubResolver resolves every host to 127.0.0.1 until it is told to fail
+type stubResolver struct {
+	failing atomic.Bool
+	lookups atomic.Int32
+}
+
+func (r *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups.Add(1)
+	if r.failing.Load() {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+	}
+	return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+}
+
+// TestDNSCacheFallback tests that the cached address is used when live resolution fails
+func TestDNSCacheFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	upstream := "http://backend.internal:" + u.Port()
+
+	fp := CreateTestProxy(t, []string{upstream}, func(fp *FailoverProxy) {
+		fp.DNSCacheTTL = caddy.Duration(time.Minute)
+	})
+	resolver := &stubResolver{}
+	fp.dnsCache.resolver = resolver
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		fp.httpClient.CloseIdleConnections()
+		return w.Code
+	}
+
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("Expected status 200 with working DNS, got %d", code)
+	}
+
+	resolver.failing.Store(true)
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("Expected status 200 from cached address during DNS failure, got %d", code)
+	}
+	if resolver.lookups.Load() < 2 {
+		t.Error("Expected live resolution to be attempted before using the cache")
+	}
+}
+
+// TestDNSCacheExpiry tests that cached addresses aren't used past the TTL
+func TestDNSCacheExpiry(t *testing.T) {
+	resolver := &stubResolver{}
+	cache := newDNSCache(time.Minute, zap.NewNop())
+	cache.resolver = resolver
+
+	if _, err := cache.lookup(context.Background(), "backend.internal"); err != nil {
+		t.Fatalf("Expected live lookup to succeed, got %v", err)
+	}
+
+	resolver.failing.Store(true)
+	cache.mu.Lock()
+	entry := cache.entries["backend.internal"]
+	entry.resolved = time.Now().Add(-2 * time.Minute)
+	cache.entries["backend.internal"] = entry
+	cache.mu.Unlock()
+
+	_, err := cache.lookup(context.Background(), "backend.internal")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Errorf("Expected DNS error once the cached entry expired, got %v", err)
+	}
+
+	if _, err := cache.lookup(context.Background(), "never.resolved"); err == nil {
+		t.Error("Expected failure for a host that was never resolved")
+	}
+}
@@ -0,0 +1,29 @@
+package failover
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// drain waits up to DrainTimeout for in-flight requests to finish, so a
+// config reload doesn't cut them off
+func (f *FailoverProxy) drain() {
+	if f.DrainTimeout <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		f.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Duration(f.DrainTimeout)):
+		f.logger.Warn("drain timeout reached with requests still in flight",
+			zap.String("path", f.HandlePath),
+			zap.Duration("drain_timeout", time.Duration(f.DrainTimeout)))
+	}
+}
@@ -0,0 +1,104 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestDrainTimeoutWaitsForInflight tests that Cleanup lets a slow request
+// finish instead of cutting it off
+func TestDrainTimeoutWaitsForInflight(t *testing.T) {
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.DrainTimeout = caddy.Duration(5 * time.Second)
+	})
+
+	w := httptest.NewRecorder()
+	served := make(chan error, 1)
+	go func() {
+		served <- fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil)
+	}()
+	<-started
+
+	if err := fp.Cleanup(); err != nil {
+		t.Fatalf("Cleanup error: %v", err)
+	}
+
+	// Cleanup only returns once the request has been served
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	default:
+		t.Fatal("Expected Cleanup to wait for the in-flight request")
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "done" {
+		t.Errorf("Expected the request to complete, got status %d body %q", w.Code, w.Body.String())
+	}
+}
+
+// TestDrainTimeoutBounded tests that Cleanup gives up after drain_timeout
+func TestDrainTimeoutBounded(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.DrainTimeout = caddy.Duration(100 * time.Millisecond)
+	})
+
+	go func() {
+		_ = fp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil), nil)
+	}()
+	<-started
+
+	start := time.Now()
+	if err := fp.Cleanup(); err != nil {
+		t.Fatalf("Cleanup error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected Cleanup to wait about the drain timeout, took %v", elapsed)
+	}
+}
+
+// TestParseDrainTimeout tests parsing the drain_timeout subdirective
+func TestParseDrainTimeout(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+		"failover_proxy http://a {\n drain_timeout 15s\n}")}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := handler.(*FailoverProxy).DrainTimeout; got != caddy.Duration(15*time.Second) {
+		t.Errorf("Expected 15s, got %v", time.Duration(got))
+	}
+
+	for _, bad := range []string{"", "soon", "-1s"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n drain_timeout " + bad + "\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for drain_timeout %q", bad)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -389,3 +390,39 @@ func startTestServer(t *testing.T, port int, name string) *http.Server {
 
 	return server
 }
+
+// TestFailoverStatusPathFilter tests filtering the status endpoint by path prefix
+func TestFailoverStatusPathFilter(t *testing.T) {
+	for _, path := range []string{"/filter/api/*", "/filter/api/v2/*", "/filter/auth/*"} {
+		CreateTestProxy(t, []string{"http://localhost:9999"}, func(fp *FailoverProxy) {
+			fp.HandlePath = path
+		})
+	}
+
+	statusPaths := func(target string) []string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		require.NoError(t, FailoverStatusHandler{}.ServeHTTP(rr, httptest.NewRequest("GET", target, nil), nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NotEqual(t, "null", strings.TrimSpace(rr.Body.String()), "Status should never be null")
+
+		var status []PathStatus
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+		paths := []string{}
+		for _, ps := range status {
+			if strings.HasPrefix(ps.Path, "/filter/") {
+				paths = append(paths, ps.Path)
+			}
+		}
+		return paths
+	}
+
+	assert.ElementsMatch(t, []string{"/filter/api/*", "/filter/api/v2/*", "/filter/auth/*"}, statusPaths("/status"),
+		"Expected every path without a filter")
+	assert.ElementsMatch(t, []string{"/filter/api/*", "/filter/api/v2/*"}, statusPaths("/status?path=/filter/api"),
+		"Expected only paths under the prefix")
+
+	rr := httptest.NewRecorder()
+	require.NoError(t, FailoverStatusHandler{}.ServeHTTP(rr, httptest.NewRequest("GET", "/status?path=/nothing", nil), nil))
+	assert.Equal(t, "[]", strings.TrimSpace(rr.Body.String()), "Expected an empty array for an unmatched prefix")
+}
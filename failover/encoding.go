@@ -0,0 +1,94 @@
+package failover
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// gzipMagic is the start of every gzip stream: ID1, ID2 and the deflate method
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// Modes for correcting gzip bodies sent without Content-Encoding
+const (
+	encodingFixHeader     = "header"     // declare the encoding so clients decode it
+	encodingFixDecompress = "decompress" // send the body decompressed
+)
+
+// fixMismatchedEncoding sniffs the start of an upstream body that declares no
+// Content-Encoding and corrects it when it is really gzip
+func (f *FailoverProxy) fixMismatchedEncoding(resp *http.Response, upstreamURL string) {
+	if f.DetectMismatchedEncoding == "" || resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	br := bufio.NewReaderSize(resp.Body, 16)
+	head, _ := br.Peek(len(gzipMagic))
+	body := struct {
+		io.Reader
+		io.Closer
+	}{br, resp.Body}
+	resp.Body = body
+	if !bytes.Equal(head, gzipMagic) {
+		return
+	}
+
+	f.logger.Warn("upstream sent gzip body without Content-Encoding",
+		zap.String("upstream", upstreamURL),
+		zap.String("fix", f.DetectMismatchedEncoding))
+
+	if f.DetectMismatchedEncoding == encodingFixDecompress {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{gz, body}
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return
+	}
+
+	resp.Header.Set("Content-Encoding", "gzip")
+}
+
+// decompressResponse gunzips upstream bodies declared as gzip when
+// decompress_response is set, so clients receive the decoded bytes. Bodies
+// that aren't really gzip are passed through unchanged.
+func (f *FailoverProxy) decompressResponse(resp *http.Response, upstreamURL string) {
+	if !f.DecompressResponse || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+
+	br := bufio.NewReaderSize(resp.Body, 16)
+	head, _ := br.Peek(len(gzipMagic))
+	body := struct {
+		io.Reader
+		io.Closer
+	}{br, resp.Body}
+	resp.Body = body
+	if !bytes.Equal(head, gzipMagic) {
+		f.logger.Debug("upstream body declared gzip is not gzip, passing it through",
+			zap.String("upstream", upstreamURL))
+		return
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{gz, body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
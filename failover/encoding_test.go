@@ -0,0 +1,159 @@
+package failover
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestDetectMismatchedEncoding tests that undeclared gzip bodies are corrected
+func TestDetectMismatchedEncoding(t *testing.T) {
+	const payload = "hello from a misconfigured upstream"
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(payload))
+	gz.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/plain" {
+			w.Write([]byte(payload))
+			return
+		}
+		w.Write(compressed.Bytes())
+	}))
+	defer upstream.Close()
+
+	t.Run("header", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+			fp.DetectMismatchedEncoding = encodingFixHeader
+		})
+
+		w := httptest.NewRecorder()
+		fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/gz", nil), nil)
+
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Errorf("Expected Content-Encoding: gzip, got %q", w.Header().Get("Content-Encoding"))
+		}
+		if !bytes.Equal(w.Body.Bytes(), compressed.Bytes()) {
+			t.Error("Expected compressed body to be passed through intact")
+		}
+	})
+
+	t.Run("decompress", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+			fp.DetectMismatchedEncoding = encodingFixDecompress
+		})
+
+		w := httptest.NewRecorder()
+		fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/gz", nil), nil)
+
+		if w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Expected no Content-Encoding, got %q", w.Header().Get("Content-Encoding"))
+		}
+		if w.Header().Get("Content-Length") != "" {
+			t.Errorf("Expected stale Content-Length to be dropped, got %s", w.Header().Get("Content-Length"))
+		}
+		if w.Body.String() != payload {
+			t.Errorf("Expected decompressed body %q, got %q", payload, w.Body.String())
+		}
+	})
+
+	t.Run("plain body untouched", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+			fp.DetectMismatchedEncoding = encodingFixHeader
+		})
+
+		w := httptest.NewRecorder()
+		fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/plain", nil), nil)
+
+		body, _ := io.ReadAll(w.Body)
+		if w.Header().Get("Content-Encoding") != "" || string(body) != payload {
+			t.Errorf("Expected plain body passed through, got encoding %q body %q",
+				w.Header().Get("Content-Encoding"), body)
+		}
+	})
+}
+
+// TestDecompressResponse tests that gzip responses are decoded only when
+// decompress_response is set
+func TestDecompressResponse(t *testing.T) {
+	const payload = "hello from a gzip upstream"
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(payload))
+	gz.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Path == "/fake" {
+			w.Write([]byte(payload))
+			return
+		}
+		w.Write(compressed.Bytes())
+	}))
+	defer upstream.Close()
+
+	// serve sends a request that accepts gzip, so the transport doesn't decode it
+	serve := func(fp *FailoverProxy, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com"+path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		return w
+	}
+
+	t.Run("default passes encoding through", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{upstream.URL})
+		w := serve(fp, "/gz")
+		if w.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(w.Body.Bytes(), compressed.Bytes()) {
+			t.Errorf("Expected the gzip body untouched, got encoding %q", w.Header().Get("Content-Encoding"))
+		}
+	})
+
+	t.Run("decompress_response", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+			fp.DecompressResponse = true
+		})
+		w := serve(fp, "/gz")
+		if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Content-Length") != "" {
+			t.Errorf("Expected Content-Encoding and Content-Length dropped, got %v", w.Header())
+		}
+		if w.Body.String() != payload {
+			t.Errorf("Expected decompressed body %q, got %q", payload, w.Body.String())
+		}
+	})
+
+	t.Run("body that isn't gzip passes through", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+			fp.DecompressResponse = true
+		})
+		w := serve(fp, "/fake")
+		if w.Body.String() != payload {
+			t.Errorf("Expected body passed through, got %q", w.Body.String())
+		}
+	})
+}
+
+// TestParseDecompressResponse tests parsing the decompress_response flag
+func TestParseDecompressResponse(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		decompress_response
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if !handler.(*FailoverProxy).DecompressResponse {
+		t.Error("Expected DecompressResponse to be set")
+	}
+}
@@ -0,0 +1,74 @@
+package failover
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// watchedBody records whether the client transport ever read the request body
+type watchedBody struct {
+	io.Reader
+	read *atomic.Bool
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.Reader.Read(p)
+}
+
+// TestExpectContinueRelaysRejection tests that an upstream 417 reaches the client before the body is sent
+func TestExpectContinueRelaysRejection(t *testing.T) {
+	var upstreamExpect atomic.Value
+	var upstreamReadBody atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamExpect.Store(r.Header.Get("Expect"))
+		if r.ContentLength > 1024 {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		upstreamReadBody.Store(true)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp.ServeHTTP(w, r, nil)
+	}))
+	defer proxy.Close()
+
+	var clientRead atomic.Bool
+	body := &watchedBody{Reader: strings.NewReader(strings.Repeat("x", 4096)), read: &clientRead}
+	req, err := http.NewRequest("PUT", proxy.URL+"/upload", body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.ContentLength = 4096
+	req.Header.Set("Expect", "100-continue")
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusExpectationFailed {
+		t.Errorf("Expected status 417, got %d", resp.StatusCode)
+	}
+	if got, _ := upstreamExpect.Load().(string); !strings.EqualFold(got, "100-continue") {
+		t.Errorf("Expected Expect header forwarded upstream, got %q", got)
+	}
+	if clientRead.Load() {
+		t.Error("Expected client body not to be sent after upstream rejection")
+	}
+	if upstreamReadBody.Load() {
+		t.Error("Expected upstream not to receive the body")
+	}
+}
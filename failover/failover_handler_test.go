@@ -8,11 +8,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 )
 
 // TestFailoverWithHeaders tests that custom headers are properly forwarded
@@ -297,6 +300,105 @@ func TestXForwardedHeaders(t *testing.T) {
 	}
 }
 
+// TestXForwardedForMode tests that append mode extends the chain received
+// from a proxy in front, while the default replaces it
+func TestXForwardedForMode(t *testing.T) {
+	var captured string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = strings.Join(r.Header.Values("X-Forwarded-For"), ", ")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		mode string
+		want string
+	}{
+		{"", "5.6.7.8"},
+		{xffModeReplace, "5.6.7.8"},
+		{xffModeAppend, "1.2.3.4, 5.6.7.8"},
+	} {
+		fp := CreateTestProxy(t, []string{server.URL}, func(fp *FailoverProxy) {
+			fp.XFFMode = tt.mode
+		})
+
+		req := httptest.NewRequest("GET", "http://example.com/test", nil)
+		req.RemoteAddr = "5.6.7.8:12345"
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		if err := fp.ServeHTTP(httptest.NewRecorder(), req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		if captured != tt.want {
+			t.Errorf("xff_mode %q: expected X-Forwarded-For %q, got %q", tt.mode, tt.want, captured)
+		}
+	}
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a.local {
+		xff_mode prepend
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for xff_mode prepend")
+	}
+}
+
+// TestTrustedProxies tests that forwarded headers from untrusted addresses
+// are corrected from the connection, and honored from trusted proxies
+func TestTrustedProxies(t *testing.T) {
+	var captured http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL}, func(fp *FailoverProxy) {
+		fp.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+		fp.XFFMode = xffModeAppend
+	})
+
+	for _, tt := range []struct {
+		remote string
+		proto  string
+		xff    string
+	}{
+		{"203.0.113.9:4000", "http", "203.0.113.9"},
+		{"10.1.2.3:4000", "https", "1.2.3.4, 10.1.2.3"},
+		{"192.168.1.1:4000", "https", "1.2.3.4, 192.168.1.1"},
+		{"192.168.1.2:4000", "http", "192.168.1.2"},
+	} {
+		req := httptest.NewRequest("GET", "http://example.com/test", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		if err := fp.ServeHTTP(httptest.NewRecorder(), req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		if got := captured.Get("X-Forwarded-Proto"); got != tt.proto {
+			t.Errorf("From %s: expected X-Forwarded-Proto %q, got %q", tt.remote, tt.proto, got)
+		}
+		if got := captured.Get("X-Forwarded-For"); got != tt.xff {
+			t.Errorf("From %s: expected X-Forwarded-For %q, got %q", tt.remote, tt.xff, got)
+		}
+	}
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a.local {
+		trusted_proxies 10.0.0.0/8 ::1
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).TrustedProxies; len(got) != 2 {
+		t.Errorf("Expected 2 trusted proxies, got %v", got)
+	}
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a.local {
+		trusted_proxies 10.0.0.0/33
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for an invalid CIDR")
+	}
+}
+
 // TestConcurrentRequests tests that the proxy handles concurrent requests correctly
 func TestConcurrentRequests(t *testing.T) {
 	var requestCount atomic.Int32
@@ -410,3 +512,526 @@ func TestStatusEndpointConcurrency(t *testing.T) {
 		t.Errorf("Expected %d successful requests, got %d", concurrency, successCount)
 	}
 }
+
+// TestAcceptOverridePerUpstream tests that each upstream receives its configured Accept header
+func TestAcceptOverridePerUpstream(t *testing.T) {
+	var primaryAccept, secondaryAccept string
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryAccept = r.Header.Get("Accept")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryAccept = r.Header.Get("Accept")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.AcceptOverrides = map[string]string{
+			primary.URL:   "application/vnd.v1+json",
+			secondary.URL: "application/vnd.v2+json",
+		}
+		// The override must win over a conflicting header_up
+		fp.UpstreamHeaders[secondary.URL] = map[string]string{"Accept": "text/plain"}
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/resource", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if primaryAccept != "application/vnd.v1+json" {
+		t.Errorf("Expected primary Accept application/vnd.v1+json, got %q", primaryAccept)
+	}
+	if secondaryAccept != "application/vnd.v2+json" {
+		t.Errorf("Expected secondary Accept application/vnd.v2+json, got %q", secondaryAccept)
+	}
+}
+
+// TestAcceptPassthroughWithoutOverride tests that the client's Accept is kept when no override applies
+func TestAcceptPassthroughWithoutOverride(t *testing.T) {
+	var receivedAccept string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedAccept = r.Header.Get("Accept")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL}, func(fp *FailoverProxy) {
+		fp.AcceptOverrides = map[string]string{"http://other.local": "application/xml"}
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/resource", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if receivedAccept != "application/json" {
+		t.Errorf("Expected client Accept to pass through, got %q", receivedAccept)
+	}
+}
+
+// TestWarnOnFailoverHeader tests that the Warning header is only added for non-primary responses
+func TestWarnOnFailoverHeader(t *testing.T) {
+	primaryStatus := int32(http.StatusOK)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&primaryStatus)))
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL},
+		WithFailDuration(time.Nanosecond),
+		func(fp *FailoverProxy) {
+			fp.WarnOnFailover = true
+		})
+
+	// Served by the primary: no warning
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if got := w.Header().Get("Warning"); got != "" {
+		t.Errorf("Expected no Warning header from primary, got %q", got)
+	}
+
+	// Served by the secondary: warning present, status unchanged
+	atomic.StoreInt32(&primaryStatus, http.StatusServiceUnavailable)
+	w = httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if got := w.Header().Get("Warning"); got != failoverWarning {
+		t.Errorf("Expected Warning %q, got %q", failoverWarning, got)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+// TestSelfHealthPath tests that the self-health path is answered without contacting upstreams
+func TestSelfHealthPath(t *testing.T) {
+	var upstreamHits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL}, func(fp *FailoverProxy) {
+		fp.SelfHealthPath = "/health"
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/health", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w.Body.String() != "OK" {
+		t.Errorf("Expected body 'OK', got %q", w.Body.String())
+	}
+	if atomic.LoadInt32(&upstreamHits) != 0 {
+		t.Error("Expected self-health request not to reach the upstream")
+	}
+
+	// Other paths are still proxied
+	req = httptest.NewRequest("GET", "http://example.com/health/deep", nil)
+	w = httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if atomic.LoadInt32(&upstreamHits) != 1 {
+		t.Error("Expected non-matching path to be proxied")
+	}
+}
+
+// TestSelfHealthWithStatus tests the self-health response including the upstream summary
+func TestSelfHealthWithStatus(t *testing.T) {
+	fp := CreateTestProxy(t, []string{"http://primary.local:3000", "http://backup.local:3000"},
+		WithPath("/api/*"),
+		func(fp *FailoverProxy) {
+			fp.SelfHealthPath = "/_proxy/health"
+			fp.SelfHealthStatus = true
+		})
+
+	req := httptest.NewRequest("GET", "http://example.com/_proxy/health", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var status PathStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if status.Active != "http://primary.local:3000" {
+		t.Errorf("Expected active upstream http://primary.local:3000, got %q", status.Active)
+	}
+	if len(status.FailoverProxies) != 2 {
+		t.Errorf("Expected 2 upstreams in summary, got %d", len(status.FailoverProxies))
+	}
+}
+
+// TestMaxResponseTimeFailsOver tests that a slow upstream is abandoned within its latency budget
+func TestMaxResponseTimeFailsOver(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	fp := CreateTestProxy(t, []string{slow.URL, fast.URL}, func(fp *FailoverProxy) {
+		fp.MaxResponseTimes = map[string]caddy.Duration{slow.URL: caddy.Duration(100 * time.Millisecond)}
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusOK || w.Body.String() != "fast" {
+		t.Errorf("Expected response from fast upstream, got %d %q", w.Code, w.Body.String())
+	}
+	if elapsed > time.Second {
+		t.Errorf("Expected failover within the budget, took %v", elapsed)
+	}
+}
+
+// TestNotModifiedPassthrough tests that a 304 from the primary is relayed cleanly without failover
+func TestNotModifiedPassthrough(t *testing.T) {
+	const etag = `"v1"`
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("full body"))
+	}))
+	defer primary.Close()
+
+	var secondaryHits int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryHits, 1)
+		w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp.ServeHTTP(w, r, nil)
+	}))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/resource", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") != etag {
+		t.Errorf("Expected ETag %s, got %q", etag, resp.Header.Get("ETag"))
+	}
+	if resp.Header.Get("Cache-Control") != "max-age=60" {
+		t.Errorf("Expected Cache-Control to be relayed, got %q", resp.Header.Get("Cache-Control"))
+	}
+	if len(body) != 0 {
+		t.Errorf("Expected empty body, got %q", body)
+	}
+	if atomic.LoadInt32(&secondaryHits) != 0 {
+		t.Errorf("Expected 304 not to trigger failover, secondary got %d hits", secondaryHits)
+	}
+}
+
+// TestEchoLastError tests that the last upstream's error response reaches the client when all fail
+func TestEchoLastError(t *testing.T) {
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "first failed", http.StatusInternalServerError)
+	}))
+	defer first.Close()
+
+	last := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"maintenance"}`))
+	}))
+	defer last.Close()
+
+	t.Run("enabled", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{first.URL, last.URL}, func(fp *FailoverProxy) {
+			fp.EchoLastError = true
+		})
+
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+		if w.Body.String() != `{"error":"maintenance"}` {
+			t.Errorf("Expected last upstream body, got %q", w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != "application/json" || w.Header().Get("Retry-After") != "30" {
+			t.Errorf("Expected Content-Type and Retry-After to be echoed, got %v", w.Header())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{first.URL, last.URL})
+
+		w := httptest.NewRecorder()
+		fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil)
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected generic 502, got %d", w.Code)
+		}
+	})
+}
+
+// TestPreferPrimaryError tests that the primary's failure response is returned after full failover
+func TestPreferPrimaryError(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("primary overloaded"))
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "secondary failed", http.StatusInternalServerError)
+	}))
+	defer secondary.Close()
+
+	t.Run("primary responded", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+			fp.PreferPrimaryError = true
+			fp.EchoLastError = true
+		})
+
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected primary status 503, got %d", w.Code)
+		}
+		if w.Body.String() != "primary overloaded" {
+			t.Errorf("Expected primary body, got %q", w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != "text/plain" {
+			t.Errorf("Expected primary Content-Type, got %q", w.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("primary unreachable", func(t *testing.T) {
+		fp := CreateTestProxy(t, []string{"http://127.0.0.1:1", secondary.URL}, func(fp *FailoverProxy) {
+			fp.PreferPrimaryError = true
+		})
+
+		w := httptest.NewRecorder()
+		fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil)
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected generic 502 without a primary response, got %d", w.Code)
+		}
+	})
+}
+
+// TestExpectContentTypeFailsOver tests that a 200 HTML page where JSON was expected triggers failover
+func TestExpectContentTypeFailsOver(t *testing.T) {
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>Access denied</html>"))
+	}))
+	defer portal.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer api.Close()
+
+	fp := CreateTestProxy(t, []string{portal.URL, api.URL}, func(fp *FailoverProxy) {
+		fp.ExpectContentTypes = map[string]string{portal.URL: "application/json"}
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Body.String() != `{"ok":true}` {
+		t.Errorf("Expected failover to the JSON upstream, got %q", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "Access denied") {
+		t.Error("Expected the HTML page not to leak into the response")
+	}
+}
+
+// TestContentTypeMatches tests media type and wildcard matching
+func TestContentTypeMatches(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    string
+		match       bool
+	}{
+		{"application/json", "application/json", true},
+		{"Application/JSON; charset=utf-8", "application/json", true},
+		{"application/problem+json", "application/*", true},
+		{"text/html", "application/json", false},
+		{"", "application/json", false},
+	}
+	for _, tt := range tests {
+		if got := contentTypeMatches(tt.contentType, tt.expected); got != tt.match {
+			t.Errorf("contentTypeMatches(%q, %q) = %v, expected %v", tt.contentType, tt.expected, got, tt.match)
+		}
+	}
+}
+
+// TestMethodRewritePerUpstream tests that a PATCH to the primary becomes a POST at the configured backup
+func TestMethodRewritePerUpstream(t *testing.T) {
+	var primaryMethod, backupMethod string
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryMethod = r.Method
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupMethod = r.Method
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.MethodRewrites = map[string]map[string]string{
+			backup.URL: {"PATCH": "POST"},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("PATCH", "http://example.com/items/1", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if primaryMethod != "PATCH" {
+		t.Errorf("Expected primary to receive PATCH, got %s", primaryMethod)
+	}
+	if backupMethod != "POST" {
+		t.Errorf("Expected backup to receive POST, got %s", backupMethod)
+	}
+}
+
+// TestHeaderDownPerUpstream tests that header_down injects and strips response headers
+func TestHeaderDownPerUpstream(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "legacy-backend/1.2")
+		w.Header().Set("X-Powered-By", "php")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.DownstreamHeaders = map[string]map[string]string{
+			backup.URL: {
+				"X-Served-By": "backup",
+				"-Server":     "",
+			},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if got := w.Header().Get("X-Served-By"); got != "backup" {
+		t.Errorf("Expected injected X-Served-By header, got %q", got)
+	}
+	if got := w.Header().Get("Server"); got != "" {
+		t.Errorf("Expected Server header to be stripped, got %q", got)
+	}
+	if got := w.Header().Get("X-Powered-By"); got != "php" {
+		t.Errorf("Expected other upstream headers to pass through, got %q", got)
+	}
+}
+
+// TestParseHeaderDown tests parsing header_down set and delete forms
+func TestParseHeaderDown(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		header_down http://a X-Served-By primary
+		header_down http://a -Server
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	headers := handler.(*FailoverProxy).DownstreamHeaders["http://a"]
+	if headers["X-Served-By"] != "primary" {
+		t.Errorf("Expected X-Served-By to be set, got %v", headers)
+	}
+	if _, ok := headers["-Server"]; !ok {
+		t.Errorf("Expected Server to be marked for removal, got %v", headers)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		header_down http://a -Server value
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected error for a value on a header removal")
+	}
+}
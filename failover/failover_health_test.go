@@ -3,12 +3,19 @@ package failover
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // TestRunHealthCheck tests the health check goroutine functionality
@@ -442,3 +449,472 @@ func TestRunHealthCheckWithBasePathURL(t *testing.T) {
 	close(fp.shutdown)
 	fp.wg.Wait()
 }
+
+// TestRunHealthCheckPathTemplate tests upstream placeholders in the health check path
+func TestRunHealthCheckPathTemplate(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]string)
+
+	newServer := func() *httptest.Server {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requested[server.URL] = r.URL.Path
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		return server
+	}
+	server1 := newServer()
+	defer server1.Close()
+	server2 := newServer()
+	defer server2.Close()
+
+	fp := &FailoverProxy{
+		logger:        zap.NewNop(),
+		healthStatus:  make(map[string]bool),
+		lastCheckTime: make(map[string]time.Time),
+		responseTime:  make(map[string]int64),
+		failureCache:  make(map[string]time.Time),
+		shutdown:      make(chan struct{}),
+		httpClient:    &http.Client{},
+		httpsClient:   &http.Client{},
+	}
+
+	hc := &HealthCheck{
+		Path:           "/health/{upstream.host}/{upstream.port}",
+		Interval:       caddy.Duration(50 * time.Millisecond),
+		Timeout:        caddy.Duration(100 * time.Millisecond),
+		ExpectedStatus: 200,
+	}
+
+	for _, server := range []*httptest.Server{server1, server2} {
+		fp.wg.Add(1)
+		go fp.runHealthCheck(server.URL, hc)
+	}
+
+	WaitForCondition(t, time.Second, 10*time.Millisecond, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requested) == 2
+	}, "both upstreams probed")
+
+	close(fp.shutdown)
+	fp.wg.Wait()
+
+	for _, server := range []*httptest.Server{server1, server2} {
+		u, _ := url.Parse(server.URL)
+		expected := "/health/" + u.Hostname() + "/" + u.Port()
+		if requested[server.URL] != expected {
+			t.Errorf("Expected probe path %s for %s, got %s", expected, server.URL, requested[server.URL])
+		}
+	}
+}
+
+// TestBuildHealthURLDefaultPorts tests port placeholders for URLs without an explicit port
+func TestBuildHealthURLDefaultPorts(t *testing.T) {
+	hc := &HealthCheck{Path: "/{upstream.scheme}/{upstream.port}"}
+
+	tests := map[string]string{
+		"http://backend.local":      "http://backend.local/http/80",
+		"https://backend.local/api": "https://backend.local/https/443",
+		"http://backend.local:8080": "http://backend.local:8080/http/8080",
+	}
+	for upstream, expected := range tests {
+		u, _ := url.Parse(upstream)
+		if got := buildHealthURL(u, hc); got != expected {
+			t.Errorf("buildHealthURL(%s) = %s, expected %s", upstream, got, expected)
+		}
+	}
+}
+
+// TestBuildHealthURLIncludeBasePath tests that the upstream's path is ignored
+// by default and prefixed to the health check path when include_base_path is set
+func TestBuildHealthURLIncludeBasePath(t *testing.T) {
+	tests := []struct {
+		name            string
+		upstream        string
+		path            string
+		includeBasePath bool
+		expected        string
+	}{
+		{"default ignores base path", "http://backend.local/api/v1", "/health", false, "http://backend.local/health"},
+		{"base path prefixed", "http://backend.local/api/v1", "/health", true, "http://backend.local/api/v1/health"},
+		{"trailing slash on base path", "http://backend.local/api/v1/", "/health", true, "http://backend.local/api/v1/health"},
+		{"path without leading slash", "http://backend.local/api/v1", "health", true, "http://backend.local/api/v1/health"},
+		{"no base path", "http://backend.local:8080", "/health", true, "http://backend.local:8080/health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.upstream)
+			hc := &HealthCheck{Path: tt.path, IncludeBasePath: tt.includeBasePath}
+			if got := buildHealthURL(u, hc); got != tt.expected {
+				t.Errorf("buildHealthURL(%s) = %s, expected %s", tt.upstream, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestHealthCheckQuietDuringShutdown tests that no status transitions are logged once shutdown begins
+func TestHealthCheckQuietDuringShutdown(t *testing.T) {
+	probeStarted := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var probes int32
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		probes++
+		first := probes == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Later probes hang like a backend that is itself shutting down
+		probeStarted <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	core, logs := observer.New(zap.DebugLevel)
+	fp := &FailoverProxy{
+		Upstreams:     []string{server.URL},
+		logger:        zap.New(core),
+		healthStatus:  make(map[string]bool),
+		lastCheckTime: make(map[string]time.Time),
+		responseTime:  make(map[string]int64),
+		failureCache:  make(map[string]time.Time),
+		shutdown:      make(chan struct{}),
+		httpClient:    &http.Client{},
+		httpsClient:   &http.Client{},
+	}
+
+	hc := &HealthCheck{
+		Path:           "/health",
+		Interval:       caddy.Duration(20 * time.Millisecond),
+		Timeout:        caddy.Duration(5 * time.Second),
+		ExpectedStatus: 200,
+	}
+
+	fp.wg.Add(1)
+	go fp.runHealthCheck(server.URL, hc)
+
+	// Wait for the second probe to be in flight, then shut down
+	select {
+	case <-probeStarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for in-flight health check")
+	}
+	logsBeforeShutdown := logs.Len()
+	close(fp.shutdown)
+	fp.wg.Wait()
+
+	for _, entry := range logs.All()[logsBeforeShutdown:] {
+		t.Errorf("Unexpected log after shutdown began: %s", entry.Message)
+	}
+	if !fp.isHealthy(server.URL) {
+		t.Error("Expected last known health status to be kept through shutdown")
+	}
+}
+
+// TestHealthCheckHTTPVersion tests that probes negotiate the configured protocol
+func TestHealthCheckHTTPVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		tls       bool
+		wantMajor int
+	}{
+		{name: "force HTTP/1.1 over TLS", version: "1.1", tls: true, wantMajor: 1},
+		{name: "HTTP/2 over TLS", version: "2", tls: true, wantMajor: 2},
+		{name: "HTTP/2 cleartext", version: "2", tls: false, wantMajor: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			protoMajor := 0
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				protoMajor = r.ProtoMajor
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+			})
+
+			var server *httptest.Server
+			if tt.tls {
+				server = httptest.NewUnstartedServer(handler)
+				server.EnableHTTP2 = true
+				server.StartTLS()
+			} else {
+				server = httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+			}
+			defer server.Close()
+
+			fp := CreateTestProxy(t, []string{server.URL},
+				WithHealthCheck(server.URL, &HealthCheck{
+					Path:        "/health",
+					Interval:    caddy.Duration(time.Hour),
+					HTTPVersion: tt.version,
+				}),
+				func(fp *FailoverProxy) {
+					fp.InsecureSkipVerify = true
+				})
+
+			WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+				return fp.isHealthy(server.URL)
+			}, "health check to pass")
+
+			mu.Lock()
+			defer mu.Unlock()
+			if protoMajor != tt.wantMajor {
+				t.Errorf("Expected probe over HTTP/%d, got HTTP/%d", tt.wantMajor, protoMajor)
+			}
+		})
+	}
+}
+
+// TestHealthCheckHostHeader tests that probes carry the configured Host header
+func TestHealthCheckHostHeader(t *testing.T) {
+	t.Setenv("FAILOVER_TEST_PROBE_HOST", "api.internal.example")
+
+	var mu sync.Mutex
+	probeHost := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		probeHost = r.Host
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL},
+		WithHealthCheck(server.URL, &HealthCheck{
+			Path:     "/health",
+			Interval: caddy.Duration(time.Hour),
+			Host:     "{env.FAILOVER_TEST_PROBE_HOST}",
+		}))
+
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		return fp.isHealthy(server.URL)
+	}, "health check to pass")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if probeHost != "api.internal.example" {
+		t.Errorf("Expected probe Host api.internal.example, got %q", probeHost)
+	}
+}
+
+// TestHealthCheckHeaders tests that probes carry the configured headers with placeholders expanded
+func TestHealthCheckHeaders(t *testing.T) {
+	t.Setenv("FAILOVER_TEST_PROBE_TOKEN", "s3cret")
+
+	var mu sync.Mutex
+	var probeAuth, probeTenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		probeAuth = r.Header.Get("Authorization")
+		probeTenant = r.Header.Get("X-Tenant")
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL},
+		WithHealthCheck(server.URL, &HealthCheck{
+			Path:     "/health",
+			Interval: caddy.Duration(time.Hour),
+			Headers: map[string]string{
+				"Authorization": "Bearer {env.FAILOVER_TEST_PROBE_TOKEN}",
+				"X-Tenant":      "probe",
+			},
+		}))
+
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		return fp.isHealthy(server.URL)
+	}, "authorized health check to pass")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if probeAuth != "Bearer s3cret" {
+		t.Errorf("Expected probe Authorization header, got %q", probeAuth)
+	}
+	if probeTenant != "probe" {
+		t.Errorf("Expected probe X-Tenant header, got %q", probeTenant)
+	}
+}
+
+// TestParseHealthCheckHeaders tests parsing the headers block inside health_check
+func TestParseHealthCheckHeaders(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			path /health
+			headers {
+				Authorization "Bearer {env.TOKEN}"
+				X-Tenant probe
+			}
+			timeout 2s
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	hc := handler.(*FailoverProxy).HealthChecks["http://a"]
+	if hc.Headers["Authorization"] != "Bearer {env.TOKEN}" || hc.Headers["X-Tenant"] != "probe" {
+		t.Errorf("Unexpected health check headers: %v", hc.Headers)
+	}
+	if time.Duration(hc.Timeout) != 2*time.Second {
+		t.Errorf("Expected options after the headers block to be parsed, got timeout %v", time.Duration(hc.Timeout))
+	}
+}
+
+// TestParseHealthCheckIncludeBasePath tests parsing include_base_path inside health_check
+func TestParseHealthCheckIncludeBasePath(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a/api http://b/api {
+		health_check http://a/api {
+			path /health
+			include_base_path
+		}
+		health_check http://b/api {
+			path /health
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	if !fp.HealthChecks["http://a/api"].IncludeBasePath {
+		t.Error("Expected include_base_path to be set")
+	}
+	if fp.HealthChecks["http://b/api"].IncludeBasePath {
+		t.Error("Expected include_base_path to default to off")
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			include_base_path yes
+		}
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for include_base_path with an argument")
+	}
+}
+
+// TestWaitForHealthy tests that provisioning waits for a healthy upstream and fails if none appears
+func TestWaitForHealthy(t *testing.T) {
+	newProxy := func(upstream string, wait time.Duration) *FailoverProxy {
+		return &FailoverProxy{
+			Upstreams: []string{upstream},
+			HealthChecks: map[string]*HealthCheck{
+				upstream: {Path: "/health", Interval: caddy.Duration(20 * time.Millisecond)},
+			},
+			WaitForHealthy: caddy.Duration(wait),
+		}
+	}
+
+	t.Run("becomes healthy", func(t *testing.T) {
+		var mu sync.Mutex
+		healthy := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		time.AfterFunc(100*time.Millisecond, func() {
+			mu.Lock()
+			healthy = true
+			mu.Unlock()
+		})
+
+		fp := newProxy(server.URL, 2*time.Second)
+		start := time.Now()
+		if err := fp.Provision(caddy.Context{}); err != nil {
+			t.Fatalf("Expected provisioning to succeed, got %v", err)
+		}
+		defer fp.Cleanup()
+
+		if time.Since(start) < 100*time.Millisecond {
+			t.Error("Expected provisioning to wait for the upstream to become healthy")
+		}
+		if !fp.isHealthy(server.URL) {
+			t.Error("Expected upstream to be healthy after provisioning")
+		}
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		fp := newProxy(server.URL, 150*time.Millisecond)
+		err := fp.Provision(caddy.Context{})
+		if err == nil {
+			fp.Cleanup()
+			t.Fatal("Expected provisioning to fail when no upstream becomes healthy")
+		}
+		if !strings.Contains(err.Error(), "wait_for_healthy") {
+			t.Errorf("Expected wait_for_healthy error, got %v", err)
+		}
+
+		// A later Cleanup from Caddy must be harmless
+		if err := fp.Cleanup(); err != nil {
+			t.Errorf("Expected second Cleanup to succeed, got %v", err)
+		}
+	})
+
+	t.Run("ignores unchecked upstreams", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		unchecked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer unchecked.Close()
+
+		fp := newProxy(server.URL, 150*time.Millisecond)
+		fp.Upstreams = append(fp.Upstreams, unchecked.URL)
+		err := fp.Provision(caddy.Context{})
+		if err == nil {
+			fp.Cleanup()
+			t.Fatal("Expected an upstream without a check not to satisfy wait_for_healthy")
+		}
+		if !strings.Contains(err.Error(), "wait_for_healthy") {
+			t.Errorf("Expected wait_for_healthy error, got %v", err)
+		}
+	})
+
+	t.Run("requires a check", func(t *testing.T) {
+		fp := &FailoverProxy{
+			Upstreams:      []string{"http://a.local"},
+			WaitForHealthy: caddy.Duration(time.Second),
+		}
+		err := fp.Provision(caddy.Context{})
+		if err == nil {
+			fp.Cleanup()
+			t.Fatal("Expected wait_for_healthy without any check to be rejected")
+		}
+		if !strings.Contains(err.Error(), "requires a health_check") {
+			t.Errorf("Expected a missing check error, got %v", err)
+		}
+	})
+}
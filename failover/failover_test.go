@@ -8,10 +8,56 @@ import (
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"go.uber.org/zap"
 )
 
+func TestProxyRegistryMaxPaths(t *testing.T) {
+	registry := &ProxyRegistry{
+		proxies: make(map[string]*ProxyEntry),
+		order:   make([]string, 0),
+	}
+	registry.SetMaxPaths(3, nil)
+
+	newProxy := func(path string) *FailoverProxy {
+		return &FailoverProxy{Upstreams: []string{"http://localhost:5051"}, HandlePath: path}
+	}
+
+	registry.Register("/a/*", newProxy("/a/*"))
+	registry.Register("/b/*", newProxy("/b/*"))
+	registry.Register("/c/*", newProxy("/c/*"))
+
+	// Re-registering /a/* makes /b/* the least recently registered path
+	registry.Register("/a/*", newProxy("/a/*"))
+
+	for _, path := range []string{"/d/*", "/e/*"} {
+		registry.Register(path, newProxy(path))
+		if len(registry.proxies) > 3 || len(registry.order) > 3 {
+			t.Fatalf("Registry exceeded cap: %d entries, order %v", len(registry.proxies), registry.order)
+		}
+	}
+
+	for _, evicted := range []string{"/b/*", "/c/*"} {
+		if _, ok := registry.proxies[evicted]; ok {
+			t.Errorf("Expected %s to be evicted", evicted)
+		}
+	}
+	expected := []string{"/a/*", "/d/*", "/e/*"}
+	for i, path := range expected {
+		if registry.order[i] != path {
+			t.Errorf("Expected order %v, got %v", expected, registry.order)
+			break
+		}
+	}
+
+	// Lowering the cap evicts immediately
+	registry.SetMaxPaths(1, nil)
+	if len(registry.proxies) != 1 || registry.order[0] != "/e/*" {
+		t.Errorf("Expected only /e/* to remain, got %v", registry.order)
+	}
+}
+
 func TestProxyRegistry(t *testing.T) {
 	// Create a new registry
 	registry := &ProxyRegistry{
@@ -431,3 +477,85 @@ func TestFailoverStatusHandler(t *testing.T) {
 		})
 	}
 }
+
+// TestFailoverStatusHandlerPassthroughNonGet tests that non-GET requests reach next when enabled
+func TestFailoverStatusHandlerPassthroughNonGet(t *testing.T) {
+	nextCalled := false
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		nextCalled = true
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	})
+
+	handler := FailoverStatusHandler{PassthroughNonGet: true}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/failover/status", nil)
+	w := httptest.NewRecorder()
+	if err := handler.ServeHTTP(w, req, next); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+
+	if !nextCalled {
+		t.Error("Expected POST to be passed to next handler")
+	}
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status from next handler %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	// GET is still served by the status handler
+	nextCalled = false
+	req = httptest.NewRequest(http.MethodGet, "/admin/failover/status", nil)
+	w = httptest.NewRecorder()
+	if err := handler.ServeHTTP(w, req, next); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	if nextCalled || w.Code != http.StatusOK {
+		t.Errorf("Expected GET to be served locally, got status %d (next called: %v)", w.Code, nextCalled)
+	}
+}
+
+// TestParseFailoverStatus tests parsing of the failover_status directive options
+func TestParseFailoverStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+		passthrough bool
+	}{
+		{name: "default", input: `failover_status`},
+		{
+			name: "passthrough_non_get",
+			input: `failover_status {
+				passthrough_non_get
+			}`,
+			passthrough: true,
+		},
+		{name: "unexpected argument", input: `failover_status extra`, expectError: true},
+		{
+			name: "unknown subdirective",
+			input: `failover_status {
+				bogus
+			}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(tt.input)}
+			handler, err := parseFailoverStatus(h)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := handler.(FailoverStatusHandler).PassthroughNonGet; got != tt.passthrough {
+				t.Errorf("Expected PassthroughNonGet %v, got %v", tt.passthrough, got)
+			}
+		})
+	}
+}
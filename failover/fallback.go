@@ -0,0 +1,87 @@
+package failover
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errAllUpstreamsFailed is returned instead of a response when every upstream
+// failed and fallback_to_next hands the request to the next handler
+var errAllUpstreamsFailed = errors.New("all upstreams failed")
+
+// FallbackResponse replaces the default 502 "All upstreams failed" response,
+// such as with a maintenance page or a 503 with Retry-After
+type FallbackResponse struct {
+	// StatusCode is the response status (default 502)
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Body is the response body. Its Content-Type is detected from the body
+	// unless set in Headers.
+	Body string `json:"body,omitempty"`
+
+	// Headers are set on the response
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// allFailedError is the json_errors body sent when every upstream failed
+type allFailedError struct {
+	Error     string           `json:"error"`
+	Upstreams []UpstreamStatus `json:"upstreams"`
+}
+
+// writeAllFailed writes the response for a request every upstream failed
+func (f *FailoverProxy) writeAllFailed(w http.ResponseWriter) {
+	if f.Fallback == nil && f.JSONErrors {
+		f.writeAllFailedJSON(w)
+		return
+	}
+	if f.Fallback == nil {
+		http.Error(w, "All upstreams failed", http.StatusBadGateway)
+		return
+	}
+
+	for name, value := range f.Fallback.Headers {
+		w.Header().Set(name, value)
+	}
+	if f.Fallback.Body != "" && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType([]byte(f.Fallback.Body)))
+	}
+	w.WriteHeader(f.Fallback.StatusCode)
+	w.Write([]byte(f.Fallback.Body))
+}
+
+// writeAllFailedJSON writes the json_errors response: a 502 with the status
+// of every upstream and, while upstreams are waiting out their fail
+// duration, a Retry-After of when the first of them is tried again
+func (f *FailoverProxy) writeAllFailedJSON(w http.ResponseWriter) {
+	if wait := f.retryAfter(); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadGateway)
+	json.NewEncoder(w).Encode(allFailedError{
+		Error:     "all upstreams failed",
+		Upstreams: f.GetUpstreamStatus(),
+	})
+}
+
+// retryAfter returns how long until the first failed upstream is tried
+// again, or zero when none is waiting out its fail duration
+func (f *FailoverProxy) retryAfter() time.Duration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var shortest time.Duration
+	for upstream, lastFail := range f.failureCache {
+		remaining := f.failDurationFor(upstream) - time.Since(lastFail)
+		if remaining > 0 && (shortest == 0 || remaining < shortest) {
+			shortest = remaining
+		}
+	}
+	return shortest
+}
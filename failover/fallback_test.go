@@ -0,0 +1,241 @@
+package failover
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// newDownUpstreams starts n upstreams that always fail
+func newDownUpstreams(t *testing.T, n int) []string {
+	upstreams := make([]string, n)
+	for i := range upstreams {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(server.Close)
+		upstreams[i] = server.URL
+	}
+	return upstreams
+}
+
+// TestFallbackResponse tests that the configured fallback is sent when every upstream is down
+func TestFallbackResponse(t *testing.T) {
+	fp := CreateTestProxy(t, newDownUpstreams(t, 2), func(fp *FailoverProxy) {
+		fp.Fallback = &FallbackResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       "Down for maintenance",
+			Headers:    map[string]string{"Retry-After": "120"},
+		}
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if w.Body.String() != "Down for maintenance" {
+		t.Errorf("Expected fallback body, got %q", w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "120" {
+		t.Errorf("Expected Retry-After 120, got %q", got)
+	}
+}
+
+// TestFallbackResponseDefaults tests the default response and fallback status
+func TestFallbackResponseDefaults(t *testing.T) {
+	serve := func(fp *FailoverProxy) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		return w
+	}
+
+	unconfigured := CreateTestProxy(t, newDownUpstreams(t, 1))
+	if w := serve(unconfigured); w.Code != http.StatusBadGateway || w.Body.String() != "All upstreams failed\n" {
+		t.Errorf("Expected the default 502 response, got %d %q", w.Code, w.Body.String())
+	}
+
+	bodyOnly := CreateTestProxy(t, newDownUpstreams(t, 1), func(fp *FailoverProxy) {
+		fp.Fallback = &FallbackResponse{Body: "<h1>Maintenance</h1>"}
+	})
+	w := serve(bodyOnly)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected fallback status to default to 502, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Expected Content-Type detected from the body, got %q", got)
+	}
+
+	invalid := &FailoverProxy{
+		Upstreams: []string{"http://a.example.com"},
+		Fallback:  &FallbackResponse{StatusCode: 700},
+	}
+	if err := invalid.Provision(caddy.Context{}); err == nil {
+		t.Error("Expected an error for an invalid fallback status")
+	}
+}
+
+// TestFallbackToNext tests that the next handler serves requests every upstream failed
+func TestFallbackToNext(t *testing.T) {
+	fp := CreateTestProxy(t, newDownUpstreams(t, 2), func(fp *FailoverProxy) {
+		fp.FallbackToNext = true
+		fp.BufferRequests = true
+		fp.Fallback = &FallbackResponse{StatusCode: http.StatusServiceUnavailable}
+	})
+
+	var nextBody string
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		data, _ := io.ReadAll(r.Body)
+		nextBody = string(data)
+		w.Write([]byte("served locally"))
+		return nil
+	})
+
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("payload"))
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, next); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK || w.Body.String() != "served locally" {
+		t.Errorf("Expected the next handler's response, got %d %q", w.Code, w.Body.String())
+	}
+	if nextBody != "payload" {
+		t.Errorf("Expected the next handler to receive the buffered body, got %q", nextBody)
+	}
+}
+
+// TestParseFallback tests parsing the fallback block
+func TestParseFallback(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		fallback {
+			status 503
+			body "Down for maintenance"
+			header Retry-After 120
+			header Content-Type text/plain
+		}
+		fallback_to_next
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fallback := handler.(*FailoverProxy).Fallback
+	if !handler.(*FailoverProxy).FallbackToNext {
+		t.Error("Expected fallback_to_next to be set")
+	}
+	if fallback == nil {
+		t.Fatal("Expected fallback to be set")
+	}
+	if fallback.StatusCode != 503 || fallback.Body != "Down for maintenance" {
+		t.Errorf("Unexpected fallback %+v", fallback)
+	}
+	if fallback.Headers["Retry-After"] != "120" || fallback.Headers["Content-Type"] != "text/plain" {
+		t.Errorf("Unexpected fallback headers: %v", fallback.Headers)
+	}
+
+	for _, input := range []string{
+		`failover_proxy http://a {
+			fallback {
+				status abc
+			}
+		}`,
+		`failover_proxy http://a {
+			fallback {
+				header Retry-After
+			}
+		}`,
+		`failover_proxy http://a {
+			fallback {
+				unknown
+			}
+		}`,
+	} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(input)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected an error parsing %q", input)
+		}
+	}
+}
+
+// TestJSONErrors tests the json_errors response when every upstream fails
+func TestJSONErrors(t *testing.T) {
+	upstreams := newDownUpstreams(t, 2)
+	fp := CreateTestProxy(t, upstreams, WithFailDuration(10*time.Second), func(fp *FailoverProxy) {
+		fp.JSONErrors = true
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", ct)
+	}
+	if got := w.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Expected Retry-After 10, got %q", got)
+	}
+
+	var body struct {
+		Error     string           `json:"error"`
+		Upstreams []UpstreamStatus `json:"upstreams"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body, got %q: %v", w.Body.String(), err)
+	}
+	if body.Error != "all upstreams failed" {
+		t.Errorf("Expected error message, got %q", body.Error)
+	}
+	if len(body.Upstreams) != 2 {
+		t.Fatalf("Expected 2 upstream statuses, got %+v", body.Upstreams)
+	}
+	for i, status := range body.Upstreams {
+		if status.Host != upstreams[i] || status.Status != "DOWN" {
+			t.Errorf("Expected upstream %s DOWN, got %+v", upstreams[i], status)
+		}
+	}
+
+	// A fallback response takes precedence
+	fp.Fallback = &FallbackResponse{StatusCode: http.StatusServiceUnavailable, Body: "maintenance"}
+	w = httptest.NewRecorder()
+	fp.writeAllFailed(w)
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "maintenance" {
+		t.Errorf("Expected the fallback response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestParseJSONErrors tests parsing the json_errors flag
+func TestParseJSONErrors(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		json_errors
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if !handler.(*FailoverProxy).JSONErrors {
+		t.Error("Expected JSONErrors to be set")
+	}
+}
@@ -0,0 +1,25 @@
+package failover
+
+import (
+	"strings"
+)
+
+// shouldForwardHeader reports whether an inbound request header is copied to
+// upstreams. With forward_headers_allow only listed headers are forwarded;
+// otherwise everything except forward_headers_deny is.
+func (f *FailoverProxy) shouldForwardHeader(name string) bool {
+	if len(f.ForwardHeadersAllow) > 0 {
+		return containsHeader(f.ForwardHeadersAllow, name)
+	}
+	return !containsHeader(f.ForwardHeadersDeny, name)
+}
+
+// containsHeader reports whether name is in the list, ignoring case
+func containsHeader(list []string, name string) bool {
+	for _, header := range list {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
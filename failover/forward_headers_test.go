@@ -0,0 +1,80 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// forwardedHeaders proxies one request carrying the given headers and returns what the upstream received
+func forwardedHeaders(t *testing.T, configure func(*FailoverProxy), headers map[string]string) http.Header {
+	t.Helper()
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.UpstreamHeaders = map[string]map[string]string{upstream.URL: {"X-Api-Key": "secret"}}
+		configure(fp)
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	return <-received
+}
+
+// TestForwardHeadersAllow tests that only allow-listed headers reach the upstream
+func TestForwardHeadersAllow(t *testing.T) {
+	got := forwardedHeaders(t, func(fp *FailoverProxy) {
+		fp.ForwardHeadersAllow = []string{"accept", "X-Request-Id"}
+		fp.ForwardHeadersDeny = []string{"Accept"}
+	}, map[string]string{
+		"Accept":       "application/json",
+		"X-Request-Id": "abc",
+		"Cookie":       "session=1",
+		"X-Internal":   "yes",
+	})
+
+	if got.Get("Accept") != "application/json" || got.Get("X-Request-Id") != "abc" {
+		t.Errorf("Expected allowed headers to be forwarded, got %v", got)
+	}
+	if got.Get("Cookie") != "" || got.Get("X-Internal") != "" {
+		t.Errorf("Expected headers outside the allow-list to be dropped, got %v", got)
+	}
+	if got.Get("X-Api-Key") != "secret" {
+		t.Error("Expected header_up to still apply")
+	}
+	if got.Get("X-Forwarded-Host") == "" {
+		t.Error("Expected proxy-set forwarding headers to still apply")
+	}
+}
+
+// TestForwardHeadersDeny tests that denied headers are stripped and the rest forwarded
+func TestForwardHeadersDeny(t *testing.T) {
+	got := forwardedHeaders(t, func(fp *FailoverProxy) {
+		fp.ForwardHeadersDeny = []string{"cookie", "X-Internal"}
+	}, map[string]string{
+		"Accept":     "application/json",
+		"Cookie":     "session=1",
+		"X-Internal": "yes",
+	})
+
+	if got.Get("Cookie") != "" || got.Get("X-Internal") != "" {
+		t.Errorf("Expected denied headers to be stripped, got %v", got)
+	}
+	if got.Get("Accept") != "application/json" {
+		t.Error("Expected other headers to be forwarded")
+	}
+	if got.Get("X-Api-Key") != "secret" {
+		t.Error("Expected header_up to still apply")
+	}
+}
@@ -0,0 +1,74 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// upstreamProtocolH2C speaks cleartext HTTP/2 to http:// upstreams, as gRPC servers expect
+const upstreamProtocolH2C = "h2c"
+
+// grpcStatusUnavailable is the gRPC status code of a server that can't take requests
+const grpcStatusUnavailable = "14"
+
+// newH2CClient creates an upstream client that speaks HTTP/2 over cleartext
+// connections, dialing like the shared transports do
+func (f *FailoverProxy) newH2CClient(idleTimeout time.Duration) *http.Client {
+	dialer := f.newDialer()
+	return newUpstreamClient(&http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		IdleConnTimeout: idleTimeout,
+	})
+}
+
+// provisionH2C replaces the clients of http:// upstreams, including dedicated
+// ones, with h2c clients
+func (f *FailoverProxy) provisionH2C() {
+	f.httpClient = f.newH2CClient(0)
+	for upstream, client := range f.upstreamClients {
+		if !strings.HasPrefix(upstream, "http://") {
+			continue
+		}
+		idleTimeout := client.Transport.(*http.Transport).IdleConnTimeout
+		f.upstreamClients[upstream] = f.newH2CClient(idleTimeout)
+	}
+}
+
+// isGRPCUnavailable reports whether a gRPC response carries the UNAVAILABLE
+// status in its headers, which a server or proxy sends without a body when it
+// can't take the call, so another upstream should be tried
+func isGRPCUnavailable(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/grpc" && !strings.HasPrefix(mediaType, "application/grpc+") {
+		return false
+	}
+	return resp.Header.Get("Grpc-Status") == grpcStatusUnavailable
+}
+
+// announceTrailers declares the upstream's trailers before the response
+// header is written, so HTTP/1.1 clients receive them too
+func announceTrailers(w http.ResponseWriter, resp *http.Response) {
+	for name := range resp.Trailer {
+		w.Header().Add("Trailer", name)
+	}
+}
+
+// copyTrailers sends the upstream's trailers, such as gRPC's grpc-status,
+// once the body has been copied
+func copyTrailers(w http.ResponseWriter, resp *http.Response) {
+	for name, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+name, value)
+		}
+	}
+}
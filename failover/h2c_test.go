@@ -0,0 +1,134 @@
+package failover
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newGRPCEchoServer starts an h2c server that echoes the request body like a
+// unary gRPC call, sending grpc-status in undeclared trailers as gRPC servers do
+func newGRPCEchoServer(t *testing.T, name string) *httptest.Server {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", name)
+	}), &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestH2CTrailers tests that h2c upstreams are reached over HTTP/2 and their
+// trailers survive the proxy
+func TestH2CTrailers(t *testing.T) {
+	upstream := newGRPCEchoServer(t, "echo")
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.UpstreamProtocol = upstreamProtocolH2C
+	})
+
+	req := httptest.NewRequest("POST", "http://example.com/echo.Echo/Say", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello" {
+		t.Errorf("Expected echoed body, got %q", body)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected grpc-status trailer 0, got %q", got)
+	}
+	if got := resp.Trailer.Get("Grpc-Message"); got != "echo" {
+		t.Errorf("Expected grpc-message trailer echo, got %q", got)
+	}
+}
+
+// TestH2CFailover tests that connection failures and gRPC UNAVAILABLE
+// responses fail over to the next upstream
+func TestH2CFailover(t *testing.T) {
+	unavailable := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", "draining")
+		w.WriteHeader(http.StatusOK)
+	}), &http2.Server{}))
+	defer unavailable.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	backup := newGRPCEchoServer(t, "backup")
+
+	for name, primary := range map[string]string{
+		"connection refused": downURL,
+		"grpc unavailable":   unavailable.URL,
+	} {
+		t.Run(name, func(t *testing.T) {
+			fp := CreateTestProxy(t, []string{primary, backup.URL}, func(fp *FailoverProxy) {
+				fp.UpstreamProtocol = upstreamProtocolH2C
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/echo.Echo/Say", strings.NewReader("hello"))
+			req.Header.Set("Content-Type", "application/grpc")
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, req, nil); err != nil {
+				t.Fatalf("ServeHTTP error: %v", err)
+			}
+
+			resp := w.Result()
+			io.ReadAll(resp.Body)
+			if got := resp.Trailer.Get("Grpc-Message"); got != "backup" {
+				t.Errorf("Expected the backup to serve the call, got grpc-message %q", got)
+			}
+		})
+	}
+}
+
+// TestParseUpstreamProtocol tests parsing and validating upstream_protocol
+func TestParseUpstreamProtocol(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		upstream_protocol h2c
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).UpstreamProtocol; got != upstreamProtocolH2C {
+		t.Errorf("Expected upstream_protocol h2c, got %q", got)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		upstream_protocol spdy
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for an unknown upstream_protocol")
+	}
+
+	fp := &FailoverProxy{Upstreams: []string{"http://a.example.com"}, UpstreamProtocol: "spdy"}
+	if err := fp.Provision(caddy.Context{}); err == nil {
+		t.Error("Expected provisioning to reject an unknown upstream_protocol")
+	}
+}
@@ -6,13 +6,18 @@ import (
 	"crypto/md5"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
@@ -21,6 +26,7 @@ import (
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/ejlevin1/caddy-failover/api_registrar"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
 )
 
 // ParseFailoverProxy parses the failover_proxy directive
@@ -33,6 +39,35 @@ func ParseFailoverStatus(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, e
 	return parseFailoverStatus(h)
 }
 
+// failoverWarning is the Warning header value added by warn_on_failover
+const failoverWarning = `199 caddy-failover "served from failover"`
+
+// errLoopDetected is returned when an upstream reports a proxy loop
+var errLoopDetected = errors.New("upstream reported a proxy loop")
+
+// echoLastErrorLimit caps how much of a failed upstream's body is kept for echo_last_error
+const echoLastErrorLimit = 64 << 10
+
+// upstreamStatusError is returned when an upstream answers with a 5xx status
+type upstreamStatusError struct {
+	status int
+	header http.Header // set when echo_last_error or prefer_primary_error is enabled
+	body   []byte      // as header, truncated to echoLastErrorLimit
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream returned %d", e.status)
+}
+
+// hopsHeader counts how many failover proxies a request has passed through
+const hopsHeader = "X-Failover-Hops"
+
+// X-Forwarded-For modes
+const (
+	xffModeReplace = "replace" // send only the client IP
+	xffModeAppend  = "append"  // add the client IP to the received chain
+)
+
 var (
 	// Global registry to track all failover proxy instances
 	proxyRegistry = &ProxyRegistry{
@@ -46,13 +81,52 @@ type ProxyEntry struct {
 	Path      string
 	Proxy     *FailoverProxy
 	Upstreams map[string]bool // Track unique upstreams to prevent duplicates
+	lastSeen  uint64          // registration clock value of the latest (re-)registration
 }
 
 // ProxyRegistry tracks all failover proxy instances for status reporting
 type ProxyRegistry struct {
-	mu      sync.RWMutex
-	proxies map[string]*ProxyEntry // path -> proxy entry
-	order   []string               // maintains registration order
+	mu       sync.RWMutex
+	proxies  map[string]*ProxyEntry // path -> proxy entry
+	order    []string               // maintains registration order
+	maxPaths int                    // evict least recently registered paths beyond this (0 = unbounded)
+	clock    uint64                 // incremented on every registration
+
+	subscribers statusSubscribers // status stream listeners, locked separately
+}
+
+// SetMaxPaths bounds the number of registered paths, evicting the least
+// recently registered ones if the registry is already larger
+func (r *ProxyRegistry) SetMaxPaths(limit int, logger *zap.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxPaths = limit
+	r.evictLocked(logger)
+}
+
+// evictLocked removes the least recently registered paths until the registry
+// is within its bound. Must be called with lock held.
+func (r *ProxyRegistry) evictLocked(logger *zap.Logger) {
+	for r.maxPaths > 0 && len(r.proxies) > r.maxPaths {
+		oldest := ""
+		for path, entry := range r.proxies {
+			if oldest == "" || entry.lastSeen < r.proxies[oldest].lastSeen {
+				oldest = path
+			}
+		}
+		delete(r.proxies, oldest)
+		for i, p := range r.order {
+			if p == oldest {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+		if logger != nil {
+			logger.Warn("evicted failover proxy registration, max_registered_paths reached",
+				zap.String("path", oldest),
+				zap.Int("max_registered_paths", r.maxPaths))
+		}
+	}
 }
 
 // Register adds a proxy to the registry
@@ -60,12 +134,16 @@ func (r *ProxyRegistry) Register(path string, proxy *FailoverProxy) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.clock++
+	defer r.evictLocked(proxy.logger)
+
 	// Check if this path already exists
 	if entry, exists := r.proxies[path]; exists {
 		// Replace the old proxy with the new one to handle re-provisioning
 		// This happens when routes are dynamically updated
 		oldProxy := entry.Proxy
 		entry.Proxy = proxy
+		entry.lastSeen = r.clock
 		entry.Upstreams = make(map[string]bool)
 		for _, upstream := range proxy.Upstreams {
 			entry.Upstreams[upstream] = true
@@ -85,6 +163,7 @@ func (r *ProxyRegistry) Register(path string, proxy *FailoverProxy) {
 			Path:      path,
 			Proxy:     proxy,
 			Upstreams: make(map[string]bool),
+			lastSeen:  r.clock,
 		}
 		for _, upstream := range proxy.Upstreams {
 			entry.Upstreams[upstream] = true
@@ -206,11 +285,28 @@ type PathStatus struct {
 // UpstreamStatus represents the status of a single upstream
 type UpstreamStatus struct {
 	Host         string    `json:"host"`
-	Status       string    `json:"status"` // UP, DOWN, UNHEALTHY
+	Status       string    `json:"status" enum:"UP|DOWN|UNHEALTHY"`
 	LastCheck    time.Time `json:"last_check,omitempty"`
 	LastFailure  time.Time `json:"last_failure,omitempty"`
+	LastSuccess  time.Time `json:"last_success,omitempty"`
+	Substatus    string    `json:"substatus,omitempty" enum:"TLS_ERROR"`
+	Circuit      string    `json:"circuit,omitempty" enum:"CLOSED|OPEN|HALF_OPEN"`
 	HealthCheck  bool      `json:"health_check_enabled"`
 	ResponseTime int64     `json:"response_time_ms,omitempty"`
+
+	// Request metrics, reported for the active upstream only
+	RequestCount   int64   `json:"request_count,omitempty"`
+	FailedRequests int64   `json:"failed_requests,omitempty"`
+	AvgResponseMs  float64 `json:"avg_response_ms,omitempty"`
+	SuccessRate    float64 `json:"success_rate,omitempty"` // Percentage
+
+	// InFlight is the number of requests currently sent to the upstream,
+	// reported when max_concurrent is set
+	InFlight int64 `json:"in_flight,omitempty"`
+
+	// Disabled reports that the upstream was taken out of rotation through
+	// the status endpoint
+	Disabled bool `json:"disabled,omitempty"`
 }
 
 // ActiveUpstream tracks the currently active upstream and its metrics
@@ -253,17 +349,86 @@ func (a *ActiveUpstream) UpdateMetrics(responseMs int64, success bool) {
 
 // HealthCheck defines health check configuration for an upstream
 type HealthCheck struct {
-	// Path is the health check endpoint path
+	// Path is the health check endpoint path. It may contain the
+	// {upstream.host}, {upstream.port} and {upstream.scheme} placeholders.
 	Path string `json:"path,omitempty"`
 
+	// Paths are further endpoints probed along with Path, such as /ready
+	// next to /live; Require decides how their results combine
+	Paths []string `json:"paths,omitempty"`
+
+	// Require is "all" when every path must pass for the upstream to be
+	// healthy, or "any" when one passing path is enough (default "all")
+	Require string `json:"require,omitempty"`
+
+	// IncludeBasePath prefixes Path with the upstream's own path, so an
+	// upstream of http://host/api/v1 is probed at /api/v1/health rather
+	// than /health
+	IncludeBasePath bool `json:"include_base_path,omitempty"`
+
 	// Interval is how often to perform health checks (default 30s)
 	Interval caddy.Duration `json:"interval,omitempty"`
 
 	// Timeout is the timeout for health check requests (default 5s)
 	Timeout caddy.Duration `json:"timeout,omitempty"`
 
+	// Type is how the upstream is probed: "http" requests Path, "tcp" only
+	// connects to the upstream's host and port (default "http")
+	Type string `json:"type,omitempty"`
+
 	// ExpectedStatus is the expected HTTP status code (default 200)
 	ExpectedStatus int `json:"expected_status,omitempty"`
+
+	// ExpectedStatusMin and ExpectedStatusMax bound an inclusive range of
+	// healthy status codes, such as 200-299. When set the range takes
+	// precedence over ExpectedStatus.
+	ExpectedStatusMin int `json:"expected_status_min,omitempty"`
+	ExpectedStatusMax int `json:"expected_status_max,omitempty"`
+
+	// ExpectedBody is a substring the probe response body must contain, so a
+	// 200 carrying an error payload still counts as unhealthy
+	ExpectedBody string `json:"expected_body,omitempty"`
+
+	// ExpectedBodyRegex is a regular expression the probe response body must match
+	ExpectedBodyRegex string `json:"expected_body_regex,omitempty"`
+
+	// Headers are extra headers sent with every probe, such as an auth token;
+	// values support {env.VAR} placeholders
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Host overrides the Host header of probe requests so virtual-hosted
+	// backends route them to the right site. Environment variables are expanded.
+	Host string `json:"host,omitempty"`
+
+	// HTTPVersion forces the protocol used for probes, "1.1" or "2". HTTP/2
+	// is used over cleartext (h2c) for http:// upstreams. By default probes
+	// use the same transport as proxied traffic.
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	// ConfirmRecovery is how many additional, quickly repeated probes must pass
+	// after an unhealthy upstream's first successful probe before it is
+	// trusted again (default 0)
+	ConfirmRecovery int `json:"confirm_recovery,omitempty"`
+
+	// InitialProbes is how many consecutive probes must pass before the
+	// upstream is first considered healthy after startup (default 1)
+	InitialProbes int `json:"initial_probes,omitempty"`
+
+	// HealthyThreshold is how many consecutive probes must pass before an
+	// unhealthy upstream is marked healthy (default 1)
+	HealthyThreshold int `json:"healthy_threshold,omitempty"`
+
+	// UnhealthyThreshold is how many consecutive probes must fail before a
+	// healthy upstream is marked unhealthy (default 1)
+	UnhealthyThreshold int `json:"unhealthy_threshold,omitempty"`
+
+	client        *http.Client   // dedicated probe client when HTTPVersion is set
+	bodyRegex     *regexp.Regexp // compiled ExpectedBodyRegex, nil when unset
+	confirmations int            // passes so far while confirming a recovery, owned by the checker goroutine
+	initialPasses int            // consecutive passes towards InitialProbes, owned by the checker goroutine
+	included      bool           // whether InitialProbes has been satisfied
+	streak        probeStreak    // consecutive results for the thresholds, owned by the checker goroutine
+	stop          chan struct{}  // closed to stop checking an upstream that was removed
 }
 
 // FailoverProxy is a Caddy HTTP handler that tries multiple upstream servers
@@ -275,39 +440,397 @@ type FailoverProxy struct {
 	// UpstreamHeaders is a map of upstream URL to headers
 	UpstreamHeaders map[string]map[string]string `json:"upstream_headers,omitempty"`
 
+	// DownstreamHeaders is a map of upstream URL to headers set on its responses;
+	// a name with a leading "-" removes that header instead
+	DownstreamHeaders map[string]map[string]string `json:"downstream_headers,omitempty"`
+
+	// MethodRewrites is a map of upstream URL to request methods that are
+	// replaced when proxying to it, e.g. PATCH -> POST for a legacy backend
+	MethodRewrites map[string]map[string]string `json:"method_rewrites,omitempty"`
+
+	// PathRewrites is a map of upstream URL to rewrites applied to the request
+	// path before it is joined with the upstream's base path, e.g. to strip
+	// an /api prefix for one backend only
+	PathRewrites map[string][]*PathRewrite `json:"path_rewrites,omitempty"`
+
+	// ForwardHeadersAllow, when set, limits the inbound request headers copied
+	// to upstreams to this list. It takes precedence over ForwardHeadersDeny.
+	ForwardHeadersAllow []string `json:"forward_headers_allow,omitempty"`
+
+	// ForwardHeadersDeny lists inbound request headers never copied to upstreams
+	ForwardHeadersDeny []string `json:"forward_headers_deny,omitempty"`
+
+	// AcceptOverrides is a map of upstream URL to the Accept header sent to it,
+	// taking precedence over both the client's Accept and header_up
+	AcceptOverrides map[string]string `json:"accept_overrides,omitempty"`
+
+	// PreserveHost sends the client's Host header to upstreams instead of
+	// the upstream's own host, for virtual-hosted backends
+	PreserveHost bool `json:"preserve_host,omitempty"`
+
+	// HostHeaders is a map of upstream URL to the Host header sent to it,
+	// taking precedence over PreserveHost
+	HostHeaders map[string]string `json:"host_headers,omitempty"`
+
+	// XFFMode is how the client IP is added to X-Forwarded-For: "replace"
+	// sends only the client IP, "append" adds it to the chain received from
+	// proxies in front (default "replace")
+	XFFMode string `json:"xff_mode,omitempty"`
+
+	// TrustedProxies are the CIDR ranges or IP addresses of proxies whose
+	// X-Forwarded-For chain and X-Forwarded-Proto are honored. Requests from
+	// other addresses have them replaced from the connection. When empty
+	// every request's headers are honored.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+
+	// UpstreamIdleTimeouts is a map of upstream URL to the idle time after which
+	// its pooled connections are closed (default 90s)
+	UpstreamIdleTimeouts map[string]caddy.Duration `json:"upstream_idle_conn_timeouts,omitempty"`
+
+	// SRVUpstreams are SRV records whose targets are added to the rotation
+	// after Upstreams and health-checked like them
+	SRVUpstreams []*SRVUpstream `json:"srv_upstreams,omitempty"`
+
+	// UpstreamALPN is a map of HTTPS upstream URL to the ALPN protocols
+	// offered in its TLS handshake, for servers requiring specific protocols
+	UpstreamALPN map[string][]string `json:"upstream_tls_alpn,omitempty"`
+
+	// UpstreamRenegotiation is a map of HTTPS upstream URL to the TLS
+	// renegotiation it may initiate: "never", "once" or "freely" (default never)
+	UpstreamRenegotiation map[string]string `json:"upstream_tls_renegotiation,omitempty"`
+
+	// ExpectContentTypes is a map of upstream URL to the media type its
+	// responses must have; anything else is treated as a failure
+	ExpectContentTypes map[string]string `json:"expect_content_types,omitempty"`
+
+	// MaxResponseTimes is a map of upstream URL to the longest it may take to
+	// start responding, covering connect, request write and response headers,
+	// before the attempt is abandoned and the next upstream tried
+	MaxResponseTimes map[string]caddy.Duration `json:"max_response_times,omitempty"`
+
 	// HealthChecks is a map of upstream URL to health check configuration
 	HealthChecks map[string]*HealthCheck `json:"health_checks,omitempty"`
 
+	// ProbeCallback is a URL that every health check result is POSTed to as
+	// JSON, for external monitoring; delivery never delays probing
+	ProbeCallback string `json:"probe_callback,omitempty"`
+
+	// PingChecks is a map of upstream URL to ICMP ping check configuration
+	PingChecks map[string]*PingCheck `json:"ping_checks,omitempty"`
+
 	// InsecureSkipVerify allows skipping TLS verification for HTTPS upstreams
 	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
 
+	// TLSClientCert and TLSClientKey are PEM files holding the client
+	// certificate presented to HTTPS upstreams that require mutual TLS.
+	// Environment variables in the paths are expanded.
+	TLSClientCert string `json:"tls_client_cert,omitempty"`
+	TLSClientKey  string `json:"tls_client_key,omitempty"`
+
+	// TLSTrustedCA is a PEM file of CA certificates used instead of the
+	// system roots to verify HTTPS upstreams
+	TLSTrustedCA string `json:"tls_trusted_ca,omitempty"`
+
+	// TLSSessionCacheSize is the number of TLS sessions cached for resumption
+	// across HTTPS upstreams (default 64, negative disables the cache)
+	TLSSessionCacheSize int `json:"tls_session_cache,omitempty"`
+
+	// ViaProxy is an outbound proxy URL (http, https or socks5) that upstream
+	// connections and health checks go through. HTTPS upstreams are tunneled
+	// with CONNECT. Environment variables are expanded.
+	ViaProxy string `json:"via_proxy,omitempty"`
+
+	// HealthPrecedence decides how active health checks and passive failure
+	// tracking combine: "active", "passive" or "combined" (default)
+	HealthPrecedence string `json:"health_precedence,omitempty"`
+
 	// FailDuration is how long to remember a failed upstream (default 30s)
 	FailDuration caddy.Duration `json:"fail_duration,omitempty"`
 
+	// FailDurationTLS is how long to remember an upstream whose TLS handshake
+	// failed, since certificate problems rarely fix themselves (default FailDuration)
+	FailDurationTLS caddy.Duration `json:"fail_duration_tls,omitempty"`
+
+	// SlowStart is how long an upstream that passes its health check again
+	// takes to ramp up to its full share of requests; until then requests
+	// outside the ramping share try the next healthy upstream first
+	// (0 disables slow start)
+	SlowStart caddy.Duration `json:"slow_start,omitempty"`
+
 	// DialTimeout is the timeout for establishing connection (default 2s)
 	DialTimeout caddy.Duration `json:"dial_timeout,omitempty"`
 
+	// DialRetries is how many times a failed TCP connection is retried within a
+	// single upstream attempt before failing over (default 0)
+	DialRetries int `json:"dial_retries,omitempty"`
+
+	// DNSCacheTTL is how long the last successful DNS resolution of an upstream
+	// host may be used when live resolution fails (0 disables the cache)
+	DNSCacheTTL caddy.Duration `json:"dns_cache_ttl,omitempty"`
+
 	// ResponseTimeout is the timeout for receiving response (default 5s)
 	ResponseTimeout caddy.Duration `json:"response_timeout,omitempty"`
 
+	// MaxConnsPerHost caps the connections opened to each upstream host
+	// (0 means unlimited). Requests beyond the cap queue for a free connection.
+	MaxConnsPerHost int `json:"max_conns_per_host,omitempty"`
+
+	// MaxConnsWait is how long a request may queue for a connection under
+	// MaxConnsPerHost before failing over (default DialTimeout)
+	MaxConnsWait caddy.Duration `json:"max_conns_wait,omitempty"`
+
+	// MaxIdleConns caps the idle connections kept open across all upstream
+	// hosts (default 100)
+	MaxIdleConns int `json:"max_idle_conns,omitempty"`
+
+	// MaxIdleConnsPerHost caps the idle connections kept open to each
+	// upstream host (default 2)
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host,omitempty"`
+
+	// IdleConnTimeout is how long an idle upstream connection is kept open
+	// (default 90s); UpstreamIdleTimeouts overrides it per upstream
+	IdleConnTimeout caddy.Duration `json:"idle_conn_timeout,omitempty"`
+
+	// ExpectContinueTimeout is how long to wait for an upstream's 100 Continue
+	// before sending the body of an Expect: 100-continue request (default 1s)
+	ExpectContinueTimeout caddy.Duration `json:"expect_continue_timeout,omitempty"`
+
 	// HandlePath is the handle block path (e.g., /auth/*) - automatically detected or explicitly set
 	HandlePath string `json:"handle_path,omitempty"`
 
+	// MaxBufferSize is the largest chunked request body buffered in memory so it
+	// can be replayed on failover (0 disables buffering of chunked bodies)
+	MaxBufferSize int64 `json:"max_buffer_size,omitempty"`
+
+	// FailoverStatusCodes are the upstream response statuses treated as
+	// failures and failed over (default any 5xx)
+	FailoverStatusCodes []int `json:"failover_status_codes,omitempty"`
+
+	// NeverFailoverStatusCodes are upstream response statuses always served
+	// to the client, even if FailoverStatusCodes or an expected Content-Type
+	// would otherwise fail them over, e.g. 4xx errors caused by the client
+	NeverFailoverStatusCodes []int `json:"never_failover_status_codes,omitempty"`
+
+	// BufferRequests reads request bodies into memory, up to
+	// BufferRequestsLimit, so they can be resent to every upstream attempted
+	BufferRequests bool `json:"buffer_requests,omitempty"`
+
+	// BufferRequestsLimit is the largest body buffered by BufferRequests
+	// (default 10MB); larger bodies go to the first upstream only
+	BufferRequestsLimit int64 `json:"buffer_requests_limit,omitempty"`
+
+	// EchoLastError returns the last upstream's failure status and body (up to
+	// 64KB) when all upstreams fail, instead of a generic 502
+	EchoLastError bool `json:"echo_last_error,omitempty"`
+
+	// PreferPrimaryError returns the primary upstream's failure status and body
+	// (up to 64KB) when all upstreams fail, falling back to the generic 502 if
+	// the primary didn't answer with a response
+	PreferPrimaryError bool `json:"prefer_primary_error,omitempty"`
+
+	// WarnOnFailover adds a Warning header to responses served by a non-primary upstream
+	WarnOnFailover bool `json:"warn_on_failover,omitempty"`
+
+	// LBPolicy picks the upstream each request tries first: "first" (default),
+	// "round_robin" or "random". Later upstreams are still tried on failure.
+	LBPolicy string `json:"lb_policy,omitempty"`
+
+	// Sticky routes requests with the same session key to the same live
+	// upstream, taking precedence over LBPolicy. Requests fail over as usual
+	// when that upstream is down.
+	Sticky *StickySession `json:"sticky,omitempty"`
+
+	// ActiveSelection picks the active upstream among the healthy ones:
+	// "order" (default) takes the first, "success_rate" the one with the best
+	// request success rate. Under the first policy requests start at it.
+	ActiveSelection string `json:"active_selection,omitempty"`
+
+	// UpstreamWeights is a map of upstream URL to its share of requests under
+	// the round_robin and random policies; upstreams without a weight count as 1
+	UpstreamWeights map[string]int `json:"upstream_weights,omitempty"`
+
+	// AdaptiveWeights spreads traffic across healthy upstreams with weights
+	// inversely proportional to their health check response times
+	AdaptiveWeights bool `json:"adaptive_weights,omitempty"`
+
+	// BodyURLRewrites rewrites internal hosts in absolute URLs found in text
+	// response bodies to the external host clients should use
+	BodyURLRewrites []BodyURLRewrite `json:"body_url_rewrites,omitempty"`
+
+	// DetectMismatchedEncoding sniffs bodies without Content-Encoding for the
+	// gzip magic number and either declares the encoding ("header") or
+	// decompresses the body ("decompress"). Empty disables detection.
+	DetectMismatchedEncoding string `json:"detect_mismatched_encoding,omitempty"`
+
+	// DecompressResponse gunzips upstream responses sent with
+	// Content-Encoding: gzip, for clients that can't decode them. By default
+	// encoded bodies are passed through untouched.
+	DecompressResponse bool `json:"decompress_response,omitempty"`
+
+	// MetricsBuckets are the upper bounds, in seconds, of the request duration
+	// histogram exposed by failover_metrics (default Prometheus buckets)
+	MetricsBuckets []float64 `json:"metrics_buckets,omitempty"`
+
+	// CookiePrefix namespaces cookies set by the proxy itself so they don't
+	// collide with upstream cookies (default "failover_")
+	CookiePrefix string `json:"cookie_prefix,omitempty"`
+
+	// MaxRegisteredPaths bounds the shared registry of proxies reported by
+	// failover_status, evicting the least recently registered paths (0 = unbounded)
+	MaxRegisteredPaths int `json:"max_registered_paths,omitempty"`
+
+	// WaitForHealthy makes provisioning block until an upstream passes its
+	// initial health check, failing if none does within this duration
+	WaitForHealthy caddy.Duration `json:"wait_for_healthy,omitempty"`
+
+	// StartupJitter delays each instance's initial health probes by a random
+	// amount up to this duration, spreading load when a fleet restarts at once
+	StartupJitter caddy.Duration `json:"startup_jitter,omitempty"`
+
+	// LogSampling logs only 1 in N routine events (successful proxies and
+	// failovers) on busy paths. The first of each is always logged, as are
+	// all errors (default 1, log everything).
+	LogSampling int `json:"log_sampling,omitempty"`
+
+	// DrainTimeout is how long Cleanup waits for in-flight requests to finish
+	// on a config reload before returning (disabled when 0)
+	DrainTimeout caddy.Duration `json:"drain_timeout,omitempty"`
+
+	// DebugUpstreams are upstream URLs whose attempts are logged verbosely
+	// (request and response headers, status and timing) at info level
+	DebugUpstreams []string `json:"debug_upstreams,omitempty"`
+
+	// SelfHealthPath is a request path answered locally with 200 instead of being
+	// proxied, so load balancers can probe the proxy itself
+	SelfHealthPath string `json:"self_health_path,omitempty"`
+
+	// SelfHealthStatus includes the proxy's upstream status in self-health responses
+	SelfHealthStatus bool `json:"self_health_status,omitempty"`
+
+	// MaxHops is the number of failover proxies a request may pass through
+	// before it is rejected with 508 Loop Detected (default 10)
+	MaxHops int `json:"max_hops,omitempty"`
+
+	// Coalesce shares a single upstream request between concurrent identical
+	// cacheable GET requests, all of which receive the same response
+	Coalesce bool `json:"coalesce,omitempty"`
+
+	// Retries is how many times a failed request is retried against the same
+	// upstream before it is marked failed and the next upstream tried (default 0)
+	Retries int `json:"retries,omitempty"`
+
+	// RetryBackoff is the delay before the first retry, doubling for each
+	// further retry (default 100ms)
+	RetryBackoff caddy.Duration `json:"retry_backoff,omitempty"`
+
+	// RetryAllMethods allows retrying non-idempotent requests such as POST
+	RetryAllMethods bool `json:"retry_all_methods,omitempty"`
+
+	// RetryBudget caps the ratio of failovers to primary attempts (disabled when nil)
+	RetryBudget *RetryBudget `json:"retry_budget,omitempty"`
+
+	// Merge combines this proxy with other failover_proxy directives for the
+	// same path in its handle block: later directives' upstreams and their
+	// settings are appended to the first one's
+	Merge bool `json:"merge,omitempty"`
+
+	// MergedInto marks a directive whose upstreams were merged into an earlier
+	// failover_proxy for this path in the same handle block; it passes requests
+	// on without proxying. It is set at provision.
+	MergedInto string `json:"merged_into,omitempty"`
+
+	// SizeRoute prefers a designated upstream for requests with large bodies
+	// (disabled when nil)
+	SizeRoute *SizeRoute `json:"size_route,omitempty"`
+
+	// Canary tries a percentage of requests on an extra upstream first,
+	// failing over to the normal order (disabled when nil)
+	Canary *Canary `json:"canary,omitempty"`
+
+	// CircuitBreaker takes upstreams out of rotation after consecutive failures
+	// instead of after each one (disabled when nil)
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker,omitempty"`
+
+	// PassiveHealth marks upstreams unhealthy after consecutive request
+	// failures, without an active health check (disabled when nil)
+	PassiveHealth *PassiveHealth `json:"passive_health,omitempty"`
+
+	// Fallback is the response sent when every upstream fails (default 502
+	// "All upstreams failed")
+	Fallback *FallbackResponse `json:"fallback,omitempty"`
+
+	// FallbackToNext passes requests every upstream failed to the next
+	// handler in the route, such as a file server, instead of responding
+	FallbackToNext bool `json:"fallback_to_next,omitempty"`
+
+	// JSONErrors replaces the plain-text 502 sent when every upstream fails
+	// with a JSON body listing the upstream statuses and a Retry-After
+	// header. Fallback takes precedence.
+	JSONErrors bool `json:"json_errors,omitempty"`
+
+	// LogRequests writes one structured entry per request with the upstream
+	// that served it, the number of upstreams tried, the status and the
+	// elapsed time
+	LogRequests bool `json:"log_requests,omitempty"`
+
+	// UpstreamProtocol selects the protocol spoken to http:// upstreams. "h2c"
+	// uses cleartext HTTP/2, for gRPC servers; by default HTTP/1.1 is used.
+	UpstreamProtocol string `json:"upstream_protocol,omitempty"`
+
+	// UpstreamHTTPVersions are the HTTP versions, "1.1" and/or "2", offered
+	// to https:// upstreams through ALPN, such as only "1.1" for upstreams
+	// that misbehave over HTTP/2. By default Go's defaults apply.
+	UpstreamHTTPVersions []string `json:"upstream_http_versions,omitempty"`
+
+	// MaxConcurrent caps the requests in flight to each upstream. An upstream
+	// at its limit is skipped for the request, so a failover storm spreads
+	// across the remaining upstreams instead of overloading one (0 = no limit)
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+
 	// autoDetectedPath stores the auto-detected path for warning purposes (not serialized)
 	autoDetectedPath string
 
-	logger         *zap.Logger
-	replacer       *caddy.Replacer
-	httpClient     *http.Client
-	httpsClient    *http.Client
-	failureCache   map[string]time.Time
-	healthStatus   map[string]bool // true = healthy, false = unhealthy
-	lastCheckTime  map[string]time.Time
-	responseTime   map[string]int64 // response time in milliseconds
-	activeUpstream *ActiveUpstream  // Currently active upstream with metrics
-	mu             sync.RWMutex
-	shutdown       chan struct{}
-	wg             sync.WaitGroup
+	logger          *zap.Logger
+	replacer        *caddy.Replacer
+	httpClient      *http.Client
+	httpsClient     *http.Client
+	upstreamClients map[string]*http.Client // Dedicated clients for upstreams with custom transports
+	failureCache    map[string]time.Time
+	tlsFailures     map[string]bool          // Upstreams whose last failure was a TLS handshake error
+	circuits        map[string]*circuitState // Circuit breaker state per upstream
+	passiveStates   map[string]*passiveState // Passive health state per upstream
+	healthStatus    map[string]bool          // true = healthy, false = unhealthy
+	lastCheckTime   map[string]time.Time
+	lastSuccess     map[string]time.Time       // When each upstream last served a request successfully
+	recoveredAt     map[string]time.Time       // When each upstream last became healthy again, for SlowStart
+	responseTime    map[string]int64           // response time in milliseconds
+	pingStatus      map[string]bool            // ICMP reachability per upstream, when ping checks are configured
+	activeUpstream  *ActiveUpstream            // Currently active upstream with metrics
+	upstreamMetrics map[string]*ActiveUpstream // Request metrics per upstream, for success_rate selection
+	upstreamActive  map[string]*atomic.Int64   // Requests active per upstream, for MaxConcurrent
+	disabled        map[string]bool            // Upstreams administratively taken out of rotation
+	declaredChecks  map[string]HealthCheck     // Health checks as configured, to restart for re-added upstreams
+	trustedNets     []*net.IPNet               // Parsed TrustedProxies
+	retryBudget     *retryBudget               // Runtime retry budget, nil when disabled
+	latency         *latencyHistogram          // Per-upstream request duration histogram
+	coalesceMu      sync.Mutex                 // Guards coalesceCalls
+	coalesceCalls   map[string]*coalesceCall   // In-flight coalesced fetches by coalesceKey
+	dnsCache        *dnsCache                  // Last-known upstream addresses, nil when disabled
+	proxyURL        *url.URL                   // Parsed ViaProxy, nil when connecting directly
+	roundRobin      atomic.Uint64              // Requests started under the round_robin policy
+	successLogs     atomic.Uint64              // Successful proxies seen, for LogSampling
+	failoverLogs    atomic.Uint64              // Failovers seen, for LogSampling
+	debugUpstreams  map[string]bool            // Expanded DebugUpstreams for lookup per attempt
+	failoverStatus  map[int]bool               // FailoverStatusCodes as a set, nil for the 5xx default
+	neverFailover   map[int]bool               // NeverFailoverStatusCodes as a set
+	probeCallback   *probeCallback             // Delivers probe results to ProbeCallback, nil when disabled
+	startupDelay    time.Duration              // This instance's StartupJitter offset, picked at provision
+	srvResolver     srvResolver                // Resolves SRVUpstreams, net.DefaultResolver unless stubbed
+	srvTargets      []string                   // Upstreams currently resolved from SRVUpstreams, after Upstreams
+	mu              sync.RWMutex
+	shutdown        chan struct{}
+	wg              sync.WaitGroup
+	inflight        sync.WaitGroup // Requests being served, drained by Cleanup
 }
 
 // CaddyModule returns the Caddy module information
@@ -320,13 +843,31 @@ func (*FailoverProxy) CaddyModule() caddy.ModuleInfo {
 
 // Provision sets up the handler
 func (f *FailoverProxy) Provision(ctx caddy.Context) error {
+	if err := f.mergeSiblings(ctx); err != nil {
+		return err
+	}
+	// Upstreams of merged directives are served by the proxy they were merged into
+	if f.MergedInto != "" {
+		return nil
+	}
+
 	f.logger = ctx.Logger(f)
 	f.replacer = caddy.NewReplacer()
 	f.failureCache = make(map[string]time.Time)
+	f.tlsFailures = make(map[string]bool)
+	f.circuits = make(map[string]*circuitState)
+	f.passiveStates = make(map[string]*passiveState)
 	f.healthStatus = make(map[string]bool)
 	f.lastCheckTime = make(map[string]time.Time)
+	f.lastSuccess = make(map[string]time.Time)
+	f.recoveredAt = make(map[string]time.Time)
 	f.responseTime = make(map[string]int64)
+	f.pingStatus = make(map[string]bool)
+	f.latency = newLatencyHistogram(f.MetricsBuckets)
 	f.activeUpstream = nil
+	f.upstreamMetrics = make(map[string]*ActiveUpstream)
+	f.upstreamActive = make(map[string]*atomic.Int64)
+	f.disabled = make(map[string]bool)
 	f.shutdown = make(chan struct{})
 
 	// Log warning if path was explicitly set when auto-detection was available
@@ -351,6 +892,9 @@ func (f *FailoverProxy) Provision(ctx caddy.Context) error {
 	}
 
 	// Register if we have a valid path (explicit or auto-generated)
+	if f.MaxRegisteredPaths > 0 {
+		proxyRegistry.SetMaxPaths(f.MaxRegisteredPaths, f.logger)
+	}
 	if registrationPath != "" {
 		proxyRegistry.Register(registrationPath, f)
 	}
@@ -365,6 +909,121 @@ func (f *FailoverProxy) Provision(ctx caddy.Context) error {
 	if f.ResponseTimeout == 0 {
 		f.ResponseTimeout = caddy.Duration(5 * time.Second)
 	}
+	if f.HealthPrecedence == "" {
+		f.HealthPrecedence = healthPrecedenceCombined
+	}
+	switch f.LBPolicy {
+	case "":
+		f.LBPolicy = lbPolicyFirst
+	case lbPolicyFirst, lbPolicyRoundRobin, lbPolicyRandom:
+	default:
+		return fmt.Errorf("invalid lb_policy: %s (expected first, round_robin or random)", f.LBPolicy)
+	}
+	if f.Sticky != nil {
+		if f.Sticky.Key != stickyKeyCookie && f.Sticky.Key != stickyKeyHeader {
+			return fmt.Errorf("invalid sticky key: %s (expected cookie or header)", f.Sticky.Key)
+		}
+		if f.Sticky.Name == "" {
+			return fmt.Errorf("sticky key requires a cookie or header name")
+		}
+	}
+	switch f.ActiveSelection {
+	case "":
+		f.ActiveSelection = activeSelectionOrder
+	case activeSelectionOrder, activeSelectionSuccessRate:
+	default:
+		return fmt.Errorf("invalid active_selection: %s (expected order or success_rate)", f.ActiveSelection)
+	}
+	if f.TLSSessionCacheSize == 0 {
+		f.TLSSessionCacheSize = 64
+	}
+	if f.ExpectContinueTimeout == 0 {
+		f.ExpectContinueTimeout = caddy.Duration(time.Second)
+	}
+	if f.MaxConnsPerHost > 0 && f.MaxConnsWait == 0 {
+		f.MaxConnsWait = f.DialTimeout
+	}
+	if f.MaxIdleConns == 0 {
+		f.MaxIdleConns = 100
+	}
+	if f.MaxIdleConnsPerHost == 0 {
+		f.MaxIdleConnsPerHost = http.DefaultMaxIdleConnsPerHost
+	}
+	if f.IdleConnTimeout == 0 {
+		f.IdleConnTimeout = caddy.Duration(90 * time.Second)
+	}
+	if f.MaxHops == 0 {
+		f.MaxHops = 10
+	}
+	if f.RetryBudget != nil {
+		f.retryBudget = newRetryBudget(f.RetryBudget)
+	}
+	if f.CircuitBreaker != nil {
+		if f.CircuitBreaker.Failures == 0 {
+			f.CircuitBreaker.Failures = 5
+		}
+		if f.CircuitBreaker.Cooldown == 0 {
+			f.CircuitBreaker.Cooldown = f.FailDuration
+		}
+		if f.CircuitBreaker.HalfOpenRequests == 0 {
+			f.CircuitBreaker.HalfOpenRequests = 1
+		}
+	}
+	if f.PassiveHealth != nil {
+		if f.PassiveHealth.MaxFails == 0 {
+			f.PassiveHealth.MaxFails = 3
+		}
+		if f.PassiveHealth.Window == 0 {
+			f.PassiveHealth.Window = caddy.Duration(30 * time.Second)
+		}
+	}
+	if f.Fallback != nil {
+		if f.Fallback.StatusCode == 0 {
+			f.Fallback.StatusCode = http.StatusBadGateway
+		}
+		if f.Fallback.StatusCode < 100 || f.Fallback.StatusCode > 599 {
+			return fmt.Errorf("invalid fallback status: %d (expected 100-599)", f.Fallback.StatusCode)
+		}
+	}
+	if f.Retries > 0 && f.RetryBackoff == 0 {
+		f.RetryBackoff = caddy.Duration(defaultRetryBackoff)
+	}
+	if len(f.FailoverStatusCodes) > 0 {
+		f.failoverStatus = make(map[int]bool, len(f.FailoverStatusCodes))
+		for _, code := range f.FailoverStatusCodes {
+			f.failoverStatus[code] = true
+		}
+	}
+	if len(f.NeverFailoverStatusCodes) > 0 {
+		f.neverFailover = make(map[int]bool, len(f.NeverFailoverStatusCodes))
+		for _, code := range f.NeverFailoverStatusCodes {
+			f.neverFailover[code] = true
+		}
+	}
+	switch f.UpstreamProtocol {
+	case "", upstreamProtocolH2C:
+	default:
+		return fmt.Errorf("invalid upstream_protocol: %s (expected h2c)", f.UpstreamProtocol)
+	}
+	if err := f.validateHTTPVersions(); err != nil {
+		return err
+	}
+	// Nothing could confirm an upstream healthy without a check to wait on
+	if f.WaitForHealthy > 0 && len(f.HealthChecks) == 0 && len(f.PingChecks) == 0 {
+		return fmt.Errorf("wait_for_healthy requires a health_check or ping_check on at least one upstream")
+	}
+	trustedNets, err := parseTrustedProxies(f.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	f.trustedNets = trustedNets
+	switch f.XFFMode {
+	case "":
+		f.XFFMode = xffModeReplace
+	case xffModeReplace, xffModeAppend:
+	default:
+		return fmt.Errorf("invalid xff_mode: %s (expected append or replace)", f.XFFMode)
+	}
 
 	// Expand environment variables in upstream URLs
 	for i, upstream := range f.Upstreams {
@@ -377,6 +1036,39 @@ func (f *FailoverProxy) Provision(ctx caddy.Context) error {
 		f.Upstreams[i] = expanded
 	}
 
+	// The size_route upstream must be one of the upstreams it reorders
+	if f.SizeRoute != nil {
+		f.SizeRoute.Large = f.replacer.ReplaceAll(f.SizeRoute.Large, "")
+		found := false
+		for _, upstream := range f.Upstreams {
+			if upstream == f.SizeRoute.Large {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("size_route large upstream %s is not in the upstream list", f.SizeRoute.Large)
+		}
+	}
+
+	// The canary is only tried for its share of requests, so it can't also
+	// be in the normal order
+	if f.Canary != nil {
+		f.Canary.Upstream = f.replacer.ReplaceAll(f.Canary.Upstream, "")
+		u, err := url.Parse(f.Canary.Upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid canary upstream: %s", f.Canary.Upstream)
+		}
+		for _, upstream := range f.Upstreams {
+			if upstream == f.Canary.Upstream {
+				return fmt.Errorf("canary upstream %s is also in the upstream list", f.Canary.Upstream)
+			}
+		}
+		if f.Canary.Percent < 0 || f.Canary.Percent > 100 {
+			return fmt.Errorf("invalid canary percent: %g (expected 0 to 100)", f.Canary.Percent)
+		}
+	}
+
 	// Expand environment variables in upstream headers
 	expandedHeaders := make(map[string]map[string]string)
 	for upstream, headers := range f.UpstreamHeaders {
@@ -401,6 +1093,73 @@ func (f *FailoverProxy) Provision(ctx caddy.Context) error {
 	}
 	f.UpstreamHeaders = expandedHeaders
 
+	// Expand environment variables in response headers
+	expandedDownstream := make(map[string]map[string]string)
+	for upstream, headers := range f.DownstreamHeaders {
+		expandedUpstream := f.replacer.ReplaceAll(upstream, "")
+		expandedDownstream[expandedUpstream] = make(map[string]string)
+		for name, value := range headers {
+			expandedDownstream[expandedUpstream][name] = f.replacer.ReplaceAll(value, "")
+		}
+	}
+	f.DownstreamHeaders = expandedDownstream
+
+	// Expand environment variables in Accept overrides
+	expandedAccept := make(map[string]string)
+	for upstream, accept := range f.AcceptOverrides {
+		expandedAccept[f.replacer.ReplaceAll(upstream, "")] = f.replacer.ReplaceAll(accept, "")
+	}
+	f.AcceptOverrides = expandedAccept
+
+	// Expand environment variables in Host header overrides
+	expandedHosts := make(map[string]string)
+	for upstream, host := range f.HostHeaders {
+		expandedHosts[f.replacer.ReplaceAll(upstream, "")] = f.replacer.ReplaceAll(host, "")
+	}
+	f.HostHeaders = expandedHosts
+
+	// Expand environment variables in method rewrite upstreams
+	expandedMethods := make(map[string]map[string]string)
+	for upstream, methods := range f.MethodRewrites {
+		expandedMethods[f.replacer.ReplaceAll(upstream, "")] = methods
+	}
+	f.MethodRewrites = expandedMethods
+
+	// Compile path rewrites, expanding environment variables in their upstreams
+	if err := f.provisionPathRewrites(); err != nil {
+		return err
+	}
+
+	// Expand environment variables in expected content type upstreams
+	expandedContentTypes := make(map[string]string)
+	for upstream, contentType := range f.ExpectContentTypes {
+		expandedContentTypes[f.replacer.ReplaceAll(upstream, "")] = contentType
+	}
+	f.ExpectContentTypes = expandedContentTypes
+
+	// Expand environment variables in max response time upstreams
+	expandedMaxResponse := make(map[string]caddy.Duration)
+	for upstream, budget := range f.MaxResponseTimes {
+		expandedMaxResponse[f.replacer.ReplaceAll(upstream, "")] = budget
+	}
+	f.MaxResponseTimes = expandedMaxResponse
+
+	// Expand environment variables in weighted upstreams
+	expandedWeights := make(map[string]int)
+	for upstream, weight := range f.UpstreamWeights {
+		if weight < 0 {
+			return fmt.Errorf("invalid weight for %s: %d", upstream, weight)
+		}
+		expandedWeights[f.replacer.ReplaceAll(upstream, "")] = weight
+	}
+	f.UpstreamWeights = expandedWeights
+
+	// Expand environment variables in debug_upstream URLs
+	f.debugUpstreams = make(map[string]bool)
+	for _, upstream := range f.DebugUpstreams {
+		f.debugUpstreams[f.replacer.ReplaceAll(upstream, "")] = true
+	}
+
 	// Expand environment variables in health check URLs
 	expandedHealthChecks := make(map[string]*HealthCheck)
 	for upstream, hc := range f.HealthChecks {
@@ -414,6 +1173,19 @@ func (f *FailoverProxy) Provision(ctx caddy.Context) error {
 	}
 	f.HealthChecks = expandedHealthChecks
 
+	// Expand environment variables in ping check upstreams and set defaults
+	expandedPingChecks := make(map[string]*PingCheck)
+	for upstream, pc := range f.PingChecks {
+		if pc.Interval == 0 {
+			pc.Interval = caddy.Duration(5 * time.Second)
+		}
+		if pc.Timeout == 0 {
+			pc.Timeout = caddy.Duration(time.Second)
+		}
+		expandedPingChecks[f.replacer.ReplaceAll(upstream, "")] = pc
+	}
+	f.PingChecks = expandedPingChecks
+
 	// Set health check defaults and start health checkers
 	// Initialize health check defaults (but don't start goroutines yet)
 	for _, hc := range f.HealthChecks {
@@ -426,73 +1198,284 @@ func (f *FailoverProxy) Provision(ctx caddy.Context) error {
 		if hc.ExpectedStatus == 0 {
 			hc.ExpectedStatus = 200
 		}
+		if hc.hasStatusRange() && (hc.ExpectedStatusMin < 100 || hc.ExpectedStatusMax > 599 || hc.ExpectedStatusMax < hc.ExpectedStatusMin) {
+			return fmt.Errorf("invalid health check expected status range: %d-%d", hc.ExpectedStatusMin, hc.ExpectedStatusMax)
+		}
 		if hc.Path == "" {
 			hc.Path = "/health"
 		}
+		switch hc.Require {
+		case "":
+			hc.Require = healthRequireAll
+		case healthRequireAll, healthRequireAny:
+		default:
+			return fmt.Errorf("invalid health check require: %s (expected all or any)", hc.Require)
+		}
+		switch hc.Type {
+		case "":
+			hc.Type = healthCheckHTTP
+		case healthCheckHTTP, healthCheckTCP:
+		default:
+			return fmt.Errorf("invalid health check type: %s (expected http or tcp)", hc.Type)
+		}
+		hc.Host = f.replacer.ReplaceAll(hc.Host, "")
+		for name, value := range hc.Headers {
+			hc.Headers[name] = f.replacer.ReplaceAll(value, "")
+		}
+		if hc.ExpectedBodyRegex != "" {
+			re, err := regexp.Compile(hc.ExpectedBodyRegex)
+			if err != nil {
+				return fmt.Errorf("invalid health check expected_body_regex: %v", err)
+			}
+			hc.bodyRegex = re
+		}
 	}
 
-	// Create HTTP transport
-	httpTransport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: time.Duration(f.DialTimeout),
-		}).DialContext,
-		ResponseHeaderTimeout: time.Duration(f.ResponseTimeout),
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
+	// Health checks declared for SRV names become templates for their targets
+	if err := f.provisionSRV(); err != nil {
+		return err
 	}
 
-	// Create HTTPS transport
-	httpsTransport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: time.Duration(f.DialTimeout),
-		}).DialContext,
-		ResponseHeaderTimeout: time.Duration(f.ResponseTimeout),
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: f.InsecureSkipVerify,
-		},
+	// Remember resolutions so dials survive transient DNS failures
+	if f.DNSCacheTTL > 0 {
+		f.dnsCache = newDNSCache(time.Duration(f.DNSCacheTTL), f.logger)
+	}
+
+	// Route upstream connections through an egress proxy
+	if f.ViaProxy != "" {
+		proxyURL, err := url.Parse(f.replacer.ReplaceAll(f.ViaProxy, ""))
+		if err != nil || proxyURL.Host == "" ||
+			(proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5") {
+			return fmt.Errorf("invalid via_proxy: %s (expected an http, https or socks5 URL)", f.ViaProxy)
+		}
+		f.proxyURL = proxyURL
+	}
+
+	// Create HTTP transport
+	httpTransport := f.newTransport(nil)
+
+	// Create HTTPS transport. The session cache is shared by every HTTPS client,
+	// including cloned per-upstream transports, so handshakes can be resumed.
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: f.InsecureSkipVerify,
+	}
+	if f.TLSSessionCacheSize > 0 {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(f.TLSSessionCacheSize)
 	}
+	if err := f.loadClientTLS(tlsConfig); err != nil {
+		return err
+	}
+	httpsTransport := f.newTransport(tlsConfig)
+	f.applyHTTPVersions(httpsTransport)
 
 	// Create clients
-	f.httpClient = &http.Client{
-		Transport: httpTransport,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	f.httpClient = newUpstreamClient(httpTransport)
+	f.httpsClient = newUpstreamClient(httpsTransport)
+
+	// Create dedicated clients for upstreams with their own idle timeout
+	f.upstreamClients = make(map[string]*http.Client)
+	for upstream, timeout := range f.UpstreamIdleTimeouts {
+		upstream = f.replacer.ReplaceAll(upstream, "")
+		transport := f.dedicatedTransport(upstream, httpTransport, httpsTransport)
+		transport.IdleConnTimeout = time.Duration(timeout)
 	}
 
-	f.httpsClient = &http.Client{
-		Transport: httpsTransport,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	// Apply per-upstream TLS handshake options to their dedicated clients
+	if err := f.provisionUpstreamTLS(httpTransport, httpsTransport); err != nil {
+		return err
+	}
+
+	// Speak cleartext HTTP/2 to http:// upstreams, such as gRPC servers
+	if f.UpstreamProtocol == upstreamProtocolH2C {
+		f.provisionH2C()
+	}
+
+	// Create dedicated probe clients for health checks pinned to a protocol
+	for upstream, hc := range f.HealthChecks {
+		if hc.HTTPVersion != "" {
+			hc.client = f.newHealthCheckClient(hc.HTTPVersion, strings.HasPrefix(upstream, "https://"), tlsConfig)
+		}
+	}
+
+	// Start delivering probe results before the first probe runs
+	if f.ProbeCallback != "" {
+		f.probeCallback = newProbeCallback(f.replacer.ReplaceAll(f.ProbeCallback, ""), f.logger)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.probeCallback.run(f.shutdown)
+		}()
 	}
 
-	// Now start health check goroutines after clients are initialized
+	// Pick this instance's offset before the first probes are scheduled
+	f.startupDelay = randomJitter(time.Duration(f.StartupJitter))
+
+	// Now start health check goroutines after clients are initialized. The
+	// configured checks are kept so upstreams added at runtime can restart them.
+	f.declaredChecks = make(map[string]HealthCheck, len(f.HealthChecks))
 	for upstream, hc := range f.HealthChecks {
+		f.declaredChecks[upstream] = *hc
+		hc.stop = make(chan struct{})
 		f.wg.Add(1)
 		go f.runHealthCheck(upstream, hc)
 	}
+	for upstream, pc := range f.PingChecks {
+		f.wg.Add(1)
+		go f.runPingCheck(upstream, pc)
+	}
+
+	// Resolve SRV upstreams, starting health checks for their targets
+	f.startSRV(tlsConfig)
+
+	// Hold back traffic until an initial probe confirms a healthy upstream
+	if f.WaitForHealthy > 0 {
+		if err := f.waitForHealthy(time.Duration(f.WaitForHealthy)); err != nil {
+			f.Cleanup()
+			return err
+		}
+	}
 
 	return nil
 }
 
+// waitForHealthy blocks until a probe confirms any upstream is healthy or the
+// timeout expires. Upstreams without checks count as healthy when serving but
+// confirm nothing, so they're ignored here.
+func (f *FailoverProxy) waitForHealthy(timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		f.mu.RLock()
+		upstreams := f.allUpstreams()
+		f.mu.RUnlock()
+		for _, upstream := range upstreams {
+			if f.probedHealthy(upstream) {
+				f.logger.Debug("upstream healthy, proxy ready",
+					zap.String("upstream", upstream))
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return fmt.Errorf("no upstream became healthy within wait_for_healthy timeout of %v", timeout)
+		}
+	}
+}
+
+// newTransport creates an upstream transport using the proxy's timeouts
+func (f *FailoverProxy) newTransport(tlsConfig *tls.Config) *http.Transport {
+	transport := &http.Transport{
+		DialContext:           f.newDialer().DialContext,
+		ResponseHeaderTimeout: time.Duration(f.ResponseTimeout),
+		ExpectContinueTimeout: time.Duration(f.ExpectContinueTimeout),
+		MaxIdleConns:          f.MaxIdleConns,
+		MaxIdleConnsPerHost:   f.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       f.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(f.IdleConnTimeout),
+		TLSClientConfig:       tlsConfig,
+	}
+	if f.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(f.proxyURL)
+	}
+	return transport
+}
+
+// newDialer creates the dialer for upstream connections, retrying failed
+// dials and using the DNS cache when configured
+func (f *FailoverProxy) newDialer() *retryingDialer {
+	return &retryingDialer{
+		dialer:  &net.Dialer{Timeout: time.Duration(f.DialTimeout)},
+		retries: f.DialRetries,
+		delay:   dialRetryDelay,
+		dns:     f.dnsCache,
+	}
+}
+
+// newHealthCheckClient creates a probe client that speaks the given HTTP version
+func (f *FailoverProxy) newHealthCheckClient(version string, secure bool, tlsConfig *tls.Config) *http.Client {
+	if version == "2" && !secure {
+		// Cleartext HTTP/2 needs the x/net transport with TLS dialing replaced
+		dialer := &net.Dialer{Timeout: time.Duration(f.DialTimeout)}
+		return &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}}
+	}
+
+	var transport *http.Transport
+	if secure {
+		transport = f.newTransport(tlsConfig.Clone())
+	} else {
+		transport = f.newTransport(nil)
+	}
+	if version == "2" {
+		transport.ForceAttemptHTTP2 = true
+	} else {
+		// A non-nil empty map disables HTTP/2 negotiation
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return newUpstreamClient(transport)
+}
+
+// newUpstreamClient wraps a transport in a client that doesn't follow redirects
+func newUpstreamClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// clientFor returns the client used to reach an upstream
+func (f *FailoverProxy) clientFor(upstreamURL, scheme string) *http.Client {
+	if client, ok := f.upstreamClients[upstreamURL]; ok {
+		return client
+	}
+	if scheme == "https" {
+		return f.httpsClient
+	}
+	return f.httpClient
+}
+
 // Cleanup stops health check goroutines and closes idle connections
 func (f *FailoverProxy) Cleanup() error {
+	if f.MergedInto != "" {
+		return nil
+	}
+
+	// Provision may already have cleaned up after a failed wait_for_healthy
+	if f.shuttingDown() {
+		return nil
+	}
+	f.drain()
+	// Goroutines are only started under the lock after checking shuttingDown,
+	// so none can be added once the wait begins
+	f.mu.Lock()
 	close(f.shutdown)
+	f.mu.Unlock()
 	f.wg.Wait()
 
 	// Close idle connections to prevent socket exhaustion
-	if f.httpClient != nil {
-		if transport, ok := f.httpClient.Transport.(*http.Transport); ok {
-			transport.CloseIdleConnections()
-		}
+	clients := []*http.Client{f.httpClient, f.httpsClient}
+	for _, client := range f.upstreamClients {
+		clients = append(clients, client)
 	}
-	if f.httpsClient != nil {
-		if transport, ok := f.httpsClient.Transport.(*http.Transport); ok {
-			transport.CloseIdleConnections()
+	for _, hc := range f.HealthChecks {
+		clients = append(clients, hc.client)
+	}
+	for _, client := range clients {
+		if client == nil {
+			continue
 		}
+		client.CloseIdleConnections()
 	}
 
 	// Unregister from global registry
@@ -509,7 +1492,11 @@ func (f *FailoverProxy) GetActiveUpstream() string {
 	defer f.mu.RUnlock()
 
 	// Find the first healthy upstream that isn't in failure state
-	for _, upstream := range f.Upstreams {
+	for _, upstream := range f.allUpstreams() {
+		if f.upstreamDisabled(upstream) {
+			continue
+		}
+
 		// Check if upstream is healthy
 		if hc := f.HealthChecks[upstream]; hc != nil {
 			if healthy, exists := f.healthStatus[upstream]; exists && !healthy {
@@ -518,10 +1505,8 @@ func (f *FailoverProxy) GetActiveUpstream() string {
 		}
 
 		// Check if upstream is in failure state
-		if lastFail, failed := f.failureCache[upstream]; failed {
-			if time.Since(lastFail) < time.Duration(f.FailDuration) {
-				continue // Skip failed upstreams
-			}
+		if f.upstreamFailed(upstream) {
+			continue // Skip failed upstreams
 		}
 
 		// This upstream is active
@@ -564,7 +1549,7 @@ func (f *FailoverProxy) GetUpstreamStatus() []UpstreamStatus {
 	defer f.mu.RUnlock()
 
 	var statuses []UpstreamStatus
-	for _, upstream := range f.Upstreams {
+	for _, upstream := range f.allUpstreams() {
 		status := UpstreamStatus{
 			Host:        upstream,
 			HealthCheck: f.HealthChecks[upstream] != nil,
@@ -577,27 +1562,54 @@ func (f *FailoverProxy) GetUpstreamStatus() []UpstreamStatus {
 			} else {
 				status.Status = "UNHEALTHY"
 			}
-		} else if lastFail, failed := f.failureCache[upstream]; failed {
-			if time.Since(lastFail) < time.Duration(f.FailDuration) {
-				status.Status = "DOWN"
-				status.LastFailure = lastFail
-			} else {
-				status.Status = "UP"
-			}
+		} else if f.upstreamFailed(upstream) {
+			status.Status = "DOWN"
+			status.LastFailure = f.failureCache[upstream]
 		} else {
 			status.Status = "UP"
 		}
 
+		// Report the circuit breaker state when one is configured
+		if f.CircuitBreaker != nil {
+			status.Circuit = f.circuitStateOf(upstream)
+		}
+
+		// Flag upstreams evicted for a TLS handshake failure
+		if lastFail, failed := f.failureCache[upstream]; failed && f.tlsFailures[upstream] &&
+			time.Since(lastFail) < f.failDurationFor(upstream) {
+			status.Substatus = substatusTLSError
+		}
+
 		// Add last check time if available
 		if checkTime, exists := f.lastCheckTime[upstream]; exists {
 			status.LastCheck = checkTime
 		}
 
+		// Add the time it last served a request, if it has
+		if successTime, exists := f.lastSuccess[upstream]; exists {
+			status.LastSuccess = successTime
+		}
+
 		// Add response time if available
 		if respTime, exists := f.responseTime[upstream]; exists {
 			status.ResponseTime = respTime
 		}
 
+		if active, ok := f.upstreamActive[upstream]; ok {
+			status.InFlight = active.Load()
+		}
+		status.Disabled = f.upstreamDisabled(upstream)
+
+		// Add request metrics if this is the active upstream
+		if active := f.activeUpstream; active != nil && active.URL == upstream {
+			active.mu.Lock()
+			status.RequestCount = active.RequestCount
+			status.FailedRequests = active.FailedRequests
+			status.AvgResponseMs = active.AvgResponseMs
+			status.SuccessRate = active.SuccessRate
+			active.mu.Unlock()
+		}
+
 		statuses = append(statuses, status)
 	}
 	return statuses
@@ -615,87 +1627,229 @@ func (f *FailoverProxy) runHealthCheck(upstreamURL string, hc *HealthCheck) {
 		return
 	}
 
-	// Build health check URL
-	healthURL := *u
-	healthURL.Path = hc.Path
-	healthURL.RawQuery = ""
+	// Build health check URLs
+	healthURLs := buildHealthURLs(u, hc)
+
+	// Stagger the first probe across instances started together
+	if !f.waitStartupJitter() || hc.stopped() {
+		return
+	}
 
 	ticker := time.NewTicker(time.Duration(hc.Interval))
 	defer ticker.Stop()
 
 	// Perform initial health check
-	f.performHealthCheck(healthURL.String(), upstreamURL, hc)
+	f.performHealthChecks(healthURLs, upstreamURL, hc)
 
 	for {
 		select {
 		case <-ticker.C:
-			f.performHealthCheck(healthURL.String(), upstreamURL, hc)
+			// The ticker and shutdown can fire together; shutdown wins
+			if f.shuttingDown() {
+				return
+			}
+			f.performHealthChecks(healthURLs, upstreamURL, hc)
+			// Probe sooner while a recovery is being confirmed
+			ticker.Reset(hc.nextProbeDelay())
 		case <-f.shutdown:
 			return
+		case <-hc.stop:
+			return
+		}
+	}
+}
+
+// stopped reports whether checking has been stopped for a removed upstream
+func (hc *HealthCheck) stopped() bool {
+	select {
+	case <-hc.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// shuttingDown reports whether Cleanup has begun stopping the proxy
+func (f *FailoverProxy) shuttingDown() bool {
+	select {
+	case <-f.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// buildHealthURL builds the probe URL for an upstream, expanding the
+// {upstream.host}, {upstream.port} and {upstream.scheme} placeholders in the path
+func buildHealthURL(u *url.URL, hc *HealthCheck) string {
+	return buildHealthPathURL(u, hc, hc.Path)
+}
+
+// buildHealthPathURL builds the probe URL of one of the check's paths
+func buildHealthPathURL(u *url.URL, hc *HealthCheck, healthPath string) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
 		}
 	}
+
+	repl := caddy.NewReplacer()
+	repl.Set("upstream.host", u.Hostname())
+	repl.Set("upstream.port", port)
+	repl.Set("upstream.scheme", u.Scheme)
+
+	path := repl.ReplaceKnown(healthPath, "")
+	if hc.IncludeBasePath {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		path = strings.TrimSuffix(u.Path, "/") + path
+	}
+
+	healthURL := *u
+	healthURL.Path = path
+	healthURL.RawQuery = ""
+	return healthURL.String()
 }
 
-// performHealthCheck performs a single health check
+// performHealthCheck performs a single health check of one URL
 func (f *FailoverProxy) performHealthCheck(healthURL, upstreamURL string, hc *HealthCheck) {
+	f.performHealthChecks([]string{healthURL}, upstreamURL, hc)
+}
+
+// performHealthChecks performs a single health check, probing each of the
+// check's URLs until the result is decided
+func (f *FailoverProxy) performHealthChecks(healthURLs []string, upstreamURL string, hc *HealthCheck) {
+	if hc.Type == healthCheckTCP {
+		f.performTCPHealthCheck(upstreamURL, hc)
+		return
+	}
+
+	start := time.Now()
+	var probe healthProbe
+	for _, healthURL := range healthURLs {
+		probe = f.probeHealthURL(healthURL, hc)
+		if hc.decided(probe.healthy) {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+
+	// Backends often go down alongside us during rolling restarts, so results
+	// gathered after shutdown began are dropped rather than logged as transitions.
+	// The same goes for SRV targets removed while being probed.
+	if f.shuttingDown() || hc.stopped() {
+		return
+	}
+
+	// Update check time and response time
+	f.mu.Lock()
+	f.lastCheckTime[upstreamURL] = time.Now()
+	if probe.err == nil {
+		f.responseTime[upstreamURL] = elapsed.Milliseconds()
+	}
+	f.mu.Unlock()
+
+	f.reportHealth(upstreamURL, hc, probe.healthy)
+	f.reportProbe(upstreamURL, probe.healthy, probe.status, elapsed)
+
+	switch {
+	case probe.err != nil:
+		f.logger.Debug("health check failed",
+			zap.String("upstream", upstreamURL),
+			zap.String("health_url", probe.url),
+			zap.Error(probe.err))
+	case probe.healthy:
+		f.logger.Debug("health check passed",
+			zap.String("upstream", upstreamURL),
+			zap.Int("status", probe.status))
+	case probe.bodyMismatch:
+		f.logger.Warn("health check failed, response body did not match",
+			zap.String("upstream", upstreamURL),
+			zap.String("health_url", probe.url),
+			zap.Int("status", probe.status))
+	default:
+		f.logger.Warn("health check failed",
+			zap.String("upstream", upstreamURL),
+			zap.String("health_url", probe.url),
+			zap.Int("status", probe.status),
+			zap.String("expected", hc.expectedStatusString()))
+	}
+}
+
+// healthProbe is the result of probing one health check URL
+type healthProbe struct {
+	url          string
+	healthy      bool
+	status       int   // response status, 0 when the request failed
+	err          error // request error, nil when a response arrived
+	bodyMismatch bool  // the status matched but the body did not
+}
+
+// probeHealthURL requests one health check URL and checks the response
+func (f *FailoverProxy) probeHealthURL(healthURL string, hc *HealthCheck) healthProbe {
+	probe := healthProbe{url: healthURL}
+
 	u, _ := url.Parse(healthURL)
 	client := f.httpClient
-	if u.Scheme == "https" {
+	if u != nil && u.Scheme == "https" {
 		client = f.httpsClient
 	}
+	if hc.client != nil {
+		client = hc.client
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(hc.Timeout))
 	defer cancel()
 
-	start := time.Now()
+	// Abandon an in-flight probe as soon as shutdown begins
+	go func() {
+		select {
+		case <-f.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
 	if err != nil {
-		f.setHealthStatus(upstreamURL, false)
-		f.logger.Debug("health check failed to create request",
-			zap.String("upstream", upstreamURL),
-			zap.Error(err))
-		return
+		probe.err = err
+		return probe
 	}
 
 	// Set custom user agent for health checks
 	req.Header.Set("User-Agent", "Caddy-failover-health-check/1.0")
-
-	resp, err := client.Do(req)
-	elapsed := time.Since(start).Milliseconds()
-
-	// Update check time and response time
-	f.mu.Lock()
-	f.lastCheckTime[upstreamURL] = time.Now()
-	if err == nil {
-		f.responseTime[upstreamURL] = elapsed
+	for name, value := range hc.Headers {
+		// The client sends req.Host, never a Host entry in the header map
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if hc.Host != "" {
+		req.Host = hc.Host
 	}
-	f.mu.Unlock()
 
+	resp, err := client.Do(req)
 	if err != nil {
-		f.setHealthStatus(upstreamURL, false)
-		f.logger.Debug("health check failed",
-			zap.String("upstream", upstreamURL),
-			zap.Error(err))
-		return
+		probe.err = err
+		return probe
 	}
 	defer resp.Body.Close()
 
+	probe.status = resp.StatusCode
+	probe.healthy = hc.statusMatches(resp.StatusCode)
+	if probe.healthy && hc.expectsBody() && !hc.bodyMatches(resp) {
+		probe.healthy = false
+		probe.bodyMismatch = true
+	}
+
 	// Drain the body to allow connection reuse
 	io.Copy(io.Discard, resp.Body)
-
-	healthy := resp.StatusCode == hc.ExpectedStatus
-	f.setHealthStatus(upstreamURL, healthy)
-
-	if healthy {
-		f.logger.Debug("health check passed",
-			zap.String("upstream", upstreamURL),
-			zap.Int("status", resp.StatusCode))
-	} else {
-		f.logger.Warn("health check failed",
-			zap.String("upstream", upstreamURL),
-			zap.Int("status", resp.StatusCode),
-			zap.Int("expected", hc.ExpectedStatus))
-	}
+	return probe
 }
 
 // setHealthStatus updates the health status of an upstream
@@ -711,30 +1865,59 @@ func (f *FailoverProxy) setHealthStatus(upstreamURL string, healthy bool) {
 		if healthy {
 			// Clear failure cache when upstream becomes healthy
 			delete(f.failureCache, upstreamURL)
+			// Ramp up an upstream that was unhealthy rather than the first result
+			if exists && f.SlowStart > 0 {
+				f.recoveredAt[upstreamURL] = time.Now()
+			}
 			f.logger.Debug("upstream became healthy",
 				zap.String("upstream", upstreamURL))
 		} else {
 			f.logger.Debug("upstream became unhealthy",
 				zap.String("upstream", upstreamURL))
 		}
+		f.notifyStatusChange()
 	}
 
 	// Check if active upstream needs to change
 	f.checkActiveUpstreamChange()
 }
 
+// recordActiveMetrics records a request's outcome in the active upstream's
+// metrics when it was sent there. Without health checks nothing has chosen an
+// active upstream yet, so the first request chooses one.
+// Must be called with lock held
+func (f *FailoverProxy) recordActiveMetrics(upstreamURL string, elapsedMs int64, success bool) {
+	if f.activeUpstream == nil {
+		f.checkActiveUpstreamChange()
+	}
+	if f.activeUpstream != nil && f.activeUpstream.URL == upstreamURL {
+		f.activeUpstream.UpdateMetrics(elapsedMs, success)
+	}
+	f.recordUpstreamMetrics(upstreamURL, elapsedMs, success)
+}
+
 // checkActiveUpstreamChange determines if the active upstream should change
 // Must be called with lock held
 func (f *FailoverProxy) checkActiveUpstreamChange() {
-	// Find the first healthy upstream
-	var newActiveURL string
-	for _, upstream := range f.Upstreams {
-		if healthy, exists := f.healthStatus[upstream]; exists && healthy {
+	// Collect the healthy upstreams. Upstreams without health checks have
+	// no health status and count as healthy until they fail.
+	var candidates []string
+	for _, upstream := range f.allUpstreams() {
+		if f.upstreamDisabled(upstream) {
+			continue
+		}
+		healthy, exists := f.healthStatus[upstream]
+		if !exists {
+			_, checked := f.HealthChecks[upstream]
+			healthy = !checked
+		}
+		if healthy {
 			// Also check failure cache
-			if lastFail, failed := f.failureCache[upstream]; !failed ||
-				time.Since(lastFail) >= time.Duration(f.FailDuration) {
-				newActiveURL = upstream
-				break
+			if !f.upstreamFailed(upstream) {
+				candidates = append(candidates, upstream)
+				if f.ActiveSelection != activeSelectionSuccessRate {
+					break
+				}
 			}
 		}
 	}
@@ -744,6 +1927,7 @@ func (f *FailoverProxy) checkActiveUpstreamChange() {
 	if f.activeUpstream != nil {
 		currentURL = f.activeUpstream.URL
 	}
+	newActiveURL := f.selectActive(candidates, currentURL)
 
 	if newActiveURL != currentURL {
 		// Debug log the detailed change
@@ -784,6 +1968,7 @@ func (f *FailoverProxy) checkActiveUpstreamChange() {
 		} else {
 			f.activeUpstream = nil
 		}
+		f.notifyStatusChange()
 	}
 }
 
@@ -801,8 +1986,12 @@ func (f *FailoverProxy) determineChangeReason(from, to string) string {
 		return "previous upstream in failure state"
 	}
 
+	if f.ActiveSelection == activeSelectionSuccessRate && f.betterSuccessRate(to, from) {
+		return "higher success rate"
+	}
+
 	// Check if a higher priority upstream recovered
-	for _, upstream := range f.Upstreams {
+	for _, upstream := range f.allUpstreams() {
 		if upstream == to {
 			return "higher priority upstream recovered"
 		}
@@ -819,6 +2008,11 @@ func (f *FailoverProxy) isHealthy(upstreamURL string) bool {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
+	// Lost pings mark the upstream tentatively down regardless of HTTP checks
+	if alive, pinged := f.pingStatus[upstreamURL]; pinged && !alive {
+		return false
+	}
+
 	// If no health check is configured, consider it healthy
 	if _, hasHealthCheck := f.HealthChecks[upstreamURL]; !hasHealthCheck {
 		return true
@@ -829,15 +2023,130 @@ func (f *FailoverProxy) isHealthy(upstreamURL string) bool {
 	return exists && healthy
 }
 
+// probedHealthy reports whether a health or ping check has confirmed the
+// upstream healthy, and no check currently reports it down
+func (f *FailoverProxy) probedHealthy(upstreamURL string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	alive, pinged := f.pingStatus[upstreamURL]
+	if pinged && !alive {
+		return false
+	}
+	if _, hasHealthCheck := f.HealthChecks[upstreamURL]; hasHealthCheck {
+		return f.healthStatus[upstreamURL]
+	}
+	return pinged
+}
+
+// serveSelfHealth answers a liveness probe for the proxy itself
+func (f *FailoverProxy) serveSelfHealth(w http.ResponseWriter) error {
+	w.Header().Set("Cache-Control", "no-store")
+	if !f.SelfHealthStatus {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, err := io.WriteString(w, "OK")
+		return err
+	}
+
+	status := PathStatus{
+		Path:            f.HandlePath,
+		Active:          f.GetActiveUpstream(),
+		ActiveMetrics:   f.GetActiveUpstreamMetrics(),
+		FailoverProxies: f.GetUpstreamStatus(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(status)
+}
+
 // ServeHTTP handles the HTTP request
 func (f *FailoverProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if f.MergedInto != "" {
+		return next.ServeHTTP(w, r)
+	}
+
+	// Answer probes of the proxy itself without touching any upstream
+	if f.SelfHealthPath != "" && r.URL.Path == f.SelfHealthPath {
+		return f.serveSelfHealth(w)
+	}
+
+	f.inflight.Add(1)
+	defer f.inflight.Done()
+
+	var err error
+	switch {
+	case isUpgradeRequest(r):
+		// Protocol upgrades such as WebSockets need the raw connection
+		err = f.serveUpgrade(w, r)
+	case f.Coalesce && isCoalescable(r):
+		// Share one upstream fetch between identical concurrent requests
+		err = f.serveCoalesced(w, r)
+	default:
+		err = f.serveUpstreams(w, r)
+	}
+
+	// With fallback_to_next the next handler serves what no upstream could
+	if errors.Is(err, errAllUpstreamsFailed) {
+		return next.ServeHTTP(w, r)
+	}
+	return err
+}
+
+// serveUpstreams proxies the request to the first upstream that handles it
+func (f *FailoverProxy) serveUpstreams(w http.ResponseWriter, r *http.Request) error {
 	// Track the index of the upstream we're trying
 	attemptedUpstreams := 0
 
-	// Try each upstream in order
-	for i, upstreamURL := range f.Upstreams {
+	// Track how many upstreams were actually sent this request, and which one served it
+	triedUpstreams := 0
+	servedBy := ""
+
+	// Record the outcome of the whole request for log_requests
+	if f.LogRequests {
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		start := time.Now()
+		defer func() {
+			f.logRequest(r, servedBy, triedUpstreams, recorder.status, time.Since(start))
+		}()
+	}
+
+	// Refuse requests that have already passed through too many proxies
+	if hops := requestHops(r); f.MaxHops > 0 && hops >= f.MaxHops {
+		f.logger.Error("proxy loop detected, too many hops",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("hops", hops),
+			zap.Int("max_hops", f.MaxHops))
+		http.Error(w, "Loop Detected", http.StatusLoopDetected)
+		return nil
+	}
+	loopDetected := false
+
+	if f.retryBudget != nil {
+		f.retryBudget.recordAttempt()
+	}
+
+	// Make the body replayable so it survives failover
+	body := f.prepareRequestBody(r)
+
+	// The most recent upstream error response, echoed when echo_last_error is set,
+	// and the primary's, returned instead when prefer_primary_error is set or the
+	// retry budget stops failover
+	var lastStatusErr, primaryStatusErr *upstreamStatusError
+
+	// Try each upstream in selection order
+	for i, upstreamURL := range f.requestOrder(r) {
+		if f.isDisabled(upstreamURL) {
+			f.logger.Debug("skipping disabled upstream",
+				zap.String("url", upstreamURL))
+			attemptedUpstreams++
+			continue
+		}
+
 		// Check if upstream is healthy
-		if !f.isHealthy(upstreamURL) {
+		if f.activeHealthApplies() && !f.isHealthy(upstreamURL) {
 			f.logger.Debug("skipping unhealthy upstream",
 				zap.String("url", upstreamURL))
 			attemptedUpstreams++
@@ -846,27 +2155,89 @@ func (f *FailoverProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 
 		// Check if upstream is in failure state
 		f.mu.RLock()
-		lastFail, failed := f.failureCache[upstreamURL]
+		lastFail := f.failureCache[upstreamURL]
+		failDuration := f.failDurationFor(upstreamURL)
+		failed := f.upstreamFailed(upstreamURL)
 		f.mu.RUnlock()
 
-		if failed && time.Since(lastFail) < time.Duration(f.FailDuration) {
-			f.logger.Debug("skipping failed upstream",
+		if failed && f.passiveHealthApplies(upstreamURL) {
+			if f.CircuitBreaker != nil {
+				f.logger.Debug("skipping upstream with open circuit",
+					zap.String("url", upstreamURL))
+			} else {
+				f.logger.Debug("skipping failed upstream",
+					zap.String("url", upstreamURL),
+					zap.Duration("remaining", failDuration-time.Since(lastFail)))
+			}
+			attemptedUpstreams++
+			continue
+		}
+
+		// Never proxy a request back to the address it arrived on
+		if isSelfReferential(r, upstreamURL, f.rewritePath(upstreamURL, r.URL.Path)) {
+			f.logger.Error("skipping self-referential upstream",
+				zap.String("url", upstreamURL),
+				zap.String("host", r.Host),
+				zap.String("path", r.URL.Path))
+			loopDetected = true
+			attemptedUpstreams++
+			continue
+		}
+
+		// A body that was streamed to a previous upstream can't be sent again
+		if triedUpstreams > 0 && !body.canResend() {
+			f.logger.Warn("request body not replayable, not failing over",
+				zap.String("skipped_upstream", upstreamURL),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path))
+			break
+		}
+
+		// An upstream at max_concurrent is skipped without being marked failed
+		if !f.acquireUpstream(upstreamURL) {
+			f.logger.Debug("skipping upstream at max_concurrent",
 				zap.String("url", upstreamURL),
-				zap.Duration("remaining", time.Duration(f.FailDuration)-time.Since(lastFail)))
+				zap.Int("max_concurrent", f.MaxConcurrent))
 			attemptedUpstreams++
 			continue
 		}
 
+		// Failing over after a real attempt consumes the retry budget
+		if triedUpstreams > 0 && f.retryBudget != nil && !f.retryBudget.tryWithdraw() {
+			attempts, retries := f.retryBudget.stats()
+			f.logger.Warn("retry budget exhausted, not failing over",
+				zap.String("skipped_upstream", upstreamURL),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int64("attempts", attempts),
+				zap.Int64("retries", retries))
+			f.releaseUpstream(upstreamURL)
+			if primaryStatusErr != nil {
+				return writeStatusError(w, primaryStatusErr)
+			}
+			if lastStatusErr != nil {
+				return writeStatusError(w, lastStatusErr)
+			}
+			break
+		}
+
 		// Log failover warning if we're not using the primary upstream
-		if attemptedUpstreams > 0 {
+		if attemptedUpstreams > 0 && f.sampled(&f.failoverLogs) {
 			f.logger.Warn("failing over to alternate upstream",
-				zap.String("primary", f.Upstreams[0]),
+				zap.String("primary", f.primaryUpstream()),
 				zap.String("failover_to", upstreamURL),
 				zap.Int("upstream_index", i),
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path))
 		}
 
+		// An open circuit may have run out of half-open trials since the check above
+		if f.CircuitBreaker != nil && f.passiveHealthApplies(upstreamURL) && !f.circuitAllow(upstreamURL) {
+			f.releaseUpstream(upstreamURL)
+			attemptedUpstreams++
+			continue
+		}
+
 		// Log which upstream we're trying
 		f.logger.Debug("attempting upstream",
 			zap.String("url", upstreamURL),
@@ -877,87 +2248,143 @@ func (f *FailoverProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 		startTime := time.Now()
 
 		// Try this upstream
-		err := f.tryUpstream(w, r, upstreamURL)
+		triedUpstreams++
+		err := f.tryUpstreamWithRetries(w, r, upstreamURL, body)
+		f.releaseUpstream(upstreamURL)
 
 		// Calculate elapsed time
-		elapsed := time.Since(startTime).Milliseconds()
+		duration := time.Since(startTime)
+		elapsed := duration.Milliseconds()
+		if f.latency != nil {
+			f.latency.observe(upstreamURL, duration.Seconds())
+		}
 
 		if err == nil {
 			// Success! Clear failure cache for this upstream
 			f.mu.Lock()
+			if _, recovered := f.failureCache[upstreamURL]; recovered {
+				f.notifyStatusChange()
+			}
 			delete(f.failureCache, upstreamURL)
+			delete(f.tlsFailures, upstreamURL)
+			f.lastSuccess[upstreamURL] = time.Now()
+			if f.CircuitBreaker != nil {
+				f.circuitRecord(upstreamURL, true)
+			}
+			f.passiveRecord(upstreamURL, true)
 
 			// Update active upstream metrics
-			if f.activeUpstream != nil && f.activeUpstream.URL == upstreamURL {
-				f.activeUpstream.UpdateMetrics(elapsed, true)
-			}
+			f.recordActiveMetrics(upstreamURL, elapsed, true)
 			f.mu.Unlock()
 
-			f.logger.Info("successfully proxied request",
-				zap.String("upstream", upstreamURL),
-				zap.String("method", r.Method),
-				zap.String("path", r.URL.Path),
-				zap.Int64("response_ms", elapsed))
+			if f.sampled(&f.successLogs) {
+				f.logger.Info("successfully proxied request",
+					zap.String("upstream", upstreamURL),
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Int64("response_ms", elapsed))
+			}
+			servedBy = upstreamURL
 			return nil
 		}
 
-		// Mark failure
+		// Mark failure, remembering TLS failures for their own fail duration
+		tlsFailure := isTLSError(err)
 		f.mu.Lock()
+		if lastFail, failed := f.failureCache[upstreamURL]; !failed || time.Since(lastFail) >= f.failDurationFor(upstreamURL) {
+			f.notifyStatusChange()
+		}
 		f.failureCache[upstreamURL] = time.Now()
+		if tlsFailure {
+			f.tlsFailures[upstreamURL] = true
+		} else {
+			delete(f.tlsFailures, upstreamURL)
+		}
+		if f.CircuitBreaker != nil {
+			f.circuitRecord(upstreamURL, false)
+		}
+		f.passiveRecord(upstreamURL, false)
 
 		// Update failure metrics if this was the active upstream
-		if f.activeUpstream != nil && f.activeUpstream.URL == upstreamURL {
-			f.activeUpstream.UpdateMetrics(0, false)
-		}
+		f.recordActiveMetrics(upstreamURL, elapsed, false)
 		f.mu.Unlock()
 
+		// Part of the response already reached the client, so no other upstream can answer
+		if errors.Is(err, errResponseStarted) {
+			return err
+		}
+
+		if errors.Is(err, errLoopDetected) {
+			loopDetected = true
+		}
+		var statusErr *upstreamStatusError
+		if errors.As(err, &statusErr) {
+			lastStatusErr = statusErr
+			if upstreamURL == f.primaryUpstream() {
+				primaryStatusErr = statusErr
+			}
+		}
+		if tlsFailure {
+			f.logger.Error("upstream TLS handshake failed",
+				zap.String("url", upstreamURL),
+				zap.Duration("fail_duration", f.failDurationFor(upstreamURL)),
+				zap.Error(err))
+		}
+
 		f.logger.Debug("upstream failed, trying next",
 			zap.String("url", upstreamURL),
 			zap.Error(err))
 		attemptedUpstreams++
 	}
 
+	// Report loops distinctly so they aren't mistaken for outages
+	if loopDetected {
+		http.Error(w, "Loop Detected", http.StatusLoopDetected)
+		return nil
+	}
+
 	// All upstreams failed
 	f.logger.Error("all upstreams failed",
 		zap.String("method", r.Method),
 		zap.String("path", r.URL.Path),
-		zap.Int("upstream_count", len(f.Upstreams)))
-	http.Error(w, "All upstreams failed", http.StatusBadGateway)
-	return nil
-}
+		zap.Int("upstream_count", len(f.declaredUpstreams())))
 
-// tryUpstream attempts to proxy the request to a single upstream
-func (f *FailoverProxy) tryUpstream(w http.ResponseWriter, r *http.Request, upstreamURL string) error {
-	// Parse upstream URL
-	u, err := url.Parse(upstreamURL)
-	if err != nil {
-		return fmt.Errorf("invalid upstream URL: %w", err)
+	if f.FallbackToNext {
+		body.rewind(r)
+		return errAllUpstreamsFailed
 	}
 
-	// Build target URL preserving upstream base path
-	targetURL := *u
-	// Join the upstream base path with the request path
-	if u.Path != "" && u.Path != "/" {
-		// Remove trailing slash from base path to avoid double slashes
-		basePath := strings.TrimSuffix(u.Path, "/")
-		targetURL.Path = basePath + r.URL.Path
-	} else {
-		targetURL.Path = r.URL.Path
+	// Let callers see the real error from the primary or the last upstream tried
+	if f.PreferPrimaryError && primaryStatusErr != nil {
+		return writeStatusError(w, primaryStatusErr)
+	}
+	if f.EchoLastError && lastStatusErr != nil {
+		return writeStatusError(w, lastStatusErr)
 	}
-	targetURL.RawQuery = r.URL.RawQuery
 
-	f.logger.Debug("proxying request",
-		zap.String("target_url", targetURL.String()),
-		zap.String("method", r.Method))
+	f.writeAllFailed(w)
+	return nil
+}
 
-	// Create new request
-	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL.String(), r.Body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// writeStatusError replays a captured upstream error response to the client
+func writeStatusError(w http.ResponseWriter, statusErr *upstreamStatusError) error {
+	for _, name := range []string{"Content-Type", "Retry-After"} {
+		if value := statusErr.header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
 	}
+	w.WriteHeader(statusErr.status)
+	_, err := w.Write(statusErr.body)
+	return err
+}
 
-	// Copy headers from original request
+// setProxyHeaders copies the inbound request headers to an upstream request,
+// subject to the allow/deny lists, and adds upstream-specific and forwarding headers
+func (f *FailoverProxy) setProxyHeaders(proxyReq, r *http.Request, upstreamURL string) {
 	for name, values := range r.Header {
+		if !f.shouldForwardHeader(name) {
+			continue
+		}
 		for _, value := range values {
 			proxyReq.Header.Add(name, value)
 		}
@@ -970,9 +2397,31 @@ func (f *FailoverProxy) tryUpstream(w http.ResponseWriter, r *http.Request, upst
 		}
 	}
 
-	// Set X-Forwarded headers
+	// Per-upstream Accept override wins over header_up for content negotiation
+	if accept, ok := f.AcceptOverrides[upstreamURL]; ok {
+		proxyReq.Header.Set("Accept", accept)
+	}
+
+	// The client sends proxyReq.Host, which defaults to the upstream's host
+	if host, ok := f.HostHeaders[upstreamURL]; ok {
+		proxyReq.Host = host
+	} else if f.PreserveHost {
+		proxyReq.Host = r.Host
+	}
+
+	// Count this hop so loops through other proxies are eventually broken
+	proxyReq.Header.Set(hopsHeader, strconv.Itoa(requestHops(r)+1))
+
+	// Set X-Forwarded headers, extending the chain from proxies in front in
+	// append mode. Headers from untrusted clients may be forged, so they're
+	// replaced based on the connection.
+	trusted := f.trustsForwarded(r)
 	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		proxyReq.Header.Set("X-Forwarded-For", clientIP)
+		chain := clientIP
+		if prior := strings.Join(r.Header.Values("X-Forwarded-For"), ", "); prior != "" && trusted && f.XFFMode == xffModeAppend {
+			chain = prior + ", " + clientIP
+		}
+		proxyReq.Header.Set("X-Forwarded-For", chain)
 	}
 	// Determine the original protocol (inbound request protocol)
 	proto := "http"
@@ -980,43 +2429,252 @@ func (f *FailoverProxy) tryUpstream(w http.ResponseWriter, r *http.Request, upst
 		proto = "https"
 	}
 	// Also check if there's already an X-Forwarded-Proto header from a previous proxy
-	if existingProto := r.Header.Get("X-Forwarded-Proto"); existingProto != "" {
+	if existingProto := r.Header.Get("X-Forwarded-Proto"); existingProto != "" && trusted {
 		proto = existingProto
 	}
 	proxyReq.Header.Set("X-Forwarded-Proto", proto)
 	proxyReq.Header.Set("X-Forwarded-Host", r.Host)
+}
 
-	// Choose client based on scheme
-	client := f.httpClient
-	if u.Scheme == "https" {
-		client = f.httpsClient
-	}
-
-	// Send request
+// buildTargetURL joins the upstream base path with the request path and query
+func buildTargetURL(u *url.URL, r *http.Request, path string) url.URL {
+	targetURL := *u
+	// Join the upstream base path with the request path
+	if u.Path != "" && u.Path != "/" {
+		// Remove trailing slash from base path to avoid double slashes
+		basePath := strings.TrimSuffix(u.Path, "/")
+		targetURL.Path = basePath + path
+	} else {
+		targetURL.Path = path
+	}
+	targetURL.RawQuery = r.URL.RawQuery
+	return targetURL
+}
+
+// requestHops returns the number of failover proxies the request has already passed through
+func requestHops(r *http.Request) int {
+	hops, err := strconv.Atoi(r.Header.Get(hopsHeader))
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
+
+// isSelfReferential reports whether proxying to the upstream would send the
+// request straight back to the host and path it arrived on. path is the
+// request path after the upstream's rewrites.
+func isSelfReferential(r *http.Request, upstreamURL, path string) bool {
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		return false
+	}
+	targetURL := buildTargetURL(u, r, path)
+	return strings.EqualFold(targetURL.Host, r.Host) && targetURL.Path == r.URL.Path
+}
+
+// tryUpstream attempts to proxy the request to a single upstream
+func (f *FailoverProxy) tryUpstream(w http.ResponseWriter, r *http.Request, upstreamURL string) error {
+	// Parse upstream URL
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		return fmt.Errorf("invalid upstream URL: %w", err)
+	}
+
+	// Build target URL preserving upstream base path
+	targetURL := buildTargetURL(u, r, f.rewritePath(upstreamURL, r.URL.Path))
+
+	f.logger.Debug("proxying request",
+		zap.String("target_url", targetURL.String()),
+		zap.String("method", r.Method))
+
+	// Abandon the attempt if the upstream hasn't started responding within its
+	// budget; once headers arrive the body is streamed without a deadline
+	ctx := r.Context()
+	var firstByteTimer *time.Timer
+	if budget, ok := f.MaxResponseTimes[upstreamURL]; ok && budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		firstByteTimer = time.AfterFunc(time.Duration(budget), cancel)
+	}
+
+	// Don't queue indefinitely behind max_conns_per_host; another upstream may be free
+	var connWaitExceeded *atomic.Bool
+	if f.MaxConnsPerHost > 0 {
+		var cancel context.CancelFunc
+		ctx, connWaitExceeded, cancel = withConnWait(ctx, time.Duration(f.MaxConnsWait))
+		defer cancel()
+	}
+
+	// Some upstreams expect a different method for the same operation
+	method := r.Method
+	if rewritten, ok := f.MethodRewrites[upstreamURL][r.Method]; ok {
+		method = rewritten
+	}
+
+	// Create new request
+	proxyReq, err := http.NewRequestWithContext(ctx, method, targetURL.String(), r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// The body is still unread while waiting on 100-continue, so its declared
+	// length can be forwarded with the expectation
+	if expectsContinue(r) {
+		proxyReq.ContentLength = r.ContentLength
+	}
+
+	// Copy headers from original request and add the proxy's own
+	f.setProxyHeaders(proxyReq, r, upstreamURL)
+
+	// Choose client based on upstream and scheme
+	client := f.clientFor(upstreamURL, u.Scheme)
+
+	// Send request
+	f.logUpstreamRequest(upstreamURL, proxyReq)
+	sent := time.Now()
 	resp, err := client.Do(proxyReq)
+	f.logUpstreamResponse(upstreamURL, resp, err, time.Since(sent))
+	if firstByteTimer != nil && !firstByteTimer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return fmt.Errorf("upstream exceeded max_response_time of %v", time.Duration(f.MaxResponseTimes[upstreamURL]))
+	}
+	if connWaitExceeded != nil && connWaitExceeded.Load() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return fmt.Errorf("no connection available within %v (max_conns_per_host %d)", time.Duration(f.MaxConnsWait), f.MaxConnsPerHost)
+	}
 	if err != nil {
 		return fmt.Errorf("upstream request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check if response indicates failure (5xx errors)
-	if resp.StatusCode >= 500 {
-		return fmt.Errorf("upstream returned %d", resp.StatusCode)
+	// A loop detected further along the chain is reported back as such
+	if resp.StatusCode == http.StatusLoopDetected {
+		return errLoopDetected
+	}
+
+	// A 200 with the wrong body type is a soft failure (e.g. a WAF block page)
+	if expected, ok := f.ExpectContentTypes[upstreamURL]; ok && responseHasBody(r.Method, resp.StatusCode) &&
+		!f.neverFailover[resp.StatusCode] && !f.isFailoverStatus(resp.StatusCode) && !contentTypeMatches(resp.Header.Get("Content-Type"), expected) {
+		return fmt.Errorf("upstream returned Content-Type %q, expected %q", resp.Header.Get("Content-Type"), expected)
 	}
 
+	// Check if response indicates failure (5xx unless failover_on says otherwise)
+	if f.isFailoverStatus(resp.StatusCode) {
+		statusErr := &upstreamStatusError{status: resp.StatusCode}
+		if f.EchoLastError || f.PreferPrimaryError || f.retryBudget != nil {
+			// Keep the response so it can be echoed if every upstream fails
+			// or the retry budget stops failover
+			statusErr.header = resp.Header.Clone()
+			statusErr.body, _ = io.ReadAll(io.LimitReader(resp.Body, echoLastErrorLimit))
+		}
+		return statusErr
+	}
+
+	// A gRPC server that can't take the call is an outage, not an answer
+	if f.UpstreamProtocol == upstreamProtocolH2C && isGRPCUnavailable(resp) {
+		return fmt.Errorf("upstream returned gRPC status UNAVAILABLE: %s", resp.Header.Get("Grpc-Message"))
+	}
+
+	// Correct gzip bodies the upstream forgot to declare
+	f.fixMismatchedEncoding(resp, upstreamURL)
+	f.decompressResponse(resp, upstreamURL)
+
 	// Copy response headers
-	for name, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(name, value)
+	copyResponseHeaders(w.Header(), resp.Header)
+
+	// Apply header_down rewrites for this upstream
+	for name, value := range f.DownstreamHeaders[upstreamURL] {
+		if strings.HasPrefix(name, "-") {
+			w.Header().Del(name[1:])
+		} else {
+			w.Header().Set(name, value)
 		}
 	}
 
+	f.setStickyCookie(w, r, upstreamURL)
+
+	// Flag responses served from a degraded path
+	if f.WarnOnFailover && upstreamURL != f.primaryUpstream() {
+		w.Header().Add("Warning", failoverWarning)
+	}
+
+	// Streams such as SSE are flushed to the client as each chunk arrives
+	var out io.Writer = w
+	var fw *flushWriter
+	if isStreamingResponse(resp) {
+		fw = newFlushWriter(w)
+		out = fw
+	}
+
+	// Rewritten bodies change length, so they are sent without Content-Length
+	var rewriter *bodyRewriter
+	if responseHasBody(r.Method, resp.StatusCode) {
+		rewriter = f.bodyRewriterFor(out, resp)
+	}
+	if rewriter != nil {
+		w.Header().Del("Content-Length")
+	}
+
+	// Trailers such as gRPC's grpc-status follow the body
+	announceTrailers(w, resp)
+	defer copyTrailers(w, resp)
+
 	// Write status code
 	w.WriteHeader(resp.StatusCode)
 
-	// Copy response body
-	_, err = io.Copy(w, resp.Body)
-	return err
+	// A 304 carries only validators and caching headers, never a body
+	if !responseHasBody(r.Method, resp.StatusCode) {
+		return nil
+	}
+
+	if fw != nil {
+		if err := fw.flush(); err != nil {
+			return responseStarted(err)
+		}
+	}
+
+	// The rewriter holds back only a possible partial match, so a stream's
+	// complete lines still reach the client as they arrive
+	if rewriter != nil {
+		if _, err := io.Copy(rewriter, resp.Body); err != nil {
+			return responseStarted(err)
+		}
+		return responseStarted(rewriter.Flush())
+	}
+	_, err = io.Copy(out, resp.Body)
+	return responseStarted(err)
+}
+
+// contentTypeMatches reports whether a Content-Type header has the expected
+// media type, which may be a wildcard such as "application/*"
+func contentTypeMatches(contentType, expected string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	expected = strings.ToLower(expected)
+	if prefix, ok := strings.CutSuffix(expected, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return mediaType == expected
+}
+
+// responseHasBody reports whether a response to the method may carry a body
+func responseHasBody(method string, status int) bool {
+	switch {
+	case method == http.MethodHead:
+		return false
+	case status >= 100 && status < 200:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
 }
 
 // parseFailoverProxy parses the Caddyfile configuration
@@ -1062,74 +2720,1131 @@ func parseFailoverProxy(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, er
 			return nil, h.Err("at least one upstream URL is required")
 		}
 
-		// Parse block for additional options
-		for h.NextBlock(0) {
-			switch h.Val() {
-			case "path":
-				// Optional path specification (overrides auto-detection)
+		// Parse block for additional options
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "path":
+				// Optional path specification (overrides auto-detection)
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				explicitPath = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "fail_duration":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid fail_duration: %v", err)
+				}
+				f.FailDuration = caddy.Duration(dur)
+
+			case "fail_duration_tls":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid fail_duration_tls: %v", err)
+				}
+				f.FailDurationTLS = caddy.Duration(dur)
+
+			case "slow_start":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid slow_start: %v", err)
+				}
+				f.SlowStart = caddy.Duration(dur)
+
+			case "health_precedence":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				switch h.Val() {
+				case healthPrecedenceActive, healthPrecedencePassive, healthPrecedenceCombined:
+					f.HealthPrecedence = h.Val()
+				default:
+					return nil, h.Errf("invalid health_precedence: %s (expected active, passive or combined)", h.Val())
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "dial_timeout":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid dial_timeout: %v", err)
+				}
+				f.DialTimeout = caddy.Duration(dur)
+
+			case "tls_session_cache":
+				// Format: tls_session_cache <size>|off
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				if h.Val() == "off" {
+					f.TLSSessionCacheSize = -1
+				} else {
+					size, err := strconv.Atoi(h.Val())
+					if err != nil || size <= 0 {
+						return nil, h.Errf("invalid tls_session_cache size: %s", h.Val())
+					}
+					f.TLSSessionCacheSize = size
+				}
+
+			case "dial_retries":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				retries, err := strconv.Atoi(h.Val())
+				if err != nil || retries < 0 {
+					return nil, h.Errf("invalid dial_retries: %s", h.Val())
+				}
+				f.DialRetries = retries
+
+			case "dns_cache_ttl":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				ttl, err := caddy.ParseDuration(h.Val())
+				if err != nil || ttl < 0 {
+					return nil, h.Errf("invalid dns_cache_ttl: %s", h.Val())
+				}
+				f.DNSCacheTTL = caddy.Duration(ttl)
+
+			case "max_conns_per_host":
+				// Format: max_conns_per_host <n> [<max_wait>]
+				args := h.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, h.ArgErr()
+				}
+				limit, err := strconv.Atoi(args[0])
+				if err != nil || limit < 1 {
+					return nil, h.Errf("invalid max_conns_per_host: %s", args[0])
+				}
+				f.MaxConnsPerHost = limit
+				if len(args) == 2 {
+					dur, err := caddy.ParseDuration(args[1])
+					if err != nil || dur <= 0 {
+						return nil, h.Errf("invalid max_conns_per_host wait: %s", args[1])
+					}
+					f.MaxConnsWait = caddy.Duration(dur)
+				}
+
+			case "max_idle_conns", "max_idle_conns_per_host":
+				// Format: max_idle_conns <n> / max_idle_conns_per_host <n>
+				option := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				limit, err := strconv.Atoi(h.Val())
+				if err != nil || limit < 1 {
+					return nil, h.Errf("invalid %s: %s", option, h.Val())
+				}
+				if option == "max_idle_conns" {
+					f.MaxIdleConns = limit
+				} else {
+					f.MaxIdleConnsPerHost = limit
+				}
+
+			case "expect_continue_timeout":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid expect_continue_timeout: %v", err)
+				}
+				f.ExpectContinueTimeout = caddy.Duration(dur)
+
+			case "response_timeout":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid response_timeout: %v", err)
+				}
+				f.ResponseTimeout = caddy.Duration(dur)
+
+			case "insecure_skip_verify":
+				f.InsecureSkipVerify = true
+
+			case "tls_client_cert":
+				// Format: tls_client_cert <file>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.TLSClientCert = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "tls_client_key":
+				// Format: tls_client_key <file>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.TLSClientKey = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "tls_trusted_ca":
+				// Format: tls_trusted_ca <file>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.TLSTrustedCA = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "via_proxy":
+				// Format: via_proxy <url>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.ViaProxy = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "max_buffer_size":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				size, err := parseByteSize(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid max_buffer_size: %v", err)
+				}
+				f.MaxBufferSize = size
+
+			case "buffer_requests":
+				// Format: buffer_requests [<max_size>]
+				f.BufferRequests = true
+				if h.NextArg() {
+					size, err := parseByteSize(h.Val())
+					if err != nil || size <= 0 {
+						return nil, h.Errf("invalid buffer_requests size: %s", h.Val())
+					}
+					f.BufferRequestsLimit = size
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "active_selection":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				switch h.Val() {
+				case activeSelectionOrder, activeSelectionSuccessRate:
+					f.ActiveSelection = h.Val()
+				default:
+					return nil, h.Errf("invalid active_selection: %s (expected order or success_rate)", h.Val())
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "lb_policy":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				switch h.Val() {
+				case lbPolicyFirst, lbPolicyRoundRobin, lbPolicyRandom:
+					f.LBPolicy = h.Val()
+				default:
+					return nil, h.Errf("invalid lb_policy: %s (expected first, round_robin or random)", h.Val())
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "weight":
+				// Format: weight <upstream_url> <weight>
+				args := h.RemainingArgs()
+				if len(args) != 2 {
+					return nil, h.ArgErr()
+				}
+				weight, err := strconv.Atoi(args[1])
+				if err != nil || weight < 0 {
+					return nil, h.Errf("invalid weight: %s", args[1])
+				}
+				if f.UpstreamWeights == nil {
+					f.UpstreamWeights = make(map[string]int)
+				}
+				f.UpstreamWeights[args[0]] = weight
+
+			case "adaptive_weights":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.AdaptiveWeights = true
+
+			case "rewrite_body_urls":
+				// Format: rewrite_body_urls <from_host> <to_host> [<max_size>]
+				args := h.RemainingArgs()
+				if len(args) < 2 || len(args) > 3 {
+					return nil, h.ArgErr()
+				}
+				rule := BodyURLRewrite{From: args[0], To: args[1]}
+				if len(args) == 3 {
+					size, err := parseByteSize(args[2])
+					if err != nil || size <= 0 {
+						return nil, h.Errf("invalid rewrite_body_urls max size: %s", args[2])
+					}
+					rule.MaxSize = size
+				}
+				f.BodyURLRewrites = append(f.BodyURLRewrites, rule)
+
+			case "decompress_response":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.DecompressResponse = true
+
+			case "detect_mismatched_encoding":
+				// Format: detect_mismatched_encoding [header|decompress]
+				f.DetectMismatchedEncoding = encodingFixHeader
+				if h.NextArg() {
+					if h.Val() != encodingFixHeader && h.Val() != encodingFixDecompress {
+						return nil, h.Errf("invalid detect_mismatched_encoding mode: %s (expected header or decompress)", h.Val())
+					}
+					f.DetectMismatchedEncoding = h.Val()
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "metrics_buckets":
+				// Format: metrics_buckets <bound>...
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.ArgErr()
+				}
+				buckets, err := parseMetricsBuckets(args)
+				if err != nil {
+					return nil, h.Errf("invalid metrics_buckets: %v", err)
+				}
+				f.MetricsBuckets = buckets
+
+			case "cookie_prefix":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.CookiePrefix = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "max_registered_paths":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				limit, err := strconv.Atoi(h.Val())
+				if err != nil || limit <= 0 {
+					return nil, h.Errf("invalid max_registered_paths: %s", h.Val())
+				}
+				f.MaxRegisteredPaths = limit
+
+			case "wait_for_healthy":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid wait_for_healthy: %v", err)
+				}
+				f.WaitForHealthy = caddy.Duration(dur)
+
+			case "startup_jitter":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil || dur < 0 {
+					return nil, h.Errf("invalid startup_jitter: %s", h.Val())
+				}
+				f.StartupJitter = caddy.Duration(dur)
+
+			case "log_sampling":
+				// Format: log_sampling <n>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				n, err := strconv.Atoi(h.Val())
+				if err != nil || n < 1 {
+					return nil, h.Errf("invalid log_sampling: %s (must be a positive integer)", h.Val())
+				}
+				f.LogSampling = n
+
+			case "drain_timeout":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil || dur < 0 {
+					return nil, h.Errf("invalid drain_timeout: %s", h.Val())
+				}
+				f.DrainTimeout = caddy.Duration(dur)
+
+			case "probe_callback":
+				// Format: probe_callback <url>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.ProbeCallback = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "self_health":
+				// Format: self_health <path> [status]
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.SelfHealthPath = h.Val()
+				if h.NextArg() {
+					if h.Val() != "status" {
+						return nil, h.Errf("unknown self_health option: %s", h.Val())
+					}
+					f.SelfHealthStatus = true
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "max_hops":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				hops, err := strconv.Atoi(h.Val())
+				if err != nil || hops < 1 {
+					return nil, h.Errf("invalid max_hops: %s", h.Val())
+				}
+				f.MaxHops = hops
+
+			case "failover_on":
+				// Format: failover_on <code|NNN-MMM>...
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.ArgErr()
+				}
+				codes, err := parseStatusCodes(args)
+				if err != nil {
+					return nil, h.Errf("invalid failover_on: %v", err)
+				}
+				f.FailoverStatusCodes = append(f.FailoverStatusCodes, codes...)
+
+			case "never_failover_status":
+				// Format: never_failover_status <code|NNN-MMM>...
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.ArgErr()
+				}
+				codes, err := parseStatusCodes(args)
+				if err != nil {
+					return nil, h.Errf("invalid never_failover_status: %v", err)
+				}
+				f.NeverFailoverStatusCodes = append(f.NeverFailoverStatusCodes, codes...)
+
+			case "echo_last_error":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.EchoLastError = true
+
+			case "prefer_primary_error":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.PreferPrimaryError = true
+
+			case "warn_on_failover":
+				f.WarnOnFailover = true
+
+			case "coalesce":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.Coalesce = true
+
+			case "retries":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				retries, err := strconv.Atoi(h.Val())
+				if err != nil || retries < 0 {
+					return nil, h.Errf("invalid retries: %s", h.Val())
+				}
+				f.Retries = retries
+
+			case "retry_backoff":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil || dur < 0 {
+					return nil, h.Errf("invalid retry_backoff: %s", h.Val())
+				}
+				f.RetryBackoff = caddy.Duration(dur)
+
+			case "retry_all_methods":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.RetryAllMethods = true
+
+			case "retry_budget":
+				// Format: retry_budget <percent> [<min_retries>]
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				var percent float64
+				if _, err := fmt.Sscanf(strings.TrimSuffix(h.Val(), "%"), "%g", &percent); err != nil || percent < 0 {
+					return nil, h.Errf("invalid retry_budget percent: %s", h.Val())
+				}
+				budget := &RetryBudget{Percent: percent}
+				if h.NextArg() {
+					var minRetries int
+					if _, err := fmt.Sscanf(h.Val(), "%d", &minRetries); err != nil || minRetries < 0 {
+						return nil, h.Errf("invalid retry_budget min_retries: %s", h.Val())
+					}
+					budget.MinRetries = minRetries
+				}
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.RetryBudget = budget
+
+			case "circuit_breaker":
+				// Format: circuit_breaker { failures <n>; cooldown <dur>; half_open_requests <n> }
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				cb := &CircuitBreaker{}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "failures", "half_open_requests":
+						name := h.Val()
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						n, err := strconv.Atoi(h.Val())
+						if err != nil || n < 1 {
+							return nil, h.Errf("invalid circuit_breaker %s: %s", name, h.Val())
+						}
+						if name == "failures" {
+							cb.Failures = n
+						} else {
+							cb.HalfOpenRequests = n
+						}
+
+					case "cooldown":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(h.Val())
+						if err != nil || dur <= 0 {
+							return nil, h.Errf("invalid circuit_breaker cooldown: %s", h.Val())
+						}
+						cb.Cooldown = caddy.Duration(dur)
+
+					default:
+						return nil, h.Errf("unknown circuit_breaker subdirective: %s", h.Val())
+					}
+				}
+				f.CircuitBreaker = cb
+
+			case "passive_health":
+				// Format: passive_health { max_fails <n>; window <dur> }
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				ph := &PassiveHealth{}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "max_fails":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						n, err := strconv.Atoi(h.Val())
+						if err != nil || n < 1 {
+							return nil, h.Errf("invalid passive_health max_fails: %s", h.Val())
+						}
+						ph.MaxFails = n
+
+					case "window":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(h.Val())
+						if err != nil || dur <= 0 {
+							return nil, h.Errf("invalid passive_health window: %s", h.Val())
+						}
+						ph.Window = caddy.Duration(dur)
+
+					default:
+						return nil, h.Errf("unknown passive_health subdirective: %s", h.Val())
+					}
+				}
+				f.PassiveHealth = ph
+
+			case "sticky":
+				// Format: sticky { key <cookie|header> <name>; rewrite_cookie }
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				sticky := &StickySession{}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "key":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if h.Val() != stickyKeyCookie && h.Val() != stickyKeyHeader {
+							return nil, h.Errf("invalid sticky key: %s (expected cookie or header)", h.Val())
+						}
+						sticky.Key = h.Val()
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						sticky.Name = h.Val()
+						if h.NextArg() {
+							return nil, h.ArgErr()
+						}
+
+					case "rewrite_cookie":
+						if h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						sticky.RewriteCookie = true
+
+					default:
+						return nil, h.Errf("unknown sticky subdirective: %s", h.Val())
+					}
+				}
+				if sticky.Key == "" {
+					return nil, h.Err("sticky requires a key")
+				}
+				f.Sticky = sticky
+
+			case "fallback":
+				// Format: fallback { status <code>; body <text>; header <name> <value> }
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				fallback := &FallbackResponse{}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "status":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						code, err := strconv.Atoi(h.Val())
+						if err != nil || code < 100 || code > 599 {
+							return nil, h.Errf("invalid fallback status: %s", h.Val())
+						}
+						fallback.StatusCode = code
+
+					case "body":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						fallback.Body = h.Val()
+						if h.NextArg() {
+							return nil, h.ArgErr()
+						}
+
+					case "header":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						name := h.Val()
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if fallback.Headers == nil {
+							fallback.Headers = make(map[string]string)
+						}
+						fallback.Headers[name] = h.Val()
+
+					default:
+						return nil, h.Errf("unknown fallback subdirective: %s", h.Val())
+					}
+				}
+				f.Fallback = fallback
+
+			case "fallback_to_next":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.FallbackToNext = true
+
+			case "json_errors":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.JSONErrors = true
+
+			case "log_requests":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.LogRequests = true
+
+			case "max_concurrent":
+				// Format: max_concurrent <n>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				n, err := strconv.Atoi(h.Val())
+				if err != nil || n < 1 {
+					return nil, h.Errf("invalid max_concurrent: %s", h.Val())
+				}
+				f.MaxConcurrent = n
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "upstream_protocol":
+				// Format: upstream_protocol h2c
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				if h.Val() != upstreamProtocolH2C {
+					return nil, h.Errf("invalid upstream_protocol: %s (expected h2c)", h.Val())
+				}
+				f.UpstreamProtocol = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "merge":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.Merge = true
+
+			case "size_route":
+				// Format: size_route { threshold <bytes>; large <upstream_url> }
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				route := &SizeRoute{}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "threshold":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						size, err := parseByteSize(h.Val())
+						if err != nil || size < 0 {
+							return nil, h.Errf("invalid size_route threshold: %s", h.Val())
+						}
+						route.Threshold = size
+
+					case "large":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						route.Large = h.Val()
+
+					default:
+						return nil, h.Errf("unknown size_route subdirective: %s", h.Val())
+					}
+				}
+				if route.Large == "" {
+					return nil, h.Err("size_route requires a large upstream")
+				}
+				f.SizeRoute = route
+
+			case "canary":
+				// Format: canary <upstream_url> <percent>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				canary := &Canary{Upstream: h.Val()}
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				percent, err := strconv.ParseFloat(strings.TrimSuffix(h.Val(), "%"), 64)
+				if err != nil || percent < 0 || percent > 100 {
+					return nil, h.Errf("invalid canary percent: %s", h.Val())
+				}
+				canary.Percent = percent
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.Canary = canary
+
+			case "debug_upstream":
+				// Format: debug_upstream <upstream_url>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.DebugUpstreams = append(f.DebugUpstreams, h.Val())
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "method_rewrite":
+				// Format: method_rewrite <upstream_url> <from> <to>
+				args := h.RemainingArgs()
+				if len(args) != 3 {
+					return nil, h.ArgErr()
+				}
+				if f.MethodRewrites == nil {
+					f.MethodRewrites = make(map[string]map[string]string)
+				}
+				if f.MethodRewrites[args[0]] == nil {
+					f.MethodRewrites[args[0]] = make(map[string]string)
+				}
+				f.MethodRewrites[args[0]][strings.ToUpper(args[1])] = strings.ToUpper(args[2])
+
+			case "rewrite":
+				// Format: rewrite <upstream_url> <from_regex> <to>
+				args := h.RemainingArgs()
+				if len(args) != 3 {
+					return nil, h.ArgErr()
+				}
+				if _, err := regexp.Compile(args[1]); err != nil {
+					return nil, h.Errf("invalid rewrite pattern: %v", err)
+				}
+				if f.PathRewrites == nil {
+					f.PathRewrites = make(map[string][]*PathRewrite)
+				}
+				f.PathRewrites[args[0]] = append(f.PathRewrites[args[0]], &PathRewrite{From: args[1], To: args[2]})
+
+			case "forward_headers_allow":
+				// Format: forward_headers_allow <header>...
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.ArgErr()
+				}
+				f.ForwardHeadersAllow = append(f.ForwardHeadersAllow, args...)
+
+			case "forward_headers_deny":
+				// Format: forward_headers_deny <header>...
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.ArgErr()
+				}
+				f.ForwardHeadersDeny = append(f.ForwardHeadersDeny, args...)
+
+			case "header_up":
+				// Format: header_up <upstream_url> <header_name> <header_value>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				upstreamURL := h.Val()
+
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				headerName := h.Val()
+
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				headerValue := h.Val()
+
+				// Initialize map if needed
+				if f.UpstreamHeaders[upstreamURL] == nil {
+					f.UpstreamHeaders[upstreamURL] = make(map[string]string)
+				}
+				f.UpstreamHeaders[upstreamURL][headerName] = headerValue
+
+			case "header_down":
+				// Format: header_down <upstream_url> <header_name> <header_value>
+				//     or: header_down <upstream_url> -<header_name>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				upstreamURL := h.Val()
+
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				headerName := h.Val()
+
+				headerValue := ""
+				if strings.HasPrefix(headerName, "-") {
+					if len(headerName) == 1 || h.NextArg() {
+						return nil, h.ArgErr()
+					}
+				} else if !h.NextArg() {
+					return nil, h.ArgErr()
+				} else {
+					headerValue = h.Val()
+				}
+
+				if f.DownstreamHeaders == nil {
+					f.DownstreamHeaders = make(map[string]map[string]string)
+				}
+				if f.DownstreamHeaders[upstreamURL] == nil {
+					f.DownstreamHeaders[upstreamURL] = make(map[string]string)
+				}
+				f.DownstreamHeaders[upstreamURL][headerName] = headerValue
+
+			case "accept_override":
+				// Format: accept_override <upstream_url> <value>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				upstreamURL := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				if f.AcceptOverrides == nil {
+					f.AcceptOverrides = make(map[string]string)
+				}
+				f.AcceptOverrides[upstreamURL] = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "preserve_host":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				f.PreserveHost = true
+
+			case "trusted_proxies":
+				// Format: trusted_proxies <cidr|ip>...
+				proxies := h.RemainingArgs()
+				if len(proxies) == 0 {
+					return nil, h.ArgErr()
+				}
+				if _, err := parseTrustedProxies(proxies); err != nil {
+					return nil, h.Err(err.Error())
+				}
+				f.TrustedProxies = append(f.TrustedProxies, proxies...)
+
+			case "xff_mode":
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
-				explicitPath = h.Val()
+				switch h.Val() {
+				case xffModeReplace, xffModeAppend:
+					f.XFFMode = h.Val()
+				default:
+					return nil, h.Errf("invalid xff_mode: %s (expected append or replace)", h.Val())
+				}
 				if h.NextArg() {
 					return nil, h.ArgErr()
 				}
 
-			case "fail_duration":
+			case "host_header":
+				// Format: host_header <upstream_url> <value>
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
-				dur, err := caddy.ParseDuration(h.Val())
+				upstreamURL := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				if f.HostHeaders == nil {
+					f.HostHeaders = make(map[string]string)
+				}
+				f.HostHeaders[upstreamURL] = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+
+			case "idle_conn_timeout":
+				// Format: idle_conn_timeout [<upstream_url>] <duration>
+				args := h.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(args[len(args)-1])
 				if err != nil {
-					return nil, h.Errf("invalid fail_duration: %v", err)
+					return nil, h.Errf("invalid idle_conn_timeout: %v", err)
 				}
-				f.FailDuration = caddy.Duration(dur)
+				// Without an upstream it applies to every upstream
+				if len(args) == 1 {
+					if dur <= 0 {
+						return nil, h.Errf("invalid idle_conn_timeout: %s", args[0])
+					}
+					f.IdleConnTimeout = caddy.Duration(dur)
+					break
+				}
+				upstreamURL := args[0]
+				if f.UpstreamIdleTimeouts == nil {
+					f.UpstreamIdleTimeouts = make(map[string]caddy.Duration)
+				}
+				f.UpstreamIdleTimeouts[upstreamURL] = caddy.Duration(dur)
 
-			case "dial_timeout":
+			case "srv", "upstream_srv":
+				// Format: srv <name> { scheme <http|https>; refresh <duration> }
+				// upstream_srv is an alias for srv
+				directive := h.Val()
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
-				dur, err := caddy.ParseDuration(h.Val())
-				if err != nil {
-					return nil, h.Errf("invalid dial_timeout: %v", err)
+				srv := &SRVUpstream{Name: h.Val()}
+				if h.NextArg() {
+					return nil, h.ArgErr()
 				}
-				f.DialTimeout = caddy.Duration(dur)
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "scheme":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if h.Val() != "http" && h.Val() != "https" {
+							return nil, h.Errf("invalid %s scheme: %s (expected http or https)", directive, h.Val())
+						}
+						srv.Scheme = h.Val()
 
-			case "response_timeout":
+					case "refresh":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(h.Val())
+						if err != nil || dur <= 0 {
+							return nil, h.Errf("invalid %s refresh: %s", directive, h.Val())
+						}
+						srv.Refresh = caddy.Duration(dur)
+
+					default:
+						return nil, h.Errf("unknown %s subdirective: %s", directive, h.Val())
+					}
+				}
+				f.SRVUpstreams = append(f.SRVUpstreams, srv)
+
+			case "upstream_http_versions":
+				// Format: upstream_http_versions <1.1|2>...
+				versions := h.RemainingArgs()
+				if len(versions) == 0 {
+					return nil, h.ArgErr()
+				}
+				for _, version := range versions {
+					if _, ok := alpnProtocols[version]; !ok {
+						return nil, h.Errf("invalid upstream_http_versions: %s", version)
+					}
+				}
+				f.UpstreamHTTPVersions = versions
+
+			case "tls_alpn":
+				// Format: tls_alpn <upstream_url> <proto...>
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
-				dur, err := caddy.ParseDuration(h.Val())
-				if err != nil {
-					return nil, h.Errf("invalid response_timeout: %v", err)
+				upstreamURL := h.Val()
+				protos := h.RemainingArgs()
+				if len(protos) == 0 {
+					return nil, h.ArgErr()
 				}
-				f.ResponseTimeout = caddy.Duration(dur)
+				if f.UpstreamALPN == nil {
+					f.UpstreamALPN = make(map[string][]string)
+				}
+				f.UpstreamALPN[upstreamURL] = protos
 
-			case "insecure_skip_verify":
-				f.InsecureSkipVerify = true
+			case "tls_renegotiation":
+				// Format: tls_renegotiation <upstream_url> <never|once|freely>
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				upstreamURL := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				if _, ok := tlsRenegotiationModes[h.Val()]; !ok {
+					return nil, h.Errf("invalid tls_renegotiation: %s (expected never, once or freely)", h.Val())
+				}
+				if f.UpstreamRenegotiation == nil {
+					f.UpstreamRenegotiation = make(map[string]string)
+				}
+				f.UpstreamRenegotiation[upstreamURL] = h.Val()
 
-			case "header_up":
-				// Format: header_up <upstream_url> <header_name> <header_value>
+			case "expect_content_type":
+				// Format: expect_content_type <upstream_url> <type>
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
 				upstreamURL := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				if f.ExpectContentTypes == nil {
+					f.ExpectContentTypes = make(map[string]string)
+				}
+				f.ExpectContentTypes[upstreamURL] = h.Val()
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
 
+			case "max_response_time":
+				// Format: max_response_time <upstream_url> <duration>
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
-				headerName := h.Val()
+				upstreamURL := h.Val()
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid max_response_time: %v", err)
+				}
+				if f.MaxResponseTimes == nil {
+					f.MaxResponseTimes = make(map[string]caddy.Duration)
+				}
+				f.MaxResponseTimes[upstreamURL] = caddy.Duration(dur)
 
+			case "ping_check":
+				// Format: ping_check <upstream_url> [{ ... }]
 				if !h.NextArg() {
 					return nil, h.ArgErr()
 				}
-				headerValue := h.Val()
+				upstreamURL := h.Val()
 
-				// Initialize map if needed
-				if f.UpstreamHeaders[upstreamURL] == nil {
-					f.UpstreamHeaders[upstreamURL] = make(map[string]string)
+				pc := &PingCheck{}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "interval":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(h.Val())
+						if err != nil {
+							return nil, h.Errf("invalid ping check interval: %v", err)
+						}
+						pc.Interval = caddy.Duration(dur)
+
+					case "timeout":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(h.Val())
+						if err != nil {
+							return nil, h.Errf("invalid ping check timeout: %v", err)
+						}
+						pc.Timeout = caddy.Duration(dur)
+
+					default:
+						return nil, h.Errf("unknown ping_check subdirective: %s", h.Val())
+					}
 				}
-				f.UpstreamHeaders[upstreamURL][headerName] = headerValue
+
+				if f.PingChecks == nil {
+					f.PingChecks = make(map[string]*PingCheck)
+				}
+				f.PingChecks[upstreamURL] = pc
 
 			case "health_check":
 				// Format: health_check <upstream_url> { ... }
@@ -1147,7 +3862,27 @@ func parseFailoverProxy(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, er
 						if !h.NextArg() {
 							return nil, h.ArgErr()
 						}
-						hc.Path = h.Val()
+						// Further path lines are probed too, combined by require
+						if hc.Path == "" {
+							hc.Path = h.Val()
+						} else {
+							hc.Paths = append(hc.Paths, h.Val())
+						}
+
+					case "require":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if h.Val() != healthRequireAll && h.Val() != healthRequireAny {
+							return nil, h.Errf("invalid health check require: %s (expected all or any)", h.Val())
+						}
+						hc.Require = h.Val()
+
+					case "include_base_path":
+						if h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						hc.IncludeBasePath = true
 
 					case "interval":
 						if !h.NextArg() {
@@ -1169,6 +3904,56 @@ func parseFailoverProxy(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, er
 						}
 						hc.Timeout = caddy.Duration(dur)
 
+					case "host":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						hc.Host = h.Val()
+
+					case "http_version":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if h.Val() != "1.1" && h.Val() != "2" {
+							return nil, h.Errf("invalid health check http_version: %s (expected 1.1 or 2)", h.Val())
+						}
+						hc.HTTPVersion = h.Val()
+
+					case "confirm_recovery":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						confirm, err := strconv.Atoi(h.Val())
+						if err != nil || confirm < 0 {
+							return nil, h.Errf("invalid confirm_recovery: %s", h.Val())
+						}
+						hc.ConfirmRecovery = confirm
+
+					case "initial_probes":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						probes, err := strconv.Atoi(h.Val())
+						if err != nil || probes < 1 {
+							return nil, h.Errf("invalid initial_probes: %s", h.Val())
+						}
+						hc.InitialProbes = probes
+
+					case "healthy_threshold", "unhealthy_threshold":
+						option := h.Val()
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						n, err := strconv.Atoi(h.Val())
+						if err != nil || n < 1 {
+							return nil, h.Errf("invalid %s: %s", option, h.Val())
+						}
+						if option == "healthy_threshold" {
+							hc.HealthyThreshold = n
+						} else {
+							hc.UnhealthyThreshold = n
+						}
+
 					case "expected_status":
 						if !h.NextArg() {
 							return nil, h.ArgErr()
@@ -1180,6 +3965,59 @@ func parseFailoverProxy(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, er
 						}
 						hc.ExpectedStatus = status
 
+					case "expected_status_range":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						low, high, err := parseStatusRange(h.Val())
+						if err != nil {
+							return nil, h.Errf("invalid expected_status_range: %v", err)
+						}
+						hc.ExpectedStatusMin, hc.ExpectedStatusMax = low, high
+
+					case "type":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if h.Val() != healthCheckHTTP && h.Val() != healthCheckTCP {
+							return nil, h.Errf("invalid health check type: %s (expected http or tcp)", h.Val())
+						}
+						hc.Type = h.Val()
+
+					case "headers":
+						// Format: headers { <name> <value> ... }
+						if h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if hc.Headers == nil {
+							hc.Headers = make(map[string]string)
+						}
+						for h.NextBlock(2) {
+							name := h.Val()
+							if !h.NextArg() {
+								return nil, h.ArgErr()
+							}
+							hc.Headers[name] = h.Val()
+							if h.NextArg() {
+								return nil, h.ArgErr()
+							}
+						}
+
+					case "expected_body":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						hc.ExpectedBody = h.Val()
+
+					case "expected_body_regex":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						if _, err := regexp.Compile(h.Val()); err != nil {
+							return nil, h.Errf("invalid expected_body_regex: %v", err)
+						}
+						hc.ExpectedBodyRegex = h.Val()
+
 					default:
 						return nil, h.Errf("unknown health_check subdirective: %s", h.Val())
 					}
@@ -1193,6 +4031,11 @@ func parseFailoverProxy(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, er
 		}
 	}
 
+	// Fill settings left unset from the failover_proxy global option
+	if defaults, ok := h.Option("failover_proxy").(ProxyDefaults); ok {
+		defaults.applyTo(f)
+	}
+
 	// Determine which path to use based on the fallback logic
 	// Get file and line information for better error reporting
 	file := h.File()
@@ -1253,7 +4096,19 @@ func (f *FailoverProxy) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 }
 
 // FailoverStatusHandler provides an HTTP endpoint for status information
-type FailoverStatusHandler struct{}
+type FailoverStatusHandler struct {
+	// PassthroughNonGet passes non-GET requests to the next handler instead of returning 405
+	PassthroughNonGet bool `json:"passthrough_non_get,omitempty"`
+
+	// AllowToggle accepts POSTs of an UpstreamToggle to disable or re-enable
+	// an upstream at runtime. Protect the endpoint before enabling it.
+	AllowToggle bool `json:"allow_toggle,omitempty"`
+
+	// AllowReconfigure accepts PUTs of an UpstreamList to <status
+	// path>/<proxy path>/upstreams, replacing a proxy's upstreams at runtime.
+	// Protect the endpoint before enabling it.
+	AllowReconfigure bool `json:"allow_reconfigure,omitempty"`
+}
 
 // CaddyModule returns the Caddy module information
 func (FailoverStatusHandler) CaddyModule() caddy.ModuleInfo {
@@ -1265,7 +4120,16 @@ func (FailoverStatusHandler) CaddyModule() caddy.ModuleInfo {
 
 // ServeHTTP handles the status request
 func (h FailoverStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method == http.MethodPost && h.AllowToggle {
+		return h.serveToggle(w, r)
+	}
+	if r.Method == http.MethodPut && h.AllowReconfigure && strings.HasSuffix(r.URL.Path, upstreamsSuffix) {
+		return h.serveSetUpstreams(w, r)
+	}
 	if r.Method != http.MethodGet {
+		if h.PassthroughNonGet && next != nil {
+			return next.ServeHTTP(w, r)
+		}
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return nil
 	}
@@ -1277,6 +4141,11 @@ func (h FailoverStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request,
 		status = []PathStatus{}
 	}
 
+	// Narrow large deployments down to the routes under a path prefix
+	if prefix := r.URL.Query().Get("path"); prefix != "" {
+		status = filterStatusByPath(status, prefix)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(status); err != nil {
 		// Log error and return error response
@@ -1288,14 +4157,52 @@ func (h FailoverStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request,
 	return nil
 }
 
+// filterStatusByPath returns the statuses whose path starts with prefix,
+// as an empty slice rather than nil when none match
+func filterStatusByPath(status []PathStatus, prefix string) []PathStatus {
+	filtered := []PathStatus{}
+	for _, ps := range status {
+		if strings.HasPrefix(ps.Path, prefix) {
+			filtered = append(filtered, ps)
+		}
+	}
+	return filtered
+}
+
 // parseFailoverStatus parses the failover_status directive
 func parseFailoverStatus(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := FailoverStatusHandler{}
 	for h.Next() {
 		if h.NextArg() {
 			return nil, h.ArgErr()
 		}
+
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "passthrough_non_get":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				handler.PassthroughNonGet = true
+
+			case "allow_toggle":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				handler.AllowToggle = true
+
+			case "allow_reconfigure":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				handler.AllowReconfigure = true
+
+			default:
+				return nil, h.Errf("unknown failover_status subdirective: %s", h.Val())
+			}
+		}
 	}
-	return FailoverStatusHandler{}, nil
+	return handler, nil
 }
 
 // hashString creates a short hash of a string for use as an identifier
@@ -1304,6 +4211,35 @@ func hashString(s string) string {
 	return fmt.Sprintf("%x", h[:4]) // Use first 4 bytes for a shorter hash
 }
 
+// parseByteSize parses a size such as "512", "64KB" or "10MB" into bytes
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	var n int64
+	if _, err := fmt.Sscanf(value, "%d", &n); err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
 // getFailoverApiSpec returns the failover API specification
 func getFailoverApiSpec() *api_registrar.CaddyModuleApiSpec {
 	return &api_registrar.CaddyModuleApiSpec{
@@ -1316,7 +4252,16 @@ func getFailoverApiSpec() *api_registrar.CaddyModuleApiSpec {
 				Method:      "GET",
 				Path:        "/status",
 				Summary:     "Get failover proxy status",
-				Description: "Returns the current status of all registered failover proxies including their upstreams, health checks, and active states",
+				Description: "Returns the current status of all registered failover proxies including their upstreams, health checks, active states, and the active upstream's request metrics",
+				QueryParams: []api_registrar.Parameter{
+					{
+						Name:        "path",
+						Description: "Only return proxies whose handle path starts with this prefix",
+						Required:    false,
+						Type:        "string",
+						Example:     "/api",
+					},
+				},
 				Responses: map[int]api_registrar.ResponseDef{
 					200: {
 						Description: "List of failover proxy statuses",
@@ -1324,6 +4269,45 @@ func getFailoverApiSpec() *api_registrar.CaddyModuleApiSpec {
 					},
 				},
 			},
+			{
+				Method:      "POST",
+				Path:        "/status",
+				Summary:     "Disable or enable an upstream",
+				Description: "Takes an upstream of a failover proxy out of rotation, or returns it, without a config reload. Requires allow_toggle on failover_status; the change lasts until the next reload",
+				Request:     UpstreamToggle{},
+				Responses: map[int]api_registrar.ResponseDef{
+					200: {
+						Description: "Updated status of the failover proxy",
+						Body:        PathStatus{},
+					},
+					400: {Description: "Invalid request body"},
+					404: {Description: "Unknown path or upstream"},
+				},
+			},
+			{
+				Method:      "PUT",
+				Path:        "/status/{path}/upstreams",
+				Summary:     "Replace the upstreams of a failover proxy",
+				Description: "Swaps in a new ordered list of upstreams without a config reload, restarting health checks of upstreams added back. Requires allow_reconfigure on failover_status; the change lasts until the next reload",
+				PathParams: []api_registrar.Parameter{
+					{
+						Name:        "path",
+						Description: "The failover proxy's handle path",
+						Required:    true,
+						Type:        "string",
+						Example:     "api/*",
+					},
+				},
+				Request: UpstreamList{},
+				Responses: map[int]api_registrar.ResponseDef{
+					200: {
+						Description: "The new and previous upstreams",
+						Body:        UpstreamList{},
+					},
+					400: {Description: "Invalid request body or upstream URL"},
+					404: {Description: "Unknown path"},
+				},
+			},
 		},
 	}
 }
@@ -1340,7 +4324,16 @@ func GetFailoverApiSpec() *api_registrar.CaddyModuleApiSpec {
 				Method:      "GET",
 				Path:        "",
 				Summary:     "Get failover proxy status",
-				Description: "Returns the current status of all registered failover proxies including their upstreams, health checks, and active states",
+				Description: "Returns the current status of all registered failover proxies including their upstreams, health checks, active states, and the active upstream's request metrics",
+				QueryParams: []api_registrar.Parameter{
+					{
+						Name:        "path",
+						Description: "Only return proxies whose handle path starts with this prefix",
+						Required:    false,
+						Type:        "string",
+						Example:     "/api",
+					},
+				},
 				Responses: map[int]api_registrar.ResponseDef{
 					200: {
 						Description: "List of failover proxy statuses",
@@ -1348,6 +4341,45 @@ func GetFailoverApiSpec() *api_registrar.CaddyModuleApiSpec {
 					},
 				},
 			},
+			{
+				Method:      "POST",
+				Path:        "",
+				Summary:     "Disable or enable an upstream",
+				Description: "Takes an upstream of a failover proxy out of rotation, or returns it, without a config reload. Requires allow_toggle on failover_status; the change lasts until the next reload",
+				Request:     UpstreamToggle{},
+				Responses: map[int]api_registrar.ResponseDef{
+					200: {
+						Description: "Updated status of the failover proxy",
+						Body:        PathStatus{},
+					},
+					400: {Description: "Invalid request body"},
+					404: {Description: "Unknown path or upstream"},
+				},
+			},
+			{
+				Method:      "PUT",
+				Path:        "/{path}/upstreams",
+				Summary:     "Replace the upstreams of a failover proxy",
+				Description: "Swaps in a new ordered list of upstreams without a config reload, restarting health checks of upstreams added back. Requires allow_reconfigure on failover_status; the change lasts until the next reload",
+				PathParams: []api_registrar.Parameter{
+					{
+						Name:        "path",
+						Description: "The failover proxy's handle path",
+						Required:    true,
+						Type:        "string",
+						Example:     "api/*",
+					},
+				},
+				Request: UpstreamList{},
+				Responses: map[int]api_registrar.ResponseDef{
+					200: {
+						Description: "The new and previous upstreams",
+						Body:        UpstreamList{},
+					},
+					400: {Description: "Invalid request body or upstream URL"},
+					404: {Description: "Unknown path"},
+				},
+			},
 		},
 	}
 }
@@ -0,0 +1,31 @@
+package failover
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// healthCheckBodyLimit caps how much of a probe response is read for body matching
+const healthCheckBodyLimit = 64 << 10
+
+// expectsBody reports whether the check inspects the probe response body
+func (hc *HealthCheck) expectsBody() bool {
+	return hc.ExpectedBody != "" || hc.bodyRegex != nil
+}
+
+// bodyMatches reads up to healthCheckBodyLimit bytes of the probe response and
+// reports whether they contain ExpectedBody and match ExpectedBodyRegex
+func (hc *HealthCheck) bodyMatches(resp *http.Response) bool {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, healthCheckBodyLimit))
+	if err != nil {
+		return false
+	}
+	if hc.ExpectedBody != "" && !bytes.Contains(body, []byte(hc.ExpectedBody)) {
+		return false
+	}
+	if hc.bodyRegex != nil && !hc.bodyRegex.Match(body) {
+		return false
+	}
+	return true
+}
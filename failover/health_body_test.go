@@ -0,0 +1,104 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// probeBody runs one health check against a server answering 200 with the given body
+func probeBody(t *testing.T, hc *HealthCheck, body *atomic.Value) func(string) bool {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body.Load().(string)))
+	}))
+	t.Cleanup(server.Close)
+
+	fp := CreateTestProxy(t, []string{server.URL})
+	hc.Timeout = caddy.Duration(time.Second)
+	hc.ExpectedStatus = http.StatusOK
+	u, _ := url.Parse(server.URL)
+	healthURL := buildHealthURL(u, hc)
+
+	return func(payload string) bool {
+		body.Store(payload)
+		fp.performHealthCheck(healthURL, server.URL, hc)
+		fp.mu.RLock()
+		defer fp.mu.RUnlock()
+		return fp.healthStatus[server.URL]
+	}
+}
+
+// TestHealthCheckExpectedBody tests that a 200 with a degraded payload is unhealthy
+func TestHealthCheckExpectedBody(t *testing.T) {
+	probe := probeBody(t, &HealthCheck{Path: "/health", ExpectedBody: `"status":"OK"`}, &atomic.Value{})
+
+	if !probe(`{"status":"OK"}`) {
+		t.Error("Expected a matching body to be healthy")
+	}
+	if probe(`{"status":"DEGRADED"}`) {
+		t.Error("Expected a DEGRADED body to be unhealthy despite the 200 status")
+	}
+}
+
+// TestHealthCheckExpectedBodyRegex tests matching the probe body against a pattern
+func TestHealthCheckExpectedBodyRegex(t *testing.T) {
+	hc := &HealthCheck{Path: "/health", bodyRegex: regexp.MustCompile(`^(OK|READY)\s*$`)}
+	probe := probeBody(t, hc, &atomic.Value{})
+
+	if !probe("READY\n") {
+		t.Error("Expected a matching body to be healthy")
+	}
+	if probe("DEGRADED") {
+		t.Error("Expected a DEGRADED body to be unhealthy")
+	}
+}
+
+// TestHealthCheckBodyLimit tests that only the first 64KB of the body is matched
+func TestHealthCheckBodyLimit(t *testing.T) {
+	probe := probeBody(t, &HealthCheck{Path: "/health", ExpectedBody: "OK"}, &atomic.Value{})
+
+	if probe(strings.Repeat(" ", healthCheckBodyLimit) + "OK") {
+		t.Error("Expected content past the read limit not to be matched")
+	}
+	if !probe("OK" + strings.Repeat(" ", 2*healthCheckBodyLimit)) {
+		t.Error("Expected a match within the limit on a large body")
+	}
+}
+
+// TestParseExpectedBody tests parsing the expected_body options
+func TestParseExpectedBody(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			expected_body OK
+			expected_body_regex "^(OK|READY)$"
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	hc := handler.(*FailoverProxy).HealthChecks["http://a"]
+	if hc.ExpectedBody != "OK" || hc.ExpectedBodyRegex != "^(OK|READY)$" {
+		t.Errorf("Unexpected health check: %+v", hc)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			expected_body_regex "("
+		}
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected error for an invalid regex")
+	}
+}
@@ -0,0 +1,91 @@
+package failover
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// minConfirmDelay is the shortest wait between recovery confirmation probes
+const minConfirmDelay = 10 * time.Millisecond
+
+// reportHealth applies a probe result. A change of status first needs
+// healthy_threshold or unhealthy_threshold results in a row. With
+// confirm_recovery, the first pass after the upstream was down only starts
+// confirmation, and the upstream is marked healthy once ConfirmRecovery
+// further probes have passed as well. Before that, an upstream with
+// initial_probes must first pass that many probes in a row to be included at all.
+func (f *FailoverProxy) reportHealth(upstreamURL string, hc *HealthCheck, healthy bool) {
+	if hc.InitialProbes > 0 && !hc.included {
+		f.reportInitialProbe(upstreamURL, hc, healthy)
+		return
+	}
+
+	if !f.thresholdMet(upstreamURL, hc, healthy) {
+		return
+	}
+
+	if !healthy || hc.ConfirmRecovery <= 0 {
+		hc.confirmations = 0
+		f.setHealthStatus(upstreamURL, healthy)
+		return
+	}
+
+	f.mu.RLock()
+	wasHealthy, known := f.healthStatus[upstreamURL]
+	f.mu.RUnlock()
+
+	// Nothing to confirm on the first probe or while already healthy
+	if !known || wasHealthy {
+		f.setHealthStatus(upstreamURL, true)
+		return
+	}
+
+	hc.confirmations++
+	if hc.confirmations > hc.ConfirmRecovery {
+		hc.confirmations = 0
+		f.setHealthStatus(upstreamURL, true)
+		return
+	}
+
+	f.logger.Debug("health check passed, confirming recovery",
+		zap.String("upstream", upstreamURL),
+		zap.Int("remaining", hc.ConfirmRecovery-hc.confirmations+1))
+}
+
+// nextProbeDelay returns the wait before the next probe. While confirming a
+// recovery, probes start well inside the interval and back off exponentially
+// towards it: Interval/2^N, then Interval/2^(N-1), ... then Interval/2.
+func (hc *HealthCheck) nextProbeDelay() time.Duration {
+	interval := time.Duration(hc.Interval)
+	if hc.confirmations == 0 {
+		return interval
+	}
+
+	delay := interval >> (hc.ConfirmRecovery - hc.confirmations + 1)
+	if delay < minConfirmDelay {
+		delay = minConfirmDelay
+	}
+	return delay
+}
+
+// reportInitialProbe applies a probe result while the upstream is still
+// warming up, keeping it out of rotation until InitialProbes consecutive passes
+func (f *FailoverProxy) reportInitialProbe(upstreamURL string, hc *HealthCheck, healthy bool) {
+	if !healthy {
+		hc.initialPasses = 0
+		f.setHealthStatus(upstreamURL, false)
+		return
+	}
+
+	hc.initialPasses++
+	if hc.initialPasses < hc.InitialProbes {
+		f.logger.Debug("health check passed, waiting for initial probes",
+			zap.String("upstream", upstreamURL),
+			zap.Int("remaining", hc.InitialProbes-hc.initialPasses))
+		return
+	}
+
+	hc.included = true
+	f.setHealthStatus(upstreamURL, true)
+}
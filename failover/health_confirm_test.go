@@ -0,0 +1,156 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// TestConfirmRecovery tests that a single success after a down period doesn't mark the upstream healthy
+func TestConfirmRecovery(t *testing.T) {
+	var status int32 = http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL})
+	hc := &HealthCheck{
+		Path:            "/health",
+		Interval:        caddy.Duration(time.Second),
+		Timeout:         caddy.Duration(time.Second),
+		ExpectedStatus:  http.StatusOK,
+		ConfirmRecovery: 3,
+	}
+	u, _ := url.Parse(server.URL)
+	healthURL := buildHealthURL(u, hc)
+
+	probe := func(code int) bool {
+		atomic.StoreInt32(&status, int32(code))
+		fp.performHealthCheck(healthURL, server.URL, hc)
+		fp.mu.RLock()
+		defer fp.mu.RUnlock()
+		return fp.healthStatus[server.URL]
+	}
+
+	if probe(http.StatusServiceUnavailable) {
+		t.Fatal("Expected upstream to be unhealthy")
+	}
+
+	// One success followed by a failure never restores the upstream
+	if probe(http.StatusOK) {
+		t.Error("Expected a single success not to mark the upstream healthy")
+	}
+	if probe(http.StatusServiceUnavailable) {
+		t.Error("Expected upstream to stay unhealthy after the confirmation failed")
+	}
+
+	// The first success plus three confirmations are needed
+	for i := 0; i < 3; i++ {
+		if probe(http.StatusOK) {
+			t.Fatalf("Expected upstream to stay unhealthy after %d passes", i+1)
+		}
+	}
+	if !probe(http.StatusOK) {
+		t.Error("Expected upstream to be healthy after all confirmations passed")
+	}
+
+	// Once healthy, later passes need no confirmation and failures apply at once
+	if probe(http.StatusServiceUnavailable) {
+		t.Error("Expected a failure to mark the upstream unhealthy immediately")
+	}
+}
+
+// TestConfirmRecoveryProbeDelay tests that confirmation probes back off towards the interval
+func TestConfirmRecoveryProbeDelay(t *testing.T) {
+	hc := &HealthCheck{Interval: caddy.Duration(8 * time.Second), ConfirmRecovery: 3}
+	if got := hc.nextProbeDelay(); got != 8*time.Second {
+		t.Errorf("Expected the normal interval outside confirmation, got %v", got)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for i, want := range expected {
+		hc.confirmations = i + 1
+		if got := hc.nextProbeDelay(); got != want {
+			t.Errorf("Confirmation %d: expected delay %v, got %v", i+1, want, got)
+		}
+	}
+
+	hc = &HealthCheck{Interval: caddy.Duration(20 * time.Millisecond), ConfirmRecovery: 5, confirmations: 1}
+	if got := hc.nextProbeDelay(); got != minConfirmDelay {
+		t.Errorf("Expected delay floored at %v, got %v", minConfirmDelay, got)
+	}
+}
+
+// TestInitialProbes tests that an upstream isn't selected until it passes its initial probes
+func TestInitialProbes(t *testing.T) {
+	var status int32 = http.StatusOK
+	var warmingHits int32
+	warming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			return
+		}
+		atomic.AddInt32(&warmingHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer warming.Close()
+
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fallback.Close()
+
+	fp := CreateTestProxy(t, []string{warming.URL, fallback.URL})
+
+	// Added after provisioning so probes run only when the test drives them
+	hc := &HealthCheck{
+		Path:           "/health",
+		Timeout:        caddy.Duration(time.Second),
+		ExpectedStatus: http.StatusOK,
+		InitialProbes:  3,
+	}
+	fp.HealthChecks[warming.URL] = hc
+	u, _ := url.Parse(warming.URL)
+	healthURL := buildHealthURL(u, hc)
+
+	probe := func(code int) {
+		atomic.StoreInt32(&status, int32(code))
+		fp.performHealthCheck(healthURL, warming.URL, hc)
+	}
+	serve := func() {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	}
+
+	// Two passes and a failure restart the count
+	probe(http.StatusOK)
+	probe(http.StatusOK)
+	probe(http.StatusServiceUnavailable)
+	probe(http.StatusOK)
+	probe(http.StatusOK)
+	serve()
+	if atomic.LoadInt32(&warmingHits) != 0 {
+		t.Fatal("Expected warming upstream not to be selected before its initial probes pass")
+	}
+
+	probe(http.StatusOK)
+	serve()
+	if atomic.LoadInt32(&warmingHits) != 1 {
+		t.Errorf("Expected upstream to be selected after 3 consecutive passes, got %d hits", atomic.LoadInt32(&warmingHits))
+	}
+
+	// Later failures and recoveries follow the steady-state rules
+	probe(http.StatusServiceUnavailable)
+	probe(http.StatusOK)
+	if !fp.isHealthy(warming.URL) {
+		t.Error("Expected a single pass to restore an upstream that was already included")
+	}
+}
@@ -0,0 +1,32 @@
+package failover
+
+import (
+	"net/url"
+)
+
+// How the results of a health check with several paths combine
+const (
+	healthRequireAll = "all" // healthy only when every path passes
+	healthRequireAny = "any" // healthy when at least one path passes
+)
+
+// probePaths returns every path the check probes: Path, then Paths
+func (hc *HealthCheck) probePaths() []string {
+	return append([]string{hc.Path}, hc.Paths...)
+}
+
+// buildHealthURLs builds the probe URL of each of the check's paths
+func buildHealthURLs(u *url.URL, hc *HealthCheck) []string {
+	paths := hc.probePaths()
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = buildHealthPathURL(u, hc, path)
+	}
+	return urls
+}
+
+// decided reports whether a probe result settles the check so the remaining
+// paths needn't be probed: a failure under "all", a pass under "any"
+func (hc *HealthCheck) decided(healthy bool) bool {
+	return healthy == (hc.Require == healthRequireAny)
+}
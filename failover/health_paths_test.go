@@ -0,0 +1,84 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// probeLiveReady runs one health check of /live and /ready against a server
+// whose /live passes and /ready fails
+func probeLiveReady(t *testing.T, require string) bool {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	fp := CreateTestProxy(t, []string{server.URL})
+	hc := &HealthCheck{
+		Path:           "/live",
+		Paths:          []string{"/ready"},
+		Require:        require,
+		ExpectedStatus: http.StatusOK,
+		Timeout:        caddy.Duration(time.Second),
+	}
+	u, _ := url.Parse(server.URL)
+	fp.performHealthChecks(buildHealthURLs(u, hc), server.URL, hc)
+
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+	return fp.healthStatus[server.URL]
+}
+
+// TestHealthCheckRequireAll tests that one failing path marks the upstream unhealthy
+func TestHealthCheckRequireAll(t *testing.T) {
+	if probeLiveReady(t, healthRequireAll) {
+		t.Error("Expected a failing /ready to mark the upstream unhealthy under require all")
+	}
+}
+
+// TestHealthCheckRequireAny tests that one passing path marks the upstream healthy
+func TestHealthCheckRequireAny(t *testing.T) {
+	if !probeLiveReady(t, healthRequireAny) {
+		t.Error("Expected a passing /live to mark the upstream healthy under require any")
+	}
+}
+
+// TestParseHealthCheckPaths tests parsing repeated path lines and require
+func TestParseHealthCheckPaths(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			path /live
+			path /ready
+			require any
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	hc := handler.(*FailoverProxy).HealthChecks["http://a"]
+	if hc.Path != "/live" || len(hc.Paths) != 1 || hc.Paths[0] != "/ready" || hc.Require != healthRequireAny {
+		t.Errorf("Expected /live and /ready under require any, got %q %v %q", hc.Path, hc.Paths, hc.Require)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			require most
+		}
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for require most")
+	}
+}
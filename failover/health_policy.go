@@ -0,0 +1,42 @@
+package failover
+
+// Health precedence modes decide how active health checks (health_check and
+// ping_check) and passive failure tracking (fail_duration) combine:
+//
+//	active result | recent failure | active | passive | combined
+//	--------------|----------------|--------|---------|---------
+//	UP            | no             | try    | try     | try
+//	UP            | yes            | try    | skip    | skip
+//	DOWN          | no             | skip   | try     | skip
+//	DOWN          | yes            | skip   | skip    | skip
+//	not checked   | no             | try    | try     | try
+//	not checked   | yes            | skip   | skip    | skip
+//
+// Upstreams without active checks always fall back to passive tracking.
+const (
+	healthPrecedenceActive   = "active"
+	healthPrecedencePassive  = "passive"
+	healthPrecedenceCombined = "combined"
+)
+
+// hasActiveChecks reports whether an upstream is actively probed
+func (f *FailoverProxy) hasActiveChecks(upstreamURL string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, httpCheck := f.HealthChecks[upstreamURL]
+	_, pingCheck := f.PingChecks[upstreamURL]
+	return httpCheck || pingCheck
+}
+
+// activeHealthApplies reports whether active health results gate the upstream
+func (f *FailoverProxy) activeHealthApplies() bool {
+	return f.HealthPrecedence != healthPrecedencePassive
+}
+
+// passiveHealthApplies reports whether recent request failures gate the upstream
+func (f *FailoverProxy) passiveHealthApplies(upstreamURL string) bool {
+	if f.HealthPrecedence != healthPrecedenceActive {
+		return true
+	}
+	return !f.hasActiveChecks(upstreamURL)
+}
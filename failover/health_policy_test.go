@@ -0,0 +1,112 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestHealthPrecedence tests each precedence mode against conflicting active and passive signals
+func TestHealthPrecedence(t *testing.T) {
+	tests := []struct {
+		precedence    string
+		activeHealthy bool
+		recentFailure bool
+		wantPrimary   bool
+	}{
+		{healthPrecedenceActive, true, true, true},
+		{healthPrecedenceActive, false, false, false},
+		{healthPrecedencePassive, true, true, false},
+		{healthPrecedencePassive, false, false, true},
+		{healthPrecedenceCombined, true, true, false},
+		{healthPrecedenceCombined, false, false, false},
+		{healthPrecedenceCombined, true, false, true},
+	}
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+
+	for _, tt := range tests {
+		name := tt.precedence
+		if tt.activeHealthy {
+			name += "/active-up"
+		} else {
+			name += "/active-down"
+		}
+		if tt.recentFailure {
+			name += "/recent-failure"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+				fp.HealthPrecedence = tt.precedence
+			})
+
+			// Seed the signals directly rather than running a health checker
+			fp.mu.Lock()
+			fp.HealthChecks[primary.URL] = &HealthCheck{}
+			fp.healthStatus[primary.URL] = tt.activeHealthy
+			if tt.recentFailure {
+				fp.failureCache[primary.URL] = time.Now()
+			}
+			fp.mu.Unlock()
+
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+				t.Fatalf("ServeHTTP error: %v", err)
+			}
+
+			want := "secondary"
+			if tt.wantPrimary {
+				want = "primary"
+			}
+			if w.Body.String() != want {
+				t.Errorf("Expected %s to serve the request, got %q", want, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestHealthPrecedenceActiveWithoutChecks tests that active mode falls back to passive tracking
+func TestHealthPrecedenceActiveWithoutChecks(t *testing.T) {
+	fp := &FailoverProxy{HealthPrecedence: healthPrecedenceActive}
+	if !fp.passiveHealthApplies("http://unchecked") {
+		t.Error("Expected passive tracking for an upstream without active checks")
+	}
+	fp.PingChecks = map[string]*PingCheck{"http://pinged": {}}
+	if fp.passiveHealthApplies("http://pinged") {
+		t.Error("Expected ping checks to count as active checks")
+	}
+}
+
+// TestParseHealthPrecedence tests parsing of the health_precedence subdirective
+func TestParseHealthPrecedence(t *testing.T) {
+	for _, mode := range []string{"active", "passive", "combined"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n health_precedence " + mode + "\n}")}
+		handler, err := parseFailoverProxy(h)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", mode, err)
+		}
+		if got := handler.(*FailoverProxy).HealthPrecedence; got != mode {
+			t.Errorf("Expected %s, got %s", mode, got)
+		}
+	}
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+		"failover_proxy http://a {\n health_precedence sometimes\n}")}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected error for invalid precedence")
+	}
+}
@@ -0,0 +1,47 @@
+package failover
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseStatusRange parses an inclusive NNN-MMM status code range
+func parseStatusRange(spec string) (low, high int, err error) {
+	lowSpec, highSpec, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid status code range: %s (expected <low>-<high>)", spec)
+	}
+	if low, err = parseStatusCode(lowSpec); err != nil {
+		return 0, 0, err
+	}
+	if high, err = parseStatusCode(highSpec); err != nil {
+		return 0, 0, err
+	}
+	if high < low {
+		return 0, 0, fmt.Errorf("invalid status code range: %s", spec)
+	}
+	return low, high, nil
+}
+
+// hasStatusRange reports whether the check accepts a range of status codes
+// rather than only ExpectedStatus
+func (hc *HealthCheck) hasStatusRange() bool {
+	return hc.ExpectedStatusMin != 0 || hc.ExpectedStatusMax != 0
+}
+
+// statusMatches reports whether a probe response status counts as healthy.
+// The expected range takes precedence over ExpectedStatus when set.
+func (hc *HealthCheck) statusMatches(status int) bool {
+	if hc.hasStatusRange() {
+		return status >= hc.ExpectedStatusMin && status <= hc.ExpectedStatusMax
+	}
+	return status == hc.ExpectedStatus
+}
+
+// expectedStatusString describes the accepted status codes for logs
+func (hc *HealthCheck) expectedStatusString() string {
+	if hc.hasStatusRange() {
+		return fmt.Sprintf("%d-%d", hc.ExpectedStatusMin, hc.ExpectedStatusMax)
+	}
+	return fmt.Sprint(hc.ExpectedStatus)
+}
@@ -0,0 +1,74 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// probeNoContent runs one health check against a server answering 204
+func probeNoContent(t *testing.T, hc *HealthCheck) bool {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	fp := CreateTestProxy(t, []string{server.URL})
+	hc.Path = "/health"
+	hc.Timeout = caddy.Duration(time.Second)
+	u, _ := url.Parse(server.URL)
+	fp.performHealthCheck(buildHealthURL(u, hc), server.URL, hc)
+
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+	return fp.healthStatus[server.URL]
+}
+
+// TestHealthCheckExpectedStatusRange tests that a 204 passes under a 2xx range
+func TestHealthCheckExpectedStatusRange(t *testing.T) {
+	if probeNoContent(t, &HealthCheck{ExpectedStatus: http.StatusOK}) {
+		t.Error("Expected a 204 to fail a strict expected_status 200")
+	}
+	if !probeNoContent(t, &HealthCheck{ExpectedStatus: http.StatusOK, ExpectedStatusMin: 200, ExpectedStatusMax: 299}) {
+		t.Error("Expected a 204 to pass the 200-299 range, which takes precedence over expected_status")
+	}
+	if probeNoContent(t, &HealthCheck{ExpectedStatusMin: 200, ExpectedStatusMax: 200}) {
+		t.Error("Expected a 204 to fail a 200-200 range")
+	}
+}
+
+// TestParseExpectedStatusRange tests parsing the expected_status_range option
+func TestParseExpectedStatusRange(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			expected_status 200
+			expected_status_range 200-299
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	hc := handler.(*FailoverProxy).HealthChecks["http://a"]
+	if hc.ExpectedStatus != 200 || hc.ExpectedStatusMin != 200 || hc.ExpectedStatusMax != 299 {
+		t.Errorf("Unexpected health check: %+v", hc)
+	}
+
+	for _, spec := range []string{"200", "299-200", "200-abc", "0-299", "200-600"} {
+		h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+			health_check http://a {
+				expected_status_range ` + spec + `
+			}
+		}`)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for expected_status_range %s", spec)
+		}
+	}
+}
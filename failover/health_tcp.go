@@ -0,0 +1,72 @@
+package failover
+
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Health check types
+const (
+	healthCheckHTTP = "http" // GET the health path and check the response
+	healthCheckTCP  = "tcp"  // connect to the upstream's port
+)
+
+// upstreamHostPort returns the upstream's host:port, defaulting the port from the scheme
+func upstreamHostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// performTCPHealthCheck marks the upstream healthy if a TCP connection to its
+// host and port succeeds within the check timeout
+func (f *FailoverProxy) performTCPHealthCheck(upstreamURL string, hc *HealthCheck) {
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		f.reportHealth(upstreamURL, hc, false)
+		return
+	}
+	addr := upstreamHostPort(u)
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, time.Duration(hc.Timeout))
+	elapsed := time.Since(start)
+	if err == nil {
+		conn.Close()
+	}
+
+	// As with HTTP probes, results gathered after shutdown began are dropped
+	if f.shuttingDown() || hc.stopped() {
+		return
+	}
+
+	f.mu.Lock()
+	f.lastCheckTime[upstreamURL] = time.Now()
+	if err == nil {
+		f.responseTime[upstreamURL] = elapsed.Milliseconds()
+	}
+	f.mu.Unlock()
+
+	healthy := err == nil
+	f.reportHealth(upstreamURL, hc, healthy)
+	f.reportProbe(upstreamURL, healthy, 0, elapsed)
+
+	if healthy {
+		f.logger.Debug("tcp health check passed",
+			zap.String("upstream", upstreamURL),
+			zap.String("addr", addr))
+	} else {
+		f.logger.Warn("tcp health check failed",
+			zap.String("upstream", upstreamURL),
+			zap.String("addr", addr),
+			zap.Error(err))
+	}
+}
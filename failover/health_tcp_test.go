@@ -0,0 +1,113 @@
+package failover
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestTCPHealthCheck tests that a TCP check follows whether the upstream port accepts connections
+func TestTCPHealthCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	accept := func(l net.Listener) {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}
+	go accept(listener)
+
+	upstream := "http://" + addr
+	hc := &HealthCheck{
+		Type:    healthCheckTCP,
+		Timeout: caddy.Duration(time.Second),
+	}
+	fp := CreateTestProxy(t, []string{upstream})
+	fp.mu.Lock()
+	fp.HealthChecks[upstream] = hc
+	fp.mu.Unlock()
+
+	fp.performHealthCheck("", upstream, hc)
+	if !fp.isHealthy(upstream) {
+		t.Fatal("Expected upstream to be healthy while its port accepts connections")
+	}
+
+	// Refuse connections by closing the listener
+	listener.Close()
+	fp.performHealthCheck("", upstream, hc)
+	if fp.isHealthy(upstream) {
+		t.Fatal("Expected upstream to be unhealthy once its port refuses connections")
+	}
+
+	// Accept again on the same port
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("Could not re-listen on %s: %v", addr, err)
+	}
+	defer listener.Close()
+	go accept(listener)
+
+	fp.performHealthCheck("", upstream, hc)
+	if !fp.isHealthy(upstream) {
+		t.Error("Expected upstream to recover once its port accepts connections again")
+	}
+}
+
+// TestUpstreamHostPort tests the default ports used for TCP checks
+func TestUpstreamHostPort(t *testing.T) {
+	tests := map[string]string{
+		"http://example.com":       "example.com:80",
+		"https://example.com":      "example.com:443",
+		"http://example.com:8080":  "example.com:8080",
+		"https://[::1]/api":        "[::1]:443",
+		"http://10.0.0.1:9000/x/y": "10.0.0.1:9000",
+	}
+	for raw, expected := range tests {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", raw, err)
+		}
+		if got := upstreamHostPort(u); got != expected {
+			t.Errorf("upstreamHostPort(%s) = %s, expected %s", raw, got, expected)
+		}
+	}
+}
+
+// TestParseHealthCheckType tests parsing the health check type
+func TestParseHealthCheckType(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a:5432 {
+		health_check http://a:5432 {
+			type tcp
+			interval 5s
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).HealthChecks["http://a:5432"].Type; got != healthCheckTCP {
+		t.Errorf("Expected type tcp, got %q", got)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			type udp
+		}
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for an unknown health check type")
+	}
+}
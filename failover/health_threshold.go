@@ -0,0 +1,49 @@
+package failover
+
+import "go.uber.org/zap"
+
+// probeStreak counts an upstream's consecutive probe results
+type probeStreak struct {
+	passes int // consecutive passing probes
+	fails  int // consecutive failing probes
+}
+
+// record adds a probe result, ending the streak of the opposite result
+func (s *probeStreak) record(healthy bool) {
+	if healthy {
+		s.passes++
+		s.fails = 0
+	} else {
+		s.fails++
+		s.passes = 0
+	}
+}
+
+// thresholdMet records a probe result and reports whether it may be applied.
+// A result matching the current status always may; a change of status needs
+// HealthyThreshold or UnhealthyThreshold results in a row, so a single probe
+// against a flaky backend doesn't flip it.
+func (f *FailoverProxy) thresholdMet(upstreamURL string, hc *HealthCheck, healthy bool) bool {
+	hc.streak.record(healthy)
+
+	f.mu.RLock()
+	wasHealthy, known := f.healthStatus[upstreamURL]
+	f.mu.RUnlock()
+	if !known || wasHealthy == healthy {
+		return true
+	}
+
+	need, have := hc.UnhealthyThreshold, hc.streak.fails
+	if healthy {
+		need, have = hc.HealthyThreshold, hc.streak.passes
+	}
+	if have >= need {
+		return true
+	}
+
+	f.logger.Debug("health check result below threshold, status unchanged",
+		zap.String("upstream", upstreamURL),
+		zap.Bool("healthy", healthy),
+		zap.Int("remaining", need-have))
+	return false
+}
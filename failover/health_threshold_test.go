@@ -0,0 +1,114 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newThresholdProbe returns a function probing an upstream with the given
+// response code and reporting its health status afterwards
+func newThresholdProbe(t *testing.T, hc *HealthCheck) func(code int) bool {
+	var status int32 = http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	t.Cleanup(server.Close)
+
+	fp := CreateTestProxy(t, []string{server.URL})
+	u, _ := url.Parse(server.URL)
+	healthURL := buildHealthURL(u, hc)
+
+	return func(code int) bool {
+		atomic.StoreInt32(&status, int32(code))
+		fp.performHealthCheck(healthURL, server.URL, hc)
+		fp.mu.RLock()
+		defer fp.mu.RUnlock()
+		return fp.healthStatus[server.URL]
+	}
+}
+
+// TestHealthyThreshold tests that a single passing probe among failures
+// doesn't mark an unhealthy upstream healthy
+func TestHealthyThreshold(t *testing.T) {
+	probe := newThresholdProbe(t, &HealthCheck{
+		Path:             "/health",
+		Timeout:          caddy.Duration(time.Second),
+		ExpectedStatus:   http.StatusOK,
+		HealthyThreshold: 3,
+	})
+
+	if probe(http.StatusServiceUnavailable) {
+		t.Fatal("Expected the first failing probe to mark the upstream unhealthy")
+	}
+	for _, code := range []int{200, 503, 200, 200, 503} {
+		if probe(code) {
+			t.Fatalf("Expected upstream to stay unhealthy without 3 passes in a row (probe %d)", code)
+		}
+	}
+	if probe(http.StatusOK) || probe(http.StatusOK) {
+		t.Fatal("Expected upstream to stay unhealthy before the third pass")
+	}
+	if !probe(http.StatusOK) {
+		t.Error("Expected upstream to be healthy after 3 passes in a row")
+	}
+}
+
+// TestUnhealthyThreshold tests that a single failing probe among passes
+// doesn't mark a healthy upstream unhealthy
+func TestUnhealthyThreshold(t *testing.T) {
+	probe := newThresholdProbe(t, &HealthCheck{
+		Path:               "/health",
+		Timeout:            caddy.Duration(time.Second),
+		ExpectedStatus:     http.StatusOK,
+		UnhealthyThreshold: 2,
+	})
+
+	if !probe(http.StatusOK) {
+		t.Fatal("Expected the first passing probe to mark the upstream healthy")
+	}
+	for _, code := range []int{503, 200, 503, 200} {
+		if !probe(code) {
+			t.Fatalf("Expected upstream to stay healthy without 2 failures in a row (probe %d)", code)
+		}
+	}
+	if !probe(http.StatusServiceUnavailable) {
+		t.Fatal("Expected upstream to stay healthy after one failure")
+	}
+	if probe(http.StatusServiceUnavailable) {
+		t.Error("Expected upstream to be unhealthy after 2 failures in a row")
+	}
+}
+
+// TestParseHealthThresholds tests parsing the threshold health check options
+func TestParseHealthThresholds(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		health_check http://a {
+			healthy_threshold 3
+			unhealthy_threshold 2
+		}
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	hc := handler.(*FailoverProxy).HealthChecks["http://a"]
+	if hc == nil || hc.HealthyThreshold != 3 || hc.UnhealthyThreshold != 2 {
+		t.Errorf("Unexpected health check: %+v", hc)
+	}
+
+	for _, bad := range []string{"healthy_threshold 0", "unhealthy_threshold x"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n health_check http://a {\n " + bad + "\n }\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestPreserveHost tests the Host header upstreams receive by default, with
+// preserve_host and with a per-upstream host_header
+func TestPreserveHost(t *testing.T) {
+	var seenHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenHost = r.Host
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+
+	tests := []struct {
+		name     string
+		opt      ProxyOption
+		expected string
+	}{
+		{"default", func(f *FailoverProxy) {}, upstreamHost},
+		{"preserve_host", func(f *FailoverProxy) { f.PreserveHost = true }, "app.example.com"},
+		{"host_header", func(f *FailoverProxy) {
+			f.PreserveHost = true
+			f.HostHeaders = map[string]string{upstream.URL: "backend.internal"}
+		}, "backend.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenHost = ""
+			fp := CreateTestProxy(t, []string{upstream.URL}, tt.opt)
+
+			req := httptest.NewRequest("GET", "http://app.example.com/", nil)
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, req, nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if seenHost != tt.expected {
+				t.Errorf("Expected upstream to see Host %q, got %q", tt.expected, seenHost)
+			}
+		})
+	}
+}
+
+// TestParsePreserveHost tests parsing preserve_host and host_header
+func TestParsePreserveHost(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		preserve_host
+		host_header http://b b.internal
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	if !fp.PreserveHost || fp.HostHeaders["http://b"] != "b.internal" {
+		t.Errorf("Unexpected config: preserve_host=%v host_headers=%v", fp.PreserveHost, fp.HostHeaders)
+	}
+
+	for _, input := range []string{"preserve_host extra", "host_header http://b", "host_header http://b b.internal extra"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+			` + input + `
+		}`)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package failover
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// alpnProtocols maps the upstream_http_versions values to the ALPN protocols
+// offered for them
+var alpnProtocols = map[string]string{
+	"1.1": "http/1.1",
+	"2":   "h2",
+}
+
+// validateHTTPVersions checks UpstreamHTTPVersions holds only known versions
+func (f *FailoverProxy) validateHTTPVersions() error {
+	seen := make(map[string]bool, len(f.UpstreamHTTPVersions))
+	for _, version := range f.UpstreamHTTPVersions {
+		if _, ok := alpnProtocols[version]; !ok || seen[version] {
+			return fmt.Errorf("invalid upstream_http_versions: %s (expected 1.1 and/or 2)", version)
+		}
+		seen[version] = true
+	}
+	return nil
+}
+
+// applyHTTPVersions limits the protocols the HTTPS transport negotiates to
+// UpstreamHTTPVersions. Without the option Go's defaults apply.
+func (f *FailoverProxy) applyHTTPVersions(transport *http.Transport) {
+	if len(f.UpstreamHTTPVersions) == 0 {
+		return
+	}
+
+	// The config is shared with probe clients, which pick their own versions
+	transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+	transport.TLSClientConfig.NextProtos = nil
+	h2 := false
+	for _, version := range f.UpstreamHTTPVersions {
+		transport.TLSClientConfig.NextProtos = append(transport.TLSClientConfig.NextProtos, alpnProtocols[version])
+		h2 = h2 || version == "2"
+	}
+
+	if h2 {
+		transport.ForceAttemptHTTP2 = true
+	} else {
+		// A non-nil empty map disables HTTP/2 negotiation
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+}
@@ -0,0 +1,108 @@
+package failover
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newH2Server starts an HTTP/2-capable TLS server that answers with the
+// protocol of each request and records the ALPN protocols clients offer
+func newH2Server(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var offered []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			offered = hello.SupportedProtos
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return offered
+	}
+}
+
+// TestUpstreamHTTPVersions tests that the offered ALPN protocols and the
+// negotiated protocol follow upstream_http_versions
+func TestUpstreamHTTPVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		offered  []string
+		proto    string
+	}{
+		{"default", nil, nil, "HTTP/1.1"},
+		{"1.1 only", []string{"1.1"}, []string{"http/1.1"}, "HTTP/1.1"},
+		{"both", []string{"2", "1.1"}, []string{"h2", "http/1.1"}, "HTTP/2.0"},
+		{"2 only", []string{"2"}, nil, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, offered := newH2Server(t)
+			fp := CreateTestProxy(t, []string{server.URL}, func(fp *FailoverProxy) {
+				fp.InsecureSkipVerify = true
+				fp.UpstreamHTTPVersions = tt.versions
+			})
+
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", w.Code)
+			}
+			if got := w.Body.String(); got != tt.proto {
+				t.Errorf("Expected %s, got %s", tt.proto, got)
+			}
+			if tt.offered != nil && !reflect.DeepEqual(offered(), tt.offered) {
+				t.Errorf("Expected ALPN %v, got %v", tt.offered, offered())
+			}
+		})
+	}
+}
+
+// TestParseUpstreamHTTPVersions tests parsing the upstream_http_versions option
+func TestParseUpstreamHTTPVersions(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy https://a.local {
+		upstream_http_versions 1.1 2
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).UpstreamHTTPVersions; !reflect.DeepEqual(got, []string{"1.1", "2"}) {
+		t.Errorf("Expected [1.1 2], got %v", got)
+	}
+
+	for _, input := range []string{
+		`failover_proxy https://a.local {
+			upstream_http_versions
+		}`,
+		`failover_proxy https://a.local {
+			upstream_http_versions 3
+		}`,
+	} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(input)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
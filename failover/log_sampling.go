@@ -0,0 +1,14 @@
+package failover
+
+import "sync/atomic"
+
+// sampled reports whether a routine event should be logged. With log_sampling
+// N, the first event and every Nth after it are logged; counter tracks the
+// events of one kind so each kind's first occurrence is always seen.
+func (f *FailoverProxy) sampled(counter *atomic.Uint64) bool {
+	n := counter.Add(1)
+	if f.LogSampling <= 1 {
+		return true
+	}
+	return (n-1)%uint64(f.LogSampling) == 0
+}
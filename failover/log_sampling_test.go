@@ -0,0 +1,99 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestLogSampling tests that only 1 in N success and failover logs are emitted, while errors always are
+func TestLogSampling(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	// Once the primary has failed it is skipped, so every request fails over
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.LogSampling = 10
+	})
+	core, logs := observer.New(zapcore.DebugLevel)
+	fp.logger = zap.New(core)
+
+	const requests = 100
+	for i := 0; i < requests; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	if got := logs.FilterMessage("successfully proxied request").Len(); got != requests/10 {
+		t.Errorf("Expected %d success logs, got %d", requests/10, got)
+	}
+	if got := logs.FilterMessage("failing over to alternate upstream").Len(); got != requests/10 {
+		t.Errorf("Expected %d failover logs, got %d", requests/10, got)
+	}
+
+	// Errors are never sampled
+	primary.Close()
+	backup.Close()
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		fp.ServeHTTP(httptest.NewRecorder(), req, nil)
+	}
+	if got := logs.FilterLevelExact(zapcore.ErrorLevel).FilterMessage("all upstreams failed").Len(); got != 3 {
+		t.Errorf("Expected every error to be logged, got %d of 3", got)
+	}
+}
+
+// TestLogSamplingFirstOccurrence tests that the first event of each kind is logged
+func TestLogSamplingFirstOccurrence(t *testing.T) {
+	fp := &FailoverProxy{LogSampling: 1000}
+	if !fp.sampled(&fp.successLogs) {
+		t.Error("Expected the first success to be logged")
+	}
+	if !fp.sampled(&fp.failoverLogs) {
+		t.Error("Expected the first failover to be logged")
+	}
+	if fp.sampled(&fp.successLogs) {
+		t.Error("Expected the second success to be sampled out")
+	}
+}
+
+// TestParseLogSampling tests parsing the log_sampling subdirective
+func TestParseLogSampling(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		log_sampling 100
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).LogSampling; got != 100 {
+		t.Errorf("Expected log_sampling 100, got %d", got)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		log_sampling 0
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for log_sampling 0")
+	}
+}
@@ -0,0 +1,111 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestSelfReferentialUpstreamReturns508 tests that an upstream pointing back at the proxy isn't followed
+func TestSelfReferentialUpstreamReturns508(t *testing.T) {
+	var hits int32
+	var fp *FailoverProxy
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fp.ServeHTTP(w, r, nil)
+	}))
+	defer server.Close()
+
+	fp = CreateTestProxy(t, []string{server.URL})
+
+	resp, err := http.Get(server.URL + "/loop")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusLoopDetected {
+		t.Errorf("Expected status 508, got %d", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("Expected the request to stop at the first hop, got %d hits", got)
+	}
+}
+
+// TestHopLimitBreaksIndirectLoop tests that a loop between two proxies is broken by the hop count
+func TestHopLimitBreaksIndirectLoop(t *testing.T) {
+	var hits int32
+	var proxyA, proxyB *FailoverProxy
+
+	serverA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		proxyA.ServeHTTP(w, r, nil)
+	}))
+	defer serverA.Close()
+
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		proxyB.ServeHTTP(w, r, nil)
+	}))
+	defer serverB.Close()
+
+	// Each proxy forwards to the other, so neither sees its own address
+	limitHops := func(fp *FailoverProxy) { fp.MaxHops = 3 }
+	proxyA = CreateTestProxy(t, []string{serverB.URL}, limitHops)
+	proxyB = CreateTestProxy(t, []string{serverA.URL}, limitHops)
+
+	resp, err := http.Get(serverA.URL + "/loop")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusLoopDetected {
+		t.Errorf("Expected status 508, got %d", resp.StatusCode)
+	}
+	// The original request plus three forwarded hops
+	if got := atomic.LoadInt32(&hits); got != 4 {
+		t.Errorf("Expected 4 hits before the loop was broken, got %d", got)
+	}
+}
+
+// TestHopHeaderIncremented tests that forwarded requests carry an incremented hop count
+func TestHopHeaderIncremented(t *testing.T) {
+	var receivedHops string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHops = r.Header.Get(hopsHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL})
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set(hopsHeader, "2")
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if receivedHops != "3" {
+		t.Errorf("Expected hop count 3, got %q", receivedHops)
+	}
+
+	// At the limit the request is rejected without contacting the upstream
+	req = httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set(hopsHeader, "10")
+	w = httptest.NewRecorder()
+	receivedHops = ""
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusLoopDetected {
+		t.Errorf("Expected status 508 at max_hops, got %d", w.Code)
+	}
+	if receivedHops != "" {
+		t.Error("Expected upstream not to be contacted at max_hops")
+	}
+}
@@ -0,0 +1,48 @@
+package failover
+
+import "sync/atomic"
+
+// acquireUpstream reserves one of the upstream's max_concurrent slots. It
+// reports false, without reserving, when the upstream is already at its limit;
+// otherwise the slot must be given back with releaseUpstream.
+func (f *FailoverProxy) acquireUpstream(upstreamURL string) bool {
+	if f.MaxConcurrent <= 0 {
+		return true
+	}
+	active := f.activeCounter(upstreamURL)
+	for {
+		n := active.Load()
+		if n >= int64(f.MaxConcurrent) {
+			return false
+		}
+		if active.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseUpstream gives back a slot reserved by acquireUpstream
+func (f *FailoverProxy) releaseUpstream(upstreamURL string) {
+	if f.MaxConcurrent <= 0 {
+		return
+	}
+	f.activeCounter(upstreamURL).Add(-1)
+}
+
+// activeCounter returns the counter of requests active on the upstream, creating it on first use
+func (f *FailoverProxy) activeCounter(upstreamURL string) *atomic.Int64 {
+	f.mu.RLock()
+	active, ok := f.upstreamActive[upstreamURL]
+	f.mu.RUnlock()
+	if ok {
+		return active
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if active, ok = f.upstreamActive[upstreamURL]; !ok {
+		active = &atomic.Int64{}
+		f.upstreamActive[upstreamURL] = active
+	}
+	return active
+}
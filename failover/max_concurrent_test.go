@@ -0,0 +1,120 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestMaxConcurrent tests that requests beyond an upstream's max_concurrent
+// limit go to the next upstream, and that in-flight counts are reported
+func TestMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	var primaryHits, backupHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		<-release
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupHits.Add(1)
+		w.Write([]byte("backup"))
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.MaxConcurrent = 2
+	})
+
+	serve := func() string {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Errorf("ServeHTTP error: %v", err)
+		}
+		return w.Body.String()
+	}
+
+	// Fill the primary's slots with requests it holds open
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body := serve(); body != "primary" {
+				t.Errorf("Expected held request to be served by the primary, got %q", body)
+			}
+		}()
+	}
+	WaitForCondition(t, time.Second, 5*time.Millisecond, func() bool { return primaryHits.Load() == 2 }, "primary to hold two requests")
+
+	if got := upstreamInFlight(t, fp, primary.URL); got != 2 {
+		t.Errorf("Expected 2 requests in flight to the primary, got %d", got)
+	}
+
+	// Further requests spread to the backup without marking the primary down
+	for i := 0; i < 3; i++ {
+		if body := serve(); body != "backup" {
+			t.Errorf("Expected request over the limit to be served by the backup, got %q", body)
+		}
+	}
+	if got := UpstreamStatusOf(t, fp, primary.URL).Status; got != "UP" {
+		t.Errorf("Expected the primary to stay UP, got %s", got)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if primaryHits.Load() != 2 || backupHits.Load() != 3 {
+		t.Errorf("Expected 2 primary and 3 backup requests, got %d and %d", primaryHits.Load(), backupHits.Load())
+	}
+	if got := upstreamInFlight(t, fp, primary.URL); got != 0 {
+		t.Errorf("Expected no requests in flight after completion, got %d", got)
+	}
+	if body := serve(); body != "primary" {
+		t.Errorf("Expected the primary to take requests again once slots free up, got %q", body)
+	}
+}
+
+// upstreamInFlight returns the reported in-flight count of an upstream
+func upstreamInFlight(t *testing.T, fp *FailoverProxy, upstream string) int64 {
+	t.Helper()
+	for _, status := range fp.GetUpstreamStatus() {
+		if status.Host == upstream {
+			return status.InFlight
+		}
+	}
+	t.Fatalf("upstream %s not found in status", upstream)
+	return 0
+}
+
+// TestParseMaxConcurrent tests parsing max_concurrent
+func TestParseMaxConcurrent(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		max_concurrent 50
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).MaxConcurrent; got != 50 {
+		t.Errorf("Expected max_concurrent 50, got %d", got)
+	}
+
+	for _, value := range []string{"0", "-1", "many"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+			max_concurrent ` + value + `
+		}`)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected an error for max_concurrent %s", value)
+		}
+	}
+}
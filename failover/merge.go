@@ -0,0 +1,168 @@
+package failover
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// mergeSiblings combines this proxy with the other failover_proxy handlers
+// for the same path in its handle block. Only the first proxy in a route ever
+// serves, since it never passes requests on, so with merge the first takes
+// the later directives' upstreams and their settings, and the later ones
+// become pass-through placeholders. Without merge the configuration is kept
+// as written, with a warning.
+//
+// Handlers are provisioned in route order, so earlier siblings are already
+// loaded and later ones are still raw JSON in the enclosing subroute.
+func (f *FailoverProxy) mergeSiblings(ctx caddy.Context) error {
+	if f.HandlePath == "" {
+		return nil
+	}
+	modules := ctx.Modules()
+	if len(modules) < 2 {
+		return nil
+	}
+	subroute, ok := modules[len(modules)-2].(*caddyhttp.Subroute)
+	if !ok {
+		return nil
+	}
+	return f.mergeWithin(ctx, subroute)
+}
+
+// mergeWithin merges this proxy with its siblings in the subroute being provisioned
+func (f *FailoverProxy) mergeWithin(ctx caddy.Context, subroute *caddyhttp.Subroute) error {
+	// The route being provisioned is the first whose handlers aren't loaded yet
+	current := len(subroute.Routes)
+	for i, route := range subroute.Routes {
+		if len(route.Handlers) == 0 {
+			current = i
+			break
+		}
+	}
+
+	for _, route := range subroute.Routes[:current] {
+		for _, handler := range route.Handlers {
+			first, ok := handler.(*FailoverProxy)
+			if !ok || first.MergedInto != "" || first.HandlePath != f.HandlePath {
+				continue
+			}
+			if first.Merge || f.Merge {
+				f.MergedInto = f.HandlePath
+			}
+			return nil
+		}
+	}
+
+	for _, route := range subroute.Routes[current+1:] {
+		for _, raw := range route.HandlersRaw {
+			later, err := siblingProxy(raw)
+			if err != nil {
+				return err
+			}
+			if later == nil || later.MergedInto != "" || later.HandlePath != f.HandlePath {
+				continue
+			}
+			if !f.Merge && !later.Merge {
+				ctx.Logger(f).Warn("multiple failover_proxy directives for the same path, only the first serves requests; "+
+					"add 'merge' to combine their upstreams",
+					zap.String("path", f.HandlePath))
+				continue
+			}
+			if err := f.mergeFrom(later); err != nil {
+				return fmt.Errorf("cannot merge failover_proxy for %s: %v", f.HandlePath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// siblingProxy decodes a raw handler if it is a failover_proxy, or returns nil
+func siblingProxy(raw json.RawMessage) (*FailoverProxy, error) {
+	var module struct {
+		Handler string `json:"handler"`
+	}
+	if err := json.Unmarshal(raw, &module); err != nil {
+		return nil, err
+	}
+	if module.Handler != "failover_proxy" {
+		return nil, nil
+	}
+	var proxy FailoverProxy
+	if err := json.Unmarshal(raw, &proxy); err != nil {
+		return nil, fmt.Errorf("decoding failover_proxy: %v", err)
+	}
+	return &proxy, nil
+}
+
+// mergeFrom appends another proxy's upstreams and SRV records, with all of
+// their per-upstream settings, after this proxy's own. Upstreams already
+// present keep their existing configuration. Settings that apply to every
+// upstream, such as TLS, must match, since the merged upstreams are reached
+// through this proxy's transport.
+func (f *FailoverProxy) mergeFrom(other *FailoverProxy) error {
+	if other.InsecureSkipVerify != f.InsecureSkipVerify || other.TLSClientCert != f.TLSClientCert ||
+		other.TLSClientKey != f.TLSClientKey || other.TLSTrustedCA != f.TLSTrustedCA {
+		return fmt.Errorf("insecure_skip_verify, tls_client_cert, tls_client_key and tls_trusted_ca must match the first directive's")
+	}
+
+	existing := make(map[string]bool, len(f.Upstreams))
+	for _, upstream := range f.Upstreams {
+		existing[upstream] = true
+	}
+	for _, srv := range f.SRVUpstreams {
+		existing[srv.Name] = true
+	}
+
+	for _, upstream := range other.Upstreams {
+		if existing[upstream] {
+			continue
+		}
+		existing[upstream] = true
+		f.Upstreams = append(f.Upstreams, upstream)
+		f.mergeUpstreamSettings(other, upstream)
+	}
+
+	for _, srv := range other.SRVUpstreams {
+		if existing[srv.Name] {
+			continue
+		}
+		existing[srv.Name] = true
+		f.SRVUpstreams = append(f.SRVUpstreams, srv)
+		f.mergeUpstreamSettings(other, srv.Name)
+	}
+	return nil
+}
+
+// mergeUpstreamSettings copies every setting other has for upstream
+func (f *FailoverProxy) mergeUpstreamSettings(other *FailoverProxy, upstream string) {
+	mergeSetting(&f.HealthChecks, other.HealthChecks, upstream)
+	mergeSetting(&f.PingChecks, other.PingChecks, upstream)
+	mergeSetting(&f.UpstreamHeaders, other.UpstreamHeaders, upstream)
+	mergeSetting(&f.DownstreamHeaders, other.DownstreamHeaders, upstream)
+	mergeSetting(&f.MethodRewrites, other.MethodRewrites, upstream)
+	mergeSetting(&f.PathRewrites, other.PathRewrites, upstream)
+	mergeSetting(&f.AcceptOverrides, other.AcceptOverrides, upstream)
+	mergeSetting(&f.HostHeaders, other.HostHeaders, upstream)
+	mergeSetting(&f.UpstreamIdleTimeouts, other.UpstreamIdleTimeouts, upstream)
+	mergeSetting(&f.UpstreamALPN, other.UpstreamALPN, upstream)
+	mergeSetting(&f.UpstreamRenegotiation, other.UpstreamRenegotiation, upstream)
+	mergeSetting(&f.ExpectContentTypes, other.ExpectContentTypes, upstream)
+	mergeSetting(&f.MaxResponseTimes, other.MaxResponseTimes, upstream)
+	mergeSetting(&f.UpstreamWeights, other.UpstreamWeights, upstream)
+}
+
+// mergeSetting copies src's value for upstream into *dst, creating the map if needed
+func mergeSetting[V any](dst *map[string]V, src map[string]V, upstream string) {
+	value, ok := src[upstream]
+	if !ok {
+		return
+	}
+	if *dst == nil {
+		*dst = make(map[string]V)
+	}
+	(*dst)[upstream] = value
+}
@@ -0,0 +1,181 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// provisionSubroute provisions failover_proxy configs as consecutive routes
+// of one subroute, the way a handle block's directives are adapted: each
+// handler is provisioned in route order while later routes are still raw
+func provisionSubroute(t *testing.T, ctx caddy.Context, handlers ...string) *caddyhttp.Subroute {
+	t.Helper()
+	subroute := &caddyhttp.Subroute{}
+	for _, handler := range handlers {
+		subroute.Routes = append(subroute.Routes, caddyhttp.Route{HandlersRaw: []json.RawMessage{json.RawMessage(handler)}})
+	}
+	for i := range subroute.Routes {
+		route := &subroute.Routes[i]
+		fp := &FailoverProxy{}
+		if err := json.Unmarshal(route.HandlersRaw[0], fp); err != nil {
+			t.Fatalf("Failed to decode handler %d: %v", i, err)
+		}
+		if err := fp.mergeWithin(ctx, subroute); err != nil {
+			t.Fatalf("Failed to provision handler %d: %v", i, err)
+		}
+		route.Handlers = []caddyhttp.MiddlewareHandler{fp}
+		route.HandlersRaw = nil
+	}
+	return subroute
+}
+
+// proxiesOf returns the failover proxies of a provisioned subroute in route order
+func proxiesOf(subroute *caddyhttp.Subroute) []*FailoverProxy {
+	var proxies []*FailoverProxy
+	for _, route := range subroute.Routes {
+		for _, handler := range route.Handlers {
+			if fp, ok := handler.(*FailoverProxy); ok {
+				proxies = append(proxies, fp)
+			}
+		}
+	}
+	return proxies
+}
+
+// newMergeTestContext returns a context for provisioning subroutes
+func newMergeTestContext(t *testing.T) caddy.Context {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// TestMergeProxiesForSamePath tests that merge combines upstreams and health checks into the first proxy
+func TestMergeProxiesForSamePath(t *testing.T) {
+	subroute := provisionSubroute(t, newMergeTestContext(t),
+		`{"handler": "failover_proxy", "upstreams": ["http://a.local", "http://b.local"], "handle_path": "/api/*", "merge": true,
+			"health_checks": {"http://a.local": {"path": "/health", "interval": 3600000000000}}}`,
+		`{"handler": "failover_proxy", "upstreams": ["http://b.local", "http://c.local"], "handle_path": "/api/*",
+			"health_checks": {"http://c.local": {"path": "/ready", "interval": 3600000000000}}}`)
+
+	proxies := proxiesOf(subroute)
+	first, second := proxies[0], proxies[1]
+	expected := []string{"http://a.local", "http://b.local", "http://c.local"}
+	if len(first.Upstreams) != len(expected) {
+		t.Fatalf("Expected combined upstreams %v, got %v", expected, first.Upstreams)
+	}
+	for i, upstream := range expected {
+		if first.Upstreams[i] != upstream {
+			t.Errorf("Expected upstream %d to be %s, got %s", i, upstream, first.Upstreams[i])
+		}
+	}
+	if hc := first.HealthChecks["http://c.local"]; hc == nil || hc.Path != "/ready" {
+		t.Errorf("Expected merged health check for http://c.local, got %+v", hc)
+	}
+	if first.HealthChecks["http://a.local"].Path != "/health" {
+		t.Error("Expected the first proxy's health check to be kept")
+	}
+	if second.MergedInto != "/api/*" {
+		t.Errorf("Expected the merged directive to pass requests through, got %+v", second)
+	}
+}
+
+// TestDuplicateProxyWithoutMerge tests that duplicates are kept as written without merge
+func TestDuplicateProxyWithoutMerge(t *testing.T) {
+	subroute := provisionSubroute(t, newMergeTestContext(t),
+		`{"handler": "failover_proxy", "upstreams": ["http://a.local"], "handle_path": "/api/*"}`,
+		`{"handler": "failover_proxy", "upstreams": ["http://b.local"], "handle_path": "/api/*"}`,
+		`{"handler": "failover_proxy", "upstreams": ["http://c.local"], "handle_path": "/other/*", "merge": true}`)
+
+	proxies := proxiesOf(subroute)
+	if len(proxies[0].Upstreams) != 1 || proxies[1].MergedInto != "" || len(proxies[1].Upstreams) != 1 {
+		t.Errorf("Expected proxies to be left separate, got %v and %v", proxies[0].Upstreams, proxies[1].Upstreams)
+	}
+	if proxies[2].MergedInto != "" {
+		t.Error("Expected a proxy for a different path not to be merged")
+	}
+}
+
+// TestMergeScopedToHandleBlock tests that proxies for the same path in
+// different handle blocks, such as in two site blocks, are never merged
+func TestMergeScopedToHandleBlock(t *testing.T) {
+	ctx := newMergeTestContext(t)
+	first := provisionSubroute(t, ctx,
+		`{"handler": "failover_proxy", "upstreams": ["http://a.local"], "handle_path": "/api/*", "merge": true}`)
+	second := provisionSubroute(t, ctx,
+		`{"handler": "failover_proxy", "upstreams": ["http://b.local"], "handle_path": "/api/*", "merge": true}`)
+
+	if upstreams := proxiesOf(first)[0].Upstreams; len(upstreams) != 1 {
+		t.Errorf("Expected the first block's proxy to keep its own upstreams, got %v", upstreams)
+	}
+	if other := proxiesOf(second)[0]; other.MergedInto != "" || len(other.Upstreams) != 1 {
+		t.Errorf("Expected the second block's proxy to serve on its own, got %+v", other)
+	}
+}
+
+// TestMergeUpstreamSettings tests that per-upstream settings of merged upstreams are kept
+func TestMergeUpstreamSettings(t *testing.T) {
+	first := &FailoverProxy{Upstreams: []string{"http://a"}}
+	second := &FailoverProxy{
+		Upstreams:         []string{"http://b"},
+		UpstreamWeights:   map[string]int{"http://b": 3},
+		HostHeaders:       map[string]string{"http://b": "b.internal"},
+		MaxResponseTimes:  map[string]caddy.Duration{"http://b": caddy.Duration(2e9)},
+		DownstreamHeaders: map[string]map[string]string{"http://b": {"X-Backend": "b"}},
+		PingChecks:        map[string]*PingCheck{"http://b": {}},
+	}
+	if err := first.mergeFrom(second); err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+
+	if first.UpstreamWeights["http://b"] != 3 {
+		t.Errorf("Expected merged weight, got %v", first.UpstreamWeights)
+	}
+	if first.HostHeaders["http://b"] != "b.internal" {
+		t.Errorf("Expected merged host_header, got %v", first.HostHeaders)
+	}
+	if _, ok := first.MaxResponseTimes["http://b"]; !ok {
+		t.Errorf("Expected merged max_response_time, got %v", first.MaxResponseTimes)
+	}
+	if first.DownstreamHeaders["http://b"]["X-Backend"] != "b" {
+		t.Errorf("Expected merged header_down, got %v", first.DownstreamHeaders)
+	}
+	if first.PingChecks["http://b"] == nil {
+		t.Errorf("Expected merged ping_check, got %v", first.PingChecks)
+	}
+}
+
+// TestMergeRejectsDifferentTLS tests that merge refuses directives whose TLS settings differ
+func TestMergeRejectsDifferentTLS(t *testing.T) {
+	first := &FailoverProxy{Upstreams: []string{"https://a"}}
+	second := &FailoverProxy{Upstreams: []string{"https://b"}, InsecureSkipVerify: true}
+	if err := first.mergeFrom(second); err == nil {
+		t.Fatal("Expected merging a directive with different TLS settings to fail")
+	}
+}
+
+// TestMergedProxyPassesThrough tests that a merged placeholder hands requests to the next handler
+func TestMergedProxyPassesThrough(t *testing.T) {
+	fp := &FailoverProxy{MergedInto: "/api/*"}
+	if err := fp.Provision(caddy.Context{}); err != nil {
+		t.Fatalf("Provision error: %v", err)
+	}
+	defer fp.Cleanup()
+
+	called := false
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		called = true
+		return nil
+	})
+	if err := fp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/api/x", nil), next); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if !called {
+		t.Error("Expected the next handler to be called")
+	}
+}
@@ -0,0 +1,200 @@
+package failover
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// ParseFailoverMetrics parses the failover_metrics directive
+func ParseFailoverMetrics(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	return parseFailoverMetrics(h)
+}
+
+// defaultMetricsBuckets are the request duration bucket boundaries in seconds,
+// matching the Prometheus client defaults
+var defaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// requestDurationMetric is the name of the per path/upstream latency histogram
+const requestDurationMetric = "caddy_failover_request_duration_seconds"
+
+// histogramSeries holds the observations for one upstream
+type histogramSeries struct {
+	counts []uint64 // observations per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// latencyHistogram records upstream attempt durations into fixed buckets
+type latencyHistogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*histogramSeries // upstream URL -> observations
+}
+
+// newLatencyHistogram creates a histogram with the given upper bounds
+func newLatencyHistogram(buckets []float64) *latencyHistogram {
+	if len(buckets) == 0 {
+		buckets = defaultMetricsBuckets
+	}
+	return &latencyHistogram{
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// observe records one attempt against an upstream
+func (h *latencyHistogram) observe(upstream string, seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[upstream]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[upstream] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, seconds); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += seconds
+	s.count++
+}
+
+// writeTo writes the histogram series in Prometheus text exposition format
+func (h *latencyHistogram) writeTo(w io.Writer, path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	upstreams := make([]string, 0, len(h.series))
+	for upstream := range h.series {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Strings(upstreams)
+
+	for _, upstream := range upstreams {
+		s := h.series[upstream]
+		labels := fmt.Sprintf(`path="%s",upstream="%s"`, escapeLabel(path), escapeLabel(upstream))
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", requestDurationMetric, labels,
+				strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", requestDurationMetric, labels, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", requestDurationMetric, labels, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", requestDurationMetric, labels, s.count)
+	}
+}
+
+// labelEscaper escapes label values as required by the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// parseMetricsBuckets parses bucket boundaries given as seconds ("0.25") or
+// durations ("250ms"), which must be positive and ascending
+func parseMetricsBuckets(args []string) ([]float64, error) {
+	buckets := make([]float64, 0, len(args))
+	for _, arg := range args {
+		seconds, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			dur, durErr := caddy.ParseDuration(arg)
+			if durErr != nil {
+				return nil, fmt.Errorf("invalid bucket %q", arg)
+			}
+			seconds = dur.Seconds()
+		}
+		if seconds <= 0 {
+			return nil, fmt.Errorf("bucket %q must be positive", arg)
+		}
+		if len(buckets) > 0 && seconds <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be in ascending order, got %q", arg)
+		}
+		buckets = append(buckets, seconds)
+	}
+	return buckets, nil
+}
+
+// WriteMetrics writes metrics for all registered proxies
+func (r *ProxyRegistry) WriteMetrics(w io.Writer) {
+	r.CleanupStale()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fmt.Fprintf(w, "# HELP %s Duration of requests sent to each upstream.\n", requestDurationMetric)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", requestDurationMetric)
+	for _, path := range r.order {
+		entry, exists := r.proxies[path]
+		if !exists || entry == nil || entry.Proxy == nil || entry.Proxy.latency == nil {
+			continue
+		}
+
+		displayPath := path
+		if entry.Proxy.HandlePath != "" {
+			displayPath = entry.Proxy.HandlePath
+		}
+		entry.Proxy.latency.writeTo(w, displayPath)
+	}
+}
+
+// FailoverMetricsHandler serves failover proxy metrics in Prometheus text format
+type FailoverMetricsHandler struct{}
+
+// CaddyModule returns the Caddy module information
+func (FailoverMetricsHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.failover_metrics",
+		New: func() caddy.Module { return new(FailoverMetricsHandler) },
+	}
+}
+
+// ServeHTTP handles the metrics request
+func (h FailoverMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	var buf strings.Builder
+	proxyRegistry.WriteMetrics(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := io.WriteString(w, buf.String()); err != nil {
+		caddy.Log().Error("failed to write failover metrics response",
+			zap.Error(err))
+	}
+	return nil
+}
+
+// parseFailoverMetrics parses the failover_metrics directive
+func parseFailoverMetrics(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := FailoverMetricsHandler{}
+	for h.Next() {
+		if h.NextArg() {
+			return nil, h.ArgErr()
+		}
+		if h.NextBlock(0) {
+			return nil, h.Errf("unknown failover_metrics subdirective: %s", h.Val())
+		}
+	}
+	return handler, nil
+}
+
+// Interface guards
+var (
+	_ caddy.Module                = (*FailoverMetricsHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*FailoverMetricsHandler)(nil)
+)
@@ -0,0 +1,119 @@
+package failover
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestMetricsHistogramExposition tests that histogram series are present and consistent
+func TestMetricsHistogramExposition(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, WithPath("/metrics-test/*"), func(fp *FailoverProxy) {
+		fp.MetricsBuckets = []float64{0.001, 0.01, 1}
+	})
+
+	const requests = 3
+	for i := 0; i < requests; i++ {
+		fp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/metrics-test/x", nil), nil)
+	}
+
+	w := httptest.NewRecorder()
+	if err := (FailoverMetricsHandler{}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected text exposition content type, got %s", w.Header().Get("Content-Type"))
+	}
+
+	labels := `path="/metrics-test/*",upstream="` + upstream.URL + `"`
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, labels) {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			t.Fatalf("Invalid sample line %q: %v", line, err)
+		}
+		values[line[:idx]] = value
+	}
+
+	series := func(suffix, le string) string {
+		if le == "" {
+			return requestDurationMetric + suffix + "{" + labels + "}"
+		}
+		return requestDurationMetric + suffix + "{" + labels + `,le="` + le + `"}`
+	}
+
+	count, ok := values[series("_count", "")]
+	if !ok || count != requests {
+		t.Fatalf("Expected _count of %d, got %v (present=%v)\n%s", requests, count, ok, w.Body.String())
+	}
+	if sum := values[series("_sum", "")]; sum < requests*0.02 {
+		t.Errorf("Expected _sum of at least %v seconds, got %v", requests*0.02, sum)
+	}
+
+	// Buckets are cumulative and end with +Inf equal to the count
+	previous := -1.0
+	for _, le := range []string{"0.001", "0.01", "1", "+Inf"} {
+		v, ok := values[series("_bucket", le)]
+		if !ok {
+			t.Fatalf("Missing bucket le=%s", le)
+		}
+		if v < previous {
+			t.Errorf("Bucket le=%s (%v) is less than the previous bucket (%v)", le, v, previous)
+		}
+		previous = v
+	}
+	if values[series("_bucket", "0.01")] != 0 {
+		t.Errorf("Expected no 20ms requests in the 10ms bucket, got %v", values[series("_bucket", "0.01")])
+	}
+	if values[series("_bucket", "1")] != requests || values[series("_bucket", "+Inf")] != count {
+		t.Errorf("Expected all requests in the 1s and +Inf buckets")
+	}
+}
+
+// TestParseMetricsBuckets tests bucket parsing from the Caddyfile
+func TestParseMetricsBuckets(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		metrics_buckets 0.05 250ms 1 2s
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []float64{0.05, 0.25, 1, 2}
+	got := handler.(*FailoverProxy).MetricsBuckets
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	}
+
+	for _, bad := range []string{"1 0.5", "0", "fast"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n metrics_buckets " + bad + "\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for buckets %q", bad)
+		}
+	}
+}
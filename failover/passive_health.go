@@ -0,0 +1,95 @@
+package failover
+
+import (
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// PassiveHealth marks an upstream UNHEALTHY after consecutive request
+// failures, giving failover memory without an active health check
+type PassiveHealth struct {
+	// MaxFails is how many consecutive failures within Window mark the
+	// upstream unhealthy (default 3)
+	MaxFails int `json:"max_fails,omitempty"`
+
+	// Window is the span the failures must fall within. An upstream without
+	// an active health check is tried again once it has been unhealthy this
+	// long, and a success restores it (default 30s)
+	Window caddy.Duration `json:"window,omitempty"`
+}
+
+// passiveState is the runtime passive health state of one upstream
+type passiveState struct {
+	fails     int       // consecutive failures in the current window
+	firstFail time.Time // when the current run of failures started
+	downSince time.Time // when passive health marked the upstream unhealthy, zero while healthy
+}
+
+// passiveRecord applies the outcome of a request to the upstream's passive
+// health. Must be called with lock held.
+func (f *FailoverProxy) passiveRecord(upstreamURL string, success bool) {
+	if f.PassiveHealth == nil {
+		return
+	}
+	ps, exists := f.passiveStates[upstreamURL]
+	if !exists {
+		ps = &passiveState{}
+		f.passiveStates[upstreamURL] = ps
+	}
+
+	if success {
+		ps.fails = 0
+		if ps.downSince.IsZero() {
+			return
+		}
+		ps.downSince = time.Time{}
+		// Actively checked upstreams keep the status their probes report
+		if _, checked := f.HealthChecks[upstreamURL]; !checked {
+			delete(f.healthStatus, upstreamURL)
+		}
+		f.logger.Info("upstream recovered, request succeeded",
+			zap.String("upstream", upstreamURL))
+		f.notifyStatusChange()
+		f.checkActiveUpstreamChange()
+		return
+	}
+
+	now := time.Now()
+
+	// A failed trial after the window keeps the upstream down for another one
+	if !ps.downSince.IsZero() {
+		ps.downSince = now
+		return
+	}
+
+	if ps.fails == 0 || now.Sub(ps.firstFail) > time.Duration(f.PassiveHealth.Window) {
+		ps.fails = 0
+		ps.firstFail = now
+	}
+	ps.fails++
+	if ps.fails < f.PassiveHealth.MaxFails {
+		return
+	}
+
+	ps.fails = 0
+	ps.downSince = now
+	f.healthStatus[upstreamURL] = false
+	f.logger.Warn("upstream marked unhealthy after consecutive failures",
+		zap.String("upstream", upstreamURL),
+		zap.Int("max_fails", f.PassiveHealth.MaxFails),
+		zap.Duration("window", time.Duration(f.PassiveHealth.Window)))
+	f.notifyStatusChange()
+	f.checkActiveUpstreamChange()
+}
+
+// passivelyDown reports whether passive health currently keeps the upstream
+// out of rotation. Must be called with lock held.
+func (f *FailoverProxy) passivelyDown(upstreamURL string) bool {
+	if f.PassiveHealth == nil {
+		return false
+	}
+	ps, exists := f.passiveStates[upstreamURL]
+	return exists && !ps.downSince.IsZero() && time.Since(ps.downSince) < time.Duration(f.PassiveHealth.Window)
+}
@@ -0,0 +1,142 @@
+package failover
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newPassiveTestProxy creates a proxy with a controlled primary and a
+// fail_duration short enough that every request reaches it
+func newPassiveTestProxy(t *testing.T, ph *PassiveHealth) (fp *FailoverProxy, primaryURL string, primaryStatus, primaryHits *int32) {
+	return CreateControlledPrimaryProxy(t, func(fp *FailoverProxy) {
+		fp.FailDuration = caddy.Duration(time.Millisecond)
+		fp.PassiveHealth = ph
+	})
+}
+
+// serveAfterFailDuration waits out fail_duration, then serves one request
+func serveAfterFailDuration(t *testing.T, fp *FailoverProxy) {
+	t.Helper()
+	time.Sleep(5 * time.Millisecond)
+	serveOnce(t, fp)
+}
+
+// TestPassiveHealthMarksUnhealthy tests that max_fails failures within the
+// window flip the upstream to UNHEALTHY and keep it out of rotation
+func TestPassiveHealthMarksUnhealthy(t *testing.T) {
+	fp, primary, _, primaryHits := newPassiveTestProxy(t, &PassiveHealth{
+		MaxFails: 3,
+		Window:   caddy.Duration(time.Minute),
+	})
+
+	for i := 0; i < 2; i++ {
+		serveAfterFailDuration(t, fp)
+	}
+	if status := UpstreamStatusOf(t, fp, primary).Status; status == "UNHEALTHY" {
+		t.Fatal("Expected primary not to be unhealthy before max_fails")
+	}
+
+	serveAfterFailDuration(t, fp)
+	if status := UpstreamStatusOf(t, fp, primary).Status; status != "UNHEALTHY" {
+		t.Fatalf("Expected primary UNHEALTHY after 3 failures, got %s", status)
+	}
+	if active := fp.GetActiveUpstream(); active == primary {
+		t.Error("Expected the active upstream to move off the unhealthy primary")
+	}
+
+	serveAfterFailDuration(t, fp)
+	if hits := atomic.LoadInt32(primaryHits); hits != 3 {
+		t.Errorf("Expected the unhealthy primary to be skipped, got %d hits", hits)
+	}
+}
+
+// TestPassiveHealthSuccessResets tests that a success resets the failure count
+func TestPassiveHealthSuccessResets(t *testing.T) {
+	fp, primary, primaryStatus, _ := newPassiveTestProxy(t, &PassiveHealth{
+		MaxFails: 3,
+		Window:   caddy.Duration(time.Minute),
+	})
+
+	for _, status := range []int32{500, 500, 200, 500, 500} {
+		atomic.StoreInt32(primaryStatus, status)
+		serveAfterFailDuration(t, fp)
+	}
+	if status := UpstreamStatusOf(t, fp, primary).Status; status == "UNHEALTHY" {
+		t.Errorf("Expected the success to reset the count, got %s", status)
+	}
+}
+
+// TestPassiveHealthRecovery tests that an unhealthy upstream is tried again
+// after the window and restored by a success
+func TestPassiveHealthRecovery(t *testing.T) {
+	fp, primary, primaryStatus, primaryHits := newPassiveTestProxy(t, &PassiveHealth{
+		MaxFails: 2,
+		Window:   caddy.Duration(100 * time.Millisecond),
+	})
+
+	serveAfterFailDuration(t, fp)
+	serveAfterFailDuration(t, fp)
+	if status := UpstreamStatusOf(t, fp, primary).Status; status != "UNHEALTHY" {
+		t.Fatalf("Expected primary UNHEALTHY, got %s", status)
+	}
+
+	atomic.StoreInt32(primaryStatus, http.StatusOK)
+	time.Sleep(150 * time.Millisecond)
+	serveOnce(t, fp)
+	if hits := atomic.LoadInt32(primaryHits); hits != 3 {
+		t.Errorf("Expected the primary to be tried after the window, got %d hits", hits)
+	}
+	if status := UpstreamStatusOf(t, fp, primary).Status; status != "UP" {
+		t.Errorf("Expected primary UP after a success, got %s", status)
+	}
+	if active := fp.GetActiveUpstream(); active != primary {
+		t.Errorf("Expected the primary to be active again, got %s", active)
+	}
+}
+
+// TestPassiveHealthWindow tests that failures spread wider than the window don't accumulate
+func TestPassiveHealthWindow(t *testing.T) {
+	fp, primary, _, _ := newPassiveTestProxy(t, &PassiveHealth{
+		MaxFails: 2,
+		Window:   caddy.Duration(50 * time.Millisecond),
+	})
+
+	serveAfterFailDuration(t, fp)
+	time.Sleep(100 * time.Millisecond)
+	serveAfterFailDuration(t, fp)
+	if status := UpstreamStatusOf(t, fp, primary).Status; status == "UNHEALTHY" {
+		t.Errorf("Expected failures outside the window not to accumulate, got %s", status)
+	}
+}
+
+// TestParsePassiveHealth tests parsing the passive_health block
+func TestParsePassiveHealth(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		passive_health {
+			max_fails 4
+			window 10s
+		}
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ph := handler.(*FailoverProxy).PassiveHealth
+	if ph == nil || ph.MaxFails != 4 || ph.Window != caddy.Duration(10*time.Second) {
+		t.Errorf("Unexpected passive_health: %+v", ph)
+	}
+
+	for _, bad := range []string{"max_fails 0", "window soon", "window 0s", "unknown 1"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n passive_health {\n " + bad + "\n }\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for passive_health %s", bad)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package failover
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// PathRewrite rewrites the request path sent to one upstream
+type PathRewrite struct {
+	// From is a regular expression matched against the request path
+	From string `json:"from"`
+
+	// To replaces every match of From; $1 and ${name} expand to capture groups
+	To string `json:"to"`
+
+	re *regexp.Regexp // compiled From
+}
+
+// provisionPathRewrites expands the upstreams of path rewrites and compiles
+// their patterns
+func (f *FailoverProxy) provisionPathRewrites() error {
+	expanded := make(map[string][]*PathRewrite)
+	for upstream, rewrites := range f.PathRewrites {
+		for _, rewrite := range rewrites {
+			re, err := regexp.Compile(rewrite.From)
+			if err != nil {
+				return fmt.Errorf("invalid rewrite pattern for %s: %v", upstream, err)
+			}
+			rewrite.re = re
+		}
+		expanded[f.replacer.ReplaceAll(upstream, "")] = rewrites
+	}
+	f.PathRewrites = expanded
+	return nil
+}
+
+// rewritePath applies the upstream's rewrites to the request path, in the
+// order they were declared
+func (f *FailoverProxy) rewritePath(upstreamURL, path string) string {
+	for _, rewrite := range f.PathRewrites[upstreamURL] {
+		path = rewrite.re.ReplaceAllString(path, rewrite.To)
+	}
+	return path
+}
@@ -0,0 +1,128 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newPathRecorder starts an upstream that records the request URI it receives
+func newPathRecorder(t *testing.T, status int) (*httptest.Server, *string) {
+	received := new(string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received = r.URL.RequestURI()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// TestPathRewritePrefixStrip tests that a rewrite applies only to its upstream
+func TestPathRewritePrefixStrip(t *testing.T) {
+	primary, primaryURI := newPathRecorder(t, http.StatusInternalServerError)
+	backup, backupURI := newPathRecorder(t, http.StatusOK)
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL + "/v2"}, func(fp *FailoverProxy) {
+		fp.PathRewrites = map[string][]*PathRewrite{
+			backup.URL + "/v2": {{From: "^/api", To: ""}},
+		}
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/api/users?page=2&sort=name", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	if *primaryURI != "/api/users?page=2&sort=name" {
+		t.Errorf("Expected the primary to receive the original path, got %s", *primaryURI)
+	}
+	if *backupURI != "/v2/users?page=2&sort=name" {
+		t.Errorf("Expected the backup to receive the stripped path under its base path, got %s", *backupURI)
+	}
+}
+
+// TestPathRewriteCaptureGroups tests capture group substitution and that
+// rewrites apply in declared order
+func TestPathRewriteCaptureGroups(t *testing.T) {
+	upstream, received := newPathRecorder(t, http.StatusOK)
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.PathRewrites = map[string][]*PathRewrite{
+			upstream.URL: {
+				{From: `^/users/([0-9]+)/(?P<section>\w+)$`, To: "/accounts/$1/${section}"},
+				{From: "^/accounts/", To: "/legacy/accounts/"},
+			},
+		}
+	})
+
+	tests := map[string]string{
+		"/users/42/profile?fields=name": "/legacy/accounts/42/profile?fields=name",
+		"/orders/7":                     "/orders/7",
+	}
+	for path, expected := range tests {
+		req := httptest.NewRequest("GET", "http://example.com"+path, nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		if *received != expected {
+			t.Errorf("Expected %s to be proxied as %s, got %s", path, expected, *received)
+		}
+	}
+}
+
+// TestPathRewriteInvalidPattern tests that provisioning rejects a bad pattern
+func TestPathRewriteInvalidPattern(t *testing.T) {
+	fp := &FailoverProxy{
+		Upstreams:    []string{"http://a.example.com"},
+		PathRewrites: map[string][]*PathRewrite{"http://a.example.com": {{From: "(", To: ""}}},
+	}
+	if err := fp.Provision(caddy.Context{}); err == nil {
+		t.Error("Expected an error for an invalid rewrite pattern")
+	}
+}
+
+// TestParsePathRewrite tests parsing rewrite
+func TestParsePathRewrite(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		rewrite http://b ^/api ""
+		rewrite http://b ^/v1/(.*)$ /v2/$1
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	rewrites := handler.(*FailoverProxy).PathRewrites["http://b"]
+	if len(rewrites) != 2 {
+		t.Fatalf("Expected 2 rewrites for http://b, got %d", len(rewrites))
+	}
+	if rewrites[0].From != "^/api" || rewrites[0].To != "" {
+		t.Errorf("Unexpected first rewrite %+v", rewrites[0])
+	}
+	if rewrites[1].From != "^/v1/(.*)$" || rewrites[1].To != "/v2/$1" {
+		t.Errorf("Unexpected second rewrite %+v", rewrites[1])
+	}
+
+	for _, input := range []string{
+		`failover_proxy http://a {
+			rewrite http://a ^/api
+		}`,
+		`failover_proxy http://a {
+			rewrite http://a ( /x
+		}`,
+	} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(input)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected an error parsing %q", input)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package failover
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// PingCheck configures ICMP echo probes used as a fast liveness signal. Ping
+// loss marks the upstream tentatively down until pings succeed again; the HTTP
+// health check, when configured, still has to pass for the upstream to be used.
+//
+// Sending ICMP requires either CAP_NET_RAW or membership of a group allowed by
+// the net.ipv4.ping_group_range sysctl. Only IPv4 upstreams are supported.
+type PingCheck struct {
+	// Interval is how often to ping the upstream (default 5s)
+	Interval caddy.Duration `json:"interval,omitempty"`
+
+	// Timeout is how long to wait for an echo reply (default 1s)
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+// pingSequence numbers echo requests so replies can be matched to them
+var pingSequence uint32
+
+// ping sends a single ICMP echo request to the host and waits for the reply
+func ping(host string, timeout time.Duration) error {
+	ip, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", host, err)
+	}
+
+	// Prefer an unprivileged datagram socket, falling back to a raw socket
+	network := "udp4"
+	conn, err := icmp.ListenPacket(network, "0.0.0.0")
+	if err != nil {
+		network = "ip4:icmp"
+		conn, err = icmp.ListenPacket(network, "0.0.0.0")
+		if err != nil {
+			return fmt.Errorf("opening ICMP socket: %w", err)
+		}
+	}
+	defer conn.Close()
+
+	var dst net.Addr = ip
+	if network == "udp4" {
+		dst = &net.UDPAddr{IP: ip.IP}
+	}
+
+	id := os.Getpid() & 0xffff
+	seq := int(atomic.AddUint32(&pingSequence, 1) & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("caddy-failover")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return fmt.Errorf("sending echo request: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("waiting for echo reply: %w", err)
+		}
+		reply, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq {
+			continue
+		}
+		// Raw sockets see every reply on the host; the kernel rewrites the ID
+		// on datagram sockets and only delivers our own replies
+		if network == "ip4:icmp" && (echo.ID != id || !peerIP(peer).Equal(ip.IP)) {
+			continue
+		}
+		return nil
+	}
+}
+
+// peerIP extracts the IP from the address an ICMP reply came from
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// runPingCheck pings an upstream periodically until shutdown
+func (f *FailoverProxy) runPingCheck(upstreamURL string, pc *PingCheck) {
+	defer f.wg.Done()
+
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		f.logger.Error("invalid upstream URL for ping check",
+			zap.String("upstream", upstreamURL),
+			zap.Error(err))
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(pc.Interval))
+	defer ticker.Stop()
+
+	f.performPingCheck(u.Hostname(), upstreamURL, pc)
+
+	for {
+		select {
+		case <-ticker.C:
+			if f.shuttingDown() {
+				return
+			}
+			f.performPingCheck(u.Hostname(), upstreamURL, pc)
+		case <-f.shutdown:
+			return
+		}
+	}
+}
+
+// performPingCheck pings the upstream once and records the result
+func (f *FailoverProxy) performPingCheck(host, upstreamURL string, pc *PingCheck) {
+	err := ping(host, time.Duration(pc.Timeout))
+	if f.shuttingDown() {
+		return
+	}
+	f.setPingStatus(upstreamURL, err == nil)
+	if err != nil {
+		f.logger.Debug("ping check failed",
+			zap.String("upstream", upstreamURL),
+			zap.Error(err))
+	}
+}
+
+// setPingStatus records the ping result for an upstream, logging changes
+func (f *FailoverProxy) setPingStatus(upstreamURL string, alive bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prev, exists := f.pingStatus[upstreamURL]
+	f.pingStatus[upstreamURL] = alive
+	if exists && prev == alive {
+		return
+	}
+	f.notifyStatusChange()
+	if alive {
+		f.logger.Debug("upstream answering pings",
+			zap.String("upstream", upstreamURL))
+	} else {
+		f.logger.Warn("upstream stopped answering pings, marking tentatively down",
+			zap.String("upstream", upstreamURL))
+	}
+}
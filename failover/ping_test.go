@@ -0,0 +1,94 @@
+package failover
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"go.uber.org/zap"
+)
+
+// TestPingLossMarksUpstreamDown tests that ping results feed into upstream health
+func TestPingLossMarksUpstreamDown(t *testing.T) {
+	if err := ping("127.0.0.1", time.Second); err != nil && strings.Contains(err.Error(), "opening ICMP socket") {
+		t.Skipf("ICMP not permitted in this environment: %v", err)
+	}
+
+	const alive = "http://127.0.0.1:8080"
+	const unreachable = "http://198.51.100.1:8080" // TEST-NET-2, never answers
+
+	fp := &FailoverProxy{
+		Upstreams:    []string{alive, unreachable},
+		logger:       zap.NewNop(),
+		healthStatus: make(map[string]bool),
+		pingStatus:   make(map[string]bool),
+		shutdown:     make(chan struct{}),
+	}
+	pc := &PingCheck{Timeout: caddy.Duration(200 * time.Millisecond)}
+
+	fp.performPingCheck("127.0.0.1", alive, pc)
+	fp.performPingCheck("198.51.100.1", unreachable, pc)
+
+	if !fp.isHealthy(alive) {
+		t.Error("Expected upstream answering pings to be healthy")
+	}
+	if fp.isHealthy(unreachable) {
+		t.Error("Expected upstream losing pings to be tentatively down")
+	}
+}
+
+// TestPingStatusCombinesWithHealthCheck tests how ping and HTTP health results combine
+func TestPingStatusCombinesWithHealthCheck(t *testing.T) {
+	const upstream = "http://backend:8080"
+	fp := &FailoverProxy{
+		HealthChecks: map[string]*HealthCheck{upstream: {}},
+		healthStatus: map[string]bool{upstream: true},
+		pingStatus:   map[string]bool{upstream: false},
+	}
+
+	if fp.isHealthy(upstream) {
+		t.Error("Expected ping loss to override a passing HTTP check")
+	}
+
+	fp.pingStatus[upstream] = true
+	if !fp.isHealthy(upstream) {
+		t.Error("Expected upstream to be healthy once pings and HTTP check pass")
+	}
+
+	fp.healthStatus[upstream] = false
+	if fp.isHealthy(upstream) {
+		t.Error("Expected a failing HTTP check to keep the upstream down despite pings")
+	}
+}
+
+// TestParsePingCheck tests parsing of the ping_check subdirective
+func TestParsePingCheck(t *testing.T) {
+	input := `failover_proxy http://a http://b {
+		ping_check http://a {
+			interval 2s
+			timeout 500ms
+		}
+		ping_check http://b
+	}`
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(input)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+
+	pc, ok := fp.PingChecks["http://a"]
+	if !ok {
+		t.Fatal("Expected ping check for http://a")
+	}
+	if time.Duration(pc.Interval) != 2*time.Second || time.Duration(pc.Timeout) != 500*time.Millisecond {
+		t.Errorf("Unexpected ping check settings: %+v", pc)
+	}
+	if _, ok := fp.PingChecks["http://b"]; !ok {
+		t.Error("Expected ping check for http://b without a block")
+	}
+}
@@ -0,0 +1,115 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// probeCallbackQueueSize bounds the probe results waiting to be delivered;
+// results are dropped rather than delaying probes when the queue is full
+const probeCallbackQueueSize = 64
+
+// probeCallbackTimeout bounds each callback POST
+const probeCallbackTimeout = 5 * time.Second
+
+// probeResult is the JSON body POSTed to the probe callback after every probe
+type probeResult struct {
+	Upstream   string    `json:"upstream"`
+	Healthy    bool      `json:"healthy"`
+	Status     int       `json:"status,omitempty"` // 0 when no response was received
+	DurationMs int64     `json:"duration_ms"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// probeCallback delivers probe results to an external URL in the background
+type probeCallback struct {
+	url    string
+	client *http.Client
+	queue  chan probeResult
+	logger *zap.Logger
+}
+
+// newProbeCallback creates a callback that POSTs probe results to url
+func newProbeCallback(url string, logger *zap.Logger) *probeCallback {
+	return &probeCallback{
+		url:    url,
+		client: &http.Client{Timeout: probeCallbackTimeout},
+		queue:  make(chan probeResult, probeCallbackQueueSize),
+		logger: logger,
+	}
+}
+
+// enqueue queues a result for delivery without blocking the prober
+func (c *probeCallback) enqueue(result probeResult) {
+	select {
+	case c.queue <- result:
+	default:
+		c.logger.Warn("probe callback queue full, dropping result",
+			zap.String("upstream", result.Upstream))
+	}
+}
+
+// run delivers queued results until shutdown
+func (c *probeCallback) run(shutdown <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-shutdown
+		cancel()
+	}()
+
+	for {
+		select {
+		case result := <-c.queue:
+			c.send(ctx, result)
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// send POSTs a single probe result
+func (c *probeCallback) send(ctx context.Context, result probeResult) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		c.logger.Warn("failed to create probe callback request",
+			zap.String("url", c.url),
+			zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.logger.Debug("probe callback failed",
+			zap.String("url", c.url),
+			zap.Error(err))
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// reportProbe hands a probe result to the probe callback, when configured
+func (f *FailoverProxy) reportProbe(upstreamURL string, healthy bool, status int, elapsed time.Duration) {
+	if f.probeCallback == nil {
+		return
+	}
+	f.probeCallback.enqueue(probeResult{
+		Upstream:   upstreamURL,
+		Healthy:    healthy,
+		Status:     status,
+		DurationMs: elapsed.Milliseconds(),
+		Timestamp:  time.Now(),
+	})
+}
@@ -0,0 +1,110 @@
+package failover
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"go.uber.org/zap"
+)
+
+// TestProbeCallbackEveryProbe tests that the callback fires for every probe, not just transitions
+func TestProbeCallbackEveryProbe(t *testing.T) {
+	results := make(chan probeResult, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON callback, got Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		var result probeResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			t.Errorf("Failed to decode callback body: %v", err)
+		}
+		results <- result
+	}))
+	defer collector.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.ProbeCallback = collector.URL
+	})
+	hc := &HealthCheck{
+		Path:           "/health",
+		Timeout:        caddy.Duration(time.Second),
+		ExpectedStatus: http.StatusOK,
+	}
+	u, _ := url.Parse(upstream.URL)
+	healthURL := buildHealthURL(u, hc)
+
+	// Three passing probes in a row: only the first is a transition
+	for i := 0; i < 3; i++ {
+		fp.performHealthCheck(healthURL, upstream.URL, hc)
+	}
+	fp.performHealthCheck("http://127.0.0.1:1/health", upstream.URL, hc)
+
+	for i := 0; i < 4; i++ {
+		select {
+		case result := <-results:
+			if result.Upstream != upstream.URL {
+				t.Errorf("Expected upstream %s, got %s", upstream.URL, result.Upstream)
+			}
+			if result.Timestamp.IsZero() {
+				t.Error("Expected a timestamp")
+			}
+			if i < 3 && (!result.Healthy || result.Status != http.StatusOK) {
+				t.Errorf("Probe %d: expected healthy 200 result, got %+v", i+1, result)
+			}
+			if i == 3 && (result.Healthy || result.Status != 0) {
+				t.Errorf("Expected failed probe without a status, got %+v", result)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected callback for probe %d", i+1)
+		}
+	}
+}
+
+// TestProbeCallbackQueueFull tests that a full queue drops results instead of blocking
+func TestProbeCallbackQueueFull(t *testing.T) {
+	c := newProbeCallback("http://127.0.0.1:1", zap.NewNop())
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < probeCallbackQueueSize+10; i++ {
+			c.enqueue(probeResult{Upstream: "http://a"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected enqueue not to block when the queue is full")
+	}
+	if len(c.queue) != probeCallbackQueueSize {
+		t.Errorf("Expected %d queued results, got %d", probeCallbackQueueSize, len(c.queue))
+	}
+}
+
+// TestParseProbeCallback tests parsing the probe_callback subdirective
+func TestParseProbeCallback(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		probe_callback https://monitor.example.com/probes
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).ProbeCallback; got != "https://monitor.example.com/probes" {
+		t.Errorf("Expected probe callback URL, got %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package failover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// upstreamsSuffix ends the status endpoint path that replaces a proxy's
+// upstreams, as in PUT /admin/failover/status/api/*/upstreams
+const upstreamsSuffix = "/upstreams"
+
+// UpstreamList is the body of a PUT that replaces a proxy's upstreams, and of
+// its response
+type UpstreamList struct {
+	// Upstreams are the upstream URLs in failover order
+	Upstreams []string `json:"upstreams"`
+
+	// Previous are the upstreams that were replaced, set in the response
+	Previous []string `json:"previous,omitempty"`
+}
+
+// declaredUpstreams returns the declared upstreams. They can be replaced at
+// runtime, so callers not holding the lock read them through here; a
+// replacement swaps in a new slice rather than changing the old one.
+func (f *FailoverProxy) declaredUpstreams() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.Upstreams
+}
+
+// primaryUpstream returns the first declared upstream, or "" when there is none
+func (f *FailoverProxy) primaryUpstream() string {
+	if upstreams := f.declaredUpstreams(); len(upstreams) > 0 {
+		return upstreams[0]
+	}
+	return ""
+}
+
+// SetUpstreams replaces the declared upstreams without a config reload, such
+// as for a blue/green rollout, and returns the previous list. Removed
+// upstreams have their health checks stopped and their state forgotten.
+// Only upstreams with a health_check in the config have it restarted when
+// added back; upstreams new to the proxy get no health check.
+func (f *FailoverProxy) SetUpstreams(upstreams []string) ([]string, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("at least one upstream is required")
+	}
+	expanded := make([]string, 0, len(upstreams))
+	keep := make(map[string]bool, len(upstreams))
+	for _, upstream := range upstreams {
+		upstream = f.replacer.ReplaceAll(upstream, "")
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid upstream URL: %s", upstream)
+		}
+		if keep[upstream] {
+			return nil, fmt.Errorf("duplicate upstream: %s", upstream)
+		}
+		if f.Canary != nil && upstream == f.Canary.Upstream {
+			return nil, fmt.Errorf("upstream %s is the canary", upstream)
+		}
+		keep[upstream] = true
+		expanded = append(expanded, upstream)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.shuttingDown() {
+		return nil, fmt.Errorf("proxy is shutting down")
+	}
+
+	previous := f.Upstreams
+	declared := make(map[string]bool, len(previous))
+	for _, upstream := range previous {
+		declared[upstream] = true
+		if keep[upstream] {
+			continue
+		}
+		f.logger.Info("upstream removed", zap.String("upstream", upstream))
+		if hc, ok := f.HealthChecks[upstream]; ok && hc.stop != nil && !hc.stopped() {
+			close(hc.stop)
+		}
+		f.forgetUpstream(upstream)
+	}
+
+	for _, upstream := range expanded {
+		if declared[upstream] {
+			continue
+		}
+		f.logger.Info("upstream added", zap.String("upstream", upstream))
+		// A configured check that was stopped when the upstream was removed
+		// starts again from scratch
+		if hc, ok := f.HealthChecks[upstream]; ok && hc.stopped() {
+			restarted := f.declaredChecks[upstream]
+			restarted.stop = make(chan struct{})
+			f.HealthChecks[upstream] = &restarted
+			f.wg.Add(1)
+			go f.runHealthCheck(upstream, &restarted)
+		}
+	}
+
+	f.Upstreams = expanded
+	f.updateSRVTargets()
+	f.notifyStatusChange()
+	f.checkActiveUpstreamChange()
+	return previous, nil
+}
+
+// forgetUpstream drops the runtime state of an upstream taken out of the
+// rotation. Must be called with lock held.
+func (f *FailoverProxy) forgetUpstream(upstreamURL string) {
+	delete(f.healthStatus, upstreamURL)
+	delete(f.lastCheckTime, upstreamURL)
+	delete(f.lastSuccess, upstreamURL)
+	delete(f.recoveredAt, upstreamURL)
+	delete(f.responseTime, upstreamURL)
+	delete(f.failureCache, upstreamURL)
+	delete(f.tlsFailures, upstreamURL)
+	delete(f.circuits, upstreamURL)
+	delete(f.passiveStates, upstreamURL)
+	delete(f.upstreamMetrics, upstreamURL)
+	delete(f.disabled, upstreamURL)
+}
+
+// serveSetUpstreams replaces the upstreams of the proxy named in the path
+// and responds with the new and previous lists
+func (h FailoverStatusHandler) serveSetUpstreams(w http.ResponseWriter, r *http.Request) error {
+	path, proxy := proxyRegistry.lookupSuffix(strings.TrimSuffix(r.URL.Path, upstreamsSuffix))
+	if proxy == nil {
+		writeJSONError(w, http.StatusNotFound, "no failover proxy matches "+r.URL.Path)
+		return nil
+	}
+
+	var list UpstreamList
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return nil
+	}
+	previous, err := proxy.SetUpstreams(list.Upstreams)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	proxy.logger.Info("upstreams replaced",
+		zap.String("path", path),
+		zap.Strings("upstreams", proxy.declaredUpstreams()),
+		zap.Strings("previous", previous))
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(UpstreamList{
+		Upstreams: proxy.declaredUpstreams(),
+		Previous:  previous,
+	})
+}
+
+// lookupSuffix returns the registered proxy whose path ends requestPath, as
+// the status endpoint's path is prefixed by wherever it is mounted. The
+// longest matching path wins.
+func (r *ProxyRegistry) lookupSuffix(requestPath string) (string, *FailoverProxy) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var path string
+	var proxy *FailoverProxy
+	for registered, entry := range r.proxies {
+		if entry == nil || entry.Proxy == nil || len(registered) <= len(path) {
+			continue
+		}
+		if strings.HasSuffix(requestPath, "/"+strings.TrimPrefix(registered, "/")) {
+			path, proxy = registered, entry.Proxy
+		}
+	}
+	return path, proxy
+}
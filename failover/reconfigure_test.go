@@ -0,0 +1,208 @@
+package failover
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestSetUpstreams tests that a PUT through the status endpoint replaces the
+// upstreams, returns the previous list and restarts health checks of
+// upstreams added back
+func TestSetUpstreams(t *testing.T) {
+	var blueProbes atomic.Int64
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			blueProbes.Add(1)
+		}
+		w.Write([]byte("blue"))
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("green"))
+	}))
+	defer green.Close()
+
+	oldRegistry := proxyRegistry
+	proxyRegistry = CreateTestRegistry()
+	defer func() { proxyRegistry = oldRegistry }()
+
+	fp := CreateTestProxy(t, []string{blue.URL}, WithPath("/api/*"),
+		WithHealthCheck(blue.URL, MockHealthCheck("/health", 20*time.Millisecond, time.Second, http.StatusOK)))
+	handler := FailoverStatusHandler{AllowReconfigure: true}
+
+	serve := func() string {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/api/users", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		body, _ := io.ReadAll(w.Result().Body)
+		return string(body)
+	}
+	put := func(upstreams ...string) UpstreamList {
+		body, _ := json.Marshal(UpstreamList{Upstreams: upstreams})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/admin/failover/status/api/*/upstreams", strings.NewReader(string(body)))
+		if err := handler.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var list UpstreamList
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return list
+	}
+
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		return blueProbes.Load() > 0
+	}, "blue was never health checked")
+	if got := serve(); got != "blue" {
+		t.Fatalf("Expected blue before replacing, got %q", got)
+	}
+
+	list := put(green.URL)
+	if len(list.Previous) != 1 || list.Previous[0] != blue.URL {
+		t.Errorf("Expected previous [%s], got %v", blue.URL, list.Previous)
+	}
+	if len(list.Upstreams) != 1 || list.Upstreams[0] != green.URL {
+		t.Errorf("Expected upstreams [%s], got %v", green.URL, list.Upstreams)
+	}
+	if got := serve(); got != "green" {
+		t.Errorf("Expected green after replacing, got %q", got)
+	}
+
+	// Blue's health check stops once it is removed
+	time.Sleep(50 * time.Millisecond)
+	stopped := blueProbes.Load()
+	time.Sleep(100 * time.Millisecond)
+	if probes := blueProbes.Load(); probes != stopped {
+		t.Errorf("Expected blue's health check to stop, got %d more probes", probes-stopped)
+	}
+	fp.mu.RLock()
+	_, tracked := fp.healthStatus[blue.URL]
+	fp.mu.RUnlock()
+	if tracked {
+		t.Error("Expected blue's health status to be forgotten")
+	}
+
+	// Adding blue back ahead of green restarts its health check
+	list = put(blue.URL, green.URL)
+	if len(list.Previous) != 1 || list.Previous[0] != green.URL {
+		t.Errorf("Expected previous [%s], got %v", green.URL, list.Previous)
+	}
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		return blueProbes.Load() > stopped
+	}, "blue's health check was not restarted")
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		fp.mu.RLock()
+		defer fp.mu.RUnlock()
+		return fp.healthStatus[blue.URL]
+	}, "blue was not marked healthy")
+	if got := serve(); got != "blue" {
+		t.Errorf("Expected blue after adding it back, got %q", got)
+	}
+}
+
+// TestSetUpstreamsErrors tests rejected replacements
+func TestSetUpstreamsErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	oldRegistry := proxyRegistry
+	proxyRegistry = CreateTestRegistry()
+	defer func() { proxyRegistry = oldRegistry }()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, WithPath("/api"))
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{"unknown path", "/status/auth/upstreams", `{"upstreams": ["http://a.local"]}`, http.StatusNotFound},
+		{"malformed body", "/status/api/upstreams", `{`, http.StatusBadRequest},
+		{"empty list", "/status/api/upstreams", `{"upstreams": []}`, http.StatusBadRequest},
+		{"bad scheme", "/status/api/upstreams", `{"upstreams": ["ftp://a.local"]}`, http.StatusBadRequest},
+		{"missing host", "/status/api/upstreams", `{"upstreams": ["http://"]}`, http.StatusBadRequest},
+		{"duplicate", "/status/api/upstreams", `{"upstreams": ["http://a.local", "http://a.local"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+			if err := (FailoverStatusHandler{AllowReconfigure: true}).ServeHTTP(w, req, nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if w.Code != tt.code {
+				t.Errorf("Expected %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if upstreams := fp.declaredUpstreams(); len(upstreams) != 1 || upstreams[0] != upstream.URL {
+		t.Errorf("Expected upstreams to be unchanged, got %v", upstreams)
+	}
+
+	// Without allow_reconfigure PUTs are still rejected
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/status/api/upstreams", strings.NewReader(`{"upstreams": ["http://a.local"]}`))
+	if err := (FailoverStatusHandler{}).ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 without allow_reconfigure, got %d", w.Code)
+	}
+}
+
+// TestSetUpstreamsAfterCleanup tests that a stopped proxy rejects replacements
+// instead of starting health checks nothing will stop
+func TestSetUpstreamsAfterCleanup(t *testing.T) {
+	fp := CreateTestProxy(t, []string{"http://blue.local", "http://green.local"}, func(fp *FailoverProxy) {
+		fp.HealthChecks = map[string]*HealthCheck{
+			"http://blue.local": {Path: "/health", Interval: caddy.Duration(time.Hour)},
+		}
+	})
+	if _, err := fp.SetUpstreams([]string{"http://green.local"}); err != nil {
+		t.Fatalf("SetUpstreams failed: %v", err)
+	}
+	if err := fp.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+
+	if _, err := fp.SetUpstreams([]string{"http://blue.local", "http://green.local"}); err == nil {
+		t.Error("Expected SetUpstreams to fail after cleanup")
+	}
+	if hc := fp.HealthChecks["http://blue.local"]; !hc.stopped() {
+		t.Error("Expected blue's health check to stay stopped")
+	}
+	if upstreams := fp.declaredUpstreams(); len(upstreams) != 1 {
+		t.Errorf("Expected upstreams to be unchanged, got %v", upstreams)
+	}
+}
+
+// TestParseFailoverStatusAllowReconfigure tests parsing the allow_reconfigure option
+func TestParseFailoverStatusAllowReconfigure(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`failover_status {
+		allow_reconfigure
+	}`)
+	handler, err := parseFailoverStatus(httpcaddyfile.Helper{Dispenser: d})
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if !handler.(FailoverStatusHandler).AllowReconfigure {
+		t.Error("Expected AllowReconfigure to be set")
+	}
+}
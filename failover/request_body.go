@@ -0,0 +1,172 @@
+package failover
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// defaultBufferRequestsLimit is the largest body buffered by buffer_requests
+// when no size is given
+const defaultBufferRequestsLimit = 10 << 20
+
+// requestBody tracks whether a request body can be replayed to another upstream
+type requestBody struct {
+	data       []byte       // buffered body, valid when replayable
+	replayable bool         // false when the body can only be sent once
+	started    *atomic.Bool // set once a non-replayable body has been read
+}
+
+// readTrackingBody records when the wrapped body is first read
+type readTrackingBody struct {
+	io.ReadCloser
+	started *atomic.Bool
+}
+
+func (b *readTrackingBody) Read(p []byte) (int, error) {
+	b.started.Store(true)
+	return b.ReadCloser.Read(p)
+}
+
+// streamRequestBody passes the body through to a single upstream, tracking
+// whether it has been read so failover remains possible until then
+func streamRequestBody(r *http.Request) *requestBody {
+	started := &atomic.Bool{}
+	r.Body = &readTrackingBody{ReadCloser: r.Body, started: started}
+	return &requestBody{replayable: false, started: started}
+}
+
+// expectsContinue reports whether the client is waiting for 100 Continue
+// before sending the body
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue")
+}
+
+// isChunked reports whether the request body has an unknown length
+func isChunked(r *http.Request) bool {
+	if r.ContentLength < 0 {
+		return true
+	}
+	for _, te := range r.TransferEncoding {
+		if te == "chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// failoverTargets returns how many upstreams a request may be tried on: the
+// declared upstreams, the current SRV targets and the canary
+func (f *FailoverProxy) failoverTargets() int {
+	f.mu.RLock()
+	targets := len(f.allUpstreams())
+	f.mu.RUnlock()
+	if f.Canary != nil {
+		targets++
+	}
+	return targets
+}
+
+// prepareRequestBody makes the request body replayable across upstream attempts
+// where possible. Chunked bodies, and with buffer_requests all bodies, are
+// buffered up to the limit from bufferLimit; larger ones are streamed to the
+// first attempted upstream only. Without buffer_requests, bodies with a known
+// length are passed through unchanged.
+func (f *FailoverProxy) prepareRequestBody(r *http.Request) *requestBody {
+	if r.Body == nil || r.Body == http.NoBody || f.failoverTargets() < 2 || (!f.BufferRequests && !isChunked(r)) {
+		return &requestBody{replayable: true}
+	}
+
+	// Reading the body now would make the server send 100 Continue before any
+	// upstream has accepted the request, so leave it for the upstream to pull
+	if expectsContinue(r) {
+		f.logger.Debug("deferring request body until upstream accepts 100-continue",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path))
+		return streamRequestBody(r)
+	}
+
+	limit := f.bufferLimit(isChunked(r))
+	if limit <= 0 {
+		f.logger.Debug("request body not buffered, failover disabled once it is sent",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path))
+		return streamRequestBody(r)
+	}
+
+	// Don't start reading a body that is already known to be too large
+	if r.ContentLength > limit {
+		f.logger.Warn("request body exceeds buffer limit, failover disabled once it is sent",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int64("content_length", r.ContentLength),
+			zap.Int64("limit", limit))
+		return streamRequestBody(r)
+	}
+
+	// Read one byte past the limit to detect oversized chunked bodies
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil || int64(len(data)) > limit {
+		f.logger.Warn("request body exceeds buffer limit, failover disabled for request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int64("limit", limit),
+			zap.Error(err))
+
+		// Stitch the consumed prefix back onto the unread remainder
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+		return &requestBody{replayable: false, started: startedBody()}
+	}
+	r.Body.Close()
+
+	f.logger.Debug("buffered request body for failover",
+		zap.String("path", r.URL.Path),
+		zap.Int("size", len(data)))
+	return &requestBody{data: data, replayable: true}
+}
+
+// bufferLimit returns the largest body buffered for replay: max_buffer_size
+// for chunked bodies when set, otherwise the buffer_requests limit, or 0 when
+// bodies aren't buffered
+func (f *FailoverProxy) bufferLimit(chunked bool) int64 {
+	if chunked && f.MaxBufferSize > 0 {
+		return f.MaxBufferSize
+	}
+	if !f.BufferRequests {
+		return 0
+	}
+	if f.BufferRequestsLimit > 0 {
+		return f.BufferRequestsLimit
+	}
+	return defaultBufferRequestsLimit
+}
+
+// startedBody returns a flag for a body that has already been partially read
+func startedBody() *atomic.Bool {
+	started := &atomic.Bool{}
+	started.Store(true)
+	return started
+}
+
+// canResend reports whether the body can still be sent to another upstream,
+// either because it is buffered or because nothing has read it yet
+func (b *requestBody) canResend() bool {
+	return b.replayable || b.started == nil || !b.started.Load()
+}
+
+// rewind resets the request body before an upstream attempt
+func (b *requestBody) rewind(r *http.Request) {
+	if b.data == nil {
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b.data))
+	r.ContentLength = int64(len(b.data))
+	r.TransferEncoding = nil
+}
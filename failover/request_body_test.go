@@ -0,0 +1,245 @@
+package failover
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newChunkedRequest creates a request whose body has no declared length
+func newChunkedRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "http://example.com/upload", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	return req
+}
+
+// TestChunkedBodyFailoverWithinLimit tests that a buffered chunked body is replayed on failover
+func TestChunkedBodyFailoverWithinLimit(t *testing.T) {
+	expectedBody := strings.Repeat("chunk-data;", 100)
+	var primaryBody, secondaryBody string
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		primaryBody = string(body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		secondaryBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.MaxBufferSize = 64 * 1024
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, newChunkedRequest(expectedBody), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after failover, got %d", w.Code)
+	}
+	if primaryBody != expectedBody {
+		t.Errorf("Expected primary to receive full body, got %d bytes", len(primaryBody))
+	}
+	if secondaryBody != expectedBody {
+		t.Errorf("Expected secondary to receive full body, got %d bytes", len(secondaryBody))
+	}
+}
+
+// TestChunkedBodyOverLimitDisablesFailover tests that an oversized chunked body is sent only once
+func TestChunkedBodyOverLimitDisablesFailover(t *testing.T) {
+	expectedBody := strings.Repeat("x", 2048)
+	var primaryBody string
+	var secondaryHits int32
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		primaryBody = string(body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.MaxBufferSize = 1024
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, newChunkedRequest(expectedBody), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if primaryBody != expectedBody {
+		t.Errorf("Expected primary to receive the full streamed body, got %d bytes", len(primaryBody))
+	}
+	if atomic.LoadInt32(&secondaryHits) != 0 {
+		t.Error("Expected no failover for a body over max_buffer_size")
+	}
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", w.Code)
+	}
+}
+
+// TestFixedLengthBodyUnchanged tests that bodies with a known length are not buffered
+func TestFixedLengthBodyUnchanged(t *testing.T) {
+	fp := &FailoverProxy{
+		Upstreams:     []string{"http://a", "http://b"},
+		MaxBufferSize: 1024,
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/", bytes.NewBufferString("payload"))
+	original := req.Body
+	body := fp.prepareRequestBody(req)
+
+	if !body.replayable || body.data != nil {
+		t.Error("Expected fixed-length body to be left as-is")
+	}
+	if req.Body != original {
+		t.Error("Expected request body to be untouched")
+	}
+}
+
+// TestParseByteSize tests size parsing for buffer limits
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":  512,
+		"64KB": 64 * 1024,
+		"10mb": 10 * 1024 * 1024,
+		"1GB":  1 << 30,
+		"100B": 100,
+	}
+	for input, expected := range tests {
+		got, err := parseByteSize(input)
+		if err != nil {
+			t.Errorf("parseByteSize(%q) returned error: %v", input, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("parseByteSize(%q) = %d, expected %d", input, got, expected)
+		}
+	}
+
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Error("Expected error for invalid size")
+	}
+}
+
+// TestBufferRequestsFailover tests that a buffered POST body is resent in full on failover
+func TestBufferRequestsFailover(t *testing.T) {
+	expectedBody := `{"order":42,"items":["a","b","c"]}`
+	var secondaryBody, secondaryType string
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		secondaryBody = string(body)
+		secondaryType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.BufferRequests = true
+	})
+
+	req := httptest.NewRequest("POST", "http://example.com/orders", strings.NewReader(expectedBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 after failover, got %d", w.Code)
+	}
+	if secondaryBody != expectedBody {
+		t.Errorf("Expected secondary to receive %q, got %q", expectedBody, secondaryBody)
+	}
+	if secondaryType != "application/json" {
+		t.Errorf("Expected Content-Type to be forwarded, got %q", secondaryType)
+	}
+}
+
+// TestBufferRequestsOverLimit tests that a body over the buffer_requests limit goes to the first upstream only
+func TestBufferRequestsOverLimit(t *testing.T) {
+	expectedBody := strings.Repeat("y", 2048)
+	var primaryBody string
+	var secondaryHits int32
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		primaryBody = string(body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.BufferRequests = true
+		fp.BufferRequestsLimit = 1024
+	})
+
+	req := httptest.NewRequest("POST", "http://example.com/upload", strings.NewReader(expectedBody))
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if primaryBody != expectedBody {
+		t.Errorf("Expected primary to receive the full streamed body, got %d bytes", len(primaryBody))
+	}
+	if atomic.LoadInt32(&secondaryHits) != 0 {
+		t.Error("Expected no failover for a body over the buffer_requests limit")
+	}
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", w.Code)
+	}
+}
+
+// TestBufferRequestsLimit tests the buffer_requests limit defaults
+func TestBufferRequestsLimit(t *testing.T) {
+	fp := &FailoverProxy{}
+	if got := fp.bufferLimit(false); got != 0 {
+		t.Errorf("Expected no buffering when disabled, got %d", got)
+	}
+
+	fp.BufferRequests = true
+	if got := fp.bufferLimit(false); got != defaultBufferRequestsLimit {
+		t.Errorf("Expected default limit %d, got %d", defaultBufferRequestsLimit, got)
+	}
+
+	fp.BufferRequestsLimit = 4096
+	fp.MaxBufferSize = 1024
+	if got := fp.bufferLimit(false); got != 4096 {
+		t.Errorf("Expected buffer_requests limit for fixed-length bodies, got %d", got)
+	}
+	if got := fp.bufferLimit(true); got != 1024 {
+		t.Errorf("Expected max_buffer_size for chunked bodies, got %d", got)
+	}
+}
@@ -0,0 +1,48 @@
+package failover
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// statusRecorder remembers the final status code written through it, for
+// log_requests. Unwrap keeps flushing and hijacking working through
+// http.ResponseController.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	// Informational responses such as 100 Continue precede the real status
+	if s.status == 0 && code >= 200 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequest writes the log_requests entry for a request. upstream is empty
+// when no upstream served it, and attempts counts the upstreams it was sent to.
+func (f *FailoverProxy) logRequest(r *http.Request, upstream string, attempts, status int, elapsed time.Duration) {
+	f.logger.Info("handled request",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("upstream", upstream),
+		zap.Bool("failover", upstream != "" && upstream != f.primaryUpstream()),
+		zap.Int("attempts", attempts),
+		zap.Int("status", status),
+		zap.Duration("elapsed", elapsed))
+}
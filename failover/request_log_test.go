@@ -0,0 +1,125 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestLogRequests tests that log_requests writes one entry per request with a
+// consistent field schema, for both a direct success and a failover
+func TestLogRequests(t *testing.T) {
+	primaryStatus := http.StatusCreated
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(primaryStatus)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backup"))
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.LogRequests = true
+	})
+	core, logs := observer.New(zapcore.InfoLevel)
+	fp.logger = zap.New(core)
+
+	serve := func() {
+		req := httptest.NewRequest("GET", "http://example.com/api/items", nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		status   int
+		upstream string
+		failover bool
+		attempts int64
+		logged   int64
+	}{
+		{"success", http.StatusCreated, primary.URL, false, 1, http.StatusCreated},
+		{"failover", http.StatusInternalServerError, backup.URL, true, 2, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primaryStatus = tt.status
+			serve()
+
+			entries := logs.TakeAll()
+			var handled []observer.LoggedEntry
+			for _, entry := range entries {
+				if entry.Message == "handled request" {
+					handled = append(handled, entry)
+				}
+			}
+			if len(handled) != 1 {
+				t.Fatalf("Expected one request log entry, got %d", len(handled))
+			}
+
+			fields := handled[0].ContextMap()
+			for _, name := range []string{"method", "path", "upstream", "failover", "attempts", "status", "elapsed"} {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("Expected field %q in request log entry", name)
+				}
+			}
+			if fields["method"] != "GET" || fields["path"] != "/api/items" {
+				t.Errorf("Unexpected method and path: %v %v", fields["method"], fields["path"])
+			}
+			if fields["upstream"] != tt.upstream {
+				t.Errorf("Expected upstream %s, got %v", tt.upstream, fields["upstream"])
+			}
+			if fields["failover"] != tt.failover {
+				t.Errorf("Expected failover %v, got %v", tt.failover, fields["failover"])
+			}
+			if fields["attempts"] != tt.attempts {
+				t.Errorf("Expected %d attempts, got %v", tt.attempts, fields["attempts"])
+			}
+			if fields["status"] != tt.logged {
+				t.Errorf("Expected status %d, got %v", tt.logged, fields["status"])
+			}
+		})
+	}
+}
+
+// TestLogRequestsDisabled tests that no request entries are written by default
+func TestLogRequestsDisabled(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL})
+	core, logs := observer.New(zapcore.InfoLevel)
+	fp.logger = zap.New(core)
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	if err := fp.ServeHTTP(httptest.NewRecorder(), req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if n := logs.FilterMessage("handled request").Len(); n != 0 {
+		t.Errorf("Expected no request log entries, got %d", n)
+	}
+}
+
+// TestParseLogRequests tests parsing log_requests
+func TestParseLogRequests(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		log_requests
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if !handler.(*FailoverProxy).LogRequests {
+		t.Error("Expected log_requests to be set")
+	}
+}
@@ -0,0 +1,90 @@
+package failover
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultRetryBackoff is the delay before the first same-upstream retry when
+// retries is set without retry_backoff
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// errResponseStarted marks failures after the response was already sent to
+// the client, which can't be retried
+var errResponseStarted = errors.New("response already started")
+
+// responseStarted wraps an error that happened while streaming the response body
+func responseStarted(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", errResponseStarted, err)
+}
+
+// isIdempotent reports whether repeating a request with this method is safe
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// canRetry reports whether a failed attempt may be repeated against the same upstream
+func (f *FailoverProxy) canRetry(r *http.Request, body *requestBody, err error) bool {
+	if !f.RetryAllMethods && !isIdempotent(r.Method) {
+		return false
+	}
+	if errors.Is(err, errResponseStarted) || errors.Is(err, errLoopDetected) {
+		return false
+	}
+	// Bodies that weren't buffered have been consumed by the first attempt
+	if body.data == nil && r.ContentLength != 0 {
+		return false
+	}
+	return body.canResend() && r.Context().Err() == nil
+}
+
+// tryUpstreamWithRetries sends the request to one upstream, retrying up to
+// Retries times with exponential backoff before reporting the failure. Each
+// retry draws from the retry budget like a failover does.
+func (f *FailoverProxy) tryUpstreamWithRetries(w http.ResponseWriter, r *http.Request, upstreamURL string, body *requestBody) error {
+	body.rewind(r)
+	err := f.tryUpstream(w, r, upstreamURL)
+	for attempt := 0; err != nil && attempt < f.Retries && f.canRetry(r, body, err); attempt++ {
+		if f.retryBudget != nil && !f.retryBudget.tryWithdraw() {
+			attempts, retries := f.retryBudget.stats()
+			f.logger.Warn("retry budget exhausted, not retrying",
+				zap.String("url", upstreamURL),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int64("attempts", attempts),
+				zap.Int64("retries", retries))
+			return err
+		}
+
+		delay := time.Duration(f.RetryBackoff) << attempt
+		f.logger.Debug("retrying upstream",
+			zap.String("url", upstreamURL),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		body.rewind(r)
+		err = f.tryUpstream(w, r, upstreamURL)
+	}
+	return err
+}
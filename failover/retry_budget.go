@@ -0,0 +1,81 @@
+package failover
+
+import (
+	"sync/atomic"
+)
+
+// retryTokenScale is the number of internal units that make up one retry token.
+// Fractional deposits (e.g. 20% of a token per request) are tracked in these units.
+const retryTokenScale = 1000
+
+// retryBudgetWindow is the number of requests whose deposits the budget may hold
+// at once, on top of the MinRetries starting balance. It prevents a long healthy period
+// from banking an unbounded number of failovers.
+const retryBudgetWindow = 100
+
+// RetryBudget configures a token bucket that caps the ratio of failover attempts
+// to primary attempts, similar to Finagle's RetryBudget
+type RetryBudget struct {
+	// Percent is the percentage of requests that may be retried or fail over (e.g. 20 for 20%)
+	Percent float64 `json:"percent,omitempty"`
+
+	// MinRetries is the number of failovers available before any requests have
+	// been seen; once spent they are earned back at Percent like any other token
+	MinRetries int `json:"min_retries,omitempty"`
+}
+
+// retryBudget is the runtime state of a RetryBudget
+type retryBudget struct {
+	deposit    int64 // units added per request
+	reserve    int64 // units available at startup
+	maxBalance int64 // upper bound on the balance
+	balance    int64 // current balance in units, accessed atomically
+	attempts   int64 // requests seen, accessed atomically
+	retries    int64 // failovers granted, accessed atomically
+}
+
+// newRetryBudget creates the runtime budget from its configuration
+func newRetryBudget(cfg *RetryBudget) *retryBudget {
+	deposit := int64(cfg.Percent / 100 * retryTokenScale)
+	reserve := int64(cfg.MinRetries) * retryTokenScale
+	return &retryBudget{
+		deposit:    deposit,
+		reserve:    reserve,
+		maxBalance: reserve + deposit*retryBudgetWindow,
+		balance:    reserve,
+	}
+}
+
+// recordAttempt deposits the per-request share of a retry token
+func (b *retryBudget) recordAttempt() {
+	atomic.AddInt64(&b.attempts, 1)
+	for {
+		current := atomic.LoadInt64(&b.balance)
+		next := current + b.deposit
+		if next > b.maxBalance {
+			next = b.maxBalance
+		}
+		if atomic.CompareAndSwapInt64(&b.balance, current, next) {
+			return
+		}
+	}
+}
+
+// tryWithdraw takes one retry token, returning false if the budget is exhausted
+func (b *retryBudget) tryWithdraw() bool {
+	for {
+		current := atomic.LoadInt64(&b.balance)
+		if current < retryTokenScale {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.balance, current, current-retryTokenScale) {
+			atomic.AddInt64(&b.retries, 1)
+			return true
+		}
+	}
+}
+
+// stats returns the number of requests and granted failovers seen so far
+func (b *retryBudget) stats() (attempts, retries int64) {
+	return atomic.LoadInt64(&b.attempts), atomic.LoadInt64(&b.retries)
+}
@@ -0,0 +1,231 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestRetryBudgetTokens tests deposit and withdrawal accounting
+func TestRetryBudgetTokens(t *testing.T) {
+	budget := newRetryBudget(&RetryBudget{Percent: 20})
+
+	// No reserve, so the first failovers must be earned
+	if budget.tryWithdraw() {
+		t.Fatal("Expected empty budget to refuse withdrawal")
+	}
+
+	// Five requests at 20% earn exactly one token
+	for i := 0; i < 5; i++ {
+		budget.recordAttempt()
+	}
+	if !budget.tryWithdraw() {
+		t.Fatal("Expected one token after five attempts")
+	}
+	if budget.tryWithdraw() {
+		t.Fatal("Expected budget to be exhausted after one withdrawal")
+	}
+
+	attempts, retries := budget.stats()
+	if attempts != 5 || retries != 1 {
+		t.Errorf("Expected 5 attempts and 1 retry, got %d and %d", attempts, retries)
+	}
+}
+
+// TestRetryBudgetReserveAndCap tests the min_retries reserve and balance cap
+func TestRetryBudgetReserveAndCap(t *testing.T) {
+	budget := newRetryBudget(&RetryBudget{Percent: 50, MinRetries: 2})
+
+	// Reserve is available immediately
+	if !budget.tryWithdraw() || !budget.tryWithdraw() {
+		t.Fatal("Expected reserve of two failovers")
+	}
+	if budget.tryWithdraw() {
+		t.Fatal("Expected reserve to be spent")
+	}
+
+	// Many attempts can't bank more than the window allows
+	for i := 0; i < retryBudgetWindow*10; i++ {
+		budget.recordAttempt()
+	}
+	granted := 0
+	for budget.tryWithdraw() {
+		granted++
+	}
+	expected := 2 + retryBudgetWindow/2
+	if granted != expected {
+		t.Errorf("Expected balance capped at %d tokens, got %d", expected, granted)
+	}
+}
+
+// TestRetryBudgetThrottlesFailover tests that failover stops once the budget is spent under load
+func TestRetryBudgetThrottlesFailover(t *testing.T) {
+	var primaryHits, secondaryHits int64
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&primaryHits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("primary down"))
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&secondaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	// A tiny fail duration keeps the primary in rotation so every request
+	// attempts it first and needs the budget to fail over
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL},
+		WithFailDuration(time.Nanosecond),
+		func(fp *FailoverProxy) {
+			fp.RetryBudget = &RetryBudget{Percent: 20}
+		})
+
+	const requests = 100
+	var failedOver, rejected int64
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "http://example.com/test", nil)
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, req, nil); err != nil {
+				t.Errorf("ServeHTTP error: %v", err)
+			}
+			switch w.Code {
+			case http.StatusOK:
+				atomic.AddInt64(&failedOver, 1)
+			case http.StatusInternalServerError:
+				// Once the budget is spent the primary's own error is returned
+				if body := w.Body.String(); body != "primary down" {
+					t.Errorf("Expected the primary's error body, got %q", body)
+				}
+				atomic.AddInt64(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if primaryHits != requests {
+		t.Errorf("Expected primary to see all %d requests, got %d", requests, primaryHits)
+	}
+	if failedOver == 0 {
+		t.Error("Expected some requests to fail over within the budget")
+	}
+	if failedOver > requests*20/100 {
+		t.Errorf("Expected at most %d failovers, got %d", requests*20/100, failedOver)
+	}
+	if secondaryHits != failedOver {
+		t.Errorf("Expected secondary hits (%d) to match failovers (%d)", secondaryHits, failedOver)
+	}
+	if failedOver+rejected != requests {
+		t.Errorf("Expected every request to be answered, got %d ok and %d rejected", failedOver, rejected)
+	}
+}
+
+// TestRetryBudgetLimitsRetries tests that same-upstream retries draw from the budget
+func TestRetryBudgetLimitsRetries(t *testing.T) {
+	var primaryHits, secondaryHits int64
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&primaryHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&secondaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	// One request deposits a tenth of a token, which can't pay for a retry
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.Retries = 3
+		fp.RetryBackoff = caddy.Duration(time.Millisecond)
+		fp.RetryBudget = &RetryBudget{Percent: 10}
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if primaryHits != 1 {
+		t.Errorf("Expected a single attempt at the primary, got %d", primaryHits)
+	}
+	if secondaryHits != 0 {
+		t.Errorf("Expected no failover with an empty budget, got %d", secondaryHits)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the primary's status, got %d", w.Code)
+	}
+}
+
+// TestParseRetryBudget tests parsing of the retry_budget subdirective
+func TestParseRetryBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantErr    bool
+		percent    float64
+		minRetries int
+	}{
+		{
+			name: "percent only",
+			input: `failover_proxy http://a http://b {
+				retry_budget 20%
+			}`,
+			percent: 20,
+		},
+		{
+			name: "percent and min retries",
+			input: `failover_proxy http://a http://b {
+				retry_budget 10 5
+			}`,
+			percent:    10,
+			minRetries: 5,
+		},
+		{
+			name: "invalid percent",
+			input: `failover_proxy http://a http://b {
+				retry_budget lots
+			}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(tt.input)}
+			handler, err := parseFailoverProxy(h)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			fp := handler.(*FailoverProxy)
+			if fp.RetryBudget == nil {
+				t.Fatal("Expected retry budget to be set")
+			}
+			if fp.RetryBudget.Percent != tt.percent || fp.RetryBudget.MinRetries != tt.minRetries {
+				t.Errorf("Expected %v%%/%d, got %v%%/%d", tt.percent, tt.minRetries,
+					fp.RetryBudget.Percent, fp.RetryBudget.MinRetries)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package failover
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// flakyServer fails its first request, by resetting the connection or with a
+// 503, and succeeds afterwards
+func flakyServer(reset bool) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			if reset {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, &hits
+}
+
+// TestRetriesSameUpstream tests that a flaky upstream is retried instead of failed over
+func TestRetriesSameUpstream(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		reset bool
+	}{{"connection reset", true}, {"status error", false}} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary, primaryHits := flakyServer(tc.reset)
+			defer primary.Close()
+
+			var backupHits int32
+			backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&backupHits, 1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer backup.Close()
+
+			fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+				fp.Retries = 2
+				fp.RetryBackoff = caddy.Duration(10 * time.Millisecond)
+			})
+
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+				t.Fatalf("ServeHTTP error: %v", err)
+			}
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", w.Code)
+			}
+			if got := atomic.LoadInt32(primaryHits); got != 2 {
+				t.Errorf("Expected primary to be tried twice, got %d", got)
+			}
+			if got := atomic.LoadInt32(&backupHits); got != 0 {
+				t.Errorf("Expected no failover to backup, got %d hits", got)
+			}
+
+			fp.mu.RLock()
+			_, failed := fp.failureCache[primary.URL]
+			fp.mu.RUnlock()
+			if failed {
+				t.Error("Expected a successful retry not to record a failure")
+			}
+		})
+	}
+}
+
+// TestNoFailoverAfterResponseStarted tests that an upstream dying mid-body
+// ends the request instead of sending a second response from the next upstream
+func TestNoFailoverAfterResponseStarted(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer primary.Close()
+
+	var secondaryHits int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryHits, 1)
+		_, _ = w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL})
+
+	w := httptest.NewRecorder()
+	err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil)
+	if !errors.Is(err, errResponseStarted) {
+		t.Errorf("Expected the body copy error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&secondaryHits); got != 0 {
+		t.Errorf("Expected the secondary not to be contacted, got %d hits", got)
+	}
+	if body := w.Body.String(); body != "partial" {
+		t.Errorf("Expected only the primary's partial body, got %q", body)
+	}
+}
+
+// TestRetriesSkipNonIdempotent tests that POSTs fail over without retrying unless retry_all_methods is set
+func TestRetriesSkipNonIdempotent(t *testing.T) {
+	for _, retryAll := range []bool{false, true} {
+		primary, primaryHits := flakyServer(false)
+		defer primary.Close()
+
+		var backupHits int32
+		backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&backupHits, 1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer backup.Close()
+
+		fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+			fp.Retries = 2
+			fp.RetryBackoff = caddy.Duration(time.Millisecond)
+			fp.RetryAllMethods = retryAll
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://example.com/", nil)
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+
+		wantPrimary, wantBackup := int32(1), int32(1)
+		if retryAll {
+			wantPrimary, wantBackup = 2, 0
+		}
+		if got := atomic.LoadInt32(primaryHits); got != wantPrimary {
+			t.Errorf("retry_all_methods=%v: expected %d primary attempts, got %d", retryAll, wantPrimary, got)
+		}
+		if got := atomic.LoadInt32(&backupHits); got != wantBackup {
+			t.Errorf("retry_all_methods=%v: expected %d backup hits, got %d", retryAll, wantBackup, got)
+		}
+	}
+}
+
+// TestRetriesSkipUnbufferedBody tests that a body consumed by the first attempt isn't retried
+func TestRetriesSkipUnbufferedBody(t *testing.T) {
+	primary, primaryHits := flakyServer(false)
+	defer primary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL}, func(fp *FailoverProxy) {
+		fp.Retries = 2
+		fp.RetryBackoff = caddy.Duration(time.Millisecond)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "http://example.com/", strings.NewReader("payload"))
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if got := atomic.LoadInt32(primaryHits); got != 1 {
+		t.Errorf("Expected no retry of an unbuffered body, got %d attempts", got)
+	}
+}
+
+// TestRetryBackoffIsExponential tests that the delay doubles between retries
+func TestRetryBackoffIsExponential(t *testing.T) {
+	var hits int32
+	var times []time.Time
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		times = append(times, time.Now())
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.Retries = 2
+		fp.RetryBackoff = caddy.Duration(40 * time.Millisecond)
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if hits != 3 {
+		t.Fatalf("Expected 1 attempt plus 2 retries, got %d", hits)
+	}
+	if first, second := times[1].Sub(times[0]), times[2].Sub(times[1]); first < 40*time.Millisecond || second < 80*time.Millisecond {
+		t.Errorf("Expected backoff of at least 40ms then 80ms, got %v then %v", first, second)
+	}
+}
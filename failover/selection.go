@@ -0,0 +1,198 @@
+package failover
+
+import (
+	"math/rand"
+)
+
+// Load-balancing policies choose which upstream a request tries first; the
+// rest follow in declared order so failover is unchanged
+const (
+	lbPolicyFirst      = "first"       // always start at the first upstream
+	lbPolicyRoundRobin = "round_robin" // rotate the starting upstream per request
+	lbPolicyRandom     = "random"      // start at a random upstream
+)
+
+// adaptiveMinWeightRatio is the smallest share of the fastest upstream's weight
+// that any healthy upstream receives, so slow upstreams aren't starved entirely
+const adaptiveMinWeightRatio = 0.1
+
+// upstreamOrder returns the upstreams in the order they should be tried for a
+// request: the declared upstreams, then any targets resolved from SRV records
+func (f *FailoverProxy) upstreamOrder() []string {
+	f.mu.RLock()
+	upstreams := f.Upstreams
+	targets := f.srvTargets
+	f.mu.RUnlock()
+
+	order := f.declaredOrder(upstreams)
+	if len(targets) == 0 {
+		return order
+	}
+	return append(order[:len(order):len(order)], targets...)
+}
+
+// declaredOrder returns the declared upstreams in load-balancing policy order
+func (f *FailoverProxy) declaredOrder(upstreams []string) []string {
+	if len(upstreams) < 2 {
+		return upstreams
+	}
+
+	if f.AdaptiveWeights {
+		f.mu.RLock()
+		weights := f.adaptiveWeights(upstreams)
+		f.mu.RUnlock()
+		return rotateUpstreams(upstreams, pickWeighted(weights))
+	}
+
+	weights := f.configuredWeights(upstreams)
+	switch f.LBPolicy {
+	case lbPolicyRoundRobin:
+		next := f.roundRobin.Add(1) - 1
+		if weights != nil {
+			return rotateUpstreams(upstreams, weightedSlot(weights, next))
+		}
+		return rotateUpstreams(upstreams, int(next%uint64(len(upstreams))))
+	case lbPolicyRandom:
+		if weights != nil {
+			return rotateUpstreams(upstreams, pickWeighted(weights))
+		}
+		return rotateUpstreams(upstreams, rand.Intn(len(upstreams)))
+	default:
+		if f.ActiveSelection == activeSelectionSuccessRate {
+			return f.activeFirst(upstreams)
+		}
+		return upstreams
+	}
+}
+
+// activeFirst returns the declared upstreams starting at the active upstream
+func (f *FailoverProxy) activeFirst(upstreams []string) []string {
+	f.mu.RLock()
+	active := ""
+	if f.activeUpstream != nil {
+		active = f.activeUpstream.URL
+	}
+	f.mu.RUnlock()
+
+	for i, upstream := range upstreams {
+		if upstream == active {
+			return rotateUpstreams(upstreams, i)
+		}
+	}
+	return upstreams
+}
+
+// configuredWeights returns each upstream's weight from UpstreamWeights, with
+// 1 for upstreams without one, or nil when no positive weight is configured
+func (f *FailoverProxy) configuredWeights(upstreams []string) []float64 {
+	if len(f.UpstreamWeights) == 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(upstreams))
+	weighted := false
+	for i, upstream := range upstreams {
+		weight, ok := f.UpstreamWeights[upstream]
+		if !ok {
+			weight = 1
+		} else if weight > 0 {
+			weighted = true
+		}
+		weights[i] = float64(weight)
+	}
+	if !weighted {
+		return nil
+	}
+	return weights
+}
+
+// weightedSlot maps the n-th request onto an upstream index so that over each
+// cycle of sum(weights) requests every upstream starts exactly weight times
+func weightedSlot(weights []float64, n uint64) int {
+	var total uint64
+	for _, w := range weights {
+		total += uint64(w)
+	}
+	slot := n % total
+	for i, w := range weights {
+		if slot < uint64(w) {
+			return i
+		}
+		slot -= uint64(w)
+	}
+	return len(weights) - 1
+}
+
+// adaptiveWeights returns selection weights inversely proportional to each
+// upstream's last health check response time. Upstreams without a measurement
+// get the average weight. Must be called with lock held.
+func (f *FailoverProxy) adaptiveWeights(upstreams []string) []float64 {
+	weights := make([]float64, len(upstreams))
+	var known, total, highest float64
+	for i, upstream := range upstreams {
+		ms, ok := f.responseTime[upstream]
+		if !ok {
+			continue
+		}
+		if ms < 1 {
+			ms = 1
+		}
+		weights[i] = 1 / float64(ms)
+		known++
+		total += weights[i]
+		if weights[i] > highest {
+			highest = weights[i]
+		}
+	}
+
+	// Without any latency data every upstream is weighted equally
+	if known == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		return weights
+	}
+
+	average := total / known
+	floor := highest * adaptiveMinWeightRatio
+	for i, upstream := range upstreams {
+		if _, ok := f.responseTime[upstream]; !ok {
+			weights[i] = average
+		}
+		if weights[i] < floor {
+			weights[i] = floor
+		}
+	}
+	return weights
+}
+
+// pickWeighted returns a random index chosen in proportion to the weights
+func pickWeighted(weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	target := rand.Float64() * total
+	for i, w := range weights {
+		target -= w
+		if target < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// rotateUpstreams returns the upstreams starting at index start, wrapping around
+// so the remaining upstreams are still available for failover in declared order
+func rotateUpstreams(upstreams []string, start int) []string {
+	if start <= 0 || start >= len(upstreams) {
+		return upstreams
+	}
+	order := make([]string, 0, len(upstreams))
+	order = append(order, upstreams[start:]...)
+	return append(order, upstreams[:start]...)
+}
@@ -0,0 +1,243 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestAdaptiveWeightsFavorFasterUpstream tests that the faster upstream gets proportionally more traffic
+func TestAdaptiveWeightsFavorFasterUpstream(t *testing.T) {
+	var fastHits, slowHits int32
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fastHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	fp := CreateTestProxy(t, []string{slow.URL, fast.URL}, func(fp *FailoverProxy) {
+		fp.AdaptiveWeights = true
+	})
+
+	// Seed divergent latencies as health checks would: fast is 4x quicker
+	fp.mu.Lock()
+	fp.responseTime[slow.URL] = 40
+	fp.responseTime[fast.URL] = 10
+	fp.mu.Unlock()
+
+	const requests = 1000
+	for i := 0; i < requests; i++ {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	}
+
+	fastShare := float64(fastHits) / requests
+	if fastShare < 0.7 || fastShare > 0.9 {
+		t.Errorf("Expected fast upstream to get ~80%% of traffic, got %.1f%% (fast=%d slow=%d)",
+			fastShare*100, fastHits, slowHits)
+	}
+	if slowHits == 0 {
+		t.Error("Expected slow upstream to still receive some traffic")
+	}
+}
+
+// TestAdaptiveWeightsClampAndDefaults tests weight clamping and upstreams without latency data
+func TestAdaptiveWeightsClampAndDefaults(t *testing.T) {
+	fp := &FailoverProxy{
+		Upstreams:    []string{"http://fast", "http://glacial", "http://unknown"},
+		responseTime: map[string]int64{"http://fast": 1, "http://glacial": 10000},
+	}
+
+	weights := fp.adaptiveWeights(fp.Upstreams)
+
+	if weights[1] != weights[0]*adaptiveMinWeightRatio {
+		t.Errorf("Expected glacial upstream clamped to %v, got %v", weights[0]*adaptiveMinWeightRatio, weights[1])
+	}
+	expectedAverage := (1.0 + 1.0/10000) / 2
+	if weights[2] != expectedAverage {
+		t.Errorf("Expected unknown upstream to get the average weight %v, got %v", expectedAverage, weights[2])
+	}
+
+	// Without any measurements all upstreams are equal
+	fp.responseTime = map[string]int64{}
+	for i, w := range fp.adaptiveWeights(fp.Upstreams) {
+		if w != 1 {
+			t.Errorf("Expected equal weight for upstream %d, got %v", i, w)
+		}
+	}
+}
+
+// TestRotateUpstreams tests that rotation keeps every upstream available for failover
+func TestRotateUpstreams(t *testing.T) {
+	upstreams := []string{"a", "b", "c"}
+	got := rotateUpstreams(upstreams, 1)
+	expected := []string{"b", "c", "a"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	}
+	if rotateUpstreams(upstreams, 0)[0] != "a" {
+		t.Error("Expected start 0 to keep declared order")
+	}
+}
+
+// TestRoundRobinDistribution tests that round_robin spreads requests evenly across healthy upstreams
+func TestRoundRobinDistribution(t *testing.T) {
+	hits := make([]int32, 3)
+	upstreams := make([]string, len(hits))
+	for i := range hits {
+		hit := &hits[i]
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(hit, 1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		upstreams[i] = server.URL
+	}
+
+	fp := CreateTestProxy(t, upstreams, func(fp *FailoverProxy) {
+		fp.LBPolicy = lbPolicyRoundRobin
+	})
+
+	const requests = 300
+	for i := 0; i < requests; i++ {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	}
+
+	for i := range hits {
+		if got := atomic.LoadInt32(&hits[i]); got != requests/3 {
+			t.Errorf("Expected upstream %d to get %d requests, got %d", i, requests/3, got)
+		}
+	}
+
+	// A failed upstream is still skipped, its turns going to the next in order
+	fp.mu.Lock()
+	fp.failureCache[upstreams[1]] = time.Now()
+	fp.mu.Unlock()
+	for i := range hits {
+		atomic.StoreInt32(&hits[i], 0)
+	}
+
+	for i := 0; i < requests; i++ {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&hits[1]); got != 0 {
+		t.Errorf("Expected failed upstream to be skipped, got %d requests", got)
+	}
+	if got := atomic.LoadInt32(&hits[0]) + atomic.LoadInt32(&hits[2]); got != requests {
+		t.Errorf("Expected all %d requests served by the remaining upstreams, got %d", requests, got)
+	}
+}
+
+// TestParseLBPolicy tests parsing of the lb_policy subdirective
+func TestParseLBPolicy(t *testing.T) {
+	for _, policy := range []string{"first", "round_robin", "random"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a http://b {\n lb_policy " + policy + "\n}")}
+		handler, err := parseFailoverProxy(h)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", policy, err)
+		}
+		if got := handler.(*FailoverProxy).LBPolicy; got != policy {
+			t.Errorf("Expected %s, got %s", policy, got)
+		}
+	}
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+		"failover_proxy http://a {\n lb_policy least_conn\n}")}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+}
+
+// TestWeightedSelection tests that a 3:1 weight produces a 3:1 split under both policies
+func TestWeightedSelection(t *testing.T) {
+	for _, policy := range []string{lbPolicyRoundRobin, lbPolicyRandom} {
+		t.Run(policy, func(t *testing.T) {
+			var heavyHits, lightHits int32
+			heavy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&heavyHits, 1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer heavy.Close()
+
+			light := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&lightHits, 1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer light.Close()
+
+			fp := CreateTestProxy(t, []string{light.URL, heavy.URL}, func(fp *FailoverProxy) {
+				fp.LBPolicy = policy
+				fp.UpstreamWeights = map[string]int{heavy.URL: 3, light.URL: 1}
+			})
+
+			const requests = 2000
+			for i := 0; i < requests; i++ {
+				w := httptest.NewRecorder()
+				if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+					t.Fatalf("ServeHTTP error: %v", err)
+				}
+			}
+
+			heavyShare := float64(heavyHits) / requests
+			if heavyShare < 0.7 || heavyShare > 0.8 {
+				t.Errorf("Expected heavy upstream to get ~75%% of traffic, got %.1f%% (heavy=%d light=%d)",
+					heavyShare*100, heavyHits, lightHits)
+			}
+		})
+	}
+}
+
+// TestConfiguredWeightsDefaults tests that missing and all-zero weights fall back to unweighted selection
+func TestConfiguredWeightsDefaults(t *testing.T) {
+	fp := &FailoverProxy{Upstreams: []string{"http://a", "http://b", "http://c"}}
+	if fp.configuredWeights(fp.Upstreams) != nil {
+		t.Error("Expected no weights when none are configured")
+	}
+
+	fp.UpstreamWeights = map[string]int{"http://a": 0, "http://b": 0}
+	if fp.configuredWeights(fp.Upstreams) != nil {
+		t.Error("Expected all-zero weights to behave as unweighted")
+	}
+
+	fp.UpstreamWeights = map[string]int{"http://a": 2}
+	weights := fp.configuredWeights(fp.Upstreams)
+	expected := []float64{2, 1, 1}
+	for i := range expected {
+		if weights[i] != expected[i] {
+			t.Fatalf("Expected weights %v, got %v", expected, weights)
+		}
+	}
+
+	// Round robin visits each upstream weight times per cycle
+	counts := make([]int, 3)
+	for n := uint64(0); n < 8; n++ {
+		counts[weightedSlot(weights, n)]++
+	}
+	if counts[0] != 4 || counts[1] != 2 || counts[2] != 2 {
+		t.Errorf("Expected 4/2/2 starts over two cycles, got %v", counts)
+	}
+}
@@ -0,0 +1,54 @@
+package failover
+
+import (
+	"net/http"
+)
+
+// SizeRoute sends requests with large bodies to an upstream with more capacity
+// first; smaller requests use the normal selection order
+type SizeRoute struct {
+	// Threshold is the Content-Length above which a request counts as large
+	Threshold int64 `json:"threshold,omitempty"`
+
+	// Large is the upstream URL preferred for large requests; it must be one
+	// of the proxy's upstreams
+	Large string `json:"large,omitempty"`
+}
+
+// isLarge reports whether the request body is over the threshold. Bodies of
+// unknown length may be arbitrarily large, so they count as large too.
+func (s *SizeRoute) isLarge(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	return isChunked(r) || r.ContentLength > s.Threshold
+}
+
+// requestOrder returns the upstreams in the order they should be tried for
+// this request: the sticky upstream first for requests with a session key,
+// upstreams warming up after a recovery last outside their share, the canary
+// first for its share of requests, and the size_route upstream first for
+// large bodies
+func (f *FailoverProxy) requestOrder(r *http.Request) []string {
+	order := f.slowStartOrder(f.stickyOrder(r, f.upstreamOrder()))
+	if f.Canary != nil && f.Canary.picked() {
+		order = preferUpstream(order, f.Canary.Upstream)
+	}
+	if f.SizeRoute != nil && f.SizeRoute.isLarge(r) {
+		return preferUpstream(order, f.SizeRoute.Large)
+	}
+	return order
+}
+
+// preferUpstream moves the preferred upstream to the front, keeping the
+// others in their existing order for failover
+func preferUpstream(upstreams []string, preferred string) []string {
+	order := make([]string, 0, len(upstreams))
+	order = append(order, preferred)
+	for _, upstream := range upstreams {
+		if upstream != preferred {
+			order = append(order, upstream)
+		}
+	}
+	return order
+}
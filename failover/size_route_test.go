@@ -0,0 +1,98 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestSizeRoutePrefersLargeUpstream tests that large bodies go to the size_route upstream first
+func TestSizeRoutePrefersLargeUpstream(t *testing.T) {
+	var smallHits, largeHits int32
+	small := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&smallHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer small.Close()
+
+	large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&largeHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer large.Close()
+
+	fp := CreateTestProxy(t, []string{small.URL, large.URL}, func(fp *FailoverProxy) {
+		fp.SizeRoute = &SizeRoute{Threshold: 1024, Large: large.URL}
+	})
+
+	serve := func(req *http.Request) {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	serve(httptest.NewRequest("POST", "http://example.com/upload", strings.NewReader(strings.Repeat("x", 4096))))
+	if atomic.LoadInt32(&largeHits) != 1 || atomic.LoadInt32(&smallHits) != 0 {
+		t.Errorf("Expected large body to go to the large upstream, got small=%d large=%d", smallHits, largeHits)
+	}
+
+	serve(httptest.NewRequest("POST", "http://example.com/upload", strings.NewReader("small")))
+	serve(httptest.NewRequest("GET", "http://example.com/", nil))
+	if atomic.LoadInt32(&smallHits) != 2 {
+		t.Errorf("Expected small requests to use the normal order, got %d hits on the first upstream", smallHits)
+	}
+
+	serve(newChunkedRequest("unknown length"))
+	if atomic.LoadInt32(&largeHits) != 2 {
+		t.Errorf("Expected a chunked body to be treated as large, got %d hits on the large upstream", largeHits)
+	}
+}
+
+// TestSizeRouteUnknownUpstream tests that the large upstream must be in the upstream list
+func TestSizeRouteUnknownUpstream(t *testing.T) {
+	fp := &FailoverProxy{
+		Upstreams: []string{"http://a", "http://b"},
+		SizeRoute: &SizeRoute{Threshold: 1024, Large: "http://c"},
+	}
+	if err := fp.Provision(caddy.Context{}); err == nil {
+		fp.Cleanup()
+		t.Fatal("Expected error for a size_route upstream outside the list")
+	}
+}
+
+// TestPreferUpstream tests reordering with a preferred upstream
+func TestPreferUpstream(t *testing.T) {
+	got := preferUpstream([]string{"a", "b", "c"}, "c")
+	if strings.Join(got, ",") != "c,a,b" {
+		t.Errorf("Expected c,a,b, got %v", got)
+	}
+}
+
+// TestParseSizeRoute tests parsing the size_route block
+func TestParseSizeRoute(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		size_route {
+			threshold 10MB
+			large http://b
+		}
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	route := handler.(*FailoverProxy).SizeRoute
+	if route == nil || route.Threshold != 10<<20 || route.Large != "http://b" {
+		t.Errorf("Unexpected size route: %+v", route)
+	}
+}
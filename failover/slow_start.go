@@ -0,0 +1,46 @@
+package failover
+
+import (
+	"math/rand"
+	"time"
+)
+
+// warmupShare returns the share of requests, from 0 to 1, a recovered
+// upstream receives first: rising linearly from 0 at recovery to 1 once
+// SlowStart has passed. Must be called with lock held.
+func (f *FailoverProxy) warmupShare(upstreamURL string, now time.Time) float64 {
+	recovered, ok := f.recoveredAt[upstreamURL]
+	if !ok || f.SlowStart <= 0 {
+		return 1
+	}
+	elapsed := now.Sub(recovered)
+	if elapsed >= time.Duration(f.SlowStart) {
+		return 1
+	}
+	return float64(elapsed) / float64(f.SlowStart)
+}
+
+// slowStartOrder moves upstreams still warming up after a recovery behind
+// the others for the requests outside their share, so those requests go to
+// the next healthy upstream while the warming one remains for failover
+func (f *FailoverProxy) slowStartOrder(upstreams []string) []string {
+	if f.SlowStart <= 0 {
+		return upstreams
+	}
+
+	now := time.Now()
+	var order, deferred []string
+	f.mu.RLock()
+	for _, upstream := range upstreams {
+		if share := f.warmupShare(upstream, now); share < 1 && rand.Float64() >= share {
+			deferred = append(deferred, upstream)
+		} else {
+			order = append(order, upstream)
+		}
+	}
+	f.mu.RUnlock()
+	if len(deferred) == 0 {
+		return upstreams
+	}
+	return append(order, deferred...)
+}
@@ -0,0 +1,122 @@
+package failover
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestSlowStart tests that a recovered primary's share of requests ramps up
+// over the slow_start window instead of jumping straight to 100%
+func TestSlowStart(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL}, func(fp *FailoverProxy) {
+		fp.SlowStart = caddy.Duration(time.Hour)
+	})
+
+	// Share of 1000 requests served by the primary
+	primaryShare := func() float64 {
+		served := 0
+		for i := 0; i < 1000; i++ {
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if body, _ := io.ReadAll(w.Result().Body); string(body) == "primary" {
+				served++
+			}
+		}
+		return float64(served) / 1000
+	}
+	recoveredAgo := func(ago time.Duration) {
+		fp.mu.Lock()
+		fp.recoveredAt[primary.URL] = time.Now().Add(-ago)
+		fp.mu.Unlock()
+	}
+
+	// The first healthy result isn't a recovery
+	fp.setHealthStatus(primary.URL, true)
+	if share := primaryShare(); share != 1 {
+		t.Fatalf("Expected the primary to serve everything before any recovery, got %.2f", share)
+	}
+
+	fp.setHealthStatus(primary.URL, false)
+	fp.setHealthStatus(primary.URL, true)
+	if share := primaryShare(); share > 0.05 {
+		t.Errorf("Expected almost no requests right after recovery, got %.2f", share)
+	}
+
+	recoveredAgo(15 * time.Minute)
+	if share := primaryShare(); share < 0.18 || share > 0.32 {
+		t.Errorf("Expected about 25%% a quarter into the window, got %.2f", share)
+	}
+
+	recoveredAgo(45 * time.Minute)
+	if share := primaryShare(); share < 0.68 || share > 0.82 {
+		t.Errorf("Expected about 75%% three quarters into the window, got %.2f", share)
+	}
+
+	recoveredAgo(2 * time.Hour)
+	if share := primaryShare(); share != 1 {
+		t.Errorf("Expected full traffic after the window, got %.2f", share)
+	}
+}
+
+// TestSlowStartFailover tests that a warming upstream still serves requests
+// the other upstreams fail
+func TestSlowStartFailover(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	down := newDownUpstreams(t, 1)[0]
+
+	fp := CreateTestProxy(t, []string{primary.URL, down}, func(fp *FailoverProxy) {
+		fp.SlowStart = caddy.Duration(time.Hour)
+	})
+	fp.setHealthStatus(primary.URL, false)
+	fp.setHealthStatus(primary.URL, true)
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	if body, _ := io.ReadAll(w.Result().Body); string(body) != "primary" {
+		t.Errorf("Expected failover to the warming primary, got %d %q", w.Code, body)
+	}
+}
+
+// TestParseSlowStart tests parsing the slow_start option
+func TestParseSlowStart(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a.local {
+		slow_start 30s
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).SlowStart; got != caddy.Duration(30*time.Second) {
+		t.Errorf("Expected 30s, got %v", time.Duration(got))
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a.local {
+		slow_start soon
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for an invalid duration")
+	}
+}
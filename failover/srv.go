@@ -0,0 +1,218 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// srvLookupTimeout bounds each SRV resolution
+const srvLookupTimeout = 5 * time.Second
+
+// srvResolver looks up SRV records, satisfied by *net.Resolver
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SRVUpstream is an SRV record, such as _http._tcp.api.service.consul, whose
+// targets are added to the rotation after the declared upstreams. The record
+// is re-resolved periodically; targets that disappear are dropped.
+type SRVUpstream struct {
+	// Name is the full SRV record name
+	Name string `json:"name"`
+
+	// Scheme is used to build each target's upstream URL (default http)
+	Scheme string `json:"scheme,omitempty"`
+
+	// Refresh is how often the record is re-resolved (default 30s)
+	Refresh caddy.Duration `json:"refresh,omitempty"`
+
+	healthCheck *HealthCheck // health_check declared for Name, copied for every target
+	targets     []string     // upstream URLs from the last successful resolution
+}
+
+// provisionSRV sets SRV defaults and takes each health_check declared for an
+// SRV name out of HealthChecks, to be used as the template for its targets
+func (f *FailoverProxy) provisionSRV() error {
+	if f.srvResolver == nil {
+		f.srvResolver = net.DefaultResolver
+	}
+	for _, srv := range f.SRVUpstreams {
+		srv.Name = f.replacer.ReplaceAll(srv.Name, "")
+		switch srv.Scheme {
+		case "":
+			srv.Scheme = "http"
+		case "http", "https":
+		default:
+			return fmt.Errorf("invalid srv scheme for %s: %s (expected http or https)", srv.Name, srv.Scheme)
+		}
+		if srv.Refresh == 0 {
+			srv.Refresh = caddy.Duration(30 * time.Second)
+		}
+
+		if hc, ok := f.HealthChecks[srv.Name]; ok {
+			delete(f.HealthChecks, srv.Name)
+			srv.healthCheck = hc
+		}
+	}
+	return nil
+}
+
+// startSRV resolves every SRV upstream once, then keeps them refreshed until shutdown
+func (f *FailoverProxy) startSRV(tlsConfig *tls.Config) {
+	for _, srv := range f.SRVUpstreams {
+		if srv.healthCheck != nil && srv.healthCheck.HTTPVersion != "" {
+			srv.healthCheck.client = f.newHealthCheckClient(srv.healthCheck.HTTPVersion, srv.Scheme == "https", tlsConfig)
+		}
+		f.refreshSRV(srv)
+
+		f.wg.Add(1)
+		go f.runSRVRefresh(srv)
+	}
+}
+
+// runSRVRefresh re-resolves an SRV upstream on its refresh interval
+func (f *FailoverProxy) runSRVRefresh(srv *SRVUpstream) {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(srv.Refresh))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.refreshSRV(srv)
+		case <-f.shutdown:
+			return
+		}
+	}
+}
+
+// refreshSRV resolves an SRV upstream and updates the rotation. A failed
+// lookup keeps the previous targets, so a DNS outage doesn't empty the pool.
+func (f *FailoverProxy) refreshSRV(srv *SRVUpstream) {
+	ctx, cancel := context.WithTimeout(context.Background(), srvLookupTimeout)
+	defer cancel()
+
+	_, records, err := f.srvResolver.LookupSRV(ctx, "", "", srv.Name)
+	if err != nil {
+		f.logger.Warn("SRV lookup failed, keeping previous targets",
+			zap.String("name", srv.Name),
+			zap.Error(err))
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.shuttingDown() {
+		return
+	}
+	srv.targets = srvTargetURLs(srv.Scheme, records)
+	f.updateSRVTargets()
+}
+
+// srvTargetURLs turns SRV records into upstream URLs, ordered by priority and
+// then by descending weight
+func srvTargetURLs(scheme string, records []*net.SRV) []string {
+	sorted := make([]*net.SRV, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Weight > sorted[j].Weight
+	})
+
+	urls := make([]string, 0, len(sorted))
+	for _, record := range sorted {
+		host := strings.TrimSuffix(record.Target, ".")
+		urls = append(urls, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return urls
+}
+
+// updateSRVTargets rebuilds the SRV part of the rotation from every SRV
+// upstream's latest targets. New targets start health checks from their
+// record's template; removed targets have their checks stopped and their
+// state forgotten. Must be called with lock held.
+func (f *FailoverProxy) updateSRVTargets() {
+	declared := make(map[string]bool, len(f.Upstreams))
+	for _, upstream := range f.Upstreams {
+		declared[upstream] = true
+	}
+
+	var targets []string
+	templates := make(map[string]*HealthCheck)
+	for _, srv := range f.SRVUpstreams {
+		for _, target := range srv.targets {
+			if _, seen := templates[target]; seen || declared[target] {
+				continue
+			}
+			targets = append(targets, target)
+			templates[target] = srv.healthCheck
+		}
+	}
+
+	current := make(map[string]bool, len(f.srvTargets))
+	for _, target := range f.srvTargets {
+		current[target] = true
+		if _, kept := templates[target]; kept {
+			continue
+		}
+		f.logger.Info("SRV target removed",
+			zap.String("upstream", target))
+		if _, declaredCheck := f.declaredChecks[target]; !declaredCheck {
+			if hc, ok := f.HealthChecks[target]; ok && hc.stop != nil {
+				close(hc.stop)
+				delete(f.HealthChecks, target)
+			}
+		}
+		f.forgetUpstream(target)
+	}
+
+	for _, target := range targets {
+		if current[target] {
+			continue
+		}
+		f.logger.Info("SRV target added",
+			zap.String("upstream", target))
+		// A health_check declared for the target itself takes precedence
+		if _, declaredCheck := f.HealthChecks[target]; declaredCheck {
+			continue
+		}
+		if template := templates[target]; template != nil {
+			hc := *template
+			hc.stop = make(chan struct{})
+			f.HealthChecks[target] = &hc
+			f.wg.Add(1)
+			go f.runHealthCheck(target, &hc)
+		}
+	}
+
+	changed := !slices.Equal(targets, f.srvTargets)
+	f.srvTargets = targets
+	if changed {
+		f.notifyStatusChange()
+		f.checkActiveUpstreamChange()
+	}
+}
+
+// allUpstreams returns the declared upstreams followed by the current SRV
+// targets. Must be called with lock held.
+func (f *FailoverProxy) allUpstreams() []string {
+	if len(f.srvTargets) == 0 {
+		return f.Upstreams
+	}
+	all := make([]string, 0, len(f.Upstreams)+len(f.srvTargets))
+	all = append(all, f.Upstreams...)
+	return append(all, f.srvTargets...)
+}
@@ -0,0 +1,225 @@
+package failover
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// stubSRVResolver returns a settable set of SRV records
+type stubSRVResolver struct {
+	mu      sync.Mutex
+	records []*net.SRV
+}
+
+func (r *stubSRVResolver) set(records ...*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = records
+}
+
+func (r *stubSRVResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return "", r.records, nil
+}
+
+// newSRVTarget creates a server counting health probes, with the SRV record pointing at it
+func newSRVTarget(t *testing.T, priority uint16, probes *int32) (*httptest.Server, *net.SRV) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			atomic.AddInt32(probes, 1)
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return server, &net.SRV{Target: u.Hostname() + ".", Port: uint16(port), Priority: priority}
+}
+
+// TestSRVUpstreams tests that SRV targets are added, probed, and dropped when they disappear
+func TestSRVUpstreams(t *testing.T) {
+	var probesA, probesB int32
+	targetA, recordA := newSRVTarget(t, 10, &probesA)
+	targetB, recordB := newSRVTarget(t, 20, &probesB)
+
+	resolver := &stubSRVResolver{}
+	resolver.set(recordB, recordA)
+
+	const name = "_http._tcp.api.service.consul"
+	fp := CreateTestProxy(t, []string{"http://127.0.0.1:1"},
+		WithHealthCheck(name, &HealthCheck{Path: "/health", Interval: caddy.Duration(20 * time.Millisecond)}),
+		func(fp *FailoverProxy) {
+			fp.SRVUpstreams = []*SRVUpstream{{Name: name, Refresh: caddy.Duration(time.Hour)}}
+			fp.srvResolver = resolver
+		})
+
+	// Targets follow the declared upstream, in SRV priority order
+	if order := fp.upstreamOrder(); !slices.Equal(order, []string{"http://127.0.0.1:1", targetA.URL, targetB.URL}) {
+		t.Fatalf("Unexpected upstream order: %v", order)
+	}
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		return atomic.LoadInt32(&probesA) > 0 && atomic.LoadInt32(&probesB) > 0
+	}, "both SRV targets to be probed")
+
+	// Requests fail over from the unreachable declared upstream to the first target
+	req := httptest.NewRequest("GET", "http://example.com/api", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	// Target A disappears from the record
+	resolver.set(recordB)
+	fp.refreshSRV(fp.SRVUpstreams[0])
+
+	if order := fp.upstreamOrder(); !slices.Equal(order, []string{"http://127.0.0.1:1", targetB.URL}) {
+		t.Fatalf("Expected target A to be dropped, got %v", order)
+	}
+	for _, status := range fp.GetUpstreamStatus() {
+		if status.Host == targetA.URL {
+			t.Error("Expected dropped target to be gone from status")
+		}
+	}
+
+	// Its health checks stop, while B's continue
+	time.Sleep(30 * time.Millisecond)
+	stoppedAt := atomic.LoadInt32(&probesA)
+	continuedFrom := atomic.LoadInt32(&probesB)
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&probesA); got != stoppedAt {
+		t.Errorf("Expected no more probes of the dropped target, got %d after %d", got, stoppedAt)
+	}
+	if atomic.LoadInt32(&probesB) <= continuedFrom {
+		t.Error("Expected the remaining target to still be probed")
+	}
+}
+
+// TestSRVLookupFailureKeepsTargets tests that a failed refresh doesn't empty the pool
+func TestSRVLookupFailureKeepsTargets(t *testing.T) {
+	var probes int32
+	target, record := newSRVTarget(t, 0, &probes)
+
+	resolver := &stubSRVResolver{}
+	resolver.set(record)
+	fp := CreateTestProxy(t, []string{"http://127.0.0.1:1"}, func(fp *FailoverProxy) {
+		fp.SRVUpstreams = []*SRVUpstream{{Name: "_http._tcp.api.service.consul"}}
+		fp.srvResolver = resolver
+	})
+
+	fp.srvResolver = failingSRVResolver{}
+	fp.refreshSRV(fp.SRVUpstreams[0])
+
+	if order := fp.upstreamOrder(); !slices.Contains(order, target.URL) {
+		t.Errorf("Expected target to survive a failed lookup, got %v", order)
+	}
+}
+
+// failingSRVResolver fails every lookup
+type failingSRVResolver struct{}
+
+func (failingSRVResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "", nil, &net.DNSError{Err: "server misbehaving", Name: name}
+}
+
+// TestSRVTargetURLs tests building target URLs in priority and weight order
+func TestSRVTargetURLs(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c.example.com.", Port: 8080, Priority: 20, Weight: 5},
+		{Target: "a.example.com.", Port: 8443, Priority: 10, Weight: 1},
+		{Target: "b.example.com.", Port: 8443, Priority: 10, Weight: 9},
+	}
+	expected := []string{"https://b.example.com:8443", "https://a.example.com:8443", "https://c.example.com:8080"}
+	if got := srvTargetURLs("https", records); !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// TestParseSRV tests parsing the srv subdirective
+func TestParseSRV(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		srv _http._tcp.api.service.consul {
+			scheme https
+			refresh 10s
+		}
+		srv _http._tcp.web.service.consul
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	srvs := handler.(*FailoverProxy).SRVUpstreams
+	if len(srvs) != 2 {
+		t.Fatalf("Expected 2 SRV upstreams, got %d", len(srvs))
+	}
+	if srvs[0].Name != "_http._tcp.api.service.consul" || srvs[0].Scheme != "https" || srvs[0].Refresh != caddy.Duration(10*time.Second) {
+		t.Errorf("Unexpected first SRV upstream: %+v", srvs[0])
+	}
+	if srvs[1].Name != "_http._tcp.web.service.consul" || srvs[1].Scheme != "" {
+		t.Errorf("Unexpected second SRV upstream: %+v", srvs[1])
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		srv _http._tcp.api.service.consul {
+			scheme ftp
+		}
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for an unsupported scheme")
+	}
+}
+
+// TestUpstreamSRVProxied tests that targets discovered through upstream_srv
+// receive requests once the declared upstream fails
+func TestUpstreamSRVProxied(t *testing.T) {
+	var probes int32
+	target, record := newSRVTarget(t, 0, &probes)
+	resolver := &stubSRVResolver{}
+	resolver.set(record)
+
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://127.0.0.1:1 {
+		upstream_srv _http._tcp.api.service.consul {
+			refresh 1h
+		}
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	fp.srvResolver = resolver
+	if err := fp.Provision(caddy.Context{}); err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	t.Cleanup(func() { fp.Cleanup() })
+
+	if order := fp.upstreamOrder(); !slices.Equal(order, []string{"http://127.0.0.1:1", target.URL}) {
+		t.Fatalf("Expected the discovered target after the declared upstream, got %v", order)
+	}
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/api", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("Expected the discovered target to serve the request, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,31 @@
+package failover
+
+import (
+	"math/rand"
+	"time"
+)
+
+// randomJitter returns a random duration in [0, max)
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// waitStartupJitter delays an upstream's first health probe by this instance's
+// startup offset, so a fleet restarting together doesn't probe the same
+// upstreams in lockstep. It returns false if shutdown began while waiting.
+func (f *FailoverProxy) waitStartupJitter() bool {
+	if f.startupDelay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(f.startupDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-f.shutdown:
+		return false
+	}
+}
@@ -0,0 +1,85 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// TestStartupJitterDelaysFirstProbe tests that the initial probe waits for the instance's jitter offset
+func TestStartupJitterDelaysFirstProbe(t *testing.T) {
+	const jitter = 200 * time.Millisecond
+
+	probed := make(chan time.Time, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case probed <- time.Now():
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	fp := CreateTestProxy(t, []string{server.URL},
+		WithHealthCheck(server.URL, &HealthCheck{
+			Path:     "/health",
+			Interval: caddy.Duration(time.Minute),
+			Timeout:  caddy.Duration(time.Second),
+		}),
+		func(fp *FailoverProxy) {
+			fp.StartupJitter = caddy.Duration(jitter)
+		})
+
+	if fp.startupDelay < 0 || fp.startupDelay >= jitter {
+		t.Fatalf("Expected startup delay within [0, %v), got %v", jitter, fp.startupDelay)
+	}
+
+	select {
+	case at := <-probed:
+		elapsed := at.Sub(start)
+		if elapsed < fp.startupDelay {
+			t.Errorf("Expected first probe after %v, got %v", fp.startupDelay, elapsed)
+		}
+		if elapsed > jitter+time.Second {
+			t.Errorf("Expected first probe within the jitter range, got %v", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an initial probe")
+	}
+}
+
+// TestStartupJitterShutdown tests that shutdown doesn't wait out the jitter
+func TestStartupJitterShutdown(t *testing.T) {
+	fp := &FailoverProxy{startupDelay: time.Minute, shutdown: make(chan struct{})}
+
+	done := make(chan bool)
+	go func() {
+		done <- fp.waitStartupJitter()
+	}()
+	close(fp.shutdown)
+
+	select {
+	case proceeded := <-done:
+		if proceeded {
+			t.Error("Expected the wait to report shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown to interrupt the jitter wait")
+	}
+}
+
+// TestRandomJitter tests that jitter offsets stay within range
+func TestRandomJitter(t *testing.T) {
+	if got := randomJitter(0); got != 0 {
+		t.Errorf("Expected no jitter when disabled, got %v", got)
+	}
+	for i := 0; i < 1000; i++ {
+		if got := randomJitter(time.Second); got < 0 || got >= time.Second {
+			t.Fatalf("Expected jitter within [0, 1s), got %v", got)
+		}
+	}
+}
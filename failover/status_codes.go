@@ -0,0 +1,55 @@
+package failover
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseStatusCodes expands status codes and inclusive NNN-MMM ranges, e.g.
+// "500-599 429", into the individual codes
+func parseStatusCodes(specs []string) ([]int, error) {
+	var codes []int
+	for _, spec := range specs {
+		low, high, isRange := strings.Cut(spec, "-")
+		start, err := parseStatusCode(low)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseStatusCode(high); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid status code range: %s", spec)
+			}
+		}
+		for code := start; code <= end; code++ {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+// parseStatusCode parses a single HTTP status code
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("invalid status code: %s", s)
+	}
+	return code, nil
+}
+
+// isFailoverStatus reports whether an upstream response with this status is
+// treated as a failure, which is any 5xx unless failover_on is configured.
+// never_failover_status takes precedence over both.
+func (f *FailoverProxy) isFailoverStatus(status int) bool {
+	if f.neverFailover[status] {
+		return false
+	}
+	if f.failoverStatus == nil {
+		return status >= 500
+	}
+	return f.failoverStatus[status]
+}
@@ -0,0 +1,163 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// TestFailoverOnStatusCodes tests failing over on 429 while passing 404 straight through
+func TestFailoverOnStatusCodes(t *testing.T) {
+	var primaryStatus int32 = http.StatusTooManyRequests
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&primaryStatus)))
+	}))
+	defer primary.Close()
+
+	var backupHits int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	codes, err := parseStatusCodes([]string{"500-599", "429"})
+	if err != nil {
+		t.Fatalf("Failed to parse codes: %v", err)
+	}
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.FailoverStatusCodes = codes
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK || atomic.LoadInt32(&backupHits) != 1 {
+		t.Errorf("Expected 429 to fail over to backup, got status %d and %d backup hits", w.Code, backupHits)
+	}
+
+	atomic.StoreInt32(&primaryStatus, http.StatusNotFound)
+	fp.mu.Lock()
+	delete(fp.failureCache, primary.URL)
+	fp.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusNotFound || atomic.LoadInt32(&backupHits) != 1 {
+		t.Errorf("Expected 404 to pass through, got status %d and %d backup hits", w.Code, backupHits)
+	}
+}
+
+// TestFailoverStatusDefault tests that only 5xx fails over without failover_on
+func TestFailoverStatusDefault(t *testing.T) {
+	fp := &FailoverProxy{}
+	for status, want := range map[int]bool{200: false, 404: false, 429: false, 500: true, 503: true} {
+		if got := fp.isFailoverStatus(status); got != want {
+			t.Errorf("isFailoverStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+// TestParseFailoverOn tests parsing codes and ranges in the failover_on subdirective
+func TestParseFailoverOn(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+		"failover_proxy http://a http://b {\n failover_on 502-504 429\n}")}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{502, 503, 504, 429}
+	got := handler.(*FailoverProxy).FailoverStatusCodes
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	}
+
+	for _, bad := range []string{"abc", "600", "504-502", "500-"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n failover_on " + bad + "\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for failover_on %s", bad)
+		}
+	}
+}
+
+// TestNeverFailoverStatus tests that never_failover_status serves a 404 directly
+// even when failover_on covers every error status
+func TestNeverFailoverStatus(t *testing.T) {
+	var primaryStatus int32 = http.StatusNotFound
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&primaryStatus)))
+	}))
+	defer primary.Close()
+
+	var backupHits int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	failoverOn, _ := parseStatusCodes([]string{"400-599"})
+	never, _ := parseStatusCodes([]string{"400-428", "430-499"})
+	fp := CreateTestProxy(t, []string{primary.URL, backup.URL}, func(fp *FailoverProxy) {
+		fp.FailoverStatusCodes = failoverOn
+		fp.NeverFailoverStatusCodes = never
+	})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusNotFound || atomic.LoadInt32(&backupHits) != 0 {
+		t.Errorf("Expected 404 to be served directly, got status %d and %d backup hits", w.Code, backupHits)
+	}
+
+	atomic.StoreInt32(&primaryStatus, http.StatusTooManyRequests)
+	w = httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK || atomic.LoadInt32(&backupHits) != 1 {
+		t.Errorf("Expected 429 to fail over to backup, got status %d and %d backup hits", w.Code, backupHits)
+	}
+}
+
+// TestParseNeverFailoverStatus tests parsing the never_failover_status subdirective
+func TestParseNeverFailoverStatus(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+		"failover_proxy http://a http://b {\n never_failover_status 404 410-411\n}")}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{404, 410, 411}
+	got := handler.(*FailoverProxy).NeverFailoverStatusCodes
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "700"} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(
+			"failover_proxy http://a {\n never_failover_status " + bad + "\n}")}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for never_failover_status %q", bad)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package failover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// statusStreamKeepalive is how often an idle status stream sends an SSE
+// comment so intermediaries don't close the connection
+const statusStreamKeepalive = 30 * time.Second
+
+// statusSubscribers fans registry change notifications out to listeners. Each
+// listener channel holds at most one pending signal, so a burst of transitions
+// collapses into a single refresh and notifying never blocks.
+type statusSubscribers struct {
+	mu       sync.Mutex
+	channels map[chan struct{}]struct{}
+}
+
+// Subscribe returns a channel signalled after status transitions and a
+// function that stops the subscription
+func (r *ProxyRegistry) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	r.subscribers.mu.Lock()
+	if r.subscribers.channels == nil {
+		r.subscribers.channels = make(map[chan struct{}]struct{})
+	}
+	r.subscribers.channels[ch] = struct{}{}
+	r.subscribers.mu.Unlock()
+
+	return ch, func() {
+		r.subscribers.mu.Lock()
+		delete(r.subscribers.channels, ch)
+		r.subscribers.mu.Unlock()
+	}
+}
+
+// notifyChange signals every subscriber that some proxy's status changed.
+// It doesn't take the registry lock, so proxies may call it while holding theirs.
+func (r *ProxyRegistry) notifyChange() {
+	r.subscribers.mu.Lock()
+	defer r.subscribers.mu.Unlock()
+	for ch := range r.subscribers.channels {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyStatusChange reports a health or failover transition to status streams
+func (f *FailoverProxy) notifyStatusChange() {
+	proxyRegistry.notifyChange()
+}
+
+// ParseFailoverStatusStream parses the failover_status_stream directive
+func ParseFailoverStatusStream(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	return parseFailoverStatusStream(h)
+}
+
+// FailoverStatusStreamHandler streams failover status as Server-Sent Events,
+// sending the full status on connect and again after every transition
+type FailoverStatusStreamHandler struct{}
+
+// CaddyModule returns the Caddy module information
+func (FailoverStatusStreamHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.failover_status_stream",
+		New: func() caddy.Module { return new(FailoverStatusStreamHandler) },
+	}
+}
+
+// ServeHTTP holds the connection open, writing status events until the client leaves
+func (h FailoverStatusStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	// Subscribe before the first snapshot so no transition is missed in between
+	changes, unsubscribe := proxyRegistry.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	keepalive := time.NewTicker(statusStreamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		if err := writeStatusEvent(w); err != nil {
+			return nil
+		}
+		if err := rc.Flush(); err != nil {
+			return nil
+		}
+
+		changed := false
+		for !changed {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-changes:
+				changed = true
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return nil
+				}
+				if err := rc.Flush(); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// writeStatusEvent writes the current registry status as one SSE data event
+func writeStatusEvent(w http.ResponseWriter) error {
+	status, err := json.Marshal(proxyRegistry.GetStatus())
+	if err != nil {
+		caddy.Log().Error("failed to encode failover status event",
+			zap.Error(err))
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", status)
+	return err
+}
+
+// parseFailoverStatusStream parses the failover_status_stream directive
+func parseFailoverStatusStream(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := FailoverStatusStreamHandler{}
+	for h.Next() {
+		if h.NextArg() {
+			return nil, h.ArgErr()
+		}
+		if h.NextBlock(0) {
+			return nil, h.Errf("unknown failover_status_stream subdirective: %s", h.Val())
+		}
+	}
+	return handler, nil
+}
+
+// Interface guards
+var (
+	_ caddy.Module                = (*FailoverStatusStreamHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*FailoverStatusStreamHandler)(nil)
+)
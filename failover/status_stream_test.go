@@ -0,0 +1,106 @@
+package failover
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readStatusEvent waits for the next SSE data event from the stream
+func readStatusEvent(t *testing.T, events chan string) string {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for status event")
+		return ""
+	}
+}
+
+// TestStatusStreamEmitsTransitions tests that a health transition produces an SSE event on an open stream
+func TestStatusStreamEmitsTransitions(t *testing.T) {
+	registry := CreateTestRegistry()
+	oldRegistry := proxyRegistry
+	proxyRegistry = registry
+	defer func() { proxyRegistry = oldRegistry }()
+
+	upstream := "http://backend.internal:8080"
+	fp := CreateTestProxy(t, []string{upstream}, WithPath("/api/*"))
+
+	handler := FailoverStatusStreamHandler{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r, nil)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+	}()
+
+	initial := readStatusEvent(t, events)
+	if !strings.Contains(initial, upstream) || strings.Contains(initial, "UNHEALTHY") {
+		t.Errorf("Expected initial snapshot with healthy upstream, got %s", initial)
+	}
+
+	fp.setHealthStatus(upstream, false)
+
+	update := readStatusEvent(t, events)
+	if !strings.Contains(update, `"status":"UNHEALTHY"`) {
+		t.Errorf("Expected transition event marking upstream unhealthy, got %s", update)
+	}
+
+	// Disconnecting removes the subscription
+	cancel()
+	WaitForCondition(t, 2*time.Second, 10*time.Millisecond, func() bool {
+		registry.subscribers.mu.Lock()
+		defer registry.subscribers.mu.Unlock()
+		return len(registry.subscribers.channels) == 0
+	}, "stream subscription was not removed after disconnect")
+}
+
+// TestNotifyChangeDoesNotBlock tests that slow subscribers don't block transitions
+func TestNotifyChangeDoesNotBlock(t *testing.T) {
+	registry := CreateTestRegistry()
+	changes, unsubscribe := registry.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < 5; i++ {
+		registry.notifyChange()
+	}
+
+	select {
+	case <-changes:
+	default:
+		t.Fatal("Expected a pending change signal")
+	}
+	select {
+	case <-changes:
+		t.Error("Expected repeated notifications to collapse into one signal")
+	default:
+	}
+}
@@ -0,0 +1,123 @@
+package failover
+
+import (
+	"hash/fnv"
+	"net/http"
+)
+
+// Sticky session keys name where the session key is read from
+const (
+	stickyKeyCookie = "cookie"
+	stickyKeyHeader = "header"
+)
+
+// stickyCookieName is the proxy cookie, before prefixing, that records the
+// upstream serving a session when RewriteCookie is set
+const stickyCookieName = "upstream"
+
+// StickySession routes requests with the same session key to the same
+// upstream, so stateful backends keep seeing the same clients
+type StickySession struct {
+	// Key is where the session key is read from: "cookie" or "header"
+	Key string `json:"key"`
+
+	// Name is the name of the cookie or header holding the session key
+	Name string `json:"name"`
+
+	// RewriteCookie records the upstream that served the session in a proxy
+	// cookie. It is rewritten when a request fails over, and the recorded
+	// upstream is preferred while it is live, so a session stays where its
+	// state now is rather than moving back when the hashed upstream recovers.
+	RewriteCookie bool `json:"rewrite_cookie,omitempty"`
+}
+
+// sessionKey returns the request's session key, empty when it has none
+func (s *StickySession) sessionKey(r *http.Request) string {
+	if s.Key == stickyKeyHeader {
+		return r.Header.Get(s.Name)
+	}
+	if c, err := r.Cookie(s.Name); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// stickyOrder moves the upstream the request's session sticks to to the
+// front of order. The recorded upstream wins while it is live; otherwise the
+// session key is hashed over the live upstreams, so a session only moves when
+// its upstream goes down. Requests without a session key keep order.
+func (f *FailoverProxy) stickyOrder(r *http.Request, order []string) []string {
+	if f.Sticky == nil {
+		return order
+	}
+
+	if f.Sticky.RewriteCookie {
+		if c, err := r.Cookie(f.proxyCookieName(stickyCookieName)); err == nil {
+			for _, upstream := range order {
+				if hashString(upstream) == c.Value && f.upstreamLive(upstream) {
+					return preferUpstream(order, upstream)
+				}
+			}
+		}
+	}
+
+	key := f.Sticky.sessionKey(r)
+	if key == "" {
+		return order
+	}
+
+	// Rendezvous hashing: the live upstream with the highest score for the
+	// key wins, and only sessions on an upstream that goes down move
+	var chosen string
+	var best uint64
+	for _, upstream := range order {
+		if !f.upstreamLive(upstream) {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(upstream))
+		if score := h.Sum64(); chosen == "" || score > best {
+			chosen, best = upstream, score
+		}
+	}
+	if chosen == "" {
+		return order
+	}
+	return preferUpstream(order, chosen)
+}
+
+// upstreamLive reports whether requests may currently be sent to the
+// upstream, by the same rules serveUpstreams uses to skip upstreams
+func (f *FailoverProxy) upstreamLive(upstreamURL string) bool {
+	if f.isDisabled(upstreamURL) {
+		return false
+	}
+	if f.activeHealthApplies() && !f.isHealthy(upstreamURL) {
+		return false
+	}
+	f.mu.RLock()
+	failed := f.upstreamFailed(upstreamURL)
+	f.mu.RUnlock()
+	return !failed || !f.passiveHealthApplies(upstreamURL)
+}
+
+// setStickyCookie records the upstream serving the request in the sticky
+// cookie when it isn't already the one recorded
+func (f *FailoverProxy) setStickyCookie(w http.ResponseWriter, r *http.Request, upstreamURL string) {
+	if f.Sticky == nil || !f.Sticky.RewriteCookie {
+		return
+	}
+	id := hashString(upstreamURL)
+	if c, err := r.Cookie(f.proxyCookieName(stickyCookieName)); err == nil && c.Value == id {
+		return
+	}
+	f.setProxyCookie(w.Header(), &http.Cookie{
+		Name:     stickyCookieName,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,190 @@
+package failover
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newNamedUpstreams starts upstreams that answer with their index
+func newNamedUpstreams(t *testing.T, n int) []string {
+	urls := make([]string, n)
+	for i := range urls {
+		name := fmt.Sprint(i)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		urls[i] = server.URL
+	}
+	return urls
+}
+
+// serveSticky sends a request carrying the given cookies and returns the
+// answering upstream's index and the response
+func serveSticky(t *testing.T, fp *FailoverProxy, cookies ...*http.Cookie) (string, *http.Response) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP returned error: %v", err)
+	}
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), resp
+}
+
+// TestStickySessions tests that the same session cookie always reaches the
+// same upstream while different sessions are spread across upstreams
+func TestStickySessions(t *testing.T) {
+	upstreams := newNamedUpstreams(t, 3)
+	fp := CreateTestProxy(t, upstreams, func(f *FailoverProxy) {
+		f.Sticky = &StickySession{Key: stickyKeyCookie, Name: "session"}
+	})
+
+	served := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		session := &http.Cookie{Name: "session", Value: fmt.Sprintf("user-%d", i)}
+		first, _ := serveSticky(t, fp, session)
+		for j := 0; j < 3; j++ {
+			if got, _ := serveSticky(t, fp, session); got != first {
+				t.Fatalf("Session %s moved from upstream %s to %s", session.Value, first, got)
+			}
+		}
+		served[first] = true
+	}
+	if len(served) != len(upstreams) {
+		t.Errorf("Expected sessions spread over all %d upstreams, got %v", len(upstreams), served)
+	}
+
+	// Requests without a session key keep the declared order
+	if got, _ := serveSticky(t, fp); got != "0" {
+		t.Errorf("Expected a request without a session to reach the first upstream, got %s", got)
+	}
+}
+
+// TestStickySessionsHeader tests reading the session key from a header
+func TestStickySessionsHeader(t *testing.T) {
+	upstreams := newNamedUpstreams(t, 3)
+	fp := CreateTestProxy(t, upstreams, func(f *FailoverProxy) {
+		f.Sticky = &StickySession{Key: stickyKeyHeader, Name: "X-Session"}
+	})
+
+	served := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("X-Session", fmt.Sprintf("user-%d", i))
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP returned error: %v", err)
+		}
+		served[w.Body.String()] = true
+	}
+	if len(served) < 2 {
+		t.Errorf("Expected header sessions spread across upstreams, got %v", served)
+	}
+}
+
+// TestStickySessionsFailover tests that a session whose upstream is down
+// fails over, and that rewrite_cookie keeps it on the new upstream after
+// the original one recovers
+func TestStickySessionsFailover(t *testing.T) {
+	upstreams := newNamedUpstreams(t, 2)
+	fp := CreateTestProxy(t, upstreams, func(f *FailoverProxy) {
+		f.Sticky = &StickySession{Key: stickyKeyCookie, Name: "session", RewriteCookie: true}
+	})
+
+	// Find a session that hashes to the first upstream
+	var session *http.Cookie
+	for i := 0; session == nil; i++ {
+		c := &http.Cookie{Name: "session", Value: fmt.Sprintf("user-%d", i)}
+		if got, _ := serveSticky(t, fp, c); got == "0" {
+			session = c
+		}
+	}
+
+	// The first response records the serving upstream
+	_, resp := serveSticky(t, fp, session)
+	pin := findCookie(resp, "failover_upstream")
+	if pin == nil || pin.Value != hashString(upstreams[0]) {
+		t.Fatalf("Expected the sticky cookie to record upstream 0, got %v", pin)
+	}
+	if _, resp := serveSticky(t, fp, session, pin); findCookie(resp, "failover_upstream") != nil {
+		t.Error("Expected no Set-Cookie while the recorded upstream serves the session")
+	}
+
+	// Take the first upstream down: the session fails over and the cookie is rewritten
+	if err := fp.SetUpstreamEnabled(upstreams[0], false); err != nil {
+		t.Fatal(err)
+	}
+	got, resp := serveSticky(t, fp, session, pin)
+	if got != "1" {
+		t.Fatalf("Expected the session to fail over to upstream 1, got %s", got)
+	}
+	pin = findCookie(resp, "failover_upstream")
+	if pin == nil || pin.Value != hashString(upstreams[1]) {
+		t.Fatalf("Expected the sticky cookie rewritten to upstream 1, got %v", pin)
+	}
+
+	// After recovery the session stays where the cookie says
+	if err := fp.SetUpstreamEnabled(upstreams[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := serveSticky(t, fp, session, pin); got != "1" {
+		t.Errorf("Expected the rewritten cookie to keep the session on upstream 1, got %s", got)
+	}
+	if got, _ := serveSticky(t, fp, session); got != "0" {
+		t.Errorf("Expected the session without the cookie to hash to upstream 0 again, got %s", got)
+	}
+}
+
+// findCookie returns the named cookie set on the response, or nil
+func findCookie(resp *http.Response, name string) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// TestParseSticky tests parsing the sticky block
+func TestParseSticky(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+		sticky {
+			key cookie session_id
+			rewrite_cookie
+		}
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	sticky := handler.(*FailoverProxy).Sticky
+	if sticky == nil || sticky.Key != "cookie" || sticky.Name != "session_id" || !sticky.RewriteCookie {
+		t.Errorf("Unexpected sticky config: %+v", sticky)
+	}
+
+	for _, block := range []string{
+		"key query id",
+		"key cookie",
+		"rewrite_cookie",
+		"bogus",
+	} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a http://b {
+			sticky {
+				` + block + `
+			}
+		}`)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for sticky block %q", block)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package failover
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// isStreamingResponse reports whether an upstream response should reach the
+// client as it arrives: Server-Sent Events, or any body of unknown length
+func isStreamingResponse(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream" || resp.ContentLength < 0
+}
+
+// flushWriter flushes the client response after every write, so streamed
+// bodies aren't held back in the server's buffers
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+// newFlushWriter wraps w, flushing through any wrapping response writers
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	return &flushWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.flush()
+}
+
+// flush sends buffered output to the client; writers that can't flush are
+// written to as usual
+func (fw *flushWriter) flush() error {
+	if err := fw.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
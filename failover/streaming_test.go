@@ -0,0 +1,157 @@
+package failover
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServerSentEventsStreamIncrementally tests that SSE events reach the client as they are sent
+func TestServerSentEventsStreamIncrementally(t *testing.T) {
+	const delay = 150 * time.Millisecond
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+			if i < 3 {
+				time.Sleep(delay)
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp.ServeHTTP(w, r, nil)
+	}))
+	defer proxy.Close()
+
+	start := time.Now()
+	resp, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var arrivals []time.Duration
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data: ") {
+			arrivals = append(arrivals, time.Since(start))
+		}
+	}
+
+	if len(arrivals) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(arrivals))
+	}
+	// Buffered output would deliver every event together at the end
+	if arrivals[2]-arrivals[0] < delay {
+		t.Errorf("Expected events to arrive incrementally, got arrivals at %v", arrivals)
+	}
+	if arrivals[0] > delay {
+		t.Errorf("Expected the first event before the upstream finished, got %v", arrivals[0])
+	}
+}
+
+// TestServerSentEventsWithBodyRewrite tests that rewritten SSE events still reach the client as they are sent
+func TestServerSentEventsWithBodyRewrite(t *testing.T) {
+	const delay = 150 * time.Millisecond
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for i := 1; i <= 2; i++ {
+			fmt.Fprintf(w, "data: http://backup.internal/events/%d\n\n", i)
+			w.(http.Flusher).Flush()
+			if i < 2 {
+				time.Sleep(delay)
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.BodyURLRewrites = []BodyURLRewrite{{From: "backup.internal", To: "www.example.com"}}
+	})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp.ServeHTTP(w, r, nil)
+	}))
+	defer proxy.Close()
+
+	start := time.Now()
+	resp, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var events []string
+	var arrivals []time.Duration
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+			arrivals = append(arrivals, time.Since(start))
+		}
+	}
+
+	if len(events) != 2 || events[0] != "http://www.example.com/events/1" || events[1] != "http://www.example.com/events/2" {
+		t.Fatalf("Expected 2 rewritten events, got %q", events)
+	}
+	if arrivals[0] > delay {
+		t.Errorf("Expected the first event before the upstream finished, got %v", arrivals[0])
+	}
+}
+
+// TestFixedLengthResponseNotStreamed tests that responses with a known length keep their Content-Length
+func TestFixedLengthResponseNotStreamed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "11")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL})
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Body.String() != `{"ok":true}` {
+		t.Errorf("Expected body to be copied, got %q", w.Body.String())
+	}
+	if w.Header().Get("Content-Length") != "11" {
+		t.Errorf("Expected Content-Length to be preserved, got %q", w.Header().Get("Content-Length"))
+	}
+	if w.Flushed {
+		t.Error("Expected a fixed-length response not to be flushed early")
+	}
+}
+
+// TestIsStreamingResponse tests which responses are flushed as they arrive
+func TestIsStreamingResponse(t *testing.T) {
+	tests := []struct {
+		contentType   string
+		contentLength int64
+		expected      bool
+	}{
+		{"text/event-stream", 100, true},
+		{"text/event-stream; charset=utf-8", -1, true},
+		{"application/json", -1, true},
+		{"application/json", 42, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Content-Type": {tt.contentType}}, ContentLength: tt.contentLength}
+		if got := isStreamingResponse(resp); got != tt.expected {
+			t.Errorf("isStreamingResponse(%q, %d) = %v, expected %v", tt.contentType, tt.contentLength, got, tt.expected)
+		}
+	}
+}
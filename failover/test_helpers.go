@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -210,6 +211,41 @@ func WaitForCondition(t *testing.T, timeout time.Duration, interval time.Duratio
 	t.Fatalf("Timeout waiting for condition: %s", message)
 }
 
+// CreateControlledPrimaryProxy creates a proxy with a primary whose status
+// code is controlled by the test (initially 500) and an always-healthy
+// secondary. primaryHits counts the requests the primary received.
+func CreateControlledPrimaryProxy(t *testing.T, opts ...ProxyOption) (fp *FailoverProxy, primaryURL string, primaryStatus, primaryHits *int32) {
+	primaryStatus = new(int32)
+	primaryHits = new(int32)
+	atomic.StoreInt32(primaryStatus, http.StatusInternalServerError)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(primaryHits, 1)
+		w.WriteHeader(int(atomic.LoadInt32(primaryStatus)))
+	}))
+	t.Cleanup(primary.Close)
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(secondary.Close)
+
+	fp = CreateTestProxy(t, []string{primary.URL, secondary.URL}, opts...)
+	return fp, primary.URL, primaryStatus, primaryHits
+}
+
+// UpstreamStatusOf returns the reported status of an upstream
+func UpstreamStatusOf(t *testing.T, fp *FailoverProxy, upstream string) UpstreamStatus {
+	t.Helper()
+	for _, status := range fp.GetUpstreamStatus() {
+		if status.Host == upstream {
+			return status
+		}
+	}
+	t.Fatalf("upstream %s not found in status", upstream)
+	return UpstreamStatus{}
+}
+
 // MockHealthCheck creates a mock health check configuration
 func MockHealthCheck(path string, interval, timeout time.Duration, expectedStatus int) *HealthCheck {
 	return &HealthCheck{
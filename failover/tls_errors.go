@@ -0,0 +1,47 @@
+package failover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// substatusTLSError marks upstreams evicted because of a TLS handshake failure
+const substatusTLSError = "TLS_ERROR"
+
+// isTLSError reports whether err came from a failed TLS handshake, such as an
+// untrusted or expired certificate or a server that doesn't speak TLS at all
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &invalidErr) || errors.As(err, &hostnameErr) {
+		return true
+	}
+
+	// The transport reports a plain HTTP reply to a handshake on its own
+	if errors.Is(err, http.ErrSchemeMismatch) {
+		return true
+	}
+
+	// Alerts sent by the server, e.g. a protocol version mismatch
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "remote error"
+}
+
+// failDurationFor returns how long a failure of the upstream keeps it out of
+// rotation, which is fail_duration_tls for TLS failures when configured.
+// Must be called with lock held.
+func (f *FailoverProxy) failDurationFor(upstreamURL string) time.Duration {
+	if f.tlsFailures[upstreamURL] && f.FailDurationTLS > 0 {
+		return time.Duration(f.FailDurationTLS)
+	}
+	return time.Duration(f.FailDuration)
+}
@@ -0,0 +1,88 @@
+package failover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// TestTLSHandshakeFailureHandling tests that TLS failures are classified and evicted for fail_duration_tls
+func TestTLSHandshakeFailureHandling(t *testing.T) {
+	// Self-signed certificate the proxy doesn't trust
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer untrusted.Close()
+
+	// Plain HTTP server addressed over https
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer plain.Close()
+	plainAsTLS := strings.Replace(plain.URL, "http://", "https://", 1)
+
+	var backupHits int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	fp := CreateTestProxy(t, []string{untrusted.URL, plainAsTLS, backup.URL},
+		WithFailDuration(50*time.Millisecond), func(fp *FailoverProxy) {
+			fp.FailDurationTLS = caddy.Duration(time.Hour)
+		})
+
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK || atomic.LoadInt32(&backupHits) != 1 {
+		t.Fatalf("Expected backup to serve the request, got status %d and %d backup hits", w.Code, backupHits)
+	}
+
+	// Outlive fail_duration; the TLS failures are still evicted
+	time.Sleep(100 * time.Millisecond)
+
+	for _, status := range fp.GetUpstreamStatus() {
+		switch status.Host {
+		case untrusted.URL, plainAsTLS:
+			if status.Status != "DOWN" || status.Substatus != substatusTLSError {
+				t.Errorf("Expected %s to be DOWN with TLS_ERROR, got %s/%s", status.Host, status.Status, status.Substatus)
+			}
+		case backup.URL:
+			if status.Substatus != "" {
+				t.Errorf("Expected no substatus for backup, got %s", status.Substatus)
+			}
+		}
+	}
+
+	fp.mu.RLock()
+	_, stillFailed := fp.failureCache[untrusted.URL]
+	evicted := time.Since(fp.failureCache[untrusted.URL]) < fp.failDurationFor(untrusted.URL)
+	fp.mu.RUnlock()
+	if !stillFailed || !evicted {
+		t.Error("Expected TLS failure to outlast fail_duration")
+	}
+}
+
+// TestIsTLSErrorIgnoresOtherFailures tests that ordinary failures aren't classified as TLS errors
+func TestIsTLSErrorIgnoresOtherFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	fp := CreateTestProxy(t, []string{server.URL, "http://127.0.0.1:1"})
+	if err := fp.tryUpstream(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), server.URL); err == nil || isTLSError(err) {
+		t.Errorf("Expected a non-TLS error for a 500, got %v", err)
+	}
+	if err := fp.tryUpstream(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), "http://127.0.0.1:1"); err == nil || isTLSError(err) {
+		t.Errorf("Expected a non-TLS error for a refused connection, got %v", err)
+	}
+}
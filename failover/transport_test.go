@@ -0,0 +1,167 @@
+package failover
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newConnCountingServer creates a test server that counts new TCP connections
+func newConnCountingServer(t *testing.T, conns *int32) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(conns, 1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestUpstreamIdleConnTimeout tests that idle connections are recycled per upstream
+func TestUpstreamIdleConnTimeout(t *testing.T) {
+	var shortConns, defaultConns int32
+	shortServer := newConnCountingServer(t, &shortConns)
+	defaultServer := newConnCountingServer(t, &defaultConns)
+
+	fp := CreateTestProxy(t, []string{shortServer.URL, defaultServer.URL}, func(fp *FailoverProxy) {
+		fp.UpstreamIdleTimeouts = map[string]caddy.Duration{
+			shortServer.URL: caddy.Duration(50 * time.Millisecond),
+		}
+	})
+
+	if fp.clientFor(shortServer.URL, "http") == fp.httpClient {
+		t.Fatal("Expected a dedicated client for the upstream with an idle timeout")
+	}
+	if fp.clientFor(defaultServer.URL, "http") != fp.httpClient {
+		t.Fatal("Expected the shared client for other upstreams")
+	}
+
+	send := func(client *http.Client, target string) {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// Two requests separated by more than the idle window
+	for _, server := range []*httptest.Server{shortServer, defaultServer} {
+		client := fp.clientFor(server.URL, "http")
+		send(client, server.URL)
+		time.Sleep(200 * time.Millisecond)
+		send(client, server.URL)
+	}
+
+	if got := atomic.LoadInt32(&shortConns); got != 2 {
+		t.Errorf("Expected idle connection to be recycled (2 connections), got %d", got)
+	}
+	if got := atomic.LoadInt32(&defaultConns); got != 1 {
+		t.Errorf("Expected default upstream to reuse its connection, got %d connections", got)
+	}
+}
+
+// TestTLSSessionResumption tests that new connections to an HTTPS upstream resume the cached session
+func TestTLSSessionResumption(t *testing.T) {
+	var full, resumed int32
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS.DidResume {
+			atomic.AddInt32(&resumed, 1)
+		} else {
+			atomic.AddInt32(&full, 1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.InsecureSkipVerify = true
+	})
+
+	const requests = 5
+	for i := 0; i < requests; i++ {
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil), nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		// Force a new connection, and so a new handshake, for the next request
+		fp.httpsClient.CloseIdleConnections()
+	}
+
+	if full != 1 {
+		t.Errorf("Expected a single full handshake, got %d", full)
+	}
+	if resumed != requests-1 {
+		t.Errorf("Expected %d resumed handshakes, got %d", requests-1, resumed)
+	}
+}
+
+// TestIdleConnPoolSizing tests that the idle pool options reach the
+// transports, and that the built-in defaults apply without them
+func TestIdleConnPoolSizing(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a.local https://b.local {
+		max_idle_conns 500
+		max_idle_conns_per_host 50
+		idle_conn_timeout 2m
+		idle_conn_timeout http://a.local 10s
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	if err := fp.Provision(caddy.Context{}); err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	defer fp.Cleanup()
+
+	for _, client := range []*http.Client{fp.httpClient, fp.httpsClient} {
+		transport := client.Transport.(*http.Transport)
+		if transport.MaxIdleConns != 500 || transport.MaxIdleConnsPerHost != 50 || transport.IdleConnTimeout != 2*time.Minute {
+			t.Errorf("Expected 500/50/2m, got %d/%d/%v",
+				transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+		}
+	}
+	dedicated := fp.clientFor("http://a.local", "http").Transport.(*http.Transport)
+	if dedicated.IdleConnTimeout != 10*time.Second || dedicated.MaxIdleConnsPerHost != 50 {
+		t.Errorf("Expected the upstream's own 10s timeout with the shared pool size, got %v/%d",
+			dedicated.IdleConnTimeout, dedicated.MaxIdleConnsPerHost)
+	}
+
+	defaults := CreateTestProxy(t, []string{"http://a.local"})
+	transport := defaults.httpClient.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 100 || transport.MaxIdleConnsPerHost != http.DefaultMaxIdleConnsPerHost || transport.IdleConnTimeout != 90*time.Second {
+		t.Errorf("Expected the defaults 100/%d/90s, got %d/%d/%v", http.DefaultMaxIdleConnsPerHost,
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	for _, input := range []string{
+		`failover_proxy http://a.local {
+			max_idle_conns 0
+		}`,
+		`failover_proxy http://a.local {
+			max_idle_conns_per_host many
+		}`,
+		`failover_proxy http://a.local {
+			idle_conn_timeout 0s
+		}`,
+	} {
+		h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(input)}
+		if _, err := parseFailoverProxy(h); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
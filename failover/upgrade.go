@@ -0,0 +1,179 @@
+package failover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errUpgradeRefused is returned when an upstream answers an upgrade request
+// with anything other than 101 Switching Protocols
+var errUpgradeRefused = errors.New("upstream refused protocol upgrade")
+
+// isUpgradeRequest reports whether the client asks to switch protocols, e.g.
+// to a WebSocket, with Connection: Upgrade and an Upgrade header
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveUpgrade proxies a protocol upgrade to the first upstream that accepts
+// the handshake. Failover only happens before the upgrade completes; once an
+// upstream switches protocols, bytes are relayed until either side closes.
+func (f *FailoverProxy) serveUpgrade(w http.ResponseWriter, r *http.Request) error {
+	for _, upstreamURL := range f.requestOrder(r) {
+		if f.isDisabled(upstreamURL) {
+			continue
+		}
+		if f.activeHealthApplies() && !f.isHealthy(upstreamURL) {
+			continue
+		}
+		f.mu.RLock()
+		failed := f.upstreamFailed(upstreamURL)
+		f.mu.RUnlock()
+		if failed && f.passiveHealthApplies(upstreamURL) {
+			continue
+		}
+		if isSelfReferential(r, upstreamURL, f.rewritePath(upstreamURL, r.URL.Path)) {
+			continue
+		}
+		if f.CircuitBreaker != nil && f.passiveHealthApplies(upstreamURL) && !f.circuitAllow(upstreamURL) {
+			continue
+		}
+
+		resp, err := f.upgradeUpstream(r, upstreamURL)
+		f.recordUpgradeAttempt(upstreamURL, err)
+		if err != nil {
+			f.logger.Debug("upstream upgrade failed, trying next",
+				zap.String("url", upstreamURL),
+				zap.Error(err))
+			continue
+		}
+
+		f.logger.Debug("upgraded connection to upstream",
+			zap.String("upstream", upstreamURL),
+			zap.String("protocol", resp.Header.Get("Upgrade")),
+			zap.String("path", r.URL.Path))
+		return f.relayUpgrade(w, resp)
+	}
+
+	f.logger.Error("all upstreams failed upgrade",
+		zap.String("path", r.URL.Path),
+		zap.String("protocol", r.Header.Get("Upgrade")))
+	if f.FallbackToNext {
+		return errAllUpstreamsFailed
+	}
+	f.writeAllFailed(w)
+	return nil
+}
+
+// upgradeUpstream sends the upgrade handshake to one upstream and returns its
+// 101 response, whose body is the upgraded connection
+func (f *FailoverProxy) upgradeUpstream(r *http.Request, upstreamURL string) (*http.Response, error) {
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream URL: %w", err)
+	}
+	targetURL := buildTargetURL(u, r, f.rewritePath(upstreamURL, r.URL.Path))
+
+	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	f.setProxyHeaders(proxyReq, r, upstreamURL)
+	proxyReq.Header.Set("Connection", "Upgrade")
+	proxyReq.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+
+	resp, err := f.clientFor(upstreamURL, u.Scheme).Do(proxyReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: status %d", errUpgradeRefused, resp.StatusCode)
+	}
+	if _, ok := resp.Body.(io.ReadWriteCloser); !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: connection not writable", errUpgradeRefused)
+	}
+	return resp, nil
+}
+
+// recordUpgradeAttempt updates the failure cache and circuit breaker after a handshake
+func (f *FailoverProxy) recordUpgradeAttempt(upstreamURL string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lastFail, failed := f.failureCache[upstreamURL]
+	if err == nil {
+		if failed {
+			f.notifyStatusChange()
+		}
+		delete(f.failureCache, upstreamURL)
+		f.lastSuccess[upstreamURL] = time.Now()
+	} else {
+		if !failed || time.Since(lastFail) >= f.failDurationFor(upstreamURL) {
+			f.notifyStatusChange()
+		}
+		f.failureCache[upstreamURL] = time.Now()
+	}
+	if f.CircuitBreaker != nil {
+		f.circuitRecord(upstreamURL, err == nil)
+	}
+}
+
+// relayUpgrade hands the client the upstream's 101 response, then copies bytes
+// in both directions until either connection closes
+func (f *FailoverProxy) relayUpgrade(w http.ResponseWriter, resp *http.Response) error {
+	backend := resp.Body.(io.ReadWriteCloser)
+	defer backend.Close()
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fmt.Errorf("failed to hijack upgraded connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Forward the handshake response as received
+	fmt.Fprintf(brw, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		return nil
+	}
+
+	// Bytes the client sent right after its request may already be buffered
+	if buffered := brw.Reader.Buffered(); buffered > 0 {
+		pending, _ := brw.Reader.Peek(buffered)
+		if _, err := backend.Write(pending); err != nil {
+			return nil
+		}
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(backend, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, backend)
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
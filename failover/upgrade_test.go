@@ -0,0 +1,148 @@
+package failover
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// websocketAccept computes the Sec-WebSocket-Accept value for a handshake key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newEchoWebSocketServer creates a server that completes the WebSocket
+// handshake and then echoes every byte it receives
+func newEchoWebSocketServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "expected websocket upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			websocketAccept(r.Header.Get("Sec-WebSocket-Key")))
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestWebSocketFailover tests that an upgrade fails over when the primary refuses the handshake
+func TestWebSocketFailover(t *testing.T) {
+	var primaryHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		http.Error(w, "websockets unavailable", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondary := newEchoWebSocketServer(t)
+
+	fp := CreateTestProxy(t, []string{primary.URL, secondary.URL})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := fp.ServeHTTP(w, r, nil); err != nil {
+			t.Errorf("ServeHTTP error: %v", err)
+		}
+	}))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /socket HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != websocketAccept(key) {
+		t.Errorf("Expected Sec-WebSocket-Accept %q, got %q", websocketAccept(key), got)
+	}
+	if atomic.LoadInt32(&primaryHits) != 1 {
+		t.Errorf("Expected primary to be tried once, got %d", atomic.LoadInt32(&primaryHits))
+	}
+
+	// Data flows both ways once upgraded
+	for _, message := range []string{"hello", "failover"} {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		echo := make([]byte, len(message))
+		if _, err := io.ReadFull(reader, echo); err != nil {
+			t.Fatalf("Failed to read echo: %v", err)
+		}
+		if string(echo) != message {
+			t.Errorf("Expected echo %q, got %q", message, echo)
+		}
+	}
+}
+
+// TestWebSocketAllRefused tests that a refused handshake on every upstream returns 502
+func TestWebSocketAllRefused(t *testing.T) {
+	refuse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	}))
+	defer refuse.Close()
+
+	fp := CreateTestProxy(t, []string{refuse.URL, refuse.URL + "/alt"})
+
+	req := httptest.NewRequest("GET", "http://example.com/socket", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", w.Code)
+	}
+}
+
+// TestIsUpgradeRequest tests detection of protocol upgrade requests
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		connection, upgrade string
+		expected            bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, upgrade", "websocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("Connection", tt.connection)
+		if tt.upgrade != "" {
+			req.Header.Set("Upgrade", tt.upgrade)
+		}
+		if got := isUpgradeRequest(req); got != tt.expected {
+			t.Errorf("isUpgradeRequest(Connection: %q, Upgrade: %q) = %v, expected %v", tt.connection, tt.upgrade, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package failover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// tlsRenegotiationModes maps tls_renegotiation values to their tls support levels
+var tlsRenegotiationModes = map[string]tls.RenegotiationSupport{
+	"never":  tls.RenegotiateNever,
+	"once":   tls.RenegotiateOnceAsClient,
+	"freely": tls.RenegotiateFreelyAsClient,
+}
+
+// loadClientTLS loads the client certificate for mutual TLS and the trusted
+// CA pool into the shared HTTPS TLS config
+func (f *FailoverProxy) loadClientTLS(tlsConfig *tls.Config) error {
+	if (f.TLSClientCert == "") != (f.TLSClientKey == "") {
+		return fmt.Errorf("tls_client_cert and tls_client_key must be set together")
+	}
+	if f.TLSClientCert != "" {
+		certFile := f.replacer.ReplaceAll(f.TLSClientCert, "")
+		keyFile := f.replacer.ReplaceAll(f.TLSClientKey, "")
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if f.TLSTrustedCA != "" {
+		caFile := f.replacer.ReplaceAll(f.TLSTrustedCA, "")
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read tls_trusted_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls_trusted_ca %s contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return nil
+}
+
+// dedicatedTransport returns the transport of the upstream's dedicated client,
+// creating the client from a clone of the shared transport on first use
+func (f *FailoverProxy) dedicatedTransport(upstream string, httpTransport, httpsTransport *http.Transport) *http.Transport {
+	if client, ok := f.upstreamClients[upstream]; ok {
+		return client.Transport.(*http.Transport)
+	}
+
+	var transport *http.Transport
+	if strings.HasPrefix(upstream, "https://") {
+		transport = httpsTransport.Clone()
+	} else {
+		transport = httpTransport.Clone()
+	}
+	f.upstreamClients[upstream] = newUpstreamClient(transport)
+	return transport
+}
+
+// provisionUpstreamTLS applies per-upstream ALPN protocols and renegotiation
+// support to the TLS config of each upstream's dedicated HTTPS client
+func (f *FailoverProxy) provisionUpstreamTLS(httpTransport, httpsTransport *http.Transport) error {
+	tlsUpstreams := make(map[string]bool)
+	alpn := make(map[string][]string)
+	for upstream, protos := range f.UpstreamALPN {
+		upstream = f.replacer.ReplaceAll(upstream, "")
+		alpn[upstream] = protos
+		tlsUpstreams[upstream] = true
+	}
+	renegotiation := make(map[string]tls.RenegotiationSupport)
+	for upstream, mode := range f.UpstreamRenegotiation {
+		support, ok := tlsRenegotiationModes[mode]
+		if !ok {
+			return fmt.Errorf("invalid tls_renegotiation for %s: %s (expected never, once or freely)", upstream, mode)
+		}
+		upstream = f.replacer.ReplaceAll(upstream, "")
+		renegotiation[upstream] = support
+		tlsUpstreams[upstream] = true
+	}
+
+	for upstream := range tlsUpstreams {
+		if !strings.HasPrefix(upstream, "https://") {
+			f.logger.Warn("TLS options ignored for non-HTTPS upstream",
+				zap.String("upstream", upstream))
+			continue
+		}
+
+		transport := f.dedicatedTransport(upstream, httpTransport, httpsTransport)
+		if protos, ok := alpn[upstream]; ok {
+			transport.TLSClientConfig.NextProtos = protos
+			// Custom protocols disable Go's HTTP/2 setup, so re-enable it when
+			// h2 may be negotiated, replacing any HTTP/1.1 pin on the shared transport
+			if slices.Contains(protos, "h2") {
+				transport.ForceAttemptHTTP2 = true
+				transport.TLSNextProto = nil
+			}
+		}
+		if support, ok := renegotiation[upstream]; ok {
+			transport.TLSClientConfig.Renegotiation = support
+		}
+	}
+	return nil
+}
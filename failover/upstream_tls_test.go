@@ -0,0 +1,317 @@
+package failover
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// newALPNServer creates an HTTPS server that rejects handshakes not offering
+// proto. It still serves HTTP/1.1, so clients must offer both.
+func newALPNServer(t *testing.T, proto string) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.NegotiatedProtocol))
+	}))
+	server.TLS = &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if !slices.Contains(hello.SupportedProtos, proto) {
+				return nil, errors.New("required ALPN protocol not offered")
+			}
+			return nil, nil
+		},
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestUpstreamALPN tests that the handshake succeeds only when the required protocol is configured
+func TestUpstreamALPN(t *testing.T) {
+	upstream := newALPNServer(t, "acme-proto")
+
+	serve := func(fp *FailoverProxy) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		return w
+	}
+
+	unconfigured := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.InsecureSkipVerify = true
+	})
+	if w := serve(unconfigured); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 without tls_alpn, got %d", w.Code)
+	}
+
+	configured := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.InsecureSkipVerify = true
+		fp.UpstreamALPN = map[string][]string{upstream.URL: {"acme-proto", "http/1.1"}}
+	})
+	w := serve(configured)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with tls_alpn, got %d", w.Code)
+	}
+	if w.Body.String() != "http/1.1" {
+		t.Errorf("Expected negotiated protocol http/1.1, got %q", w.Body.String())
+	}
+}
+
+// TestUpstreamALPNHTTP2 tests that offering h2 through tls_alpn speaks HTTP/2
+// to an upstream that only serves HTTP/2
+func TestUpstreamALPNHTTP2(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Write([]byte(r.Proto))
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	upstream.Config.ErrorLog = log.New(io.Discard, "", 0)
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+
+	fp := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.InsecureSkipVerify = true
+		fp.UpstreamALPN = map[string][]string{upstream.URL: {"h2"}}
+	})
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	if err := fp.ServeHTTP(w, req, nil); err != nil {
+		t.Fatalf("ServeHTTP error: %v", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 over HTTP/2, got %d", w.Code)
+	}
+	if w.Body.String() != "HTTP/2.0" {
+		t.Errorf("Expected the upstream to see HTTP/2.0, got %q", w.Body.String())
+	}
+}
+
+// TestUpstreamRenegotiation tests that renegotiation support reaches only the configured upstream
+func TestUpstreamRenegotiation(t *testing.T) {
+	fp := CreateTestProxy(t, []string{"https://a.example.com", "https://b.example.com"}, func(fp *FailoverProxy) {
+		fp.UpstreamRenegotiation = map[string]string{"https://a.example.com": "freely"}
+	})
+
+	transport := fp.clientFor("https://a.example.com", "https").Transport.(*http.Transport)
+	if got := transport.TLSClientConfig.Renegotiation; got != tls.RenegotiateFreelyAsClient {
+		t.Errorf("Expected RenegotiateFreelyAsClient, got %v", got)
+	}
+	if fp.clientFor("https://b.example.com", "https") != fp.httpsClient {
+		t.Error("Expected upstream without TLS options to use the shared HTTPS client")
+	}
+	if fp.httpsClient.Transport.(*http.Transport).TLSClientConfig.Renegotiation != tls.RenegotiateNever {
+		t.Error("Expected the shared HTTPS client to keep renegotiation disabled")
+	}
+}
+
+// TestParseUpstreamTLS tests parsing tls_alpn and tls_renegotiation
+func TestParseUpstreamTLS(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy https://a {
+		tls_alpn https://a acme-proto http/1.1
+		tls_renegotiation https://a once
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	if got := fp.UpstreamALPN["https://a"]; !slices.Equal(got, []string{"acme-proto", "http/1.1"}) {
+		t.Errorf("Expected ALPN protocols [acme-proto http/1.1], got %v", got)
+	}
+	if got := fp.UpstreamRenegotiation["https://a"]; got != "once" {
+		t.Errorf("Expected renegotiation once, got %q", got)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy https://a {
+		tls_renegotiation https://a sometimes
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for an unknown renegotiation mode")
+	}
+}
+
+// writeClientCert generates a self-signed client certificate, writes it and
+// its key as PEM files into dir and returns the parsed certificate
+func writeClientCert(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "failover-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, "client.pem"), certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "client-key.pem"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// TestUpstreamMutualTLS tests that the client certificate is presented to an
+// upstream that requires and verifies one, and that tls_trusted_ca verifies
+// the upstream without insecure_skip_verify
+func TestUpstreamMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	upstream.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	upstream.Config.ErrorLog = log.New(io.Discard, "", 0)
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+
+	// Trust the test server's certificate through tls_trusted_ca
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAILOVER_TLS_DIR", dir)
+
+	serve := func(fp *FailoverProxy) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		w := httptest.NewRecorder()
+		if err := fp.ServeHTTP(w, req, nil); err != nil {
+			t.Fatalf("ServeHTTP error: %v", err)
+		}
+		return w
+	}
+
+	withoutCert := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.TLSTrustedCA = "{env.FAILOVER_TLS_DIR}/ca.pem"
+	})
+	if w := serve(withoutCert); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 without a client certificate, got %d", w.Code)
+	}
+
+	withCert := CreateTestProxy(t, []string{upstream.URL}, func(fp *FailoverProxy) {
+		fp.TLSClientCert = "{env.FAILOVER_TLS_DIR}/client.pem"
+		fp.TLSClientKey = "{env.FAILOVER_TLS_DIR}/client-key.pem"
+		fp.TLSTrustedCA = "{env.FAILOVER_TLS_DIR}/ca.pem"
+	})
+	w := serve(withCert)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with a client certificate, got %d", w.Code)
+	}
+	if w.Body.String() != "failover-client" {
+		t.Errorf("Expected the upstream to see client certificate failover-client, got %q", w.Body.String())
+	}
+}
+
+// TestUpstreamMutualTLSProvisionErrors tests that incomplete or unreadable
+// client TLS settings fail provisioning
+func TestUpstreamMutualTLSProvisionErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeClientCert(t, dir)
+
+	tests := map[string]func(fp *FailoverProxy){
+		"cert without key": func(fp *FailoverProxy) {
+			fp.TLSClientCert = filepath.Join(dir, "client.pem")
+		},
+		"missing key file": func(fp *FailoverProxy) {
+			fp.TLSClientCert = filepath.Join(dir, "client.pem")
+			fp.TLSClientKey = filepath.Join(dir, "missing.pem")
+		},
+		"missing ca file": func(fp *FailoverProxy) {
+			fp.TLSTrustedCA = filepath.Join(dir, "missing.pem")
+		},
+		"ca without certificates": func(fp *FailoverProxy) {
+			fp.TLSTrustedCA = filepath.Join(dir, "client-key.pem")
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			fp := &FailoverProxy{Upstreams: []string{"https://a.example.com"}}
+			configure(fp)
+			if err := fp.Provision(caddy.Context{}); err == nil {
+				t.Error("Expected provisioning to fail")
+			}
+		})
+	}
+}
+
+// TestParseUpstreamMutualTLS tests parsing tls_client_cert, tls_client_key and tls_trusted_ca
+func TestParseUpstreamMutualTLS(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy https://a {
+		tls_client_cert {env.CERT_DIR}/client.pem
+		tls_client_key {env.CERT_DIR}/client-key.pem
+		tls_trusted_ca /etc/ssl/internal-ca.pem
+	}`)}
+
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fp := handler.(*FailoverProxy)
+	if fp.TLSClientCert != "{env.CERT_DIR}/client.pem" || fp.TLSClientKey != "{env.CERT_DIR}/client-key.pem" {
+		t.Errorf("Unexpected client certificate files: %q, %q", fp.TLSClientCert, fp.TLSClientKey)
+	}
+	if fp.TLSTrustedCA != "/etc/ssl/internal-ca.pem" {
+		t.Errorf("Expected trusted CA /etc/ssl/internal-ca.pem, got %q", fp.TLSTrustedCA)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy https://a {
+		tls_client_cert
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected an error for tls_client_cert without a file")
+	}
+}
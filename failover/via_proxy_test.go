@@ -0,0 +1,152 @@
+package failover
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+// stubProxy is a forward proxy that records each request it handles. Plain
+// HTTP requests are forwarded and CONNECT requests are tunneled.
+type stubProxy struct {
+	mu   sync.Mutex
+	seen []string // "METHOD target" per request
+}
+
+func (p *stubProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	if r.Method == http.MethodConnect {
+		p.seen = append(p.seen, r.Method+" "+r.Host)
+	} else {
+		p.seen = append(p.seen, r.Method+" "+r.URL.String())
+	}
+	p.mu.Unlock()
+
+	if r.Method == http.MethodConnect {
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		client, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			io.Copy(upstream, client)
+			upstream.Close()
+		}()
+		io.Copy(client, upstream)
+		client.Close()
+		return
+	}
+
+	outReq, _ := http.NewRequest(r.Method, r.URL.String(), r.Body)
+	outReq.Header = r.Header.Clone()
+	resp, err := http.DefaultTransport.RoundTrip(outReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (p *stubProxy) requests() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.seen...)
+}
+
+// TestViaProxy tests that HTTP upstreams are reached through a forwarding
+// proxy and HTTPS upstreams through a CONNECT tunnel
+func TestViaProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	stub := &stubProxy{}
+	proxy := httptest.NewServer(stub)
+	defer proxy.Close()
+
+	tests := []struct {
+		name     string
+		upstream string
+		expected string
+	}{
+		{"http", plain.URL, "GET " + plain.URL + "/data"},
+		{"https", secure.URL, "CONNECT " + secure.Listener.Addr().String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub.mu.Lock()
+			stub.seen = nil
+			stub.mu.Unlock()
+
+			fp := CreateTestProxy(t, []string{tt.upstream}, func(f *FailoverProxy) {
+				f.ViaProxy = proxy.URL
+				f.InsecureSkipVerify = true
+			})
+
+			w := httptest.NewRecorder()
+			if err := fp.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/data", nil), nil); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if w.Code != http.StatusOK || w.Body.String() != "upstream" {
+				t.Fatalf("Expected the upstream's response, got %d %q", w.Code, w.Body.String())
+			}
+			if seen := stub.requests(); len(seen) != 1 || seen[0] != tt.expected {
+				t.Errorf("Expected the proxy to see %q, got %v", tt.expected, seen)
+			}
+		})
+	}
+}
+
+// TestViaProxyProvisionErrors tests rejected via_proxy URLs
+func TestViaProxyProvisionErrors(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy.local", "proxy.local:3128", "://bad"} {
+		fp := &FailoverProxy{Upstreams: []string{"http://localhost:5001"}, ViaProxy: proxyURL}
+		if err := fp.Provision(caddy.Context{}); err == nil {
+			fp.Cleanup()
+			t.Errorf("Expected error for via_proxy %q", proxyURL)
+		}
+	}
+}
+
+// TestParseViaProxy tests parsing the via_proxy option
+func TestParseViaProxy(t *testing.T) {
+	h := httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		via_proxy http://{env.EGRESS_PROXY}:3128
+	}`)}
+	handler, err := parseFailoverProxy(h)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := handler.(*FailoverProxy).ViaProxy; got != "http://{env.EGRESS_PROXY}:3128" {
+		t.Errorf("Unexpected via_proxy: %s", got)
+	}
+
+	h = httpcaddyfile.Helper{Dispenser: caddyfile.NewTestDispenser(`failover_proxy http://a {
+		via_proxy
+	}`)}
+	if _, err := parseFailoverProxy(h); err == nil {
+		t.Error("Expected error for via_proxy without a URL")
+	}
+}
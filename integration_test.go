@@ -8,9 +8,12 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/caddytest"
 )
 
@@ -154,3 +157,36 @@ func TestFailoverStatusEndpointIntegration(t *testing.T) {
 		t.Errorf("Expected Content-Type 'application/json', got '%s'", contentType)
 	}
 }
+
+// TestGlobalDefaultsAdapted tests that the failover_proxy global option is
+// written into the adapted JSON of directives that don't set the field
+func TestGlobalDefaultsAdapted(t *testing.T) {
+	adapter := caddyfile.Adapter{ServerType: httpcaddyfile.ServerType{}}
+	config, _, err := adapter.Adapt([]byte(`
+		{
+			order failover_proxy before reverse_proxy
+			failover_proxy {
+				dial_timeout 10s
+			}
+		}
+		a.example.com {
+			failover_proxy http://localhost:5001
+		}
+		b.example.com {
+			failover_proxy http://localhost:5002 {
+				dial_timeout 1s
+			}
+		}
+	`), nil)
+	if err != nil {
+		t.Fatalf("Failed to adapt Caddyfile: %v", err)
+	}
+
+	adapted := string(config)
+	if !strings.Contains(adapted, `"dial_timeout":10000000000,"handler":"failover_proxy","upstreams":["http://localhost:5001"]`) {
+		t.Errorf("Expected the global dial_timeout in the first proxy, got %s", adapted)
+	}
+	if !strings.Contains(adapted, `"dial_timeout":1000000000,"handler":"failover_proxy","upstreams":["http://localhost:5002"]`) {
+		t.Errorf("Expected the second proxy to keep its own dial_timeout, got %s", adapted)
+	}
+}
@@ -10,8 +10,13 @@ import (
 func init() {
 	caddy.RegisterModule(&failover.FailoverProxy{})
 	caddy.RegisterModule(&failover.FailoverStatusHandler{})
+	caddy.RegisterModule(&failover.FailoverMetricsHandler{})
+	caddy.RegisterModule(&failover.FailoverStatusStreamHandler{})
 	httpcaddyfile.RegisterHandlerDirective("failover_proxy", failover.ParseFailoverProxy)
 	httpcaddyfile.RegisterHandlerDirective("failover_status", failover.ParseFailoverStatus)
+	httpcaddyfile.RegisterHandlerDirective("failover_metrics", failover.ParseFailoverMetrics)
+	httpcaddyfile.RegisterHandlerDirective("failover_status_stream", failover.ParseFailoverStatusStream)
+	httpcaddyfile.RegisterGlobalOption("failover_proxy", failover.ParseGlobalFailoverProxy)
 
 	// Register failover API specification
 	api_registrar.RegisterApiSpec("failover_api", failover.GetFailoverApiSpec)
@@ -20,3 +25,5 @@ func init() {
 // Export types for external packages
 type FailoverProxy = failover.FailoverProxy
 type FailoverStatusHandler = failover.FailoverStatusHandler
+type FailoverMetricsHandler = failover.FailoverMetricsHandler
+type FailoverStatusStreamHandler = failover.FailoverStatusStreamHandler